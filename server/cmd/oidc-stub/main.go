@@ -0,0 +1,37 @@
+// oidc-stub 在本地启动一个模拟的OIDC身份提供方，用于联调社交登录。
+//
+//	go run ./cmd/oidc-stub -addr :9999 -client-id magicstream -email alice@example.com
+//
+// 然后为API服务配置 OIDC_PROVIDERS=stub、OIDC_STUB_ISSUER=http://localhost:9999、OIDC_STUB_CLIENT_ID=magicstream
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/joey17520/magic-stream-app/oidc"
+)
+
+func main() {
+	addr := flag.String("addr", ":9999", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9999", "issuer url, must match how clients reach this server")
+	clientID := flag.String("client-id", "magicstream", "accepted client id")
+	email := flag.String("email", "alice@example.com", "email of the default user")
+	verified := flag.Bool("email-verified", true, "whether the default user's email is verified")
+	flag.Parse()
+
+	server, err := oidc.NewStubServer(*issuer, *clientID, oidc.StubUser{
+		Subject:       "stub-" + *email,
+		Email:         *email,
+		EmailVerified: *verified,
+		GivenName:     "Stub",
+		FamilyName:    "User",
+	})
+	if err != nil {
+		log.Fatalf("failed to create stub server: %v", err)
+	}
+
+	log.Printf("OIDC stub provider listening on %s (issuer %s)", *addr, *issuer)
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
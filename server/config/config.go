@@ -4,6 +4,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
@@ -25,6 +26,57 @@ type Config struct {
 	SecretKey        string `env:"SECRET_KEY,required"`
 	SecretRefreshKey string `env:"SECRET_REFRESH_KEY,required"`
 
+	// JWT签名配置，JWTSigningAlgorithm 取值 RS256、EdDSA 或 HS256（HS256使用上面的对称密钥，不做轮换）
+	JWTSigningAlgorithm    string        `env:"JWT_SIGNING_ALGORITHM" envDefault:"RS256"`
+	JWTKeyRotationInterval time.Duration `env:"JWT_KEY_ROTATION_INTERVAL" envDefault:"720h"`
+	JWTKeyGracePeriod      time.Duration `env:"JWT_KEY_GRACE_PERIOD" envDefault:"192h"`
+	// JWTLegacyTokensUntil 从HS256切换到非对称算法后，没有kid的旧令牌的最后有效时间（RFC 3339），
+	// 一般设为切换时间加上refresh token有效期；未设置时不再接受旧令牌
+	JWTLegacyTokensUntil time.Time `env:"JWT_LEGACY_TOKENS_UNTIL"`
+
+	// 访问令牌来源优先级：header（优先Authorization: Bearer）或 cookie（优先access_token cookie）
+	AuthTokenPrecedence string `env:"AUTH_TOKEN_PRECEDENCE" envDefault:"header"`
+
+	// 登录失败限制配置
+	LoginMaxAccountFailures int           `env:"LOGIN_MAX_ACCOUNT_FAILURES" envDefault:"5"`
+	LoginMaxIPFailures      int           `env:"LOGIN_MAX_IP_FAILURES" envDefault:"20"`
+	LoginFailureWindow      time.Duration `env:"LOGIN_FAILURE_WINDOW" envDefault:"15m"`
+	LoginLockoutDuration    time.Duration `env:"LOGIN_LOCKOUT_DURATION" envDefault:"15m"`
+	LoginBaseDelay          time.Duration `env:"LOGIN_BASE_DELAY" envDefault:"1s"`
+
+	// 两步验证配置
+	RequireAdminTwoFactor bool          `env:"REQUIRE_ADMIN_TWO_FACTOR" envDefault:"false"`
+	TwoFactorIssuer       string        `env:"TWO_FACTOR_ISSUER" envDefault:"MagicStream"`
+	TwoFactorChallengeTTL time.Duration `env:"TWO_FACTOR_CHALLENGE_TTL" envDefault:"5m"`
+
+	// OIDC社交登录配置：OIDC_PROVIDERS为逗号分隔的提供方名称，
+	// 每个提供方通过 OIDC_<NAME>_ISSUER、OIDC_<NAME>_CLIENT_ID、OIDC_<NAME>_CLIENT_SECRET、OIDC_<NAME>_SCOPES 配置
+	APIBaseURL    string               `env:"API_BASE_URL" envDefault:"http://localhost:8088"`
+	OIDCProviders []OIDCProviderConfig `env:"OIDC_PROVIDERS"`
+
+	// 账户安全配置
+	AppBaseURL                  string        `env:"APP_BASE_URL" envDefault:"http://localhost:5173"`
+	PasswordResetTTL            time.Duration `env:"PASSWORD_RESET_TTL" envDefault:"1h"`
+	PasswordResetResendInterval time.Duration `env:"PASSWORD_RESET_RESEND_INTERVAL" envDefault:"1m"`
+
+	// 账户注销配置：申请注销后经过宽限期才真正删除，宽限期内重新登录即取消注销
+	AccountDeletionGracePeriod time.Duration `env:"ACCOUNT_DELETION_GRACE_PERIOD" envDefault:"720h"`
+	AccountPurgeInterval       time.Duration `env:"ACCOUNT_PURGE_INTERVAL" envDefault:"1h"`
+
+	// 邮箱验证配置，UnverifiedAccountPolicy 取值 allow（不限制）、limit（限制部分功能）、block（禁止登录）
+	EmailVerificationTTL            time.Duration `env:"EMAIL_VERIFICATION_TTL" envDefault:"24h"`
+	EmailVerificationResendInterval time.Duration `env:"EMAIL_VERIFICATION_RESEND_INTERVAL" envDefault:"1m"`
+	UnverifiedAccountPolicy         string        `env:"UNVERIFIED_ACCOUNT_POLICY" envDefault:"allow"`
+
+	// 邮件配置
+	MailDriver    string `env:"MAIL_DRIVER" envDefault:"outbox"`
+	MailFrom      string `env:"MAIL_FROM" envDefault:"MagicStream <no-reply@magicstream.local>"`
+	SMTPHost      string `env:"SMTP_HOST"`
+	SMTPPort      int    `env:"SMTP_PORT" envDefault:"587"`
+	SMTPUsername  string `env:"SMTP_USERNAME"`
+	SMTPPassword  string `env:"SMTP_PASSWORD"`
+	MailOutboxDir string `env:"MAIL_OUTBOX_DIR" envDefault:".tmp/outbox"`
+
 	// CORS配置
 	AllowedOrigins []string `env:"ALLOWED_ORIGINS" envDefault:"http://localhost:5173,http://localhost:80" envSeparator:","`
 
@@ -32,8 +84,67 @@ type Config struct {
 	DeepSeekAPIKey     string `env:"DEEPSEEK_API_KEY"`
 	BasePromptTemplate string `env:"BASE_PROMPT_TEMPLATE" envDefault:"You are a sentiment analysis assistant. Classify the following movie review into one of these sentiment categories: {rankings}. Only respond with the category name. Review:"`
 
+	// 电影元数据来源配置，MetadataProvider 取值 tmdb、fixture（读取本地样例数据），为空时不启用
+	MetadataProvider   string `env:"METADATA_PROVIDER"`
+	TMDBAPIKey         string `env:"TMDB_API_KEY"`
+	TMDBBaseURL        string `env:"TMDB_BASE_URL" envDefault:"https://api.themoviedb.org/3"`
+	TMDBImageBaseURL   string `env:"TMDB_IMAGE_BASE_URL" envDefault:"https://image.tmdb.org/t/p/original"`
+	MetadataFixtureDir string `env:"METADATA_FIXTURE_DIR" envDefault:"fixtures/metadata"`
+
+	// 自托管视频存储配置，StorageDriver 取值 local（本地文件系统），为空时不启用
+	StorageDriver    string `env:"STORAGE_DRIVER" envDefault:"local"`
+	StorageLocalDir  string `env:"STORAGE_LOCAL_DIR" envDefault:"data/media"`
+	MaxVideoUploadMB int    `env:"MAX_VIDEO_UPLOAD_MB" envDefault:"4096"`
+
 	// 业务配置
 	RecommendedMovieLimit int `env:"RECOMMENDED_MOVIE_LIMIT" envDefault:"5"`
+
+	// 推荐后处理配置
+	RecommendationExcludeSeen   bool          `env:"RECOMMENDATION_EXCLUDE_SEEN" envDefault:"true"`
+	RecommendationMaxGenreShare float64       `env:"RECOMMENDATION_MAX_GENRE_SHARE" envDefault:"0.6"`
+	RecommendationMMRLambda     float64       `env:"RECOMMENDATION_MMR_LAMBDA" envDefault:"0.7"`
+	RecommendationCandidatePool int           `env:"RECOMMENDATION_CANDIDATE_POOL" envDefault:"50"`
+	RecommendationCacheTTL      time.Duration `env:"RECOMMENDATION_CACHE_TTL" envDefault:"10m"`
+
+	// 推荐策略A/B实验配置，实验名为空时不启用实验
+	RecommendationExperiment         string `env:"RECOMMENDATION_EXPERIMENT"`
+	RecommendationExperimentVariants string `env:"RECOMMENDATION_EXPERIMENT_VARIANTS" envDefault:"control=ranking:50,treatment=diverse:50"`
+
+	// 热门榜单配置
+	TrendingRefreshInterval time.Duration `env:"TRENDING_REFRESH_INTERVAL" envDefault:"10m"`
+	TrendingLimit           int           `env:"TRENDING_LIMIT" envDefault:"20"`
+
+	// 地区授权配置：RegionHeader 为CDN或反向代理写入的地区请求头（如CF-IPCountry），为空时不信任任何请求头；
+	// 请求头和用户资料都没有地区时使用DefaultRegion
+	RegionHeader  string `env:"REGION_HEADER"`
+	DefaultRegion string `env:"DEFAULT_REGION"`
+}
+
+// OIDCProviderConfig 一个OIDC身份提供方的配置
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+// 未验证邮箱账户的处理策略
+const (
+	UnverifiedPolicyAllow = "allow"
+	UnverifiedPolicyLimit = "limit"
+	UnverifiedPolicyBlock = "block"
+)
+
+// appConfig 保存最近一次加载的配置，供无法直接注入配置的包使用
+var appConfig *Config
+
+// GetConfig 获取已加载的配置，未加载时使用全局日志记录器加载一次
+func GetConfig() *Config {
+	if appConfig == nil {
+		return LoadConfig(zap.L())
+	}
+	return appConfig
 }
 
 // LoadConfig 加载配置
@@ -57,12 +168,91 @@ func LoadConfig(logger *zap.Logger) *Config {
 		SecretKey:        getEnv("SECRET_KEY", ""),
 		SecretRefreshKey: getEnv("SECRET_REFRESH_KEY", ""),
 
+		// JWT签名配置
+		JWTSigningAlgorithm:    getEnv("JWT_SIGNING_ALGORITHM", "RS256"),
+		JWTKeyRotationInterval: getEnvAsDuration("JWT_KEY_ROTATION_INTERVAL", 720*time.Hour),
+		JWTKeyGracePeriod:      getEnvAsDuration("JWT_KEY_GRACE_PERIOD", 192*time.Hour),
+		JWTLegacyTokensUntil:   getEnvAsTime("JWT_LEGACY_TOKENS_UNTIL", time.Time{}),
+
+		// 访问令牌来源优先级
+		AuthTokenPrecedence: strings.ToLower(getEnv("AUTH_TOKEN_PRECEDENCE", "header")),
+
+		// 登录失败限制配置
+		LoginMaxAccountFailures: getEnvAsInt("LOGIN_MAX_ACCOUNT_FAILURES", 5),
+		LoginMaxIPFailures:      getEnvAsInt("LOGIN_MAX_IP_FAILURES", 20),
+		LoginFailureWindow:      getEnvAsDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		LoginLockoutDuration:    getEnvAsDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		LoginBaseDelay:          getEnvAsDuration("LOGIN_BASE_DELAY", time.Second),
+
+		// 两步验证配置
+		RequireAdminTwoFactor: getEnvAsBool("REQUIRE_ADMIN_TWO_FACTOR", false),
+		TwoFactorIssuer:       getEnv("TWO_FACTOR_ISSUER", "MagicStream"),
+		TwoFactorChallengeTTL: getEnvAsDuration("TWO_FACTOR_CHALLENGE_TTL", 5*time.Minute),
+
+		// OIDC社交登录配置
+		APIBaseURL:    strings.TrimRight(getEnv("API_BASE_URL", "http://localhost:8088"), "/"),
+		OIDCProviders: loadOIDCProviders(),
+
+		// 账户安全配置
+		AppBaseURL:                  strings.TrimRight(getEnv("APP_BASE_URL", "http://localhost:5173"), "/"),
+		PasswordResetTTL:            getEnvAsDuration("PASSWORD_RESET_TTL", time.Hour),
+		PasswordResetResendInterval: getEnvAsDuration("PASSWORD_RESET_RESEND_INTERVAL", time.Minute),
+
+		// 账户注销配置
+		AccountDeletionGracePeriod: getEnvAsDuration("ACCOUNT_DELETION_GRACE_PERIOD", 720*time.Hour),
+		AccountPurgeInterval:       getEnvAsDuration("ACCOUNT_PURGE_INTERVAL", time.Hour),
+
+		// 邮箱验证配置
+		EmailVerificationTTL:            getEnvAsDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour),
+		EmailVerificationResendInterval: getEnvAsDuration("EMAIL_VERIFICATION_RESEND_INTERVAL", time.Minute),
+		UnverifiedAccountPolicy:         strings.ToLower(getEnv("UNVERIFIED_ACCOUNT_POLICY", "allow")),
+
+		// 邮件配置
+		MailDriver:    getEnv("MAIL_DRIVER", "outbox"),
+		MailFrom:      getEnv("MAIL_FROM", "MagicStream <no-reply@magicstream.local>"),
+		SMTPHost:      getEnv("SMTP_HOST", ""),
+		SMTPPort:      getEnvAsInt("SMTP_PORT", 587),
+		SMTPUsername:  getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:  getEnv("SMTP_PASSWORD", ""),
+		MailOutboxDir: getEnv("MAIL_OUTBOX_DIR", ".tmp/outbox"),
+
 		// AI服务配置
 		DeepSeekAPIKey:     getEnv("DEEPSEEK_API_KEY", ""),
 		BasePromptTemplate: getEnv("BASE_PROMPT_TEMPLATE", "You are a sentiment analysis assistant. Classify the following movie review into one of these sentiment categories: {rankings}. Only respond with the category name. Review:"),
 
+		// 电影元数据来源配置
+		MetadataProvider:   strings.ToLower(getEnv("METADATA_PROVIDER", "")),
+		TMDBAPIKey:         getEnv("TMDB_API_KEY", ""),
+		TMDBBaseURL:        getEnv("TMDB_BASE_URL", "https://api.themoviedb.org/3"),
+		TMDBImageBaseURL:   getEnv("TMDB_IMAGE_BASE_URL", "https://image.tmdb.org/t/p/original"),
+		MetadataFixtureDir: getEnv("METADATA_FIXTURE_DIR", "fixtures/metadata"),
+
+		// 自托管视频存储配置
+		StorageDriver:    strings.ToLower(getEnv("STORAGE_DRIVER", "local")),
+		StorageLocalDir:  getEnv("STORAGE_LOCAL_DIR", "data/media"),
+		MaxVideoUploadMB: getEnvAsInt("MAX_VIDEO_UPLOAD_MB", 4096),
+
 		// 业务配置
 		RecommendedMovieLimit: getEnvAsInt("RECOMMENDED_MOVIE_LIMIT", 5),
+
+		// 推荐后处理配置
+		RecommendationExcludeSeen:   getEnvAsBool("RECOMMENDATION_EXCLUDE_SEEN", true),
+		RecommendationMaxGenreShare: getEnvAsFloat("RECOMMENDATION_MAX_GENRE_SHARE", 0.6),
+		RecommendationMMRLambda:     getEnvAsFloat("RECOMMENDATION_MMR_LAMBDA", 0.7),
+		RecommendationCandidatePool: getEnvAsInt("RECOMMENDATION_CANDIDATE_POOL", 50),
+		RecommendationCacheTTL:      getEnvAsDuration("RECOMMENDATION_CACHE_TTL", 10*time.Minute),
+
+		// 推荐策略A/B实验配置
+		RecommendationExperiment:         getEnv("RECOMMENDATION_EXPERIMENT", ""),
+		RecommendationExperimentVariants: getEnv("RECOMMENDATION_EXPERIMENT_VARIANTS", "control=ranking:50,treatment=diverse:50"),
+
+		// 热门榜单配置
+		TrendingRefreshInterval: getEnvAsDuration("TRENDING_REFRESH_INTERVAL", 10*time.Minute),
+		TrendingLimit:           getEnvAsInt("TRENDING_LIMIT", 20),
+
+		// 地区授权配置
+		RegionHeader:  strings.TrimSpace(getEnv("REGION_HEADER", "")),
+		DefaultRegion: strings.ToUpper(strings.TrimSpace(getEnv("DEFAULT_REGION", ""))),
 	}
 
 	// 处理CORS配置
@@ -75,9 +265,31 @@ func LoadConfig(logger *zap.Logger) *Config {
 	// 验证必需配置
 	config.validate(logger)
 
+	appConfig = config
 	return config
 }
 
+// loadOIDCProviders 按OIDC_PROVIDERS中的名称读取每个身份提供方的配置
+func loadOIDCProviders() []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, name := range strings.Split(getEnv("OIDC_PROVIDERS", ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		providers = append(providers, OIDCProviderConfig{
+			Name:         name,
+			Issuer:       getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			Scopes:       strings.Fields(getEnv(prefix+"SCOPES", "openid email profile")),
+		})
+	}
+	return providers
+}
+
 // getEnv 获取环境变量，提供默认值
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -100,6 +312,62 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return value
 }
 
+// getEnvAsBool 获取环境变量作为布尔值
+func getEnvAsBool(key string, defaultValue bool) bool {
+	strValue := getEnv(key, "")
+	if strValue == "" {
+		return defaultValue
+	}
+
+	value, err := strconv.ParseBool(strValue)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvAsFloat 获取环境变量作为浮点数
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	strValue := getEnv(key, "")
+	if strValue == "" {
+		return defaultValue
+	}
+
+	value, err := strconv.ParseFloat(strValue, 64)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvAsTime 获取环境变量作为RFC 3339格式的时间（如 2025-01-31T00:00:00Z）
+func getEnvAsTime(key string, defaultValue time.Time) time.Time {
+	strValue := getEnv(key, "")
+	if strValue == "" {
+		return defaultValue
+	}
+
+	value, err := time.Parse(time.RFC3339, strValue)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvAsDuration 获取环境变量作为时间间隔（如 10m、1h）
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	strValue := getEnv(key, "")
+	if strValue == "" {
+		return defaultValue
+	}
+
+	value, err := time.ParseDuration(strValue)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
 // validate 验证配置
 func (c *Config) validate(logger *zap.Logger) {
 	// 必需配置验证
@@ -124,6 +392,160 @@ func (c *Config) validate(logger *zap.Logger) {
 		c.RecommendedMovieLimit = 5
 	}
 
+	if c.RecommendationMaxGenreShare <= 0 || c.RecommendationMaxGenreShare > 1 {
+		logger.Warn("Recommendation max genre share must be in (0, 1], using default",
+			zap.Float64("provided", c.RecommendationMaxGenreShare),
+			zap.Float64("default", 0.6),
+		)
+		c.RecommendationMaxGenreShare = 0.6
+	}
+
+	if c.RecommendationMMRLambda < 0 || c.RecommendationMMRLambda > 1 {
+		logger.Warn("Recommendation MMR lambda must be in [0, 1], using default",
+			zap.Float64("provided", c.RecommendationMMRLambda),
+			zap.Float64("default", 0.7),
+		)
+		c.RecommendationMMRLambda = 0.7
+	}
+
+	if c.RecommendationCandidatePool < c.RecommendedMovieLimit {
+		c.RecommendationCandidatePool = c.RecommendedMovieLimit
+	}
+
+	if c.TrendingRefreshInterval < time.Minute {
+		logger.Warn("Trending refresh interval is too short, using default",
+			zap.Duration("provided", c.TrendingRefreshInterval),
+			zap.Duration("default", 10*time.Minute),
+		)
+		c.TrendingRefreshInterval = 10 * time.Minute
+	}
+
+	if c.MaxVideoUploadMB <= 0 {
+		logger.Warn("Max video upload size must be positive, using default",
+			zap.Int("provided", c.MaxVideoUploadMB),
+			zap.Int("default", 4096),
+		)
+		c.MaxVideoUploadMB = 4096
+	}
+
+	if c.TrendingLimit <= 0 || c.TrendingLimit > 100 {
+		c.TrendingLimit = 20
+	}
+
+	switch strings.ToUpper(c.JWTSigningAlgorithm) {
+	case "RS256":
+		c.JWTSigningAlgorithm = "RS256"
+	case "EDDSA":
+		c.JWTSigningAlgorithm = "EdDSA"
+	case "HS256":
+		c.JWTSigningAlgorithm = "HS256"
+	default:
+		logger.Warn("Unknown jwt signing algorithm, using default",
+			zap.String("provided", c.JWTSigningAlgorithm),
+			zap.String("default", "RS256"),
+		)
+		c.JWTSigningAlgorithm = "RS256"
+	}
+
+	if c.JWTKeyRotationInterval < time.Hour {
+		logger.Warn("JWT key rotation interval is too short, using default",
+			zap.Duration("provided", c.JWTKeyRotationInterval),
+			zap.Duration("default", 720*time.Hour),
+		)
+		c.JWTKeyRotationInterval = 720 * time.Hour
+	}
+
+	// 旧密钥的验证宽限期不能短于refresh token的有效期，否则轮换后已登录的用户会被迫重新登录
+	if c.JWTKeyGracePeriod < 7*24*time.Hour {
+		logger.Warn("JWT key grace period is shorter than the session lifetime, using minimum",
+			zap.Duration("provided", c.JWTKeyGracePeriod),
+			zap.Duration("minimum", 7*24*time.Hour),
+		)
+		c.JWTKeyGracePeriod = 7 * 24 * time.Hour
+	}
+
+	if c.AuthTokenPrecedence != "header" && c.AuthTokenPrecedence != "cookie" {
+		logger.Warn("Unknown auth token precedence, using default",
+			zap.String("provided", c.AuthTokenPrecedence),
+			zap.String("default", "header"),
+		)
+		c.AuthTokenPrecedence = "header"
+	}
+
+	if c.LoginMaxAccountFailures <= 0 {
+		c.LoginMaxAccountFailures = 5
+	}
+
+	if c.LoginMaxIPFailures < c.LoginMaxAccountFailures {
+		logger.Warn("Login IP failure limit is lower than the account limit, using account limit",
+			zap.Int("provided", c.LoginMaxIPFailures),
+			zap.Int("account_limit", c.LoginMaxAccountFailures),
+		)
+		c.LoginMaxIPFailures = c.LoginMaxAccountFailures
+	}
+
+	if c.LoginFailureWindow <= 0 {
+		c.LoginFailureWindow = 15 * time.Minute
+	}
+
+	if c.LoginLockoutDuration <= 0 {
+		c.LoginLockoutDuration = 15 * time.Minute
+	}
+
+	if c.TwoFactorChallengeTTL < time.Minute || c.TwoFactorChallengeTTL > 30*time.Minute {
+		logger.Warn("Two-factor challenge TTL must be between 1m and 30m, using default",
+			zap.Duration("provided", c.TwoFactorChallengeTTL),
+			zap.Duration("default", 5*time.Minute),
+		)
+		c.TwoFactorChallengeTTL = 5 * time.Minute
+	}
+
+	if c.AccountDeletionGracePeriod < 0 {
+		logger.Warn("Account deletion grace period must not be negative, using default",
+			zap.Duration("provided", c.AccountDeletionGracePeriod),
+			zap.Duration("default", 720*time.Hour),
+		)
+		c.AccountDeletionGracePeriod = 720 * time.Hour
+	}
+
+	if c.AccountPurgeInterval < time.Minute {
+		logger.Warn("Account purge interval is too short, using default",
+			zap.Duration("provided", c.AccountPurgeInterval),
+			zap.Duration("default", time.Hour),
+		)
+		c.AccountPurgeInterval = time.Hour
+	}
+
+	if c.DefaultRegion != "" && !isRegionCode(c.DefaultRegion) {
+		logger.Warn("Default region must be a two-letter ISO 3166-1 code, ignoring it",
+			zap.String("provided", c.DefaultRegion),
+		)
+		c.DefaultRegion = ""
+	}
+
+	// 缺少必要配置的身份提供方不启用
+	providers := c.OIDCProviders[:0]
+	for _, provider := range c.OIDCProviders {
+		if provider.Issuer == "" || provider.ClientID == "" {
+			logger.Warn("OIDC provider is missing issuer or client id, disabling it",
+				zap.String("provider", provider.Name),
+			)
+			continue
+		}
+		providers = append(providers, provider)
+	}
+	c.OIDCProviders = providers
+
+	switch c.UnverifiedAccountPolicy {
+	case UnverifiedPolicyAllow, UnverifiedPolicyLimit, UnverifiedPolicyBlock:
+	default:
+		logger.Warn("Unknown unverified account policy, using default",
+			zap.String("provided", c.UnverifiedAccountPolicy),
+			zap.String("default", UnverifiedPolicyAllow),
+		)
+		c.UnverifiedAccountPolicy = UnverifiedPolicyAllow
+	}
+
 	// 记录配置摘要（敏感信息不记录）
 	logger.Info("Configuration loaded",
 		zap.String("server_port", c.ServerPort),
@@ -132,6 +554,34 @@ func (c *Config) validate(logger *zap.Logger) {
 		zap.String("database", c.DatabaseName),
 		zap.Strings("allowed_origins", c.AllowedOrigins),
 		zap.Int("recommended_movie_limit", c.RecommendedMovieLimit),
+		zap.Bool("recommendation_exclude_seen", c.RecommendationExcludeSeen),
+		zap.Float64("recommendation_max_genre_share", c.RecommendationMaxGenreShare),
+		zap.Float64("recommendation_mmr_lambda", c.RecommendationMMRLambda),
+		zap.Duration("recommendation_cache_ttl", c.RecommendationCacheTTL),
+		zap.String("recommendation_experiment", c.RecommendationExperiment),
+		zap.Duration("trending_refresh_interval", c.TrendingRefreshInterval),
 		zap.Bool("deepseek_configured", c.DeepSeekAPIKey != ""),
+		zap.String("metadata_provider", c.MetadataProvider),
+		zap.String("storage_driver", c.StorageDriver),
+		zap.Int("max_video_upload_mb", c.MaxVideoUploadMB),
+		zap.String("jwt_signing_algorithm", c.JWTSigningAlgorithm),
+		zap.Duration("jwt_key_rotation_interval", c.JWTKeyRotationInterval),
+		zap.Time("jwt_legacy_tokens_until", c.JWTLegacyTokensUntil),
+		zap.String("auth_token_precedence", c.AuthTokenPrecedence),
+		zap.Int("login_max_account_failures", c.LoginMaxAccountFailures),
+		zap.Int("login_max_ip_failures", c.LoginMaxIPFailures),
+		zap.Duration("login_lockout_duration", c.LoginLockoutDuration),
+		zap.Bool("require_admin_two_factor", c.RequireAdminTwoFactor),
+		zap.Int("oidc_providers", len(c.OIDCProviders)),
+		zap.String("mail_driver", c.MailDriver),
+		zap.String("unverified_account_policy", c.UnverifiedAccountPolicy),
+		zap.Duration("account_deletion_grace_period", c.AccountDeletionGracePeriod),
+		zap.String("region_header", c.RegionHeader),
+		zap.String("default_region", c.DefaultRegion),
 	)
 }
+
+// isRegionCode 判断是否为两位大写字母的地区代码
+func isRegionCode(region string) bool {
+	return len(region) == 2 && region[0] >= 'A' && region[0] <= 'Z' && region[1] >= 'A' && region[1] <= 'Z'
+}
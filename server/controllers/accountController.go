@@ -0,0 +1,343 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/config"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/mailer"
+	"github.com/joey17520/magic-stream-app/models"
+	"github.com/joey17520/magic-stream-app/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// accountPurgeBatchSize 每轮最多清理的到期账户数量
+const accountPurgeBatchSize = 100
+
+// ExportAccount 导出当前用户的个人数据（资料和家庭成员档案、喜爱的类型、评分、评论、各档案的观看记录和片单、会话和API密钥），以JSON附件下载
+func ExportAccount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := getUserCollection().FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "user_not_found")})
+			return
+		}
+
+		export := models.AccountExport{
+			ExportedAt:     time.Now(),
+			Profile:        user,
+			FavoriteGenres: user.FavoriteGenres,
+			Ratings:        []models.ExportedRating{},
+			Reviews:        []models.ExportedReview{},
+			History:        []models.MovieEvent{},
+			Watchlist:      []models.WatchlistItem{},
+		}
+
+		sortByCreated := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+		cursor, err := getUserRatingCollection().Find(ctx, bson.M{"user_id": userId}, sortByCreated)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_ratings")})
+			return
+		}
+		var ratings []models.Rating
+		if err := cursor.All(ctx, &ratings); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_decoding_ratings")})
+			return
+		}
+		for _, rating := range ratings {
+			export.Ratings = append(export.Ratings, models.ExportedRating{
+				ImdbID:    rating.ImdbID,
+				Rating:    rating.Rating,
+				CreatedAt: rating.CreatedAt,
+				UpdatedAt: rating.UpdatedAt,
+			})
+			if rating.Review != "" {
+				export.Reviews = append(export.Reviews, models.ExportedReview{
+					ImdbID:    rating.ImdbID,
+					Review:    rating.Review,
+					CreatedAt: rating.CreatedAt,
+					UpdatedAt: rating.UpdatedAt,
+				})
+			}
+		}
+
+		cursor, err = getEventCollection().Find(ctx, bson.M{"user_id": userId}, sortByCreated)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_history")})
+			return
+		}
+		if err := cursor.All(ctx, &export.History); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_decoding_history")})
+			return
+		}
+
+		cursor, err = getWatchlistCollection().Find(ctx, bson.M{"user_id": userId}, options.Find().SetSort(bson.D{{Key: "added_at", Value: 1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_watchlist")})
+			return
+		}
+		if err := cursor.All(ctx, &export.Watchlist); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_decoding_watchlist")})
+			return
+		}
+
+		if export.Sessions, err = utils.ListSessions(userId); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_sessions")})
+			return
+		}
+		if export.APIKeys, err = utils.ListAPIKeys(userId); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_api_keys")})
+			return
+		}
+
+		filename := "magicstream-export-" + export.ExportedAt.Format("20060102") + ".json"
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		c.Header("Cache-Control", "no-store")
+		c.IndentedJSON(http.StatusOK, export)
+	}
+}
+
+// DeleteAccount 申请注销当前账户：立即退出所有设备并撤销API密钥，宽限期结束后由后台任务删除账户；
+// 宽限期内重新登录即取消注销。设置了本地密码的账户需要提供当前密码
+func DeleteAccount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+
+		var req models.AccountDelete
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := getUserCollection().FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "user_not_found")})
+			return
+		}
+
+		// 通过外部身份提供方创建的账户没有本地密码，已登录的会话本身就是凭据
+		if user.Password != "" {
+			if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.Msg(c, "password_incorrect")})
+				return
+			}
+		}
+
+		now := time.Now()
+		scheduledAt := now.Add(config.GetConfig().AccountDeletionGracePeriod)
+		_, err = getUserCollection().UpdateOne(ctx,
+			bson.M{"user_id": userId},
+			bson.M{"$set": bson.M{
+				"deletion_requested_at": now,
+				"deletion_scheduled_at": scheduledAt,
+				"updated_at":            now,
+			}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_scheduling_account_deletion")})
+			return
+		}
+
+		if err := utils.RevokeAllSessions(userId, ""); err != nil {
+			utils.Warn("Failed to revoke sessions of deleted account", utils.ErrorFields(err)...)
+		}
+		if err := utils.RevokeAllAPIKeys(userId); err != nil {
+			utils.Warn("Failed to revoke API keys of deleted account", utils.ErrorFields(err)...)
+		}
+
+		utils.RecordAudit(models.AuditLog{
+			Action:    models.AuditActionAccountDeletionRequested,
+			UserID:    userId,
+			Email:     user.Email,
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			Details:   map[string]any{"scheduled_at": scheduledAt},
+		})
+
+		err = getMailer().Send(ctx, mailer.Message{
+			To:      user.Email,
+			Subject: "Your MagicStream account is scheduled for deletion",
+			Body:    "Hi " + user.FirstName + ",\n\nYour MagicStream account and personal data will be deleted on " + scheduledAt.Format("2006-01-02") + ".\nIf you change your mind, simply log in again before then and the deletion will be cancelled.",
+		})
+		if err != nil {
+			utils.Warn("Failed to send account deletion notification", utils.ErrorFields(err)...)
+		}
+
+		clearAuthCookies(c)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":               i18n.Msg(c, "account_deletion_scheduled"),
+			"deletion_scheduled_at": scheduledAt,
+		})
+	}
+}
+
+// cancelAccountDeletion 用户在宽限期内重新登录时取消注销
+func cancelAccountDeletion(c *gin.Context, user *models.User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := getUserCollection().UpdateOne(ctx,
+		bson.M{"user_id": user.UserID},
+		bson.M{
+			"$unset": bson.M{"deletion_requested_at": "", "deletion_scheduled_at": ""},
+			"$set":   bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	user.DeletionRequestedAt = nil
+	user.DeletionScheduledAt = nil
+
+	utils.RecordAudit(models.AuditLog{
+		Action:    models.AuditActionAccountDeletionCancelled,
+		UserID:    user.UserID,
+		Email:     user.Email,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+
+	return nil
+}
+
+// StartAccountPurger 立即清理一次到期的注销账户，之后按固定间隔清理，直到ctx被取消
+func StartAccountPurger(ctx context.Context, interval time.Duration) {
+	purgeExpiredAccounts(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purgeExpiredAccounts(ctx)
+		}
+	}
+}
+
+// purgeExpiredAccounts 删除宽限期已过的注销账户，单个账户失败不影响其他账户，下一轮会重试
+func purgeExpiredAccounts(ctx context.Context) {
+	findCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().
+		SetProjection(bson.M{"user_id": 1, "email": 1, "profiles.profile_id": 1}).
+		SetLimit(accountPurgeBatchSize)
+
+	cursor, err := getUserCollection().Find(findCtx, bson.M{"deletion_scheduled_at": bson.M{"$lte": time.Now()}}, opts)
+	if err != nil {
+		utils.Error("Failed to find accounts scheduled for deletion", utils.ErrorFields(err)...)
+		return
+	}
+
+	var users []models.User
+	if err := cursor.All(findCtx, &users); err != nil {
+		utils.Error("Failed to decode accounts scheduled for deletion", utils.ErrorFields(err)...)
+		return
+	}
+
+	for _, user := range users {
+		if err := purgeAccount(ctx, user); err != nil {
+			utils.Error("Failed to purge account", append(utils.ErrorFields(err), zap.String("user_id", user.UserID))...)
+			continue
+		}
+		utils.Info("Account purged", zap.String("user_id", user.UserID))
+	}
+}
+
+// purgeAccount 删除账户及其个人数据。评分和评论保留用于统计，但作者被替换为匿名ID；
+// 先禁用账户使宽限期到期后无法再通过登录取消注销，最后才删除用户文档，中途失败时下一轮可以重试
+func purgeAccount(ctx context.Context, user models.User) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	result, err := getUserCollection().UpdateOne(ctx,
+		bson.M{"user_id": user.UserID, "deletion_scheduled_at": bson.M{"$lte": time.Now()}},
+		bson.M{"$set": bson.M{"disabled": true, "disabled_reason": "account deleted"}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		// 已被取消注销
+		return nil
+	}
+
+	_, err = getUserRatingCollection().UpdateMany(ctx,
+		bson.M{"user_id": user.UserID},
+		bson.M{"$set": bson.M{"user_id": "deleted-" + bson.NewObjectID().Hex(), "anonymized": true}},
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err := getEventCollection().DeleteMany(ctx, bson.M{"user_id": user.UserID}); err != nil {
+		return err
+	}
+	if _, err := getWatchlistCollection().DeleteMany(ctx, bson.M{"user_id": user.UserID}); err != nil {
+		return err
+	}
+	if err := getExperimentTracker().DeleteUserEvents(ctx, user.UserID); err != nil {
+		return err
+	}
+	if _, err := getUserTokenCollection().DeleteMany(ctx, bson.M{"user_id": user.UserID}); err != nil {
+		return err
+	}
+	if err := utils.DeleteUserSessions(user.UserID); err != nil {
+		return err
+	}
+	if err := utils.DeleteUserAPIKeys(user.UserID); err != nil {
+		return err
+	}
+	if err := utils.ResetLoginFailures(user.Email); err != nil {
+		return err
+	}
+	if err := utils.AnonymizeAuditLogs(user.UserID, user.Email); err != nil {
+		return err
+	}
+
+	if _, err := getUserCollection().DeleteOne(ctx, bson.M{"user_id": user.UserID}); err != nil {
+		return err
+	}
+
+	getRecommendationCache().Invalidate(recommendationCacheKey(user.UserID, ""))
+	for _, profile := range user.Profiles {
+		getRecommendationCache().Invalidate(recommendationCacheKey(user.UserID, profile.ProfileID))
+	}
+
+	utils.RecordAudit(models.AuditLog{
+		Action: models.AuditActionAccountDeleted,
+		UserID: user.UserID,
+	})
+
+	return nil
+}
@@ -0,0 +1,346 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/models"
+	"github.com/joey17520/magic-stream-app/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+)
+
+// 用户列表分页参数
+const (
+	defaultUserPageSize = 20
+	maxUserPageSize     = 100
+)
+
+// errLastAdmin 操作会导致系统中没有可用的管理员
+var errLastAdmin = errors.New("cannot remove the last active admin")
+
+// AdminListUsers 分页查询用户，支持按姓名或邮箱搜索（q）、按角色（role）和禁用状态（disabled）过滤
+func AdminListUsers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+		if err != nil || page < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_page")})
+			return
+		}
+		pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(defaultUserPageSize)))
+		if err != nil || pageSize < 1 || pageSize > maxUserPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_page_size", maxUserPageSize)})
+			return
+		}
+
+		filter := bson.M{}
+		if q := c.Query("q"); q != "" {
+			pattern := bson.Regex{Pattern: regexp.QuoteMeta(q), Options: "i"}
+			filter["$or"] = bson.A{
+				bson.M{"email": pattern},
+				bson.M{"first_name": pattern},
+				bson.M{"last_name": pattern},
+				bson.M{"user_id": q},
+			}
+		}
+		if role := c.Query("role"); role != "" {
+			if role != models.RoleAdmin && role != models.RoleUser {
+				c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_role")})
+				return
+			}
+			filter["role"] = role
+		}
+		if disabled := c.Query("disabled"); disabled != "" {
+			value, err := strconv.ParseBool(disabled)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_disabled_filter")})
+				return
+			}
+			if value {
+				filter["disabled"] = true
+			} else {
+				filter["disabled"] = bson.M{"$ne": true}
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		total, err := getUserCollection().CountDocuments(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_users")})
+			return
+		}
+
+		opts := options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+			SetSkip(int64((page - 1) * pageSize)).
+			SetLimit(int64(pageSize))
+
+		cursor, err := getUserCollection().Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_users")})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		users := []models.User{}
+		if err := cursor.All(ctx, &users); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_decoding_users")})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.UserPage{
+			Users:    users,
+			Page:     page,
+			PageSize: pageSize,
+			Total:    total,
+		})
+	}
+}
+
+// AdminGetUser 查看单个用户
+func AdminGetUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := getUserCollection().FindOne(ctx, bson.M{"user_id": c.Param("user_id")}).Decode(&user); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "user_not_found")})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_user")})
+			return
+		}
+
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+// AdminUpdateUserRole 提升或降低用户角色，管理员不能修改自己的角色，也不能降级最后一个管理员
+func AdminUpdateUserRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+
+		userId := c.Param("user_id")
+		if userId == actorId {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "cannot_change_own_role")})
+			return
+		}
+
+		var req models.UserRoleUpdate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "detail": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if req.Role != models.RoleAdmin {
+			if err := ensureAnotherAdmin(ctx, userId); err != nil {
+				respondAdminUserError(c, err, "error_updating_role")
+				return
+			}
+		}
+
+		user, err := updateUserAsAdmin(ctx, userId, bson.M{"$set": bson.M{"role": req.Role, "updated_at": time.Now()}})
+		if err != nil {
+			respondAdminUserError(c, err, "error_updating_role")
+			return
+		}
+
+		recordAdminAudit(c, models.AuditActionUserRoleChanged, user, map[string]any{"role": req.Role})
+
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+// AdminDisableUser 禁用用户：禁止登录，已有会话全部撤销，API密钥也随之失效
+func AdminDisableUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+
+		userId := c.Param("user_id")
+		if userId == actorId {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "cannot_disable_self")})
+			return
+		}
+
+		var req models.UserDisable
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "detail": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := ensureAnotherAdmin(ctx, userId); err != nil {
+			respondAdminUserError(c, err, "error_disabling_user")
+			return
+		}
+
+		now := time.Now()
+		user, err := updateUserAsAdmin(ctx, userId, bson.M{"$set": bson.M{
+			"disabled":        true,
+			"disabled_at":     now,
+			"disabled_reason": req.Reason,
+			"updated_at":      now,
+		}})
+		if err != nil {
+			respondAdminUserError(c, err, "error_disabling_user")
+			return
+		}
+
+		if err := utils.RevokeAllSessions(userId, ""); err != nil {
+			utils.Warn("Failed to revoke sessions of disabled user", utils.ErrorFields(err)...)
+		}
+
+		recordAdminAudit(c, models.AuditActionUserDisabled, user, map[string]any{"reason": req.Reason})
+
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+// AdminEnableUser 重新启用被禁用的用户，用户需要重新登录
+func AdminEnableUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, err := updateUserAsAdmin(ctx, c.Param("user_id"), bson.M{
+			"$set":   bson.M{"disabled": false, "updated_at": time.Now()},
+			"$unset": bson.M{"disabled_at": "", "disabled_reason": ""},
+		})
+		if err != nil {
+			respondAdminUserError(c, err, "error_enabling_user")
+			return
+		}
+
+		recordAdminAudit(c, models.AuditActionUserEnabled, user, nil)
+
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+// AdminLogoutUser 强制用户退出所有设备
+func AdminLogoutUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := getUserCollection().FindOne(ctx, bson.M{"user_id": c.Param("user_id")}).Decode(&user); err != nil {
+			respondAdminUserError(c, err, "error_fetching_user")
+			return
+		}
+
+		if err := utils.RevokeAllSessions(user.UserID, ""); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_revoking_sessions")})
+			return
+		}
+
+		recordAdminAudit(c, models.AuditActionUserLoggedOut, &user, nil)
+
+		c.JSON(http.StatusOK, gin.H{"message": i18n.Msg(c, "user_logged_out_everywhere")})
+	}
+}
+
+// updateUserAsAdmin 更新用户并返回更新后的文档
+func updateUserAsAdmin(ctx context.Context, userId string, update bson.M) (*models.User, error) {
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var user models.User
+	if err := getUserCollection().FindOneAndUpdate(ctx, bson.M{"user_id": userId}, update, opts).Decode(&user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ensureAnotherAdmin 当目标用户是管理员时，确认除他以外还有其他未禁用的管理员
+func ensureAnotherAdmin(ctx context.Context, userId string) error {
+	var target models.User
+	if err := getUserCollection().FindOne(ctx, bson.M{"user_id": userId}).Decode(&target); err != nil {
+		return err
+	}
+	if target.Role != models.RoleAdmin || target.Disabled {
+		return nil
+	}
+
+	count, err := getUserCollection().CountDocuments(ctx, bson.M{
+		"role":     models.RoleAdmin,
+		"disabled": bson.M{"$ne": true},
+		"user_id":  bson.M{"$ne": userId},
+	})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errLastAdmin
+	}
+	return nil
+}
+
+// respondAdminUserError 把用户管理中的错误转换为响应
+func respondAdminUserError(c *gin.Context, err error, messageKey string) {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "user_not_found")})
+	case errors.Is(err, errLastAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": i18n.Msg(c, "last_admin")})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, messageKey)})
+	}
+}
+
+// recordAdminAudit 记录管理员对用户的操作
+func recordAdminAudit(c *gin.Context, action string, user *models.User, details map[string]any) {
+	actorId, _ := utils.GetUserIdFromContext(c)
+	if details == nil {
+		details = map[string]any{}
+	}
+	details["actor_id"] = actorId
+
+	utils.Info("Admin user action",
+		zap.String("action", action),
+		zap.String("actor_id", actorId),
+		zap.String("user_id", user.UserID),
+	)
+
+	utils.RecordAudit(models.AuditLog{
+		Action:    action,
+		UserID:    user.UserID,
+		Email:     user.Email,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Details:   details,
+	})
+}
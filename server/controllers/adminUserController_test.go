@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminRouter 以admin-1的身份挂载用户管理端点
+func adminRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("userId", "admin-1")
+	})
+	router.GET("/admin/users", AdminListUsers())
+	router.PATCH("/admin/users/:user_id/role", AdminUpdateUserRole())
+	router.POST("/admin/users/:user_id/disable", AdminDisableUser())
+	return router
+}
+
+func serveAdmin(router *gin.Engine, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminListUsersRejectsBadQuery(t *testing.T) {
+	router := adminRouter()
+
+	for _, query := range []string{
+		"page=0",
+		"page=abc",
+		"page_size=0",
+		"page_size=101",
+		"role=SUPERUSER",
+		"disabled=maybe",
+	} {
+		rec := serveAdmin(router, http.MethodGet, "/admin/users?"+query, "")
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("?%s: status = %d, want %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestAdminCannotTargetThemselves(t *testing.T) {
+	router := adminRouter()
+
+	rec := serveAdmin(router, http.MethodPatch, "/admin/users/admin-1/role", `{"role":"USER"}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "own role") {
+		t.Errorf("demote self: status = %d, body %s", rec.Code, rec.Body.String())
+	}
+
+	rec = serveAdmin(router, http.MethodPost, "/admin/users/admin-1/disable", "")
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "own account") {
+		t.Errorf("disable self: status = %d, body %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAdminUserRequestValidation(t *testing.T) {
+	router := adminRouter()
+
+	// 校验失败在访问数据库之前返回
+	if rec := serveAdmin(router, http.MethodPatch, "/admin/users/user-2/role", `{"role":"OWNER"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown role: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := serveAdmin(router, http.MethodPatch, "/admin/users/user-2/role", `{}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("missing role: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	reason := `{"reason":"` + strings.Repeat("x", 501) + `"}`
+	if rec := serveAdmin(router, http.MethodPost, "/admin/users/user-2/disable", reason); rec.Code != http.StatusBadRequest {
+		t.Errorf("long reason: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
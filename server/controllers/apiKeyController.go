@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/models"
+	"github.com/joey17520/magic-stream-app/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.uber.org/zap"
+)
+
+// maxAPIKeysPerUser 每个用户最多同时持有的API密钥数量
+const maxAPIKeysPerUser = 20
+
+// GetAPIKeys 列出当前用户的API密钥，不包含密钥本身
+func GetAPIKeys() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+
+		keys, err := utils.ListAPIKeys(userId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_api_keys")})
+			return
+		}
+
+		c.JSON(http.StatusOK, keys)
+	}
+}
+
+// CreateAPIKey 为当前用户创建API密钥，原始密钥只在本次响应中返回；
+// 申请的权限范围不能超出用户角色允许的范围。密钥绑定当前档案，受家长控制限制的档案还需要提供PIN
+func CreateAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+		role, err := utils.GetRoleFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "role_not_found")})
+			return
+		}
+
+		var req models.APIKeyCreate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "detail": err.Error()})
+			return
+		}
+
+		scopes := make([]string, 0, len(req.Scopes))
+		for _, scope := range req.Scopes {
+			if requiredRole := models.APIKeyScopeRoles[scope]; requiredRole != "" && requiredRole != role {
+				c.JSON(http.StatusForbidden, gin.H{"error": i18n.Msg(c, "scope_not_allowed_for_role", scope)})
+				return
+			}
+			if !slices.Contains(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+
+		// 受限档案创建的密钥不能绕过家长控制：需要PIN，且密钥使用时仍按该档案限制
+		if utils.GetMaxCertificationFromContext(c) != "" {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			var user models.User
+			if err := getUserCollection().FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "user_not_found")})
+				return
+			}
+			if !checkParentalPIN(c, user) {
+				return
+			}
+		}
+		profileId := utils.GetProfileIdFromContext(c)
+
+		count, err := utils.CountAPIKeys(userId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_creating_api_key")})
+			return
+		}
+		if count >= maxAPIKeysPerUser {
+			c.JSON(http.StatusConflict, gin.H{"error": i18n.Msg(c, "api_key_limit_reached")})
+			return
+		}
+
+		var expiresAt *time.Time
+		if req.ExpiresInDays != nil {
+			t := time.Now().AddDate(0, 0, *req.ExpiresInDays)
+			expiresAt = &t
+		}
+
+		key, raw, err := utils.CreateAPIKey(userId, profileId, req.Name, scopes, expiresAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_creating_api_key")})
+			return
+		}
+
+		utils.Info("API key created",
+			zap.String("user_id", userId),
+			zap.String("key_id", key.KeyID),
+			zap.String("profile_id", profileId),
+			zap.Strings("scopes", scopes),
+		)
+
+		c.JSON(http.StatusCreated, gin.H{
+			"api_key": key,
+			"key":     raw,
+			"message": i18n.Msg(c, "api_key_store_securely"),
+		})
+	}
+}
+
+// RevokeAPIKey 撤销当前用户的某个API密钥
+func RevokeAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+
+		keyId := c.Param("key_id")
+		if keyId == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "api_key_id_required")})
+			return
+		}
+
+		if err := utils.RevokeAPIKey(userId, keyId); err != nil {
+			if errors.Is(err, utils.ErrAPIKeyInvalid) {
+				c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "api_key_not_found")})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_revoking_api_key")})
+			return
+		}
+
+		utils.Info("API key revoked", zap.String("user_id", userId), zap.String("key_id", keyId))
+
+		c.JSON(http.StatusOK, gin.H{"message": i18n.Msg(c, "api_key_revoked")})
+	}
+}
@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/config"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/models"
+	"github.com/joey17520/magic-stream-app/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.uber.org/zap"
+)
+
+// requestRegion 确定请求方所在地区：优先使用配置的可信地区请求头，其次是用户资料中的地区，最后是默认地区
+func requestRegion(c *gin.Context) string {
+	cfg := config.GetConfig()
+	if cfg.RegionHeader != "" {
+		if region := utils.NormalizeRegion(c.GetHeader(cfg.RegionHeader)); region != "" {
+			return region
+		}
+	}
+	if region := utils.GetCountryFromContext(c); region != "" {
+		return region
+	}
+	return cfg.DefaultRegion
+}
+
+// availabilityFilter 生成只匹配在region和at可以观看的电影的查询条件，field为电影授权规则字段的路径，
+// 与utils.MovieAvailable的判断保持一致
+func availabilityFilter(field, region string, at time.Time) bson.M {
+	countries := bson.A{nil, bson.A{}}
+	if region != "" {
+		countries = append(countries, region)
+	}
+
+	return bson.M{"$or": bson.A{
+		bson.M{field: bson.M{"$in": bson.A{nil, bson.A{}}}},
+		bson.M{field: bson.M{"$elemMatch": bson.M{
+			"countries": bson.M{"$in": countries},
+			"$and": bson.A{
+				bson.M{"$or": bson.A{bson.M{"starts_at": nil}, bson.M{"starts_at": bson.M{"$lte": at}}}},
+				bson.M{"$or": bson.A{bson.M{"ends_at": nil}, bson.M{"ends_at": bson.M{"$gt": at}}}},
+			},
+		}}},
+	}}
+}
+
+// restrictAvailability 给查询条件加上当前请求地区和时间的授权过滤
+func restrictAvailability(c *gin.Context, filter bson.M, field string) bson.M {
+	return addAvailabilityFilter(filter, field, requestRegion(c), time.Now())
+}
+
+// addAvailabilityFilter 把授权过滤条件并入已有的查询条件，不覆盖其中的$and
+func addAvailabilityFilter(filter bson.M, field, region string, at time.Time) bson.M {
+	return appendAndClause(filter, availabilityFilter(field, region, at))
+}
+
+// appendAndClause 把条件并入查询条件的$and
+func appendAndClause(filter bson.M, clause bson.M) bson.M {
+	if and, ok := filter["$and"].(bson.A); ok {
+		filter["$and"] = append(and, clause)
+	} else {
+		filter["$and"] = bson.A{clause}
+	}
+	return filter
+}
+
+// addAnyRegionAvailabilityFilter 只按时间过滤：没有授权规则，或至少有一条规则在at生效（不论地区），
+// 用于需要在各地区共用的查询结果，使用前再按请求地区过滤
+func addAnyRegionAvailabilityFilter(filter bson.M, field string, at time.Time) bson.M {
+	clause := bson.M{"$or": bson.A{
+		bson.M{field: bson.M{"$in": bson.A{nil, bson.A{}}}},
+		bson.M{field: bson.M{"$elemMatch": bson.M{
+			"$and": bson.A{
+				bson.M{"$or": bson.A{bson.M{"starts_at": nil}, bson.M{"starts_at": bson.M{"$lte": at}}}},
+				bson.M{"$or": bson.A{bson.M{"ends_at": nil}, bson.M{"ends_at": bson.M{"$gt": at}}}},
+			},
+		}}},
+	}}
+	return appendAndClause(filter, clause)
+}
+
+// movieAvailableForRequest 判断电影在当前请求的地区和时间是否可以观看
+func movieAvailableForRequest(c *gin.Context, movie models.Movie) bool {
+	return utils.MovieAvailable(movie.Availability, requestRegion(c), time.Now())
+}
+
+// respondUnavailable 电影在请求方所在地区或当前时间没有授权，按不存在处理
+func respondUnavailable(c *gin.Context) {
+	c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "movie_unavailable_in_region")})
+}
+
+// errInvalidAvailabilityWindow 授权规则的结束时间不晚于开始时间
+var errInvalidAvailabilityWindow = errors.New("ends_at must be after starts_at")
+
+// validateAvailability 校验授权规则的时间范围，地区代码由结构体标签校验
+func validateAvailability(windows []models.AvailabilityWindow) error {
+	for _, window := range windows {
+		if window.StartsAt != nil && window.EndsAt != nil && !window.EndsAt.After(*window.StartsAt) {
+			return errInvalidAvailabilityWindow
+		}
+	}
+	return nil
+}
+
+// UpdateMovieAvailability 管理员替换电影的授权规则
+func UpdateMovieAvailability() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		movieId := c.Param("imdb_id")
+
+		var req models.MovieAvailabilityUpdate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+			return
+		}
+		utils.NormalizeAvailability(req.Availability)
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "detail": err.Error()})
+			return
+		}
+		if err := validateAvailability(req.Availability); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "detail": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		update := bson.M{"$set": bson.M{"availability": req.Availability}}
+		if len(req.Availability) == 0 {
+			update = bson.M{"$unset": bson.M{"availability": ""}}
+		}
+
+		result, err := getMovieCollection().UpdateOne(ctx, bson.M{"imdb_id": movieId}, update)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_updating_movie")})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "movie_not_found")})
+			return
+		}
+		getRecommendationCache().InvalidateAll()
+
+		actorId, _ := utils.GetUserIdFromContext(c)
+		utils.Info("Movie availability updated",
+			zap.String("imdb_id", movieId),
+			zap.String("actor_id", actorId),
+			zap.Int("windows", len(req.Availability)),
+		)
+
+		c.JSON(http.StatusOK, gin.H{"imdb_id": movieId, "availability": req.Availability})
+	}
+}
+
+// PreviewCatalog 管理员按指定地区（region）和时间（at，RFC 3339，默认当前时间）预览电影目录，
+// 不受管理员自己的地区和家长控制影响；其他查询参数与GetMovies相同
+func PreviewCatalog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		region := ""
+		if raw := strings.TrimSpace(c.Query("region")); raw != "" {
+			if region = utils.NormalizeRegion(raw); region == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_region")})
+				return
+			}
+		}
+
+		at := time.Now()
+		if raw := c.Query("at"); raw != "" {
+			parsed, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_at")})
+				return
+			}
+			at = parsed
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		filter, err := catalogFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_year")})
+			return
+		}
+		addAvailabilityFilter(filter, "availability", region, at)
+
+		cursor, err := getMovieCollection().Find(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_movies")})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		movies := []models.Movie{}
+		if err := cursor.All(ctx, &movies); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_decoding_movies")})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"region": region,
+			"at":     at,
+			"total":  len(movies),
+			"movies": localizeMovies(c, movies),
+		})
+	}
+}
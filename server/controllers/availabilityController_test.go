@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joey17520/magic-stream-app/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestValidateAvailability(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 6, 0)
+
+	valid := [][]models.AvailabilityWindow{
+		nil,
+		{{StartsAt: &start}},
+		{{EndsAt: &end}},
+		{{StartsAt: &start, EndsAt: &end}, {Countries: []string{"US"}}},
+	}
+	for _, windows := range valid {
+		if err := validateAvailability(windows); err != nil {
+			t.Errorf("validateAvailability(%+v) = %v", windows, err)
+		}
+	}
+
+	invalid := [][]models.AvailabilityWindow{
+		{{StartsAt: &end, EndsAt: &start}},
+		{{StartsAt: &start, EndsAt: &start}},
+		{{StartsAt: &start, EndsAt: &end}, {StartsAt: &end, EndsAt: &start}},
+	}
+	for _, windows := range invalid {
+		if err := validateAvailability(windows); !errors.Is(err, errInvalidAvailabilityWindow) {
+			t.Errorf("validateAvailability(%+v) = %v, want errInvalidAvailabilityWindow", windows, err)
+		}
+	}
+}
+
+func TestAppendAndClause(t *testing.T) {
+	filter := bson.M{}
+	appendAndClause(filter, bson.M{"a": 1})
+	appendAndClause(filter, bson.M{"b": 2})
+
+	and, ok := filter["$and"].(bson.A)
+	if !ok || len(and) != 2 {
+		t.Fatalf("filter = %v, want both clauses under $and", filter)
+	}
+
+	// 候选集缓存在各地区共用，只按时间过滤，不能包含地区条件
+	cached := addAnyRegionAvailabilityFilter(bson.M{}, "availability", time.Now())
+	if strings.Contains(fmt.Sprint(cached), "countries") {
+		t.Fatalf("region-independent filter mentions countries: %v", cached)
+	}
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/config"
+	"github.com/joey17520/magic-stream-app/database"
+	"github.com/joey17520/magic-stream-app/experiments"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/middlewares"
+	"github.com/joey17520/magic-stream-app/recommendation"
+	"github.com/joey17520/magic-stream-app/utils"
+	"go.uber.org/zap"
+)
+
+var (
+	activeExperiment       *experiments.Experiment
+	experimentTracker      *experiments.Tracker
+	experimentsInitialized bool
+)
+
+// initExperiments 延迟初始化实验事件记录器和推荐实验，配置无效时记录警告并关闭实验
+func initExperiments() {
+	if experimentsInitialized {
+		return
+	}
+	experimentsInitialized = true
+	experimentTracker = experiments.NewTracker(database.OpenCollection("experiment_events"))
+
+	cfg := config.GetConfig()
+	if cfg.RecommendationExperiment == "" {
+		return
+	}
+
+	experiment, err := experiments.Parse(cfg.RecommendationExperiment, cfg.RecommendationExperimentVariants)
+	if err != nil {
+		utils.Warn("Invalid recommendation experiment, experiment disabled", utils.ErrorFields(err)...)
+		return
+	}
+
+	for _, variant := range experiment.Variants {
+		if _, ok := recommendation.GetStrategy(variant.Strategy); !ok {
+			utils.Warn("Unknown recommendation strategy in experiment, experiment disabled",
+				zap.String("variant", variant.Name),
+				zap.String("strategy", variant.Strategy),
+			)
+			return
+		}
+	}
+
+	activeExperiment = experiment
+}
+
+// getActiveExperiment 获取当前启用的推荐实验，未启用时返回nil
+func getActiveExperiment() (*experiments.Experiment, *experiments.Tracker) {
+	initExperiments()
+	return activeExperiment, experimentTracker
+}
+
+// getExperimentTracker 获取实验事件记录器，未启用实验时也可用于清理以往实验的事件
+func getExperimentTracker() *experiments.Tracker {
+	initExperiments()
+	return experimentTracker
+}
+
+// recordExperimentOutcome 若用户处于实验中且电影来自其曝光结果，记录一次转化
+func recordExperimentOutcome(ctx context.Context, userId, movieId, outcome string) {
+	experiment, tracker := getActiveExperiment()
+	if experiment == nil {
+		return
+	}
+
+	variant := experiment.Assign(userId)
+	attributed, err := tracker.RecordOutcome(ctx, experiment.Name, variant.Name, userId, movieId, outcome)
+	if err != nil {
+		utils.Warn("Failed to record experiment outcome", utils.ErrorFields(err)...)
+		return
+	}
+	if attributed {
+		middlewares.RecordExperimentOutcome(experiment.Name, variant.Name, outcome)
+	}
+}
+
+// ClickRecommendation 记录用户点击了某部推荐电影
+func ClickRecommendation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+
+		movieId := c.Param("imdb_id")
+		if movieId == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "movie_id_required")})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, ok := findStreamableMovie(ctx, c, movieId); !ok {
+			return
+		}
+		recordExperimentOutcome(ctx, userId, movieId, experiments.OutcomeClick)
+
+		c.JSON(http.StatusOK, gin.H{"message": i18n.Msg(c, "click_recorded")})
+	}
+}
+
+// GetExperimentMetrics 返回当前推荐实验各分组的曝光与转化指标（仅管理员）
+func GetExperimentMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		experiment, tracker := getActiveExperiment()
+		if experiment == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "no_experiment_running")})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		metrics, err := tracker.Metrics(ctx, experiment)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_computing_experiment_metrics")})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"experiment": experiment,
+			"metrics":    metrics,
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/database"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/models"
+	"github.com/joey17520/magic-stream-app/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var (
+	eventCollection             *mongo.Collection
+	eventCollectionsInitialized bool
+)
+
+// initEventCollections 延迟初始化事件集合
+func initEventCollections() {
+	if !eventCollectionsInitialized {
+		eventCollection = database.OpenCollection("movie_events")
+		eventCollectionsInitialized = true
+	}
+}
+
+// getEventCollection 获取电影事件集合
+func getEventCollection() *mongo.Collection {
+	initEventCollections()
+	return eventCollection
+}
+
+// profileScope 按账户和家庭成员档案过滤的条件，profileId为空时只匹配账户主档案的数据
+func profileScope(userId, profileId string) bson.M {
+	filter := bson.M{"user_id": userId}
+	if profileId == "" {
+		filter["profile_id"] = nil
+	} else {
+		filter["profile_id"] = profileId
+	}
+	return filter
+}
+
+// recordMovieEvent 记录档案对电影的交互事件，value用于携带评分等附加数值
+func recordMovieEvent(ctx context.Context, userId, profileId, movieId, eventType string, value float64) error {
+	event := models.MovieEvent{
+		UserID:    userId,
+		ProfileID: profileId,
+		ImdbID:    movieId,
+		Type:      eventType,
+		Value:     value,
+		CreatedAt: time.Now(),
+	}
+
+	_, err := getEventCollection().InsertOne(ctx, event)
+	return err
+}
+
+// excludedEventTypes 推荐时需要排除其电影的事件类型：
+// 档案标记为不感兴趣的电影始终排除，includeSeen为true时同时排除播放过或评过分的电影；
+// 只打开过详情页的电影仍会推荐，浏览不代表已经看过
+func excludedEventTypes(includeSeen bool) []string {
+	eventTypes := []string{models.MovieEventDismiss}
+	if includeSeen {
+		eventTypes = append(eventTypes, models.MovieEventPlay, models.MovieEventRate)
+	}
+	return eventTypes
+}
+
+// getExcludedMovieIds 获取推荐时需要排除的电影ID，规则见excludedEventTypes
+func getExcludedMovieIds(ctx context.Context, userId, profileId string, includeSeen bool) ([]string, error) {
+	filter := profileScope(userId, profileId)
+	filter["type"] = bson.M{"$in": excludedEventTypes(includeSeen)}
+
+	var movieIds []string
+	if err := getEventCollection().Distinct(ctx, "imdb_id", filter).Decode(&movieIds); err != nil {
+		return nil, err
+	}
+
+	return movieIds, nil
+}
+
+// getMoviesPlayedSince 获取档案在since之后播放过的电影ID
+func getMoviesPlayedSince(ctx context.Context, userId, profileId string, since time.Time) ([]string, error) {
+	filter := profileScope(userId, profileId)
+	filter["type"] = models.MovieEventPlay
+	filter["created_at"] = bson.M{"$gte": since}
+
+	var movieIds []string
+	if err := getEventCollection().Distinct(ctx, "imdb_id", filter).Decode(&movieIds); err != nil {
+		return nil, err
+	}
+	return movieIds, nil
+}
+
+// DismissRecommendation 用户标记某部推荐电影为不感兴趣，之后不再推荐
+func DismissRecommendation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+
+		movieId := c.Param("imdb_id")
+		if movieId == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "movie_id_required")})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, ok := findStreamableMovie(ctx, c, movieId); !ok {
+			return
+		}
+
+		profileId := utils.GetProfileIdFromContext(c)
+		if err := recordMovieEvent(ctx, userId, profileId, movieId, models.MovieEventDismiss, 0); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_saving_feedback")})
+			return
+		}
+		getRecommendationCache().Invalidate(recommendationCacheKey(userId, profileId))
+
+		c.JSON(http.StatusOK, gin.H{"message": i18n.Msg(c, "recommendation_dismissed")})
+	}
+}
+
+// GetHistory 获取当前档案的观看和评分记录，按时间倒序，最多返回limit条（默认50，最大200）
+func GetHistory() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if err != nil || limit < 1 || limit > 200 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_history_limit")})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		filter := profileScope(userId, utils.GetProfileIdFromContext(c))
+		filter["type"] = bson.M{"$in": []string{models.MovieEventView, models.MovieEventPlay, models.MovieEventRate}}
+
+		opts := options.Find().
+			SetSort(bson.D{{Key: "created_at", Value: -1}}).
+			SetLimit(int64(limit))
+
+		cursor, err := getEventCollection().Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_history")})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		events := []models.MovieEvent{}
+		if err := cursor.All(ctx, &events); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_decoding_history")})
+			return
+		}
+
+		c.JSON(http.StatusOK, events)
+	}
+}
@@ -0,0 +1,25 @@
+package controllers
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/joey17520/magic-stream-app/models"
+)
+
+func TestExcludedEventTypes(t *testing.T) {
+	if got := excludedEventTypes(false); !slices.Equal(got, []string{models.MovieEventDismiss}) {
+		t.Fatalf("excludedEventTypes(false) = %v, want only dismissals", got)
+	}
+
+	seen := excludedEventTypes(true)
+	for _, eventType := range []string{models.MovieEventDismiss, models.MovieEventPlay, models.MovieEventRate} {
+		if !slices.Contains(seen, eventType) {
+			t.Errorf("excludedEventTypes(true) = %v, missing %q", seen, eventType)
+		}
+	}
+	// 打开详情页不等于看过，不能让浏览把电影挤出推荐
+	if slices.Contains(seen, models.MovieEventView) {
+		t.Errorf("excludedEventTypes(true) = %v, must not exclude detail views", seen)
+	}
+}
@@ -0,0 +1,516 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/config"
+	"github.com/joey17520/magic-stream-app/database"
+	"github.com/joey17520/magic-stream-app/hls"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/models"
+	"github.com/joey17520/magic-stream-app/storage"
+	"github.com/joey17520/magic-stream-app/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+)
+
+// maxHLSPlaylistSize 上传的媒体播放列表大小上限
+const maxHLSPlaylistSize = 4 << 20
+
+// hlsInitSegmentName 初始化片段在播放地址中的名称（不含扩展名）
+const hlsInitSegmentName = "init"
+
+var (
+	hlsCollection             *mongo.Collection
+	hlsCollectionsInitialized bool
+)
+
+// initHLSCollections 延迟初始化HLS码率版本集合
+func initHLSCollections() {
+	if !hlsCollectionsInitialized {
+		hlsCollection = database.OpenCollection("hls_renditions")
+		hlsCollectionsInitialized = true
+	}
+}
+
+// getHLSCollection 获取HLS码率版本集合
+func getHLSCollection() *mongo.Collection {
+	initHLSCollections()
+	return hlsCollection
+}
+
+// hlsSegmentName 分片在播放地址中的名称：码率版本的上传时间、序号和保存对象的扩展名。
+// 替换码率版本后旧的分片地址不再有效，同一地址的内容不会变化，可以长期缓存
+func hlsSegmentName(rendition models.HLSRendition, index string, segment models.HLSSegment) string {
+	return strconv.FormatInt(rendition.CreatedAt.UnixMilli(), 36) + "-" + index + path.Ext(segment.Key)
+}
+
+// deleteHLSSegments 删除码率版本的所有分片对象，失败只记录日志
+func deleteHLSSegments(ctx context.Context, store storage.BlobStore, keys []string) {
+	for _, key := range keys {
+		if err := store.Delete(ctx, key); err != nil {
+			utils.Warn("Failed to delete HLS segment", append(utils.ErrorFields(err), zap.String("key", key))...)
+		}
+	}
+}
+
+// renditionKeys 码率版本引用的所有对象键
+func renditionKeys(rendition models.HLSRendition) []string {
+	keys := make([]string, 0, len(rendition.Segments)+1)
+	if rendition.Init != nil {
+		keys = append(keys, rendition.Init.Key)
+	}
+	for _, segment := range rendition.Segments {
+		keys = append(keys, segment.Key)
+	}
+	return keys
+}
+
+// readFormValue 读取multipart表单中的短文本字段
+func readFormValue(r io.Reader) (string, error) {
+	value, err := io.ReadAll(io.LimitReader(r, 256))
+	return strings.TrimSpace(string(value)), err
+}
+
+// UploadHLSRendition 管理员上传电影的一个HLS码率版本，替换同名版本。multipart表单包含：
+// bandwidth（必需，bps）、resolution（如1280x720）、codecs、playlist（打包工具生成的媒体播放列表）
+// 和多个segment文件（文件名与播放列表中的分片地址对应）
+func UploadHLSRendition() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store := getBlobStore()
+		if store == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": i18n.Msg(c, "video_storage_disabled")})
+			return
+		}
+		movieId := c.Param("imdb_id")
+		name := c.Param("rendition")
+		if err := validate.Var(name, "required,max=32,alphanum"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "detail": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := getMovieCollection().FindOne(ctx, bson.M{"imdb_id": movieId}).Err(); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "movie_not_found")})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_movies")})
+			return
+		}
+
+		maxSize := int64(config.GetConfig().MaxVideoUploadMB) << 20
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize)
+		reader, err := c.Request.MultipartReader()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+			return
+		}
+
+		// 分片边读边写入存储；任何一步失败都删除本次已保存的分片
+		prefix := "movies/" + movieId + "/hls/" + name + "/" + strconv.FormatInt(time.Now().UnixNano(), 36) + "/"
+		var keys []string
+		stored := make(map[string]models.HLSSegment)
+		fail := func(status int, key string, extra gin.H) {
+			cleanupCtx, cleanupCancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cleanupCancel()
+			deleteHLSSegments(cleanupCtx, store, keys)
+			body := gin.H{"error": i18n.Msg(c, key)}
+			for k, v := range extra {
+				body[k] = v
+			}
+			c.JSON(status, body)
+		}
+
+		rendition := models.HLSRendition{ImdbID: movieId, Name: name}
+		var playlist *hls.MediaPlaylist
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				fail(http.StatusBadRequest, "invalid_request_body", nil)
+				return
+			}
+
+			switch part.FormName() {
+			case "bandwidth":
+				value, err := readFormValue(part)
+				if err == nil {
+					rendition.Bandwidth, err = strconv.Atoi(value)
+				}
+				if err != nil {
+					fail(http.StatusBadRequest, "invalid_bandwidth", nil)
+					return
+				}
+			case "resolution":
+				value, err := readFormValue(part)
+				if err == nil && value != "" {
+					_, err = fmt.Sscanf(value, "%dx%d", &rendition.Width, &rendition.Height)
+				}
+				if err != nil {
+					fail(http.StatusBadRequest, "invalid_resolution", nil)
+					return
+				}
+			case "codecs":
+				if rendition.Codecs, err = readFormValue(part); err != nil {
+					fail(http.StatusBadRequest, "invalid_request_body", nil)
+					return
+				}
+			case "playlist":
+				playlist, err = hls.ParseMediaPlaylist(io.LimitReader(part, maxHLSPlaylistSize))
+				if err != nil {
+					fail(http.StatusBadRequest, "invalid_hls_playlist", gin.H{"detail": err.Error()})
+					return
+				}
+			case "segment":
+				filename := path.Base(part.FileName())
+				contentType := hls.SegmentContentType(filename)
+				if contentType == "" {
+					fail(http.StatusUnsupportedMediaType, "unsupported_segment_type", gin.H{"segment": filename})
+					return
+				}
+				if _, ok := stored[filename]; ok {
+					fail(http.StatusBadRequest, "duplicate_hls_segment", gin.H{"segment": filename})
+					return
+				}
+
+				key := prefix + strconv.Itoa(len(keys)) + path.Ext(filename)
+				info, err := store.Put(c.Request.Context(), key, part)
+				if err != nil {
+					var maxBytesErr *http.MaxBytesError
+					if errors.As(err, &maxBytesErr) {
+						fail(http.StatusRequestEntityTooLarge, "video_too_large", nil)
+						return
+					}
+					utils.Error("Failed to store HLS segment", append(utils.ErrorFields(err), zap.String("imdb_id", movieId))...)
+					fail(http.StatusInternalServerError, "error_uploading_video", nil)
+					return
+				}
+				keys = append(keys, key)
+				stored[filename] = models.HLSSegment{Key: key, ContentType: contentType, Size: info.Size, SHA256: info.SHA256}
+			}
+		}
+		if playlist == nil {
+			fail(http.StatusBadRequest, "hls_playlist_required", nil)
+			return
+		}
+
+		// 按播放列表的顺序组装分片，播放列表中没有引用的分片不保留
+		used := make(map[string]bool, len(stored))
+		if playlist.InitURI != "" {
+			filename := path.Base(playlist.InitURI)
+			segment, ok := stored[filename]
+			if !ok {
+				fail(http.StatusBadRequest, "hls_segment_missing", gin.H{"segment": filename})
+				return
+			}
+			rendition.Init = &segment
+			used[segment.Key] = true
+		}
+		for _, entry := range playlist.Segments {
+			filename := path.Base(entry.URI)
+			segment, ok := stored[filename]
+			if !ok {
+				fail(http.StatusBadRequest, "hls_segment_missing", gin.H{"segment": filename})
+				return
+			}
+			segment.Duration = entry.Duration
+			rendition.Segments = append(rendition.Segments, segment)
+			rendition.Duration += entry.Duration
+			used[segment.Key] = true
+		}
+		rendition.SegmentCount = len(rendition.Segments)
+		rendition.CreatedAt = time.Now().Truncate(time.Millisecond)
+
+		if err := validate.Struct(rendition); err != nil {
+			fail(http.StatusBadRequest, "validation_failed", gin.H{"detail": err.Error()})
+			return
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var unused []string
+		for _, key := range keys {
+			if !used[key] {
+				unused = append(unused, key)
+			}
+		}
+		deleteHLSSegments(ctx, store, unused)
+
+		var previous models.HLSRendition
+		opts := options.FindOneAndReplace().SetUpsert(true).SetProjection(bson.M{"init": 1, "segments": 1})
+		err = getHLSCollection().FindOneAndReplace(ctx, bson.M{"imdb_id": movieId, "name": name}, rendition, opts).Decode(&previous)
+		switch {
+		case err == nil:
+			deleteHLSSegments(ctx, store, renditionKeys(previous))
+		case errors.Is(err, mongo.ErrNoDocuments):
+		default:
+			keys = renditionKeys(rendition)
+			fail(http.StatusInternalServerError, "error_uploading_video", nil)
+			return
+		}
+
+		actorId, _ := utils.GetUserIdFromContext(c)
+		utils.Info("HLS rendition uploaded",
+			zap.String("imdb_id", movieId),
+			zap.String("rendition", name),
+			zap.String("actor_id", actorId),
+			zap.Int("segments", rendition.SegmentCount),
+		)
+
+		c.JSON(http.StatusOK, rendition)
+	}
+}
+
+// GetHLSRenditions 管理员查看电影的所有HLS码率版本，不返回分片列表
+func GetHLSRenditions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		opts := options.Find().SetProjection(bson.M{"segments": 0}).SetSort(bson.D{{Key: "bandwidth", Value: 1}})
+		cursor, err := getHLSCollection().Find(ctx, bson.M{"imdb_id": c.Param("imdb_id")}, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_renditions")})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		renditions := []models.HLSRendition{}
+		if err := cursor.All(ctx, &renditions); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_renditions")})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"renditions": renditions})
+	}
+}
+
+// DeleteHLSRendition 管理员删除电影的一个HLS码率版本及其分片
+func DeleteHLSRendition() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store := getBlobStore()
+		if store == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": i18n.Msg(c, "video_storage_disabled")})
+			return
+		}
+		movieId := c.Param("imdb_id")
+		name := c.Param("rendition")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var rendition models.HLSRendition
+		err := getHLSCollection().FindOneAndDelete(ctx, bson.M{"imdb_id": movieId, "name": name}).Decode(&rendition)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "hls_rendition_not_found")})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_deleting_video")})
+			return
+		}
+		deleteHLSSegments(ctx, store, renditionKeys(rendition))
+
+		actorId, _ := utils.GetUserIdFromContext(c)
+		utils.Info("HLS rendition deleted", zap.String("imdb_id", movieId), zap.String("rendition", name), zap.String("actor_id", actorId))
+
+		c.JSON(http.StatusOK, gin.H{"message": i18n.Msg(c, "video_deleted")})
+	}
+}
+
+// servePlaylist 返回动态生成的播放列表。码率版本随时可能被替换，播放器每次都需要重新验证，
+// ETag为内容摘要，未变化时返回304
+func servePlaylist(c *gin.Context, body []byte, modTime time.Time) {
+	sum := sha256.Sum256(body)
+	header := c.Writer.Header()
+	header.Set("Content-Type", hls.ContentType)
+	header.Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	header.Set("Cache-Control", "private, no-cache")
+	http.ServeContent(c.Writer, c.Request, "", modTime, bytes.NewReader(body))
+}
+
+// StreamHLSMaster 返回电影的HLS主播放列表，列出所有码率版本
+func StreamHLSMaster() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		movieId := c.Param("imdb_id")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, ok := findStreamableMovie(ctx, c, movieId); !ok {
+			return
+		}
+
+		opts := options.Find().SetProjection(bson.M{"segments": 0})
+		cursor, err := getHLSCollection().Find(ctx, bson.M{"imdb_id": movieId}, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_streaming_video")})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		var renditions []models.HLSRendition
+		if err := cursor.All(ctx, &renditions); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_streaming_video")})
+			return
+		}
+		if len(renditions) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "video_not_found")})
+			return
+		}
+
+		variants := make([]hls.Variant, 0, len(renditions))
+		var modTime time.Time
+		for _, rendition := range renditions {
+			variants = append(variants, hls.Variant{
+				URI:       rendition.Name + "/index.m3u8",
+				Bandwidth: rendition.Bandwidth,
+				Width:     rendition.Width,
+				Height:    rendition.Height,
+				Codecs:    rendition.Codecs,
+			})
+			if rendition.CreatedAt.After(modTime) {
+				modTime = rendition.CreatedAt
+			}
+		}
+
+		// 播放器每次开始播放时只请求一次主播放列表
+		recordPlaybackStarted(ctx, c, movieId)
+		servePlaylist(c, hls.WriteMaster(variants), modTime)
+	}
+}
+
+// StreamHLSMedia 返回一个码率版本的媒体播放列表
+func StreamHLSMedia() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		movieId := c.Param("imdb_id")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, ok := findStreamableMovie(ctx, c, movieId); !ok {
+			return
+		}
+
+		var rendition models.HLSRendition
+		err := getHLSCollection().FindOne(ctx, bson.M{"imdb_id": movieId, "name": c.Param("rendition")}).Decode(&rendition)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "hls_rendition_not_found")})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_streaming_video")})
+			return
+		}
+
+		playlist := &hls.MediaPlaylist{Segments: make([]hls.Segment, 0, len(rendition.Segments))}
+		if rendition.Init != nil {
+			playlist.InitURI = "segments/" + hlsSegmentName(rendition, hlsInitSegmentName, *rendition.Init)
+		}
+		for i, segment := range rendition.Segments {
+			playlist.Segments = append(playlist.Segments, hls.Segment{
+				URI:      "segments/" + hlsSegmentName(rendition, strconv.Itoa(i), segment),
+				Duration: segment.Duration,
+			})
+		}
+
+		servePlaylist(c, hls.WriteMedia(playlist), rendition.CreatedAt)
+	}
+}
+
+// StreamHLSSegment 返回一个分片，分片地址的内容不会变化，可以长期缓存
+func StreamHLSSegment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store := getBlobStore()
+		if store == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": i18n.Msg(c, "video_storage_disabled")})
+			return
+		}
+		movieId := c.Param("imdb_id")
+		segmentName := c.Param("segment")
+		_, index, _ := strings.Cut(strings.TrimSuffix(segmentName, path.Ext(segmentName)), "-")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, ok := findStreamableMovie(ctx, c, movieId); !ok {
+			return
+		}
+
+		// 只读取请求的分片，不加载整个分片列表
+		projection := bson.M{"created_at": 1, "init": 1}
+		position := -1
+		if index != hlsInitSegmentName {
+			var err error
+			if position, err = strconv.Atoi(index); err != nil || position < 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "video_not_found")})
+				return
+			}
+			projection = bson.M{"created_at": 1, "segments": bson.M{"$slice": bson.A{position, 1}}}
+		}
+
+		var rendition models.HLSRendition
+		opts := options.FindOne().SetProjection(projection)
+		err := getHLSCollection().FindOne(ctx, bson.M{"imdb_id": movieId, "name": c.Param("rendition")}, opts).Decode(&rendition)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "hls_rendition_not_found")})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_streaming_video")})
+			return
+		}
+
+		var segment *models.HLSSegment
+		switch {
+		case position < 0:
+			segment = rendition.Init
+		case len(rendition.Segments) == 1:
+			segment = &rendition.Segments[0]
+		}
+		if segment == nil || hlsSegmentName(rendition, index, *segment) != segmentName {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "video_not_found")})
+			return
+		}
+
+		file, _, err := store.Open(c.Request.Context(), segment.Key)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				utils.Warn("HLS segment missing from storage", zap.String("imdb_id", movieId), zap.String("key", segment.Key))
+				c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "video_not_found")})
+				return
+			}
+			utils.Error("Failed to open HLS segment", append(utils.ErrorFields(err), zap.String("imdb_id", movieId))...)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_streaming_video")})
+			return
+		}
+		defer file.Close()
+
+		header := c.Writer.Header()
+		header.Set("Content-Type", segment.ContentType)
+		header.Set("ETag", `"`+segment.SHA256+`"`)
+		header.Set("Cache-Control", "private, max-age=31536000, immutable")
+		header.Set("X-Content-Type-Options", "nosniff")
+		http.ServeContent(c.Writer, c.Request, "", rendition.CreatedAt, file)
+	}
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/models"
+)
+
+func TestHLSSegmentName(t *testing.T) {
+	first := models.HLSRendition{CreatedAt: time.UnixMilli(1_700_000_000_000)}
+	replaced := models.HLSRendition{CreatedAt: first.CreatedAt.Add(time.Millisecond)}
+	segment := models.HLSSegment{Key: "hls/tt0111161/720p/abc/segment-3.m4s"}
+
+	name := hlsSegmentName(first, "3", segment)
+	if !strings.HasSuffix(name, "-3.m4s") {
+		t.Fatalf("name = %q, want the index and the stored extension", name)
+	}
+	// 替换码率版本后分片地址必须变化，否则缓存中的旧分片会被当作新版本播放
+	if hlsSegmentName(replaced, "3", segment) == name {
+		t.Fatal("segment name did not change after the rendition was replaced")
+	}
+}
+
+func TestRenditionKeys(t *testing.T) {
+	rendition := models.HLSRendition{
+		Init:     &models.HLSSegment{Key: "init.mp4"},
+		Segments: []models.HLSSegment{{Key: "0.m4s"}, {Key: "1.m4s"}},
+	}
+	if got := renditionKeys(rendition); !slices.Equal(got, []string{"init.mp4", "0.m4s", "1.m4s"}) {
+		t.Errorf("renditionKeys = %v", got)
+	}
+
+	rendition.Init = nil
+	if got := renditionKeys(rendition); !slices.Equal(got, []string{"0.m4s", "1.m4s"}) {
+		t.Errorf("renditionKeys without init = %v", got)
+	}
+}
+
+func TestServePlaylist(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	body := []byte("#EXTM3U\n#EXT-X-VERSION:7\n")
+
+	router := gin.New()
+	router.GET("/master.m3u8", func(c *gin.Context) {
+		servePlaylist(c, body, time.Now())
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/master.m3u8", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != string(body) {
+		t.Fatalf("status = %d, body = %q", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "private, no-cache" {
+		t.Errorf("Cache-Control = %q", got)
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("playlist has no ETag")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/master.m3u8", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("revalidation: status = %d, want %d", rec.Code, http.StatusNotModified)
+	}
+}
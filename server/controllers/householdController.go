@@ -0,0 +1,378 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/models"
+	"github.com/joey17520/magic-stream-app/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+)
+
+// maxHouseholdProfiles 每个账户最多可以创建的家庭成员档案数量（不含账户主档案）
+const maxHouseholdProfiles = 5
+
+// findHouseholdProfile 在用户的档案中按ID查找，profileId为空或不存在时返回nil
+func findHouseholdProfile(user models.User, profileId string) *models.HouseholdProfile {
+	if profileId == "" {
+		return nil
+	}
+	for i := range user.Profiles {
+		if user.Profiles[i].ProfileID == profileId {
+			return &user.Profiles[i]
+		}
+	}
+	return nil
+}
+
+// householdProfileNameTaken 同一账户下档案名称不区分大小写唯一，exceptId为正在修改的档案
+func householdProfileNameTaken(user models.User, name, exceptId string) bool {
+	for _, profile := range user.Profiles {
+		if profile.ProfileID != exceptId && strings.EqualFold(profile.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetHouseholdProfiles 列出当前账户的家庭成员档案
+func GetHouseholdProfiles() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.User
+		opts := options.FindOne().SetProjection(bson.M{"profiles": 1})
+		if err := getUserCollection().FindOne(ctx, bson.M{"user_id": userId}, opts).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "user_not_found")})
+			return
+		}
+
+		profiles := make([]models.HouseholdProfile, 0, len(user.Profiles))
+		for _, profile := range user.Profiles {
+			profile.FavoriteGenres = localizeGenres(c, profile.FavoriteGenres)
+			profiles = append(profiles, profile)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"profiles":           profiles,
+			"current_profile_id": utils.GetProfileIdFromContext(c),
+		})
+	}
+}
+
+// CreateHouseholdProfile 为当前账户创建家庭成员档案
+func CreateHouseholdProfile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+
+		var req models.HouseholdProfileCreate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "detail": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := getUserCollection().FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "user_not_found")})
+			return
+		}
+		if householdProfileNameTaken(user, req.Name, "") {
+			c.JSON(http.StatusConflict, gin.H{"error": i18n.Msg(c, "profile_name_taken")})
+			return
+		}
+
+		genres, err := resolveGenres(ctx, req.FavoriteGenres)
+		if err != nil {
+			if errors.Is(err, errUnknownGenre) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "unknown_genre")})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_genres")})
+			return
+		}
+
+		now := time.Now()
+		profile := models.HouseholdProfile{
+			ProfileID:        bson.NewObjectID().Hex(),
+			Name:             req.Name,
+			Avatar:           req.Avatar,
+			FavoriteGenres:   genres,
+			Kids:             req.Kids,
+			MaxCertification: req.MaxCertification,
+			CreatedAt:        now,
+			UpdatedAt:        now,
+		}
+
+		// 数量限制放在更新条件里，并发创建时也不会超出上限
+		result, err := getUserCollection().UpdateOne(ctx,
+			bson.M{
+				"user_id": userId,
+				"$expr":   bson.M{"$lt": bson.A{bson.M{"$size": bson.M{"$ifNull": bson.A{"$profiles", bson.A{}}}}, maxHouseholdProfiles}},
+			},
+			bson.M{
+				"$push": bson.M{"profiles": profile},
+				"$set":  bson.M{"updated_at": now},
+			},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_creating_profile")})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": i18n.Msg(c, "profile_limit_reached")})
+			return
+		}
+
+		utils.Info("Household profile created", zap.String("user_id", userId), zap.String("profile_id", profile.ProfileID))
+
+		c.JSON(http.StatusCreated, profile)
+	}
+}
+
+// UpdateHouseholdProfile 更新家庭成员档案，只修改请求中提供的字段
+func UpdateHouseholdProfile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+		profileId := c.Param("profile_id")
+
+		var req models.HouseholdProfileUpdate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+			return
+		}
+		if req.Name != nil {
+			name := strings.TrimSpace(*req.Name)
+			req.Name = &name
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "detail": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := getUserCollection().FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "user_not_found")})
+			return
+		}
+		if findHouseholdProfile(user, profileId) == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "profile_not_found")})
+			return
+		}
+
+		// 修改儿童标记或分级限制需要家长控制PIN
+		if (req.Kids != nil || req.MaxCertification != nil) && !checkParentalPIN(c, user) {
+			return
+		}
+
+		now := time.Now()
+		set := bson.M{"updated_at": now, "profiles.$.updated_at": now}
+		if req.Name != nil {
+			if householdProfileNameTaken(user, *req.Name, profileId) {
+				c.JSON(http.StatusConflict, gin.H{"error": i18n.Msg(c, "profile_name_taken")})
+				return
+			}
+			set["profiles.$.name"] = *req.Name
+		}
+		if req.Avatar != nil {
+			set["profiles.$.avatar"] = *req.Avatar
+		}
+		if req.Kids != nil {
+			set["profiles.$.kids"] = *req.Kids
+		}
+		if req.MaxCertification != nil {
+			set["profiles.$.max_certification"] = *req.MaxCertification
+		}
+		if req.FavoriteGenres != nil {
+			genres, err := resolveGenres(ctx, *req.FavoriteGenres)
+			if err != nil {
+				if errors.Is(err, errUnknownGenre) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "unknown_genre")})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_genres")})
+				return
+			}
+			set["profiles.$.favorite_genres"] = genres
+		}
+
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		err = getUserCollection().FindOneAndUpdate(ctx,
+			bson.M{"user_id": userId, "profiles.profile_id": profileId},
+			bson.M{"$set": set},
+			opts,
+		).Decode(&user)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "profile_not_found")})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_updating_profile")})
+			return
+		}
+
+		if req.FavoriteGenres != nil || req.Kids != nil || req.MaxCertification != nil {
+			getRecommendationCache().Invalidate(recommendationCacheKey(userId, profileId))
+		}
+
+		c.JSON(http.StatusOK, findHouseholdProfile(user, profileId))
+	}
+}
+
+// DeleteHouseholdProfile 删除家庭成员档案及其观看记录和片单，正在使用该档案的会话需要重新选择档案。
+// 受限档案中的操作或删除受限档案需要家长控制PIN
+func DeleteHouseholdProfile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+		profileId := c.Param("profile_id")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := getUserCollection().FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "user_not_found")})
+			return
+		}
+		target := findHouseholdProfile(user, profileId)
+		if target == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "profile_not_found")})
+			return
+		}
+		restricted := utils.GetMaxCertificationFromContext(c) != "" || utils.EffectiveMaxCertification(user.ParentalControls, target) != ""
+		if restricted && !checkParentalPIN(c, user) {
+			return
+		}
+
+		result, err := getUserCollection().UpdateOne(ctx,
+			bson.M{"user_id": userId, "profiles.profile_id": profileId},
+			bson.M{
+				"$pull": bson.M{"profiles": bson.M{"profile_id": profileId}},
+				"$set":  bson.M{"updated_at": time.Now()},
+			},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_deleting_profile")})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "profile_not_found")})
+			return
+		}
+
+		scope := profileScope(userId, profileId)
+		if _, err := getEventCollection().DeleteMany(ctx, scope); err != nil {
+			utils.Warn("Failed to delete history of deleted profile", utils.ErrorFields(err)...)
+		}
+		if _, err := getWatchlistCollection().DeleteMany(ctx, scope); err != nil {
+			utils.Warn("Failed to delete watchlist of deleted profile", utils.ErrorFields(err)...)
+		}
+		getRecommendationCache().Invalidate(recommendationCacheKey(userId, profileId))
+
+		c.JSON(http.StatusOK, gin.H{"message": i18n.Msg(c, "profile_deleted")})
+	}
+}
+
+// SelectHouseholdProfile 选择当前会话使用的档案：重新签发带有档案ID的令牌，之后的观看记录、片单、推荐和分级限制都属于该档案。
+// profile_id为空时切换回账户主档案
+func SelectHouseholdProfile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+		sessionId, err := utils.GetSessionIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "session_id_not_found")})
+			return
+		}
+
+		var req models.HouseholdProfileSelect
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := getUserCollection().FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "user_not_found")})
+			return
+		}
+
+		profile := findHouseholdProfile(user, req.ProfileID)
+		if req.ProfileID != "" && profile == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "profile_not_found")})
+			return
+		}
+
+		// 从受限档案切换到限制更宽松的档案需要家长控制PIN
+		target := utils.EffectiveMaxCertification(user.ParentalControls, profile)
+		if loosensRestriction(utils.GetMaxCertificationFromContext(c), target) && !checkParentalPIN(c, user) {
+			return
+		}
+
+		// 新令牌取代当前会话的令牌，旧的refresh token随之作废
+		session, err := utils.ValidateSession(sessionId, userId, c.ClientIP())
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.Msg(c, "session_expired")})
+			return
+		}
+		refreshTokenId, err := utils.RotateRefreshToken(sessionId, userId, session.RefreshTokenID)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.Msg(c, "session_expired")})
+			return
+		}
+
+		role := utils.EffectiveRole(user.Role, user.TwoFactorEnabled)
+		token, refreshToken, err := utils.GenerateAllTokens(user.Email, user.FirstName, user.LastName, role, user.UserID, sessionId, req.ProfileID, refreshTokenId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_generating_tokens")})
+			return
+		}
+
+		setAuthCookies(c, token, refreshToken)
+
+		c.JSON(http.StatusOK, gin.H{"message": i18n.Msg(c, "profile_selected"), "profile": profile})
+	}
+}
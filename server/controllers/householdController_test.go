@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/joey17520/magic-stream-app/models"
+)
+
+func TestFindHouseholdProfile(t *testing.T) {
+	user := models.User{Profiles: []models.HouseholdProfile{
+		{ProfileID: "p1", Name: "Kids"},
+		{ProfileID: "p2", Name: "Guest"},
+	}}
+
+	if got := findHouseholdProfile(user, ""); got != nil {
+		t.Errorf("empty id returned %+v, want the main profile (nil)", got)
+	}
+	if got := findHouseholdProfile(user, "p3"); got != nil {
+		t.Errorf("unknown id returned %+v", got)
+	}
+
+	// 返回的指针指向用户文档中的档案，修改会反映到user上
+	got := findHouseholdProfile(user, "p2")
+	if got == nil || got.Name != "Guest" {
+		t.Fatalf("findHouseholdProfile(p2) = %+v", got)
+	}
+	got.Name = "Visitor"
+	if user.Profiles[1].Name != "Visitor" {
+		t.Error("findHouseholdProfile returned a copy")
+	}
+}
+
+func TestHouseholdProfileNameTaken(t *testing.T) {
+	user := models.User{Profiles: []models.HouseholdProfile{
+		{ProfileID: "p1", Name: "Kids"},
+		{ProfileID: "p2", Name: "Guest"},
+	}}
+
+	if !householdProfileNameTaken(user, "kids", "") {
+		t.Error("names must be unique regardless of case")
+	}
+	if householdProfileNameTaken(user, "KIDS", "p1") {
+		t.Error("renaming a profile to its own name must be allowed")
+	}
+	if !householdProfileNameTaken(user, "guest", "p1") {
+		t.Error("renaming to another profile's name must be rejected")
+	}
+	if householdProfileNameTaken(user, "Grandma", "") {
+		t.Error("a new name was reported as taken")
+	}
+}
+
+func TestCreateHouseholdProfileValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/profiles", func(c *gin.Context) {
+		c.Set("userId", "user-1")
+	}, CreateHouseholdProfile())
+
+	// 名称会先去掉首尾空白再校验，全是空白的名称视为缺失
+	for _, body := range []string{
+		`{"name":"   ","favorite_genres":[{"genre_id":1,"genre_name":"Comedy"}]}`,
+		`{"name":"` + strings.Repeat("n", 51) + `","favorite_genres":[{"genre_id":1,"genre_name":"Comedy"}]}`,
+		`{"name":"Kids","favorite_genres":[]}`,
+		`{"name":"Kids"`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/profiles", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", body, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/utils"
+)
+
+// GetJWKS 公开当前可用于验证令牌的公钥（JWKS），HS256模式下返回空集合
+func GetJWKS() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 密钥轮换后旧公钥仍在宽限期内保留，短时间缓存不会导致验证失败
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, utils.GetJWKS())
+	}
+}
@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/models"
+	"github.com/joey17520/magic-stream-app/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+)
+
+// localizeGenres 返回按请求语言替换了名称的类型副本，不修改原切片
+func localizeGenres(c *gin.Context, genres []models.Genre) []models.Genre {
+	if genres == nil {
+		return nil
+	}
+	preferences := i18n.PreferencesFromContext(c)
+	localized := make([]models.Genre, len(genres))
+	for i, genre := range genres {
+		if name, ok := i18n.Pick(genre.Names, preferences); ok {
+			genre.GenreName = name
+		}
+		localized[i] = genre
+	}
+	return localized
+}
+
+// localizeMovie 返回按请求语言替换了标题和类型名称的电影副本；推荐结果来自缓存，不能就地修改
+func localizeMovie(c *gin.Context, movie models.Movie) models.Movie {
+	if title, ok := i18n.Pick(movie.Titles, i18n.PreferencesFromContext(c)); ok {
+		movie.Title = title
+	}
+	movie.Genre = localizeGenres(c, movie.Genre)
+	return movie
+}
+
+// localizeMovies 对电影列表逐个调用localizeMovie，返回新的切片
+func localizeMovies(c *gin.Context, movies []models.Movie) []models.Movie {
+	if movies == nil {
+		return nil
+	}
+	localized := make([]models.Movie, len(movies))
+	for i, movie := range movies {
+		localized[i] = localizeMovie(c, movie)
+	}
+	return localized
+}
+
+// UpdateMovieTitles 管理员替换电影各语言的标题
+func UpdateMovieTitles() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		movieId := c.Param("imdb_id")
+
+		var req models.LocalizedNamesUpdate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "detail": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		update := bson.M{"$set": bson.M{"titles": req.Names}}
+		if len(req.Names) == 0 {
+			update = bson.M{"$unset": bson.M{"titles": ""}}
+		}
+
+		result, err := getMovieCollection().UpdateOne(ctx, bson.M{"imdb_id": movieId}, update)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_updating_movie")})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "movie_not_found")})
+			return
+		}
+		getRecommendationCache().InvalidateAll()
+
+		c.JSON(http.StatusOK, gin.H{"imdb_id": movieId, "titles": req.Names})
+	}
+}
+
+// UpdateGenreNames 管理员替换类型各语言的名称，并同步到电影和用户资料中保存的类型副本
+func UpdateGenreNames() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		genreId, err := strconv.Atoi(c.Param("genre_id"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "genre_not_found")})
+			return
+		}
+
+		var req models.LocalizedNamesUpdate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "detail": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		result, err := getGenreCollection().UpdateOne(ctx, bson.M{"genre_id": genreId}, bson.M{"$set": bson.M{"names": req.Names}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_updating_genre")})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "genre_not_found")})
+			return
+		}
+
+		// 电影和用户资料中嵌入的是类型的副本，同步失败只影响这些副本的显示名称
+		opts := options.UpdateMany().SetArrayFilters([]any{bson.M{"g.genre_id": genreId}})
+		embedded := []struct {
+			collection *mongo.Collection
+			filter     bson.M
+			field      string
+		}{
+			{getMovieCollection(), bson.M{"genre.genre_id": genreId}, "genre.$[g].names"},
+			{getUserCollection(), bson.M{"favorite_genres.genre_id": genreId}, "favorite_genres.$[g].names"},
+			{getUserCollection(), bson.M{"profiles.favorite_genres.genre_id": genreId}, "profiles.$[].favorite_genres.$[g].names"},
+		}
+		for _, target := range embedded {
+			if _, err := target.collection.UpdateMany(ctx, target.filter, bson.M{"$set": bson.M{target.field: req.Names}}, opts); err != nil {
+				utils.Warn("Failed to sync genre names", append(utils.ErrorFields(err), zap.Int("genre_id", genreId), zap.String("field", target.field))...)
+			}
+		}
+		getRecommendationCache().InvalidateAll()
+
+		c.JSON(http.StatusOK, gin.H{"genre_id": genreId, "names": req.Names})
+	}
+}
@@ -0,0 +1,321 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/config"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/metadata"
+	"github.com/joey17520/magic-stream-app/models"
+	"github.com/joey17520/magic-stream-app/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+)
+
+// unrankedName 新导入的电影还没有管理员评论，使用未评级的排名
+const unrankedName = "Not_Ranked"
+
+var (
+	metadataProvider            metadata.MetadataProvider
+	metadataProviderInitialized bool
+)
+
+// getMetadataProvider 延迟创建元数据来源，未配置或配置有误时返回nil
+func getMetadataProvider() metadata.MetadataProvider {
+	if !metadataProviderInitialized {
+		cfg := config.GetConfig()
+		provider, err := metadata.New(metadata.Options{
+			Driver:           cfg.MetadataProvider,
+			TMDBAPIKey:       cfg.TMDBAPIKey,
+			TMDBBaseURL:      cfg.TMDBBaseURL,
+			TMDBImageBaseURL: cfg.TMDBImageBaseURL,
+			FixtureDir:       cfg.MetadataFixtureDir,
+		})
+		if err != nil {
+			utils.Error("Failed to initialize metadata provider", utils.ErrorFields(err)...)
+		}
+		metadataProvider = provider
+		metadataProviderInitialized = true
+	}
+	return metadataProvider
+}
+
+// MetadataPreview 元数据预览：外部数据、合并到电影后的结果，以及导入时需要回传的确认码
+type MetadataPreview struct {
+	Metadata *metadata.MovieMetadata `json:"metadata"`
+	Movie    models.Movie            `json:"movie"`
+	Exists   bool                    `json:"exists"`
+	// UnknownGenres 外部数据中无法对应到genres集合的类型，导入时会被忽略
+	UnknownGenres []string `json:"unknown_genres,omitempty"`
+	// Confirmation 外部数据的摘要，导入时数据发生变化则拒绝导入，保证导入的就是预览过的内容
+	Confirmation string `json:"confirmation"`
+}
+
+// MetadataImport 导入请求，confirmation来自预览结果
+type MetadataImport struct {
+	Confirmation string `json:"confirmation" validate:"required"`
+}
+
+// buildMetadataPreview 查询外部数据并与已有电影合并，合并规则见mergeMetadata
+func buildMetadataPreview(ctx context.Context, provider metadata.MetadataProvider, imdbId string) (*MetadataPreview, error) {
+	md, err := provider.Lookup(ctx, imdbId)
+	if err != nil {
+		return nil, err
+	}
+
+	confirmation, err := metadataConfirmation(md)
+	if err != nil {
+		return nil, err
+	}
+	preview := &MetadataPreview{Metadata: md, Confirmation: confirmation}
+
+	var movie models.Movie
+	err = getMovieCollection().FindOne(ctx, bson.M{"imdb_id": imdbId}).Decode(&movie)
+	switch {
+	case err == nil:
+		preview.Exists = true
+	case errors.Is(err, mongo.ErrNoDocuments):
+		movie = models.Movie{ImdbID: imdbId}
+	default:
+		return nil, err
+	}
+
+	var genres []models.Genre
+	if len(md.Genres) > 0 {
+		cursor, err := getGenreCollection().Find(ctx, bson.M{})
+		if err != nil {
+			return nil, err
+		}
+		defer cursor.Close(ctx)
+		if err := cursor.All(ctx, &genres); err != nil {
+			return nil, err
+		}
+	}
+
+	preview.Movie, preview.UnknownGenres = mergeMetadata(movie, md, genres)
+	return preview, nil
+}
+
+// metadataConfirmation 外部数据的摘要，作为预览和导入之间的确认码
+func metadataConfirmation(md *metadata.MovieMetadata) (string, error) {
+	data, err := json.Marshal(md)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// mergeMetadata 把外部数据合并到电影：只覆盖外部数据中有值的字段，评论、评级、分级和授权规则保持不变。
+// 类型按genres集合中的名称对应，返回无法对应的类型
+func mergeMetadata(movie models.Movie, md *metadata.MovieMetadata, genres []models.Genre) (models.Movie, []string) {
+	if md.Title != "" {
+		movie.Title = md.Title
+	}
+	if md.ReleaseYear != 0 {
+		movie.ReleaseYear = md.ReleaseYear
+	}
+	if md.Runtime != 0 {
+		movie.Runtime = md.Runtime
+	}
+	if md.PosterURL != "" {
+		movie.PosterPath = md.PosterURL
+		movie.Images = appendImage(movie.Images, models.ImageTypePoster, md.PosterURL)
+	}
+	if md.BackdropURL != "" {
+		movie.Images = appendImage(movie.Images, models.ImageTypeBackdrop, md.BackdropURL)
+	}
+	if md.TrailerKey != "" {
+		movie.YouTubeID = md.TrailerKey
+		if !slices.ContainsFunc(movie.Videos, func(video models.MediaVideo) bool { return video.Key == md.TrailerKey }) {
+			movie.Videos = append(movie.Videos, models.MediaVideo{Type: models.VideoTypeTrailer, Site: "youtube", Key: md.TrailerKey})
+		}
+	}
+
+	matched, unknown := matchGenres(genres, md.Genres)
+	if len(matched) > 0 {
+		movie.Genre = matched
+	}
+	return movie, unknown
+}
+
+// appendImage 图片不在列表中时追加
+func appendImage(images []models.MediaImage, imageType, url string) []models.MediaImage {
+	if slices.ContainsFunc(images, func(image models.MediaImage) bool { return image.URL == url }) {
+		return images
+	}
+	return append(images, models.MediaImage{Type: imageType, URL: url})
+}
+
+// matchGenres 按名称（不区分大小写，包括各语言名称）把外部数据的类型对应到genres集合中的类型
+func matchGenres(all []models.Genre, names []string) ([]models.Genre, []string) {
+	var matched []models.Genre
+	var unknown []string
+	for _, name := range names {
+		index := slices.IndexFunc(all, func(genre models.Genre) bool {
+			if strings.EqualFold(genre.GenreName, name) {
+				return true
+			}
+			for _, localized := range genre.Names {
+				if strings.EqualFold(localized, name) {
+					return true
+				}
+			}
+			return false
+		})
+		if index < 0 {
+			unknown = append(unknown, name)
+			continue
+		}
+		if !slices.ContainsFunc(matched, func(genre models.Genre) bool { return genre.GenreID == all[index].GenreID }) {
+			matched = append(matched, all[index])
+		}
+	}
+	return matched, unknown
+}
+
+// respondMetadataError 把查询外部数据的错误转换为响应
+func respondMetadataError(c *gin.Context, err error) {
+	if errors.Is(err, metadata.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "metadata_not_found")})
+		return
+	}
+	utils.Warn("Metadata lookup failed", append(utils.ErrorFields(err), zap.String("imdb_id", c.Param("imdb_id")))...)
+	c.JSON(http.StatusBadGateway, gin.H{"error": i18n.Msg(c, "error_fetching_metadata")})
+}
+
+// metadataProviderFor 校验IMDb ID并获取元数据来源，不可用时写入响应并返回nil
+func metadataProviderFor(c *gin.Context) metadata.MetadataProvider {
+	if !metadata.ValidImdbID(c.Param("imdb_id")) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_imdb_id")})
+		return nil
+	}
+	provider := getMetadataProvider()
+	if provider == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": i18n.Msg(c, "metadata_provider_disabled")})
+		return nil
+	}
+	return provider
+}
+
+// PreviewMovieMetadata 管理员按IMDb ID从外部数据库查询电影，预览合并后的结果，不写入数据库
+func PreviewMovieMetadata() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provider := metadataProviderFor(c)
+		if provider == nil {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		preview, err := buildMetadataPreview(ctx, provider, c.Param("imdb_id"))
+		if err != nil {
+			respondMetadataError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, preview)
+	}
+}
+
+// ImportMovieMetadata 管理员确认预览后导入：电影不存在时创建，存在时只更新外部数据提供的字段
+func ImportMovieMetadata() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provider := metadataProviderFor(c)
+		if provider == nil {
+			return
+		}
+		imdbId := c.Param("imdb_id")
+
+		var req MetadataImport
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "detail": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		preview, err := buildMetadataPreview(ctx, provider, imdbId)
+		if err != nil {
+			respondMetadataError(c, err)
+			return
+		}
+		if preview.Confirmation != req.Confirmation {
+			c.JSON(http.StatusConflict, gin.H{"error": i18n.Msg(c, "metadata_changed"), "preview": preview})
+			return
+		}
+		movie := preview.Movie
+		if movie.Title == "" {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": i18n.Msg(c, "metadata_incomplete")})
+			return
+		}
+
+		unranked := models.Ranking{RankingValue: 999, RankingName: unrankedName}
+		if rankings, err := GetRankings(); err == nil {
+			for _, ranking := range rankings {
+				if ranking.RankingValue == 999 {
+					unranked = ranking
+				}
+			}
+		}
+
+		update := bson.M{
+			"$set": bson.M{
+				"title":        movie.Title,
+				"poster_path":  movie.PosterPath,
+				"youtube_id":   movie.YouTubeID,
+				"genre":        movie.Genre,
+				"release_year": movie.ReleaseYear,
+				"runtime":      movie.Runtime,
+				"images":       movie.Images,
+				"videos":       movie.Videos,
+			},
+			"$setOnInsert": bson.M{
+				"admin_review": "",
+				"ranking":      unranked,
+			},
+		}
+		if movie.Genre == nil {
+			update["$set"].(bson.M)["genre"] = []models.Genre{}
+		}
+
+		opts := options.UpdateOne().SetUpsert(true)
+		result, err := getMovieCollection().UpdateOne(ctx, bson.M{"imdb_id": imdbId}, update, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_importing_movie")})
+			return
+		}
+		getRecommendationCache().InvalidateAll()
+
+		actorId, _ := utils.GetUserIdFromContext(c)
+		utils.Info("Movie metadata imported",
+			zap.String("imdb_id", imdbId),
+			zap.String("source", provider.Name()),
+			zap.String("actor_id", actorId),
+			zap.Bool("created", result.UpsertedCount > 0),
+		)
+
+		status := http.StatusOK
+		if result.UpsertedCount > 0 {
+			status = http.StatusCreated
+		}
+		c.JSON(status, movie)
+	}
+}
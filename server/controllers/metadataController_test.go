@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/joey17520/magic-stream-app/metadata"
+	"github.com/joey17520/magic-stream-app/models"
+)
+
+// newFixtureProvider 使用仓库中的样例元数据
+func newFixtureProvider(t *testing.T) *metadata.FixtureProvider {
+	t.Helper()
+	provider, err := metadata.NewFixtureProvider("../fixtures/metadata")
+	if err != nil {
+		t.Fatalf("NewFixtureProvider: %v", err)
+	}
+	return provider
+}
+
+func TestFixtureLookup(t *testing.T) {
+	provider := newFixtureProvider(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		imdbId  string
+		wantErr error
+	}{
+		{name: "fixture exists", imdbId: "tt0111161"},
+		{name: "no fixture", imdbId: "tt0000001", wantErr: metadata.ErrNotFound},
+		{name: "path traversal", imdbId: "../tt0111161", wantErr: metadata.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md, err := provider.Lookup(ctx, tt.imdbId)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Lookup error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Lookup: %v", err)
+			}
+			if md.ImdbID != tt.imdbId || md.Source != metadata.DriverFixture || md.Title == "" {
+				t.Fatalf("Lookup = %+v, want fixture %s with a title", md, tt.imdbId)
+			}
+		})
+	}
+}
+
+func TestMetadataPreviewConfirmation(t *testing.T) {
+	md, err := newFixtureProvider(t).Lookup(context.Background(), "tt0111161")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+
+	confirmation, err := metadataConfirmation(md)
+	if err != nil {
+		t.Fatalf("metadataConfirmation: %v", err)
+	}
+
+	// 相同的数据再次预览得到相同的确认码，导入时可以通过校验
+	again := *md
+	if got, _ := metadataConfirmation(&again); got != confirmation {
+		t.Fatalf("confirmation changed for identical metadata: %s != %s", got, confirmation)
+	}
+
+	// 预览之后数据发生变化时确认码不同，导入会被拒绝
+	changes := map[string]func(*metadata.MovieMetadata){
+		"title":   func(m *metadata.MovieMetadata) { m.Title += " (Remastered)" },
+		"runtime": func(m *metadata.MovieMetadata) { m.Runtime++ },
+		"genres":  func(m *metadata.MovieMetadata) { m.Genres = append(m.Genres, "Thriller") },
+		"poster":  func(m *metadata.MovieMetadata) { m.PosterURL = "https://example.com/other.jpg" },
+	}
+	for name, change := range changes {
+		t.Run(name, func(t *testing.T) {
+			changed := *md
+			changed.Genres = append([]string(nil), md.Genres...)
+			change(&changed)
+			got, err := metadataConfirmation(&changed)
+			if err != nil {
+				t.Fatalf("metadataConfirmation: %v", err)
+			}
+			if got == confirmation {
+				t.Fatal("confirmation did not change with the metadata")
+			}
+		})
+	}
+}
+
+func TestMergeMetadata(t *testing.T) {
+	md, err := newFixtureProvider(t).Lookup(context.Background(), "tt0111161")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	genres := []models.Genre{
+		{GenreID: 1, GenreName: "Comedy"},
+		{GenreID: 2, GenreName: "drama"},
+		{GenreID: 3, GenreName: "Krimi", Names: map[string]string{"en": "Crime"}},
+	}
+
+	t.Run("new movie", func(t *testing.T) {
+		movie, unknown := mergeMetadata(models.Movie{ImdbID: md.ImdbID}, md, genres)
+
+		if movie.Title != md.Title || movie.ReleaseYear != md.ReleaseYear || movie.Runtime != md.Runtime {
+			t.Fatalf("merged movie = %+v, want title, year and runtime from metadata", movie)
+		}
+		if movie.PosterPath != md.PosterURL || movie.YouTubeID != md.TrailerKey {
+			t.Fatalf("poster/trailer = %q/%q, want %q/%q", movie.PosterPath, movie.YouTubeID, md.PosterURL, md.TrailerKey)
+		}
+		if len(movie.Images) != 2 || len(movie.Videos) != 1 {
+			t.Fatalf("images = %d, videos = %d, want 2 and 1", len(movie.Images), len(movie.Videos))
+		}
+		if len(movie.Genre) != 2 || movie.Genre[0].GenreID != 2 || movie.Genre[1].GenreID != 3 {
+			t.Fatalf("genres = %+v, want Drama and Crime matched by name", movie.Genre)
+		}
+		if len(unknown) != 0 {
+			t.Fatalf("unknown genres = %v, want none", unknown)
+		}
+	})
+
+	t.Run("existing movie keeps curated fields", func(t *testing.T) {
+		existing := models.Movie{
+			ImdbID:        md.ImdbID,
+			Title:         "Old title",
+			AdminReview:   "A classic.",
+			Ranking:       models.Ranking{RankingValue: 1, RankingName: "Excellent"},
+			Certification: models.CertificationPG,
+			Genre:         []models.Genre{{GenreID: 9, GenreName: "Classic"}},
+			Images:        []models.MediaImage{{Type: models.ImageTypePoster, URL: md.PosterURL}},
+		}
+
+		movie, unknown := mergeMetadata(existing, md, []models.Genre{{GenreID: 1, GenreName: "Comedy"}})
+
+		if movie.Title != md.Title {
+			t.Fatalf("title = %q, want %q", movie.Title, md.Title)
+		}
+		if movie.AdminReview != existing.AdminReview || movie.Ranking != existing.Ranking || movie.Certification != existing.Certification {
+			t.Fatalf("curated fields changed: %+v", movie)
+		}
+		// 没有能对应的类型时保留原有类型
+		if len(movie.Genre) != 1 || movie.Genre[0].GenreID != 9 {
+			t.Fatalf("genres = %+v, want existing genres kept", movie.Genre)
+		}
+		if len(unknown) != len(md.Genres) {
+			t.Fatalf("unknown genres = %v, want %v", unknown, md.Genres)
+		}
+		// 已有的海报不重复添加
+		if len(movie.Images) != 2 {
+			t.Fatalf("images = %+v, want existing poster plus backdrop", movie.Images)
+		}
+	})
+}
@@ -3,22 +3,30 @@ package controllers
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"github.com/joey17520/magic-stream-app/config"
 	"github.com/joey17520/magic-stream-app/database"
+	"github.com/joey17520/magic-stream-app/experiments"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/middlewares"
 	"github.com/joey17520/magic-stream-app/models"
+	"github.com/joey17520/magic-stream-app/recommendation"
 	"github.com/joey17520/magic-stream-app/utils"
 	"github.com/joho/godotenv"
 	"github.com/tmc/langchaingo/llms/openai"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
 )
 
 var (
@@ -56,8 +64,74 @@ func getGenreCollection() *mongo.Collection {
 	return genreCollection
 }
 
+var (
+	recommendationCache            *recommendation.Cache
+	recommendationCacheInitialized bool
+)
+
+// recommendationCacheKey 推荐缓存按档案区分，账户主档案直接使用用户ID
+func recommendationCacheKey(userId, profileId string) string {
+	if profileId == "" {
+		return userId
+	}
+	return userId + ":" + profileId
+}
+
+// getRecommendationCache 获取推荐结果缓存
+func getRecommendationCache() *recommendation.Cache {
+	if !recommendationCacheInitialized {
+		recommendationCache = recommendation.NewCache(config.GetConfig().RecommendationCacheTTL)
+		recommendationCacheInitialized = true
+	}
+	return recommendationCache
+}
+
 var validate = validator.New()
 
+// errInvalidYear 年份参数不是整数
+var errInvalidYear = errors.New("invalid year")
+
+// catalogFilter 根据查询参数生成电影目录的查询条件：q按原始标题和请求语言的标题搜索（不区分大小写），
+// year、year_from、year_to按上映年份过滤，person按演职人员过滤
+func catalogFilter(c *gin.Context) (bson.M, error) {
+	var conditions bson.A
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		pattern := bson.Regex{Pattern: regexp.QuoteMeta(q), Options: "i"}
+		titles := bson.A{bson.M{"title": pattern}}
+		for _, tag := range i18n.PreferencesFromContext(c) {
+			titles = append(titles, bson.M{"titles." + tag: pattern})
+		}
+		conditions = append(conditions, bson.M{"$or": titles})
+	}
+
+	years := bson.M{}
+	for param, operator := range map[string]string{"year": "$eq", "year_from": "$gte", "year_to": "$lte"} {
+		raw := c.Query(param)
+		if raw == "" {
+			continue
+		}
+		year, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, errInvalidYear
+		}
+		years[operator] = year
+	}
+	if len(years) > 0 {
+		conditions = append(conditions, bson.M{"release_year": years})
+	}
+
+	if personId := c.Query("person"); personId != "" {
+		conditions = append(conditions, personFilter(personId))
+	}
+
+	filter := bson.M{}
+	if len(conditions) > 0 {
+		filter["$and"] = conditions
+	}
+	return filter, nil
+}
+
+// GetMovies 获取电影目录，查询参数见catalogFilter；超出当前档案允许分级或在请求方地区不可观看的电影不会返回
 func GetMovies() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(10*time.Second))
@@ -65,20 +139,28 @@ func GetMovies() gin.HandlerFunc {
 
 		var movies []models.Movie
 
+		filter, err := catalogFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_year")})
+			return
+		}
+		restrictCertifications(c, filter, "certification")
+		restrictAvailability(c, filter, "availability")
+
 		collection := getMovieCollection()
-		cursor, err := collection.Find(ctx, bson.M{})
+		cursor, err := collection.Find(ctx, filter)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch movies."})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_movies")})
 			return
 		}
 		defer cursor.Close(ctx)
 
 		if err := cursor.All(ctx, &movies); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode movies."})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_decoding_movies")})
 			return
 		}
 
-		c.JSON(http.StatusOK, movies)
+		c.JSON(http.StatusOK, localizeMovies(c, movies))
 	}
 }
 
@@ -90,7 +172,7 @@ func GetMovie() gin.HandlerFunc {
 		movieID := c.Param("imdb_id")
 
 		if movieID == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Movie ID is required"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "movie_id_required")})
 			return
 		}
 		var movie models.Movie
@@ -98,11 +180,28 @@ func GetMovie() gin.HandlerFunc {
 		collection := getMovieCollection()
 		err := collection.FindOne(ctx, bson.M{"imdb_id": movieID}).Decode(&movie)
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Movie not found"})
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "movie_not_found")})
+			return
+		}
+
+		if !movieAvailableForRequest(c, movie) {
+			respondUnavailable(c)
+			return
+		}
+		if !utils.CertificationAllowed(movie.Certification, utils.GetMaxCertificationFromContext(c)) {
+			respondRestricted(c)
 			return
 		}
 
-		c.JSON(http.StatusOK, movie)
+		// 记录浏览事件，用于观看历史和热门榜单
+		if userId, err := utils.GetUserIdFromContext(c); err == nil {
+			if err := recordMovieEvent(ctx, userId, utils.GetProfileIdFromContext(c), movieID, models.MovieEventView, 0); err != nil {
+				utils.Warn("Failed to record movie view", utils.ErrorFields(err)...)
+			}
+		}
+		middlewares.RecordMovieViewed()
+
+		c.JSON(http.StatusOK, localizeMovie(c, movie))
 	}
 }
 
@@ -113,20 +212,36 @@ func AddMovie() gin.HandlerFunc {
 
 		var movie models.Movie
 		if err := c.ShouldBindJSON(&movie); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Input"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_input")})
 			return
 		}
+		utils.NormalizeAvailability(movie.Availability)
+		// 视频文件只能通过上传接口设置
+		movie.Video = nil
 		if err := validate.Struct(movie); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation Failed", "details": err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "details": err.Error()})
+			return
+		}
+		if err := validateAvailability(movie.Availability); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "details": err.Error()})
+			return
+		}
+		if err := verifyPeople(ctx, movie); err != nil {
+			if errors.Is(err, errUnknownPerson) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "unknown_person")})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_adding_movie")})
 			return
 		}
 
 		collection := getMovieCollection()
 		result, err := collection.InsertOne(ctx, movie)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add movie"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_adding_movie")})
 			return
 		}
+		getRecommendationCache().InvalidateAll()
 
 		c.JSON(http.StatusCreated, result)
 	}
@@ -136,18 +251,18 @@ func AdminReviewUpdate() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		role, err := utils.GetRoleFromContext(c)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Role not found in context"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "role_not_found")})
 			return
 		}
 
-		if role != "ADMIN" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User must be part of the Admin role"})
+		if role != models.RoleAdmin {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.Msg(c, "admin_required")})
 			return
 		}
 
 		movieId := c.Param("imdb_id")
 		if movieId == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Movie Id required"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "movie_id_required")})
 			return
 		}
 		var req struct {
@@ -159,12 +274,12 @@ func AdminReviewUpdate() gin.HandlerFunc {
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
 			return
 		}
 		sentiment, rankVal, err := GetReviewRanking(req.AdminReview)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting review ranking"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_getting_review_ranking")})
 			return
 		}
 
@@ -185,14 +300,17 @@ func AdminReviewUpdate() gin.HandlerFunc {
 		collection := getMovieCollection()
 		result, err := collection.UpdateOne(ctx, filter, update)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating movie"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_updating_movie")})
 			return
 		}
 
 		if result.MatchedCount == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Movie not found"})
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "movie_not_found")})
 			return
 		}
+		// 评级变化会影响推荐排序
+		getRecommendationCache().InvalidateAll()
+
 		resp.RankingName = sentiment
 		resp.AdminReview = req.AdminReview
 
@@ -280,59 +398,160 @@ func GetRecommendedMovies() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userId, err := utils.GetUserIdFromContext(c)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
 			return
 		}
 
-		favoriteGenres, err := GetUsersFavoriteGenres(userId)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		err = godotenv.Load()
-		if err != nil {
-			utils.Warn("Unable to load .env file", utils.ErrorFields(err)...)
+		var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		// 参与实验的用户按分组使用对应的推荐策略
+		strategyName := recommendation.DefaultStrategy
+		experiment, tracker := getActiveExperiment()
+		var variant experiments.Variant
+		if experiment != nil {
+			variant = experiment.Assign(userId)
+			strategyName = variant.Strategy
+			c.Header("X-Experiment-Variant", experiment.Name+"/"+variant.Name)
 		}
-		var recommendedMovieLimitVal int64 = 5
-		recommendedMovieLimitStr := os.Getenv("RECOMMENDED_MOVIE_LIMIT")
 
-		if recommendedMovieLimitStr != "" {
-			recommendedMovieLimitVal, _ = strconv.ParseInt(recommendedMovieLimitStr, 10, 64)
+		// 分组由用户ID确定，推荐内容按档案区分，因此缓存键由用户ID和档案ID组成；
+		// 修改家长控制或档案的分级限制时会使对应档案的缓存失效，用PIN临时解除限制的请求不读写缓存
+		profile := utils.GetProfileFromContext(c)
+		profileId := utils.GetProfileIdFromContext(c)
+		maxCertification := utils.GetMaxCertificationFromContext(c)
+		region := requestRegion(c)
+		override := c.GetBool("parentalOverride")
+		cacheKey := recommendationCacheKey(userId, profileId)
+		cache := getRecommendationCache()
+
+		var candidates recommendation.Candidates
+		hit := false
+		if !override {
+			candidates, hit = cache.Get(cacheKey)
+		}
+		if hit {
+			middlewares.RecordRecommendationCacheHit()
+
+			// 播放不会使缓存失效，读取时去掉候选集计算之后才播放的电影
+			if config.GetConfig().RecommendationExcludeSeen {
+				played, err := getMoviesPlayedSince(ctx, userId, profileId, candidates.BuiltAt)
+				if err != nil {
+					utils.Warn("Failed to fetch recently played movies", utils.ErrorFields(err)...)
+				}
+				candidates = candidates.Without(played)
+			}
+		} else {
+			middlewares.RecordRecommendationCacheMiss()
+
+			version := cache.Version(cacheKey)
+			candidates, err = buildRecommendationCandidates(ctx, userId, profile, maxCertification)
+			if err != nil {
+				utils.Error("Failed to build recommendations", append(utils.ErrorFields(err), zap.String("user_id", userId))...)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_recommendations")})
+				return
+			}
+			if !override {
+				cache.Set(cacheKey, candidates, version)
+			}
+			middlewares.RecordRecommendationGenerated()
 		}
 
-		findOptions := options.Find()
-		findOptions.SetSort(bson.D{{Key: "ranking.ranking_value", Value: 1}})
-		findOptions.SetLimit(recommendedMovieLimitVal)
-		filter := bson.M{"genre.genre_name": bson.M{"$in": favoriteGenres}}
+		// 缓存的候选集不区分地区，且授权规则随时间变化，每次请求按当前地区和时间过滤后再挑选
+		recommendedMovies := selectRecommendations(candidates, region, time.Now(), strategyName)
 
-		var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
+		if experiment != nil {
+			movieIds := make([]string, 0, len(recommendedMovies))
+			for _, movie := range recommendedMovies {
+				movieIds = append(movieIds, movie.ImdbID)
+			}
+			if err := tracker.RecordExposure(ctx, experiment.Name, variant.Name, userId, movieIds); err != nil {
+				utils.Warn("Failed to record experiment exposure", utils.ErrorFields(err)...)
+			} else {
+				middlewares.RecordExperimentExposure(experiment.Name, variant.Name)
+			}
+		}
 
-		collection := getMovieCollection()
-		cursor, err := collection.Find(ctx, filter, findOptions)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching recommended movies"})
-			return
+		c.JSON(http.StatusOK, localizeMovies(c, recommendedMovies))
+	}
+}
+
+// selectRecommendations 从候选集中去掉在region和at不能观看的电影，再按策略挑选最终结果
+func selectRecommendations(candidates recommendation.Candidates, region string, at time.Time, strategyName string) []models.Movie {
+	available := make([]models.Movie, 0, len(candidates.Movies))
+	for _, movie := range candidates.Movies {
+		if utils.MovieAvailable(movie.Availability, region, at) {
+			available = append(available, movie)
 		}
-		defer cursor.Close(ctx)
+	}
 
-		var recommendedMovies []models.Movie
-		if err := cursor.All(ctx, &recommendedMovies); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+	cfg := config.GetConfig()
+	strategy, _ := recommendation.GetStrategy(strategyName)
+	return strategy(available, candidates.FavoriteGenres, recommendation.Options{
+		Limit:         cfg.RecommendedMovieLimit,
+		MaxGenreShare: cfg.RecommendationMaxGenreShare,
+		Lambda:        cfg.RecommendationMMRLambda,
+	})
+}
+
+// buildRecommendationCandidates 根据档案喜爱的类型和反馈取出推荐候选集，profile为nil时使用账户主档案；
+// maxCertification不为空时只包含不超过该分级的电影。候选集只排除在任何地区都不能观看的电影，可以在各地区共用
+func buildRecommendationCandidates(ctx context.Context, userId string, profile *models.HouseholdProfile, maxCertification string) (recommendation.Candidates, error) {
+	var favoriteGenres []string
+	profileId := ""
+	if profile != nil {
+		profileId = profile.ProfileID
+		for _, genre := range profile.FavoriteGenres {
+			favoriteGenres = append(favoriteGenres, genre.GenreName)
 		}
+	} else {
+		var err error
+		if favoriteGenres, err = GetUsersFavoriteGenres(userId); err != nil {
+			return recommendation.Candidates{}, err
+		}
+	}
+
+	cfg := config.GetConfig()
 
-		c.JSON(http.StatusOK, recommendedMovies)
+	// 在查询排除列表之前记录时间，之后发生的播放由读取缓存时的过滤处理
+	builtAt := time.Now()
+	excludedMovieIds, err := getExcludedMovieIds(ctx, userId, profileId, cfg.RecommendationExcludeSeen)
+	if err != nil {
+		return recommendation.Candidates{}, fmt.Errorf("fetching user feedback: %w", err)
 	}
+
+	// 先取出较大的候选集，再按策略挑选最终结果
+	findOptions := options.Find()
+	findOptions.SetSort(bson.D{{Key: "ranking.ranking_value", Value: 1}})
+	findOptions.SetLimit(int64(cfg.RecommendationCandidatePool))
+	filter := bson.M{"genre.genre_name": bson.M{"$in": favoriteGenres}}
+	if len(excludedMovieIds) > 0 {
+		filter["imdb_id"] = bson.M{"$nin": excludedMovieIds}
+	}
+	if allowed := utils.AllowedCertifications(maxCertification); allowed != nil {
+		filter["certification"] = bson.M{"$in": allowed}
+	}
+	addAnyRegionAvailabilityFilter(filter, "availability", time.Now())
+
+	collection := getMovieCollection()
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return recommendation.Candidates{}, fmt.Errorf("fetching recommended movies: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var movies []models.Movie
+	if err := cursor.All(ctx, &movies); err != nil {
+		return recommendation.Candidates{}, err
+	}
+
+	return recommendation.Candidates{Movies: movies, FavoriteGenres: favoriteGenres, BuiltAt: builtAt}, nil
 }
 
 func GetUsersFavoriteGenres(userId string) ([]string, error) {
 	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	// 直接打开用户集合
-	userCollection := database.OpenCollection("users")
-
 	filter := bson.M{"user_id": userId}
 
 	projection := bson.M{
@@ -343,7 +562,7 @@ func GetUsersFavoriteGenres(userId string) ([]string, error) {
 	opts := options.FindOne().SetProjection(projection)
 
 	var result bson.M
-	err := userCollection.FindOne(ctx, filter, opts).Decode(&result)
+	err := getUserCollection().FindOne(ctx, filter, opts).Decode(&result)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return []string{}, err
@@ -383,16 +602,16 @@ func GetGenres() gin.HandlerFunc {
 		collection := getGenreCollection()
 		cursor, err := collection.Find(ctx, bson.M{})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching movie genres"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_genres")})
 			return
 		}
 		defer cursor.Close(ctx)
 
 		if err := cursor.All(ctx, &genres); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_genres")})
 			return
 		}
 
-		c.JSON(http.StatusOK, genres)
+		c.JSON(http.StatusOK, localizeGenres(c, genres))
 	}
 }
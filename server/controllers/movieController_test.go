@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// catalogContext 构造带有查询参数和Accept-Language的请求上下文
+func catalogContext(query, acceptLanguage string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/movies?"+query, nil)
+	if acceptLanguage != "" {
+		c.Request.Header.Set("Accept-Language", acceptLanguage)
+	}
+	return c
+}
+
+func TestCatalogFilterWithoutParameters(t *testing.T) {
+	filter, err := catalogFilter(catalogContext("", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filter) != 0 {
+		t.Fatalf("filter = %v, want an empty filter", filter)
+	}
+}
+
+func TestCatalogFilterYears(t *testing.T) {
+	filter, err := catalogFilter(catalogContext("year_from=1990&year_to=1999", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conditions := filter["$and"].(bson.A)
+	if len(conditions) != 1 {
+		t.Fatalf("conditions = %v, want only the year range", conditions)
+	}
+	years := conditions[0].(bson.M)["release_year"].(bson.M)
+	if years["$gte"] != 1990 || years["$lte"] != 1999 || years["$eq"] != nil {
+		t.Fatalf("release_year = %v", years)
+	}
+
+	for _, query := range []string{"year=nineties", "year_from=1990.5", "year_to=-"} {
+		if _, err := catalogFilter(catalogContext(query, "")); !errors.Is(err, errInvalidYear) {
+			t.Errorf("?%s: err = %v, want errInvalidYear", query, err)
+		}
+	}
+
+	// 空值视为未提供
+	if filter, err := catalogFilter(catalogContext("year=", "")); err != nil || len(filter) != 0 {
+		t.Errorf("?year=: filter = %v, err = %v", filter, err)
+	}
+}
+
+func TestCatalogFilterCombinesConditions(t *testing.T) {
+	filter, err := catalogFilter(catalogContext("q=a.b&year=2001&person=p-1", "zh-CN, en;q=0.5"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conditions := filter["$and"].(bson.A)
+	if len(conditions) != 3 {
+		t.Fatalf("conditions = %v, want title, year and person", conditions)
+	}
+
+	titles := conditions[0].(bson.M)["$or"].(bson.A)
+	if len(titles) != 3 {
+		t.Fatalf("title conditions = %v, want the original title plus zh-CN and en", titles)
+	}
+	pattern := titles[1].(bson.M)["titles.zh-CN"].(bson.Regex)
+	// 搜索词中的正则元字符按字面匹配
+	if pattern.Pattern != `a\.b` || pattern.Options != "i" {
+		t.Fatalf("pattern = %+v", pattern)
+	}
+
+	if got := conditions[2].(bson.M); len(got["$or"].(bson.A)) != 2 {
+		t.Fatalf("person condition = %v, want cast or crew", got)
+	}
+}
+
+func TestVerifyPeopleWithoutCredits(t *testing.T) {
+	// 没有演职人员时不需要查询people集合
+	if err := verifyPeople(context.Background(), models.Movie{}); err != nil {
+		t.Fatalf("verifyPeople = %v", err)
+	}
+}
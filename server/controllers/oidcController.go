@@ -0,0 +1,326 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/config"
+	"github.com/joey17520/magic-stream-app/database"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/middlewares"
+	"github.com/joey17520/magic-stream-app/models"
+	"github.com/joey17520/magic-stream-app/oidc"
+	"github.com/joey17520/magic-stream-app/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+)
+
+// oauthStateTTL 从跳转到身份提供方到回调的最长时间
+const oauthStateTTL = 10 * time.Minute
+
+// errIdentityEmailNotVerified 身份提供方没有提供已验证的邮箱，无法关联或创建账户
+var errIdentityEmailNotVerified = errors.New("identity provider did not return a verified email")
+
+// errLocalEmailNotVerified 同一邮箱的本地账户尚未验证邮箱，不能自动关联外部身份
+var errLocalEmailNotVerified = errors.New("local account email is not verified")
+
+var (
+	oauthStateCollection *mongo.Collection
+	oidcRegistry         *oidc.Registry
+	oidcInitialized      bool
+)
+
+// initOIDC 延迟初始化OIDC登录状态集合和身份提供方注册表
+func initOIDC() {
+	if !oidcInitialized {
+		oauthStateCollection = database.OpenCollection("oauth_states")
+
+		cfg := config.GetConfig()
+		providers := make([]oidc.Config, 0, len(cfg.OIDCProviders))
+		for _, provider := range cfg.OIDCProviders {
+			providers = append(providers, oidc.Config{
+				Name:         provider.Name,
+				Issuer:       provider.Issuer,
+				ClientID:     provider.ClientID,
+				ClientSecret: provider.ClientSecret,
+				RedirectURL:  cfg.APIBaseURL + "/auth/" + provider.Name + "/callback",
+				Scopes:       provider.Scopes,
+			})
+		}
+		oidcRegistry = oidc.NewRegistry(providers)
+
+		oidcInitialized = true
+	}
+}
+
+// getOAuthStateCollection 获取OIDC登录状态集合
+func getOAuthStateCollection() *mongo.Collection {
+	initOIDC()
+	return oauthStateCollection
+}
+
+// getOIDCRegistry 获取身份提供方注册表
+func getOIDCRegistry() *oidc.Registry {
+	initOIDC()
+	return oidcRegistry
+}
+
+// OIDCLogin 跳转到外部身份提供方登录（授权码模式 + PKCE），可通过device查询参数指定设备名称
+func OIDCLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		provider, err := getOIDCRegistry().Get(ctx, c.Param("provider"))
+		if err != nil {
+			if errors.Is(err, oidc.ErrUnknownProvider) {
+				c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "unknown_identity_provider")})
+				return
+			}
+			utils.Error("OIDC discovery failed", append(utils.ErrorFields(err), zap.String("provider", c.Param("provider")))...)
+			c.JSON(http.StatusBadGateway, gin.H{"error": i18n.Msg(c, "identity_provider_unavailable")})
+			return
+		}
+
+		state, err := oidc.RandomString()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_starting_login")})
+			return
+		}
+		nonce, err := oidc.RandomString()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_starting_login")})
+			return
+		}
+		verifier, challenge, err := oidc.NewPKCE()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_starting_login")})
+			return
+		}
+
+		now := time.Now()
+		_, err = getOAuthStateCollection().InsertOne(ctx, models.OAuthState{
+			StateHash:    utils.HashOpaqueToken(state),
+			Provider:     provider.Name(),
+			Nonce:        nonce,
+			CodeVerifier: verifier,
+			Device:       c.Query("device"),
+			ExpiresAt:    now.Add(oauthStateTTL),
+			CreatedAt:    now,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_starting_login")})
+			return
+		}
+
+		c.Redirect(http.StatusFound, provider.AuthCodeURL(state, nonce, challenge))
+	}
+}
+
+// OIDCCallback 身份提供方回调：校验state、用授权码换取并校验ID令牌，关联或创建账户后登录，
+// 最后跳转回前端；需要两步验证时把挑战令牌放在URL片段中交给前端完成第二步
+func OIDCCallback() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		providerName := c.Param("provider")
+
+		if errCode := c.Query("error"); errCode != "" {
+			utils.Warn("OIDC provider returned an error",
+				zap.String("provider", providerName),
+				zap.String("error", errCode),
+				zap.String("description", c.Query("error_description")),
+			)
+			redirectLoginFailure(c, "oidc_denied")
+			return
+		}
+
+		state, code := c.Query("state"), c.Query("code")
+		if state == "" || code == "" {
+			redirectLoginFailure(c, "oidc_invalid_request")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+
+		// state只能使用一次
+		var loginState models.OAuthState
+		err := getOAuthStateCollection().FindOneAndDelete(ctx, bson.M{
+			"state_hash": utils.HashOpaqueToken(state),
+			"provider":   providerName,
+			"expires_at": bson.M{"$gt": time.Now()},
+		}).Decode(&loginState)
+		if err != nil {
+			redirectLoginFailure(c, "oidc_invalid_state")
+			return
+		}
+
+		provider, err := getOIDCRegistry().Get(ctx, providerName)
+		if err != nil {
+			redirectLoginFailure(c, "oidc_unavailable")
+			return
+		}
+
+		token, err := provider.Exchange(ctx, code, loginState.CodeVerifier)
+		if err != nil {
+			utils.Warn("OIDC code exchange failed", append(utils.ErrorFields(err), zap.String("provider", providerName))...)
+			redirectLoginFailure(c, "oidc_exchange_failed")
+			return
+		}
+
+		claims, err := provider.VerifyIDToken(ctx, token.IDToken, loginState.Nonce)
+		if err != nil {
+			utils.Warn("OIDC id token rejected", append(utils.ErrorFields(err), zap.String("provider", providerName))...)
+			redirectLoginFailure(c, "oidc_invalid_token")
+			return
+		}
+
+		// 部分提供方只在userinfo中返回邮箱
+		if claims.Email == "" && token.AccessToken != "" {
+			if info, err := provider.UserInfo(ctx, token.AccessToken); err == nil && info.Subject == claims.Subject {
+				claims.Email, claims.EmailVerified = info.Email, info.EmailVerified
+				claims.GivenName, claims.FamilyName, claims.Name = info.GivenName, info.FamilyName, info.Name
+			}
+		}
+
+		user, err := findOrLinkUser(ctx, c, providerName, claims)
+		if err != nil {
+			if errors.Is(err, errIdentityEmailNotVerified) {
+				redirectLoginFailure(c, "oidc_email_not_verified")
+				return
+			}
+			if errors.Is(err, errLocalEmailNotVerified) {
+				redirectLoginFailure(c, "oidc_account_not_verified")
+				return
+			}
+			utils.Error("Failed to link external identity", append(utils.ErrorFields(err), zap.String("provider", providerName))...)
+			redirectLoginFailure(c, "oidc_link_failed")
+			return
+		}
+
+		appBaseURL := config.GetConfig().AppBaseURL
+
+		if user.TwoFactorEnabled {
+			challenge, err := utils.GenerateChallengeToken(user.Email, user.UserID, config.GetConfig().TwoFactorChallengeTTL)
+			if err != nil {
+				redirectLoginFailure(c, "oidc_login_failed")
+				return
+			}
+			c.Redirect(http.StatusFound, appBaseURL+"/login/2fa#challenge_token="+url.QueryEscape(challenge))
+			return
+		}
+
+		if _, err := startLoginSession(c, *user, loginState.Device); err != nil {
+			redirectLoginFailure(c, "oidc_login_failed")
+			return
+		}
+
+		c.Redirect(http.StatusFound, appBaseURL+"/")
+	}
+}
+
+// findOrLinkUser 按外部身份查找用户；首次登录时按已验证的邮箱关联已有账户，没有账户则创建新用户。
+// 本地账户的邮箱未验证时拒绝关联：注册时可以填写任意邮箱，自动关联会让抢注者和邮箱主人共用同一个账户
+func findOrLinkUser(ctx context.Context, c *gin.Context, provider string, claims *oidc.Claims) (*models.User, error) {
+	var user models.User
+	err := getUserCollection().FindOne(ctx, bson.M{
+		"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": claims.Subject}},
+	}).Decode(&user)
+	if err == nil {
+		return &user, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	// 只有身份提供方确认过的邮箱才能用于关联，否则任何人都可以用别人的邮箱接管账户
+	if claims.Email == "" || !claims.IsEmailVerified() {
+		return nil, errIdentityEmailNotVerified
+	}
+	email := utils.NormalizeEmail(claims.Email)
+
+	now := time.Now()
+	identity := models.ExternalIdentity{
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    email,
+		LinkedAt: now,
+	}
+
+	filter := utils.EmailFilter(email)
+	filter["email_verified"] = true
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = getUserCollection().FindOneAndUpdate(ctx,
+		filter,
+		bson.M{
+			"$push": bson.M{"identities": identity},
+			"$set":  bson.M{"updated_at": now},
+		},
+		opts,
+	).Decode(&user)
+	if err == nil {
+		utils.RecordAudit(models.AuditLog{
+			Action:    models.AuditActionIdentityLinked,
+			UserID:    user.UserID,
+			Email:     user.Email,
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			Details:   map[string]any{"provider": provider},
+		})
+		return &user, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	// 有同一邮箱但未验证的本地账户时不创建新账户，避免同一邮箱出现两个账户
+	count, err := getUserCollection().CountDocuments(ctx, utils.EmailFilter(email))
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, errLocalEmailNotVerified
+	}
+
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" && lastName == "" {
+		firstName, lastName, _ = strings.Cut(strings.TrimSpace(claims.Name), " ")
+	}
+	if firstName == "" {
+		firstName, _, _ = strings.Cut(email, "@")
+	}
+
+	// 外部账户没有本地密码，需要时可以通过忘记密码流程设置
+	user = models.User{
+		UserID:          bson.NewObjectID().Hex(),
+		FirstName:       firstName,
+		LastName:        lastName,
+		Email:           email,
+		EmailVerified:   true,
+		EmailVerifiedAt: &now,
+		Role:            models.RoleUser,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		FavoriteGenres:  []models.Genre{},
+		Identities:      []models.ExternalIdentity{identity},
+	}
+	if _, err := getUserCollection().InsertOne(ctx, user); err != nil {
+		return nil, err
+	}
+
+	middlewares.RecordUserRegistered()
+	utils.Info("User registered via identity provider", zap.String("user_id", user.UserID), zap.String("provider", provider))
+
+	return &user, nil
+}
+
+// redirectLoginFailure 跳转回前端登录页并带上错误码
+func redirectLoginFailure(c *gin.Context, reason string) {
+	c.Redirect(http.StatusFound, config.GetConfig().AppBaseURL+"/login?error="+url.QueryEscape(reason))
+}
@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/models"
+	"github.com/joey17520/magic-stream-app/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// restrictCertifications 按当前请求允许的最高分级给查询条件加上分级过滤，field为电影分级字段的路径
+func restrictCertifications(c *gin.Context, filter bson.M, field string) bson.M {
+	if allowed := utils.AllowedCertifications(utils.GetMaxCertificationFromContext(c)); allowed != nil {
+		filter[field] = bson.M{"$in": allowed}
+	}
+	return filter
+}
+
+// respondRestricted 电影超出当前档案允许的分级，客户端可以提示输入家长控制PIN后重试
+func respondRestricted(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":                 i18n.Msg(c, "title_restricted"),
+		"parental_pin_required": true,
+	})
+}
+
+// loosensRestriction 判断从current切换到target是否会放宽分级限制，空字符串表示不限制
+func loosensRestriction(current, target string) bool {
+	if current == "" {
+		return false
+	}
+	if target == "" {
+		return true
+	}
+	return slices.Index(models.Certifications, target) > slices.Index(models.Certifications, current)
+}
+
+// checkParentalPIN 放宽家长控制的操作需要在请求头中提供PIN；账户没有设置PIN或本次请求已通过PIN校验时直接放行。
+// 校验失败时写入响应并返回false
+func checkParentalPIN(c *gin.Context, user models.User) bool {
+	if c.GetBool("parentalOverride") || user.ParentalControls == nil || user.ParentalControls.PINHash == "" {
+		return true
+	}
+
+	pin := c.GetHeader(utils.ParentalPINHeader)
+	if pin == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": i18n.Msg(c, "parental_pin_required"), "parental_pin_required": true})
+		return false
+	}
+
+	return verifyParentalPIN(c, user.UserID, pin)
+}
+
+// verifyParentalPIN 校验PIN并把错误转换为响应
+func verifyParentalPIN(c *gin.Context, userId, pin string) bool {
+	if err := utils.VerifyParentalPIN(userId, pin); err != nil {
+		switch {
+		case errors.Is(err, utils.ErrParentalPINLocked):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": i18n.Msg(c, "parental_pin_locked")})
+		case errors.Is(err, utils.ErrParentalPINInvalid):
+			c.JSON(http.StatusForbidden, gin.H{"error": i18n.Msg(c, "parental_pin_incorrect"), "parental_pin_required": true})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_checking_parental_pin")})
+		}
+		return false
+	}
+	return true
+}
+
+// GetParentalControls 获取账户的家长控制设置
+func GetParentalControls() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := getUserCollection().FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "user_not_found")})
+			return
+		}
+
+		controls := models.ParentalControls{}
+		if user.ParentalControls != nil {
+			controls = *user.ParentalControls
+			controls.PINSet = controls.PINHash != ""
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"parental_controls":         controls,
+			"current_max_certification": utils.GetMaxCertificationFromContext(c),
+		})
+	}
+}
+
+// UpdateParentalControls 修改账户主档案允许的最高分级和家长控制PIN，已设置PIN时需要提供当前PIN
+func UpdateParentalControls() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+
+		var req models.ParentalControlsUpdate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "detail": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := getUserCollection().FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "user_not_found")})
+			return
+		}
+
+		// 受限档案不能修改账户的家长控制设置，否则可以绕过自己的限制
+		if utils.GetProfileFromContext(c) != nil && utils.GetMaxCertificationFromContext(c) != "" && !c.GetBool("parentalOverride") {
+			c.JSON(http.StatusForbidden, gin.H{"error": i18n.Msg(c, "parental_controls_locked_in_profile")})
+			return
+		}
+
+		if user.ParentalControls != nil && user.ParentalControls.PINHash != "" {
+			if req.CurrentPIN == "" {
+				c.JSON(http.StatusForbidden, gin.H{"error": i18n.Msg(c, "current_parental_pin_required"), "parental_pin_required": true})
+				return
+			}
+			if !verifyParentalPIN(c, userId, req.CurrentPIN) {
+				return
+			}
+		} else if req.MaxCertification != nil && *req.MaxCertification != "" && req.PIN == nil {
+			// 没有PIN的限制随时可以被解除，启用限制时必须同时设置PIN
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "parental_pin_required_to_enable")})
+			return
+		}
+
+		set := bson.M{"updated_at": time.Now()}
+		if req.MaxCertification != nil {
+			set["parental_controls.max_certification"] = *req.MaxCertification
+		}
+		if req.PIN != nil {
+			hash, err := utils.HashParentalPIN(*req.PIN)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_saving_pin")})
+				return
+			}
+			set["parental_controls.pin_hash"] = hash
+			set["parental_controls.pin_failures"] = 0
+		}
+
+		if _, err := getUserCollection().UpdateOne(ctx, bson.M{"user_id": userId}, bson.M{"$set": set}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_updating_parental_controls")})
+			return
+		}
+
+		if req.MaxCertification != nil {
+			getRecommendationCache().Invalidate(recommendationCacheKey(userId, ""))
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": i18n.Msg(c, "parental_controls_updated")})
+	}
+}
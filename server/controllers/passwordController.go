@@ -0,0 +1,321 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/config"
+	"github.com/joey17520/magic-stream-app/database"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/mailer"
+	"github.com/joey17520/magic-stream-app/models"
+	"github.com/joey17520/magic-stream-app/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	userTokenCollection           *mongo.Collection
+	appMailer                     mailer.Mailer
+	accountCollectionsInitialized bool
+)
+
+// initAccountCollections 延迟初始化一次性令牌集合
+func initAccountCollections() {
+	if !accountCollectionsInitialized {
+		userTokenCollection = database.OpenCollection("user_tokens")
+		accountCollectionsInitialized = true
+	}
+}
+
+// SetMailer 设置邮件发送器，由main在启动时根据配置创建，配置有误时在启动阶段就退出
+func SetMailer(m mailer.Mailer) {
+	appMailer = m
+}
+
+// getUserTokenCollection 获取一次性令牌集合
+func getUserTokenCollection() *mongo.Collection {
+	initAccountCollections()
+	return userTokenCollection
+}
+
+// getMailer 获取邮件发送器
+func getMailer() mailer.Mailer {
+	return appMailer
+}
+
+// issueUserToken 为用户签发指定用途的一次性令牌，返回发给用户的原始令牌
+func issueUserToken(ctx context.Context, userId, purpose string, ttl time.Duration) (string, error) {
+	raw, hash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	_, err = getUserTokenCollection().InsertOne(ctx, models.UserToken{
+		TokenHash: hash,
+		UserID:    userId,
+		Purpose:   purpose,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return raw, nil
+}
+
+// consumeUserToken 校验并原子地标记一次性令牌为已使用，令牌无效、过期或已使用时返回mongo.ErrNoDocuments
+func consumeUserToken(ctx context.Context, raw, purpose string) (*models.UserToken, error) {
+	now := time.Now()
+	filter := bson.M{
+		"token_hash": utils.HashOpaqueToken(raw),
+		"purpose":    purpose,
+		"used_at":    nil,
+		"expires_at": bson.M{"$gt": now},
+	}
+
+	var token models.UserToken
+	err := getUserTokenCollection().FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"used_at": now}}).Decode(&token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// expireUserTokens 使用户某一用途下所有未使用的令牌失效
+func expireUserTokens(ctx context.Context, userId, purpose string) error {
+	now := time.Now()
+	_, err := getUserTokenCollection().UpdateMany(ctx,
+		bson.M{"user_id": userId, "purpose": purpose, "used_at": nil, "expires_at": bson.M{"$gt": now}},
+		bson.M{"$set": bson.M{"used_at": now}},
+	)
+	return err
+}
+
+// userTokenCooldown 返回距离用户可以再次获取指定用途令牌还需等待的时间，interval内签发过令牌时大于0
+func userTokenCooldown(ctx context.Context, userId, purpose string, interval time.Duration) (time.Duration, error) {
+	var latest models.UserToken
+	opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	err := getUserTokenCollection().FindOne(ctx, bson.M{"user_id": userId, "purpose": purpose}, opts).Decode(&latest)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return max(interval-time.Since(latest.CreatedAt), 0), nil
+}
+
+// setUserPassword 更新用户密码并撤销所有会话
+func setUserPassword(ctx context.Context, userId, newPassword string) error {
+	hashedPassword, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	_, err = getUserCollection().UpdateOne(ctx,
+		bson.M{"user_id": userId},
+		bson.M{"$set": bson.M{"password": hashedPassword, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+
+	return utils.RevokeAllSessions(userId, "")
+}
+
+// ChangePassword 已登录用户修改密码，需要提供当前密码；成功后所有会话失效，需要重新登录
+func ChangePassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+
+		var req models.PasswordChange
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "detail": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := getUserCollection().FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "user_not_found")})
+			return
+		}
+
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.Msg(c, "current_password_incorrect")})
+			return
+		}
+
+		if err := setUserPassword(ctx, userId, req.NewPassword); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_updating_password")})
+			return
+		}
+
+		err = getMailer().Send(ctx, mailer.Message{
+			To:      user.Email,
+			Subject: "Your MagicStream password was changed",
+			Body:    "Hi " + user.FirstName + ",\n\nThe password for your MagicStream account was just changed and all devices were signed out.\nIf this wasn't you, reset your password immediately.",
+		})
+		if err != nil {
+			utils.Warn("Failed to send password changed notification", utils.ErrorFields(err)...)
+		}
+
+		clearAuthCookies(c)
+
+		c.JSON(http.StatusOK, gin.H{"message": i18n.Msg(c, "password_changed")})
+	}
+}
+
+// ForgotPassword 发送密码重置邮件。无论邮箱是否存在都返回相同的响应，避免泄露账户是否存在；
+// 查找用户、签发令牌和发送邮件都在响应之后进行，响应时间也不会因账户是否存在而不同
+func ForgotPassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.PasswordForgot
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "detail": err.Error()})
+			return
+		}
+
+		if !runInBackground(accountEmailSlots, func() { sendPasswordResetEmail(req.Email) }) {
+			utils.Warn("Too many pending account emails, password reset dropped")
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": i18n.Msg(c, "password_reset_email_sent")})
+	}
+}
+
+// accountEmailTimeout 后台发送一封账户邮件（包括查找用户和签发令牌）允许的最长时间
+const accountEmailTimeout = 30 * time.Second
+
+// accountEmailSlots 限制同时在后台发送的账户邮件（密码重置、邮箱验证）数量，避免大量请求堆积goroutine和数据库连接
+var accountEmailSlots = make(chan struct{}, 16)
+
+// runInBackground 有空闲名额时在新的goroutine中运行fn，结束后归还名额；没有名额时不运行并返回false
+func runInBackground(slots chan struct{}, fn func()) bool {
+	select {
+	case slots <- struct{}{}:
+	default:
+		return false
+	}
+	go func() {
+		defer func() { <-slots }()
+		fn()
+	}()
+	return true
+}
+
+// sendPasswordResetEmail 邮箱已注册时签发新的重置令牌并发送邮件，在后台运行，错误只记录日志
+func sendPasswordResetEmail(email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), accountEmailTimeout)
+	defer cancel()
+
+	var user models.User
+	err := getUserCollection().FindOne(ctx, utils.EmailFilter(email)).Decode(&user)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			utils.Error("Failed to look up user for password reset", utils.ErrorFields(err)...)
+		}
+		return
+	}
+
+	cfg := config.GetConfig()
+
+	// 冷却时间内已经发送过重置邮件则不再发送；请求早已返回相同的响应，这里只是跳过
+	wait, err := userTokenCooldown(ctx, user.UserID, models.TokenPurposePasswordReset, cfg.PasswordResetResendInterval)
+	if err != nil {
+		utils.Error("Failed to check password reset cooldown", append(utils.ErrorFields(err), zap.String("user_id", user.UserID))...)
+		return
+	}
+	if wait > 0 {
+		return
+	}
+
+	// 同一时间只保留最新的重置令牌
+	if err := expireUserTokens(ctx, user.UserID, models.TokenPurposePasswordReset); err != nil {
+		utils.Error("Failed to expire password reset tokens", append(utils.ErrorFields(err), zap.String("user_id", user.UserID))...)
+		return
+	}
+
+	token, err := issueUserToken(ctx, user.UserID, models.TokenPurposePasswordReset, cfg.PasswordResetTTL)
+	if err != nil {
+		utils.Error("Failed to create password reset token", append(utils.ErrorFields(err), zap.String("user_id", user.UserID))...)
+		return
+	}
+
+	err = getMailer().Send(ctx, passwordResetMessage(user, token, cfg.AppBaseURL, cfg.PasswordResetTTL))
+	if err != nil {
+		utils.Error("Failed to send password reset email", append(utils.ErrorFields(err), zap.String("user_id", user.UserID))...)
+	}
+}
+
+// passwordResetMessage 构造包含重置链接的邮件
+func passwordResetMessage(user models.User, token, appBaseURL string, ttl time.Duration) mailer.Message {
+	resetLink := appBaseURL + "/reset-password?token=" + url.QueryEscape(token)
+	return mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your MagicStream password",
+		Body:    "Hi " + user.FirstName + ",\n\nUse the link below to reset your password. It expires in " + ttl.String() + " and can only be used once.\n\n" + resetLink + "\n\nIf you didn't request this, you can ignore this email.",
+	}
+}
+
+// ResetPassword 使用重置令牌设置新密码，令牌只能使用一次，成功后所有会话失效
+func ResetPassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.PasswordReset
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "detail": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		token, err := consumeUserToken(ctx, req.Token, models.TokenPurposePasswordReset)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_reset_token")})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_validating_reset_token")})
+			return
+		}
+
+		if err := setUserPassword(ctx, token.UserID, req.NewPassword); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_updating_password")})
+			return
+		}
+
+		clearAuthCookies(c)
+
+		c.JSON(http.StatusOK, gin.H{"message": i18n.Msg(c, "password_reset")})
+	}
+}
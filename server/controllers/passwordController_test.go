@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/mailer"
+	"github.com/joey17520/magic-stream-app/models"
+	"github.com/joey17520/magic-stream-app/utils"
+)
+
+// linkPattern 邮件正文中的链接
+var linkPattern = regexp.MustCompile(`https?://\S+`)
+
+func TestPasswordResetEmailViaOutbox(t *testing.T) {
+	outbox, err := mailer.NewOutboxMailer(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewOutboxMailer: %v", err)
+	}
+
+	// 与issueUserToken相同：原始令牌发给用户，数据库中只保存摘要
+	raw, hash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		t.Fatalf("GenerateOpaqueToken: %v", err)
+	}
+
+	user := models.User{UserID: "user-1", Email: "alice@example.com", FirstName: "Alice"}
+	msg := passwordResetMessage(user, raw, "https://app.example.test", 30*time.Minute)
+	if err := outbox.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	messages, err := outbox.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("outbox has %d messages, want 1", len(messages))
+	}
+	sent := messages[0]
+	if sent.To != user.Email || sent.SentAt.IsZero() {
+		t.Fatalf("sent message = %+v, want one addressed to %s", sent, user.Email)
+	}
+	if !strings.Contains(sent.Body, "30m0s") {
+		t.Fatalf("body does not mention the link lifetime:\n%s", sent.Body)
+	}
+
+	link := linkPattern.FindString(sent.Body)
+	if link == "" {
+		t.Fatalf("body has no link:\n%s", sent.Body)
+	}
+	parsed, err := url.Parse(link)
+	if err != nil {
+		t.Fatalf("parse link %q: %v", link, err)
+	}
+	if parsed.Host != "app.example.test" || parsed.Path != "/reset-password" {
+		t.Fatalf("link = %s, want https://app.example.test/reset-password", link)
+	}
+
+	// 链接中的令牌提交给ResetPassword后按摘要查找，必须与签发时保存的摘要一致
+	token := parsed.Query().Get("token")
+	if token != raw {
+		t.Fatalf("token in link = %q, want %q", token, raw)
+	}
+	if utils.HashOpaqueToken(token) != hash {
+		t.Fatal("token in link does not hash to the stored digest")
+	}
+}
+
+func TestPasswordHandlersRejectInvalidRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/password/forgot", ForgotPassword())
+	router.POST("/password/reset", ResetPassword())
+
+	// 这些请求在访问数据库之前就会被拒绝
+	tests := []struct {
+		name string
+		path string
+		body string
+	}{
+		{name: "forgot: malformed json", path: "/password/forgot", body: `{"email":`},
+		{name: "forgot: missing email", path: "/password/forgot", body: `{}`},
+		{name: "forgot: invalid email", path: "/password/forgot", body: `{"email":"not-an-email"}`},
+		{name: "reset: missing token", path: "/password/reset", body: `{"new_password":"secret123"}`},
+		{name: "reset: short password", path: "/password/reset", body: `{"token":"abc","new_password":"123"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, http.StatusBadRequest, rec.Body.String())
+			}
+		})
+	}
+}
+
+// TestRunInBackground 名额用完时新的任务被丢弃，任务结束后名额归还
+func TestRunInBackground(t *testing.T) {
+	slots := make(chan struct{}, 2)
+	release := make(chan struct{})
+	done := make(chan struct{}, 3)
+	blocked := func() {
+		<-release
+		done <- struct{}{}
+	}
+
+	if !runInBackground(slots, blocked) || !runInBackground(slots, blocked) {
+		t.Fatal("runInBackground refused a task while slots were free")
+	}
+	if runInBackground(slots, blocked) {
+		t.Fatal("runInBackground started a third task with only two slots")
+	}
+
+	close(release)
+	for range 2 {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("background task did not finish")
+		}
+	}
+
+	// 归还名额发生在任务返回之后，稍等片刻再尝试
+	deadline := time.Now().Add(time.Second)
+	for !runInBackground(slots, func() { done <- struct{}{} }) {
+		if time.Now().After(deadline) {
+			t.Fatal("slots were not released after the tasks finished")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	<-done
+}
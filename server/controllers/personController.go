@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/database"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/models"
+	"github.com/joey17520/magic-stream-app/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+)
+
+var (
+	personCollection             *mongo.Collection
+	personCollectionsInitialized bool
+)
+
+// initPersonCollections 延迟初始化演职人员集合
+func initPersonCollections() {
+	if !personCollectionsInitialized {
+		personCollection = database.OpenCollection("people")
+		personCollectionsInitialized = true
+	}
+}
+
+// getPersonCollection 获取演职人员集合
+func getPersonCollection() *mongo.Collection {
+	initPersonCollections()
+	return personCollection
+}
+
+// errUnknownPerson 演员表或职员表引用了people集合中不存在的人物
+var errUnknownPerson = errors.New("unknown person")
+
+// personFilter 匹配演员表或职员表中包含该人物的电影
+func personFilter(personId string) bson.M {
+	return bson.M{"$or": bson.A{
+		bson.M{"cast.person_id": personId},
+		bson.M{"crew.person_id": personId},
+	}}
+}
+
+// verifyPeople 确认电影演职人员引用的人物都存在
+func verifyPeople(ctx context.Context, movie models.Movie) error {
+	var ids []string
+	for _, member := range movie.Cast {
+		ids = append(ids, member.PersonID)
+	}
+	for _, member := range movie.Crew {
+		ids = append(ids, member.PersonID)
+	}
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	count, err := getPersonCollection().CountDocuments(ctx, bson.M{"person_id": bson.M{"$in": ids}})
+	if err != nil {
+		return err
+	}
+	if count != int64(len(ids)) {
+		return errUnknownPerson
+	}
+	return nil
+}
+
+// GetPerson 获取人物资料和作品列表，作品按上映年份倒序；作品列表与电影目录一样受分级和地区授权限制
+func GetPerson() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		personId := c.Param("id")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var person models.Person
+		if err := getPersonCollection().FindOne(ctx, bson.M{"person_id": personId}).Decode(&person); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "person_not_found")})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_person")})
+			return
+		}
+
+		filter := bson.M{"$and": bson.A{personFilter(personId)}}
+		restrictCertifications(c, filter, "certification")
+		restrictAvailability(c, filter, "availability")
+
+		opts := options.Find().SetSort(bson.D{{Key: "release_year", Value: -1}, {Key: "title", Value: 1}})
+		cursor, err := getMovieCollection().Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_movies")})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		var movies []models.Movie
+		if err := cursor.All(ctx, &movies); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_decoding_movies")})
+			return
+		}
+
+		filmography := make([]models.FilmographyEntry, 0, len(movies))
+		for _, movie := range movies {
+			entry := models.FilmographyEntry{Movie: localizeMovie(c, movie)}
+			for _, member := range movie.Cast {
+				if member.PersonID == personId && member.Character != "" {
+					entry.Characters = append(entry.Characters, member.Character)
+				}
+			}
+			for _, member := range movie.Crew {
+				if member.PersonID == personId {
+					entry.Jobs = append(entry.Jobs, member.Job)
+				}
+			}
+			filmography = append(filmography, entry)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"person":      person,
+			"filmography": filmography,
+		})
+	}
+}
+
+// CreatePerson 管理员添加演职人员，返回的person_id用于电影的演员表和职员表
+func CreatePerson() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var person models.Person
+		if err := c.ShouldBindJSON(&person); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+			return
+		}
+		if err := validate.Struct(person); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "detail": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		now := time.Now()
+		person.ID = bson.NilObjectID
+		person.PersonID = bson.NewObjectID().Hex()
+		person.CreatedAt = now
+		person.UpdatedAt = now
+
+		if _, err := getPersonCollection().InsertOne(ctx, person); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_creating_person")})
+			return
+		}
+
+		actorId, _ := utils.GetUserIdFromContext(c)
+		utils.Info("Person created", zap.String("person_id", person.PersonID), zap.String("actor_id", actorId))
+
+		c.JSON(http.StatusCreated, person)
+	}
+}
@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/models"
+	"github.com/joey17520/magic-stream-app/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// errUnknownGenre 请求中包含genres集合中不存在的类型
+var errUnknownGenre = errors.New("unknown genre")
+
+// GetProfile 获取当前登录用户的个人资料
+func GetProfile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.User
+		err = getUserCollection().FindOne(ctx, bson.M{"user_id": userId}).Decode(&user)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "user_not_found")})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_user")})
+			return
+		}
+
+		user.FavoriteGenres = localizeGenres(c, user.FavoriteGenres)
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+// UpdateProfile 更新当前登录用户的姓名和喜爱的类型，只修改请求中提供的字段
+func UpdateProfile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+
+		var req models.UserProfileUpdate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+			return
+		}
+		if req.Country != nil {
+			country := strings.ToUpper(strings.TrimSpace(*req.Country))
+			req.Country = &country
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "detail": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		set := bson.M{"updated_at": time.Now()}
+		if req.FirstName != nil {
+			set["first_name"] = *req.FirstName
+		}
+		if req.LastName != nil {
+			set["last_name"] = *req.LastName
+		}
+		if req.Country != nil {
+			set["country"] = *req.Country
+		}
+		if req.FavoriteGenres != nil {
+			genres, err := resolveGenres(ctx, *req.FavoriteGenres)
+			if err != nil {
+				if errors.Is(err, errUnknownGenre) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "unknown_genre")})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_genres")})
+				return
+			}
+			set["favorite_genres"] = genres
+		}
+
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+		var user models.User
+		err = getUserCollection().FindOneAndUpdate(ctx, bson.M{"user_id": userId}, bson.M{"$set": set}, opts).Decode(&user)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "user_not_found")})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_updating_user")})
+			return
+		}
+
+		if req.FavoriteGenres != nil || req.Country != nil {
+			getRecommendationCache().Invalidate(recommendationCacheKey(userId, ""))
+		}
+
+		user.FavoriteGenres = localizeGenres(c, user.FavoriteGenres)
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+// resolveGenres 按genre_id校验类型是否存在于genres集合，返回集合中的规范数据（去重）
+func resolveGenres(ctx context.Context, requested []models.Genre) ([]models.Genre, error) {
+	ids := make([]int, 0, len(requested))
+	for _, genre := range requested {
+		ids = append(ids, genre.GenreID)
+	}
+
+	cursor, err := getGenreCollection().Find(ctx, bson.M{"genre_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var known []models.Genre
+	if err := cursor.All(ctx, &known); err != nil {
+		return nil, err
+	}
+
+	byId := make(map[int]models.Genre, len(known))
+	for _, genre := range known {
+		byId[genre.GenreID] = genre
+	}
+
+	genres := make([]models.Genre, 0, len(requested))
+	added := make(map[int]bool, len(requested))
+	for _, genre := range requested {
+		canonical, ok := byId[genre.GenreID]
+		if !ok {
+			return nil, errUnknownGenre
+		}
+		if added[genre.GenreID] {
+			continue
+		}
+		added[genre.GenreID] = true
+		genres = append(genres, canonical)
+	}
+
+	return genres, nil
+}
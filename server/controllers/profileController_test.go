@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUpdateProfileValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.PATCH("/me", func(c *gin.Context) {
+		c.Set("userId", "user-1")
+	}, UpdateProfile())
+
+	// 这些请求在访问数据库之前就会被拒绝
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "malformed json", body: `{"first_name":`},
+		{name: "short first name", body: `{"first_name":"A"}`},
+		{name: "long last name", body: `{"last_name":"` + strings.Repeat("x", 101) + `"}`},
+		{name: "empty favorite genres", body: `{"favorite_genres":[]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/me", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, http.StatusBadRequest, rec.Body.String())
+			}
+		})
+	}
+}
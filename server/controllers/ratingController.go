@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/database"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/models"
+	"github.com/joey17520/magic-stream-app/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var (
+	userRatingCollection         *mongo.Collection
+	ratingCollectionsInitialized bool
+)
+
+// initRatingCollections 延迟初始化用户评分集合
+func initRatingCollections() {
+	if !ratingCollectionsInitialized {
+		userRatingCollection = database.OpenCollection("ratings")
+		ratingCollectionsInitialized = true
+	}
+}
+
+// getUserRatingCollection 获取用户评分集合
+func getUserRatingCollection() *mongo.Collection {
+	initRatingCollections()
+	return userRatingCollection
+}
+
+// RateMovie 用户为电影评分（1-5星），可附带文字评论；重复评分会覆盖之前的评分
+func RateMovie() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+
+		movieId := c.Param("imdb_id")
+		if movieId == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "movie_id_required")})
+			return
+		}
+
+		var req struct {
+			Rating int    `json:"rating" validate:"required,min=1,max=5"`
+			Review string `json:"review" validate:"max=2000"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "details": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, ok := findStreamableMovie(ctx, c, movieId); !ok {
+			return
+		}
+
+		now := time.Now()
+		filter := bson.M{"user_id": userId, "imdb_id": movieId}
+		update := bson.M{
+			"$set": bson.M{
+				"rating":     req.Rating,
+				"review":     req.Review,
+				"updated_at": now,
+			},
+			"$setOnInsert": bson.M{
+				"created_at": now,
+			},
+		}
+
+		opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+		var rating models.Rating
+		err = getUserRatingCollection().FindOneAndUpdate(ctx, filter, update, opts).Decode(&rating)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_saving_rating")})
+			return
+		}
+
+		profileId := utils.GetProfileIdFromContext(c)
+		if err := recordMovieEvent(ctx, userId, profileId, movieId, models.MovieEventRate, float64(req.Rating)); err != nil {
+			utils.Warn("Failed to record rating event", utils.ErrorFields(err)...)
+		}
+		getRecommendationCache().Invalidate(recommendationCacheKey(userId, profileId))
+
+		c.JSON(http.StatusOK, rating)
+	}
+}
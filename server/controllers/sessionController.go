@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/utils"
+)
+
+// GetSessions 列出当前用户所有有效的会话（设备、IP、User-Agent、创建和最近使用时间）
+func GetSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+		currentSessionId, _ := utils.GetSessionIdFromContext(c)
+
+		sessions, err := utils.ListSessions(userId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_sessions")})
+			return
+		}
+
+		for i := range sessions {
+			sessions[i].Current = sessions[i].SessionID == currentSessionId
+		}
+
+		c.JSON(http.StatusOK, sessions)
+	}
+}
+
+// RevokeSession 撤销当前用户的某个会话，撤销当前会话时同时清除cookie
+func RevokeSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+		currentSessionId, _ := utils.GetSessionIdFromContext(c)
+
+		sessionId := c.Param("session_id")
+		if sessionId == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "session_id_required")})
+			return
+		}
+
+		if err := utils.RevokeSession(userId, sessionId); err != nil {
+			if errors.Is(err, utils.ErrSessionInvalid) {
+				c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "session_not_found")})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_revoking_session")})
+			return
+		}
+
+		if sessionId == currentSessionId {
+			clearAuthCookies(c)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": i18n.Msg(c, "session_revoked")})
+	}
+}
+
+// RevokeAllSessions 撤销当前用户的所有会话；except_current=true时保留当前会话（退出其他设备）
+func RevokeAllSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+
+		exceptSessionId := ""
+		if c.Query("except_current") == "true" {
+			exceptSessionId, _ = utils.GetSessionIdFromContext(c)
+		}
+
+		if err := utils.RevokeAllSessions(userId, exceptSessionId); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_revoking_sessions")})
+			return
+		}
+
+		if exceptSessionId == "" {
+			clearAuthCookies(c)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": i18n.Msg(c, "sessions_revoked")})
+	}
+}
@@ -0,0 +1,322 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/config"
+	"github.com/joey17520/magic-stream-app/experiments"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/models"
+	"github.com/joey17520/magic-stream-app/storage"
+	"github.com/joey17520/magic-stream-app/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+)
+
+// videoExtensions 允许上传的视频类型及保存时使用的扩展名
+var videoExtensions = map[string]string{
+	"video/mp4":        ".mp4",
+	"video/webm":       ".webm",
+	"video/ogg":        ".ogv",
+	"video/quicktime":  ".mov",
+	"video/x-matroska": ".mkv",
+}
+
+var (
+	blobStore            storage.BlobStore
+	blobStoreInitialized bool
+)
+
+// getBlobStore 延迟创建视频存储，未配置或配置有误时返回nil
+func getBlobStore() storage.BlobStore {
+	if !blobStoreInitialized {
+		cfg := config.GetConfig()
+		store, err := storage.New(storage.Options{
+			Driver:   cfg.StorageDriver,
+			LocalDir: cfg.StorageLocalDir,
+		})
+		if err != nil {
+			utils.Error("Failed to initialize blob store", utils.ErrorFields(err)...)
+		}
+		blobStore = store
+		blobStoreInitialized = true
+	}
+	return blobStore
+}
+
+// videoContentType 确定上传文件的视频类型：优先使用文件部分声明的类型，无法识别时按扩展名判断，不支持时返回空字符串
+func videoContentType(declared, filename string) string {
+	for _, candidate := range []string{declared, mime.TypeByExtension(filepath.Ext(filename))} {
+		mediaType, _, err := mime.ParseMediaType(candidate)
+		if err != nil {
+			continue
+		}
+		if _, ok := videoExtensions[mediaType]; ok {
+			return mediaType
+		}
+	}
+	return ""
+}
+
+// UploadMovieVideo 管理员上传电影的视频文件（multipart表单的file字段），替换已有的视频
+func UploadMovieVideo() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store := getBlobStore()
+		if store == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": i18n.Msg(c, "video_storage_disabled")})
+			return
+		}
+		movieId := c.Param("imdb_id")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := getMovieCollection().FindOne(ctx, bson.M{"imdb_id": movieId}).Err(); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "movie_not_found")})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_movies")})
+			return
+		}
+
+		maxSize := int64(config.GetConfig().MaxVideoUploadMB) << 20
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize)
+
+		// 逐段读取表单，文件直接写入存储，不在内存或临时目录中缓存整个文件
+		reader, err := c.Request.MultipartReader()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+			return
+		}
+		var file io.Reader
+		var contentType string
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+				return
+			}
+			if part.FormName() == "file" {
+				file = part
+				contentType = videoContentType(part.Header.Get("Content-Type"), part.FileName())
+				break
+			}
+		}
+		if file == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "video_file_required")})
+			return
+		}
+		if contentType == "" {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": i18n.Msg(c, "unsupported_video_type")})
+			return
+		}
+
+		// 每次上传使用新的对象键，替换期间正在播放旧视频的请求不受影响
+		key := "movies/" + movieId + "/" + strconv.FormatInt(time.Now().UnixNano(), 36) + videoExtensions[contentType]
+		info, err := store.Put(c.Request.Context(), key, file)
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": i18n.Msg(c, "video_too_large")})
+				return
+			}
+			utils.Error("Failed to store video", append(utils.ErrorFields(err), zap.String("imdb_id", movieId))...)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_uploading_video")})
+			return
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if info.Size == 0 {
+			_ = store.Delete(ctx, key)
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "video_file_required")})
+			return
+		}
+
+		video := models.VideoFile{
+			Key:         key,
+			ContentType: contentType,
+			Size:        info.Size,
+			SHA256:      info.SHA256,
+			UploadedAt:  time.Now(),
+		}
+
+		var previous models.Movie
+		opts := options.FindOneAndUpdate().SetProjection(bson.M{"video": 1})
+		err = getMovieCollection().FindOneAndUpdate(ctx, bson.M{"imdb_id": movieId}, bson.M{"$set": bson.M{"video": video}}, opts).Decode(&previous)
+		if err != nil {
+			if delErr := store.Delete(ctx, key); delErr != nil {
+				utils.Warn("Failed to delete orphaned video", append(utils.ErrorFields(delErr), zap.String("key", key))...)
+			}
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "movie_not_found")})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_uploading_video")})
+			return
+		}
+		if previous.Video != nil && previous.Video.Key != key {
+			if err := store.Delete(ctx, previous.Video.Key); err != nil {
+				utils.Warn("Failed to delete replaced video", append(utils.ErrorFields(err), zap.String("key", previous.Video.Key))...)
+			}
+		}
+
+		actorId, _ := utils.GetUserIdFromContext(c)
+		utils.Info("Movie video uploaded",
+			zap.String("imdb_id", movieId),
+			zap.String("actor_id", actorId),
+			zap.String("content_type", contentType),
+			zap.Int64("size", info.Size),
+		)
+
+		c.JSON(http.StatusOK, video)
+	}
+}
+
+// DeleteMovieVideo 管理员删除电影的视频文件
+func DeleteMovieVideo() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store := getBlobStore()
+		if store == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": i18n.Msg(c, "video_storage_disabled")})
+			return
+		}
+		movieId := c.Param("imdb_id")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var previous models.Movie
+		opts := options.FindOneAndUpdate().SetProjection(bson.M{"video": 1})
+		err := getMovieCollection().FindOneAndUpdate(ctx, bson.M{"imdb_id": movieId}, bson.M{"$unset": bson.M{"video": ""}}, opts).Decode(&previous)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "movie_not_found")})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_deleting_video")})
+			return
+		}
+		if previous.Video == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "video_not_found")})
+			return
+		}
+		if err := store.Delete(ctx, previous.Video.Key); err != nil {
+			utils.Warn("Failed to delete video", append(utils.ErrorFields(err), zap.String("key", previous.Video.Key))...)
+		}
+
+		actorId, _ := utils.GetUserIdFromContext(c)
+		utils.Info("Movie video deleted", zap.String("imdb_id", movieId), zap.String("actor_id", actorId))
+
+		c.JSON(http.StatusOK, gin.H{"message": i18n.Msg(c, "video_deleted")})
+	}
+}
+
+// findStreamableMovie 查找电影并检查地区授权和家长控制，与获取电影详情的规则一致；不能播放时写入响应并返回false。
+// 评分、反馈等针对某部电影的写操作也使用它，看不到的电影同样不能操作
+func findStreamableMovie(ctx context.Context, c *gin.Context, movieId string) (models.Movie, bool) {
+	var movie models.Movie
+	opts := options.FindOne().SetProjection(bson.M{"imdb_id": 1, "certification": 1, "availability": 1, "video": 1})
+	if err := getMovieCollection().FindOne(ctx, bson.M{"imdb_id": movieId}, opts).Decode(&movie); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "movie_not_found")})
+		return movie, false
+	}
+	if !movieAvailableForRequest(c, movie) {
+		respondUnavailable(c)
+		return movie, false
+	}
+	if !utils.CertificationAllowed(movie.Certification, utils.GetMaxCertificationFromContext(c)) {
+		respondRestricted(c)
+		return movie, false
+	}
+	return movie, true
+}
+
+// recordPlaybackStarted 登录用户开始播放电影时记录播放事件（推荐时据此排除看过的电影）和实验的观看转化。
+// 播放器会对同一视频发出多次Range请求，只有从头开始读取的GET请求才算一次播放
+func recordPlaybackStarted(ctx context.Context, c *gin.Context, movieId string) {
+	if c.Request.Method != http.MethodGet {
+		return
+	}
+	if rangeHeader := c.GetHeader("Range"); rangeHeader != "" && !strings.HasPrefix(rangeHeader, "bytes=0-") {
+		return
+	}
+	userId, err := utils.GetUserIdFromContext(c)
+	if err != nil {
+		return
+	}
+
+	// 不使推荐缓存失效，读取缓存时会去掉之后播放的电影
+	if err := recordMovieEvent(ctx, userId, utils.GetProfileIdFromContext(c), movieId, models.MovieEventPlay, 0); err != nil {
+		utils.Warn("Failed to record movie playback", utils.ErrorFields(err)...)
+	}
+	recordExperimentOutcome(ctx, userId, movieId, experiments.OutcomeWatch)
+}
+
+// StreamMovie 播放电影的自托管视频，支持Range请求和条件请求
+func StreamMovie() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		store := getBlobStore()
+		if store == nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": i18n.Msg(c, "video_storage_disabled")})
+			return
+		}
+		movieId := c.Param("imdb_id")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		movie, ok := findStreamableMovie(ctx, c, movieId)
+		if !ok {
+			return
+		}
+		if movie.Video == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "video_not_found")})
+			return
+		}
+
+		// 传输时间取决于文件大小和客户端，读取视频不使用上面的超时
+		file, _, err := store.Open(c.Request.Context(), movie.Video.Key)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				utils.Warn("Movie video missing from storage", zap.String("imdb_id", movieId), zap.String("key", movie.Video.Key))
+				c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "video_not_found")})
+				return
+			}
+			utils.Error("Failed to open video", append(utils.ErrorFields(err), zap.String("imdb_id", movieId))...)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_streaming_video")})
+			return
+		}
+		defer file.Close()
+
+		recordPlaybackStarted(ctx, c, movieId)
+
+		serveVideo(c, movie.Video, file)
+	}
+}
+
+// serveVideo 输出视频内容。设置ETag后，ServeContent会处理Range、If-None-Match、If-Range等请求
+func serveVideo(c *gin.Context, video *models.VideoFile, content io.ReadSeeker) {
+	header := c.Writer.Header()
+	header.Set("Content-Type", video.ContentType)
+	header.Set("ETag", `"`+video.SHA256+`"`)
+	header.Set("Cache-Control", "private, max-age=3600")
+	header.Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(c.Writer, c.Request, "", video.UploadedAt, content)
+}
@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/models"
+)
+
+func TestServeVideo(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	content := "0123456789abcdefghij"
+	video := &models.VideoFile{
+		ContentType: "video/mp4",
+		Size:        int64(len(content)),
+		SHA256:      "c0ffee",
+		UploadedAt:  time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC),
+	}
+
+	router := gin.New()
+	router.GET("/stream", func(c *gin.Context) {
+		serveVideo(c, video, strings.NewReader(content))
+	})
+
+	serve := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/stream", nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	full := serve(nil)
+	if full.Code != http.StatusOK || full.Body.String() != content {
+		t.Fatalf("full: status = %d, body = %q", full.Code, full.Body.String())
+	}
+	for name, want := range map[string]string{
+		"Content-Type":           "video/mp4",
+		"ETag":                   `"c0ffee"`,
+		"Accept-Ranges":          "bytes",
+		"X-Content-Type-Options": "nosniff",
+	} {
+		if got := full.Header().Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	partial := serve(map[string]string{"Range": "bytes=10-14"})
+	if partial.Code != http.StatusPartialContent {
+		t.Fatalf("range: status = %d, want %d", partial.Code, http.StatusPartialContent)
+	}
+	if got := partial.Body.String(); got != "abcde" {
+		t.Errorf("range body = %q, want abcde", got)
+	}
+	if got := partial.Header().Get("Content-Range"); got != "bytes 10-14/20" {
+		t.Errorf("Content-Range = %q", got)
+	}
+
+	suffix := serve(map[string]string{"Range": "bytes=-3"})
+	if suffix.Code != http.StatusPartialContent || suffix.Body.String() != "hij" {
+		t.Errorf("suffix range: status = %d, body = %q", suffix.Code, suffix.Body.String())
+	}
+
+	if rec := serve(map[string]string{"Range": "bytes=50-60"}); rec.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("unsatisfiable range: status = %d", rec.Code)
+	}
+
+	notModified := serve(map[string]string{"If-None-Match": `"c0ffee"`})
+	if notModified.Code != http.StatusNotModified || notModified.Body.Len() != 0 {
+		t.Errorf("If-None-Match: status = %d, body length %d", notModified.Code, notModified.Body.Len())
+	}
+	if rec := serve(map[string]string{"If-None-Match": `"stale"`}); rec.Code != http.StatusOK {
+		t.Errorf("If-None-Match with another ETag: status = %d", rec.Code)
+	}
+
+	// 视频已被替换时If-Range不匹配，返回完整内容而不是旧版本的片段
+	rec := serve(map[string]string{"Range": "bytes=0-4", "If-Range": `"stale"`})
+	body, _ := io.ReadAll(rec.Body)
+	if rec.Code != http.StatusOK || string(body) != content {
+		t.Errorf("If-Range mismatch: status = %d, body = %q", rec.Code, body)
+	}
+}
+
+func TestVideoContentType(t *testing.T) {
+	tests := []struct {
+		declared, filename, want string
+	}{
+		{"video/mp4", "movie.bin", "video/mp4"},
+		{"video/webm; codecs=vp9", "movie", "video/webm"},
+		{"application/octet-stream", "movie.mp4", "video/mp4"},
+		{"", "movie.webm", "video/webm"},
+		{"image/png", "poster.png", ""},
+		{"", "movie.exe", ""},
+	}
+	for _, tt := range tests {
+		if got := videoContentType(tt.declared, tt.filename); got != tt.want {
+			t.Errorf("videoContentType(%q, %q) = %q, want %q", tt.declared, tt.filename, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/database"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/models"
+	"github.com/joey17520/magic-stream-app/trending"
+	"github.com/joey17520/magic-stream-app/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var (
+	trendingCollection             *mongo.Collection
+	trendingCollectionsInitialized bool
+)
+
+// initTrendingCollections 延迟初始化热门榜单集合
+func initTrendingCollections() {
+	if !trendingCollectionsInitialized {
+		trendingCollection = database.OpenCollection("trending_movies")
+		trendingCollectionsInitialized = true
+	}
+}
+
+// getTrendingCollection 获取热门榜单集合
+func getTrendingCollection() *mongo.Collection {
+	initTrendingCollections()
+	return trendingCollection
+}
+
+// NewTrendingAggregator 创建热门榜单后台聚合器
+func NewTrendingAggregator(interval time.Duration, limit int) *trending.Aggregator {
+	return trending.NewAggregator(
+		getEventCollection(),
+		getMovieCollection(),
+		getTrendingCollection(),
+		interval,
+		limit,
+		utils.GetLogger(),
+	)
+}
+
+// GetTrendingMovies 返回指定窗口（24h或7d）的热门电影，数据由后台聚合任务预先计算；超出当前档案允许分级或在请求方地区不可观看的电影会被过滤
+func GetTrendingMovies() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		windowName := c.DefaultQuery("window", trending.DefaultWindow)
+		window, ok := trending.FindWindow(windowName)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_trending_window")})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		collection := getTrendingCollection()
+
+		// 只读取最近一次计算的榜单，避免刷新过程中新旧榜单混在一起
+		var latest models.TrendingMovie
+		latestOpts := options.FindOne().SetSort(bson.D{{Key: "computed_at", Value: -1}})
+		err := collection.FindOne(ctx, bson.M{"window": window.Name}, latestOpts).Decode(&latest)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusOK, []models.TrendingMovie{})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_trending")})
+			return
+		}
+
+		filter := bson.M{"window": window.Name, "computed_at": latest.ComputedAt}
+		restrictCertifications(c, filter, "movie.certification")
+		restrictAvailability(c, filter, "movie.availability")
+		findOptions := options.Find().SetSort(bson.D{{Key: "rank", Value: 1}})
+
+		cursor, err := collection.Find(ctx, filter, findOptions)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_trending")})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		var trendingMovies []models.TrendingMovie
+		if err := cursor.All(ctx, &trendingMovies); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_decoding_trending")})
+			return
+		}
+
+		for i := range trendingMovies {
+			trendingMovies[i].Movie = localizeMovie(c, trendingMovies[i].Movie)
+		}
+
+		c.JSON(http.StatusOK, trendingMovies)
+	}
+}
@@ -0,0 +1,24 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetTrendingMoviesRejectsUnknownWindow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/movies/trending", GetTrendingMovies())
+
+	// 未知窗口在读取榜单之前就被拒绝
+	for _, query := range []string{"?window=1h", "?window=24H", "?window="} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/movies/trending"+query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: status = %d, want %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/config"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/models"
+	"github.com/joey17520/magic-stream-app/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// errInvalidTwoFactorCode 验证码错误、已被使用或恢复码无效
+var errInvalidTwoFactorCode = errors.New("invalid two-factor code")
+
+// verifyTwoFactor 校验用户提交的TOTP验证码或恢复码。
+// 验证码的时间步长必须大于上次使用的步长，防止同一验证码被重放；恢复码使用后即被移除
+func verifyTwoFactor(ctx context.Context, user models.User, code, recoveryCode string) error {
+	if !user.TwoFactorEnabled || user.TwoFactor == nil || user.TwoFactor.Secret == "" {
+		return errInvalidTwoFactorCode
+	}
+
+	var filter, update bson.M
+	if code != "" {
+		step, ok := utils.ValidateTOTP(user.TwoFactor.Secret, code, time.Now())
+		if !ok {
+			return errInvalidTwoFactorCode
+		}
+		filter = bson.M{"user_id": user.UserID, "two_factor.last_used_step": bson.M{"$lt": step}}
+		update = bson.M{"$set": bson.M{"two_factor.last_used_step": step}}
+	} else {
+		hash := utils.HashRecoveryCode(recoveryCode)
+		filter = bson.M{"user_id": user.UserID, "two_factor.recovery_codes": hash}
+		update = bson.M{"$pull": bson.M{"two_factor.recovery_codes": hash}}
+	}
+
+	result, err := getUserCollection().UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+// LoginTwoFactor 登录第二步：使用挑战令牌和验证码（或恢复码）完成登录
+func LoginTwoFactor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.TwoFactorLogin
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_input")})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "detail": err.Error()})
+			return
+		}
+
+		claims, err := utils.ValidateChallengeToken(req.ChallengeToken)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.Msg(c, "invalid_challenge")})
+			return
+		}
+
+		// 验证码的尝试次数与密码共用登录失败限制
+		if !loginAllowed(c, claims.Email) {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := getUserCollection().FindOne(ctx, bson.M{"user_id": claims.UserId}).Decode(&user); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.Msg(c, "invalid_challenge")})
+			return
+		}
+
+		if err := verifyTwoFactor(ctx, user, req.Code, req.RecoveryCode); err != nil {
+			if errors.Is(err, errInvalidTwoFactorCode) {
+				recordLoginFailure(c, user.Email, user.UserID)
+				c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.Msg(c, "invalid_two_factor_code")})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_verifying_two_factor_code")})
+			return
+		}
+
+		if err := utils.ResetLoginFailures(user.Email); err != nil {
+			utils.Warn("Failed to reset login failures", utils.ErrorFields(err)...)
+		}
+
+		if req.RecoveryCode != "" {
+			utils.Info("Recovery code used for login", zap.String("user_id", user.UserID))
+		}
+
+		completeLogin(c, user, req.Device)
+	}
+}
+
+// EnrollTwoFactor 开始启用两步验证：生成新的密钥，返回otpauth URI，需通过ConfirmTwoFactor确认后才生效
+func EnrollTwoFactor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := getUserCollection().FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "user_not_found")})
+			return
+		}
+		if user.TwoFactorEnabled {
+			c.JSON(http.StatusConflict, gin.H{"error": i18n.Msg(c, "two_factor_already_enabled")})
+			return
+		}
+
+		secret, err := utils.GenerateTOTPSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_generating_two_factor_secret")})
+			return
+		}
+
+		_, err = getUserCollection().UpdateOne(ctx,
+			bson.M{"user_id": userId},
+			bson.M{"$set": bson.M{"two_factor.pending_secret": secret, "updated_at": time.Now()}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_saving_two_factor_secret")})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"secret":      secret,
+			"otpauth_uri": utils.TOTPURI(config.GetConfig().TwoFactorIssuer, user.Email, secret),
+		})
+	}
+}
+
+// ConfirmTwoFactor 使用身份验证器中的验证码确认启用两步验证，返回只展示一次的恢复码；
+// 其他会话随之失效，当前会话需刷新令牌以获得完整权限
+func ConfirmTwoFactor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+		sessionId, _ := utils.GetSessionIdFromContext(c)
+
+		var req models.TwoFactorCode
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "detail": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := getUserCollection().FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "user_not_found")})
+			return
+		}
+		if user.TwoFactorEnabled {
+			c.JSON(http.StatusConflict, gin.H{"error": i18n.Msg(c, "two_factor_already_enabled")})
+			return
+		}
+		if user.TwoFactor == nil || user.TwoFactor.PendingSecret == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "two_factor_enrollment_not_started")})
+			return
+		}
+
+		secret := user.TwoFactor.PendingSecret
+		step, ok := utils.ValidateTOTP(secret, req.Code, time.Now())
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_two_factor_code")})
+			return
+		}
+
+		codes, hashes, err := utils.GenerateRecoveryCodes()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_generating_recovery_codes")})
+			return
+		}
+
+		now := time.Now()
+		result, err := getUserCollection().UpdateOne(ctx,
+			bson.M{"user_id": userId, "two_factor_enabled": bson.M{"$ne": true}, "two_factor.pending_secret": secret},
+			bson.M{"$set": bson.M{
+				"two_factor_enabled": true,
+				"two_factor": models.TwoFactor{
+					Secret:        secret,
+					RecoveryCodes: hashes,
+					LastUsedStep:  step,
+					EnabledAt:     &now,
+				},
+				"updated_at": now,
+			}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_enabling_two_factor")})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": i18n.Msg(c, "two_factor_enrollment_changed")})
+			return
+		}
+
+		if err := utils.RevokeAllSessions(userId, sessionId); err != nil {
+			utils.Warn("Failed to revoke other sessions after enabling two-factor", utils.ErrorFields(err)...)
+		}
+
+		utils.Info("Two-factor authentication enabled", zap.String("user_id", userId))
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":        i18n.Msg(c, "two_factor_enabled"),
+			"recovery_codes": codes,
+		})
+	}
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，之前的恢复码全部失效
+func RegenerateRecoveryCodes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+
+		var req models.TwoFactorCode
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "detail": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := getUserCollection().FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "user_not_found")})
+			return
+		}
+
+		// 与登录共用失败限制，防止拿到会话的人在这里穷举验证码
+		if !loginAllowed(c, user.Email) {
+			return
+		}
+		if err := verifyTwoFactor(ctx, user, req.Code, ""); err != nil {
+			if errors.Is(err, errInvalidTwoFactorCode) {
+				recordLoginFailure(c, user.Email, user.UserID)
+				c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_two_factor_code")})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_verifying_two_factor_code")})
+			return
+		}
+		if err := utils.ResetLoginFailures(user.Email); err != nil {
+			utils.Warn("Failed to reset login failures", utils.ErrorFields(err)...)
+		}
+
+		codes, hashes, err := utils.GenerateRecoveryCodes()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_generating_recovery_codes")})
+			return
+		}
+
+		_, err = getUserCollection().UpdateOne(ctx,
+			bson.M{"user_id": userId},
+			bson.M{"$set": bson.M{"two_factor.recovery_codes": hashes, "updated_at": time.Now()}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_saving_recovery_codes")})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	}
+}
+
+// DisableTwoFactor 关闭两步验证，需要当前密码和验证码（或恢复码）
+func DisableTwoFactor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+
+		var req models.TwoFactorDisable
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "detail": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.User
+		if err := getUserCollection().FindOne(ctx, bson.M{"user_id": userId}).Decode(&user); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "user_not_found")})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_user")})
+			return
+		}
+
+		// 与登录共用失败限制，密码和验证码错误都计入失败次数
+		if !loginAllowed(c, user.Email) {
+			return
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+			recordLoginFailure(c, user.Email, user.UserID)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.Msg(c, "current_password_incorrect")})
+			return
+		}
+
+		if err := verifyTwoFactor(ctx, user, req.Code, req.RecoveryCode); err != nil {
+			if errors.Is(err, errInvalidTwoFactorCode) {
+				recordLoginFailure(c, user.Email, user.UserID)
+				c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_two_factor_code")})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_verifying_two_factor_code")})
+			return
+		}
+		if err := utils.ResetLoginFailures(user.Email); err != nil {
+			utils.Warn("Failed to reset login failures", utils.ErrorFields(err)...)
+		}
+
+		_, err = getUserCollection().UpdateOne(ctx,
+			bson.M{"user_id": userId},
+			bson.M{
+				"$set":   bson.M{"two_factor_enabled": false, "updated_at": time.Now()},
+				"$unset": bson.M{"two_factor": ""},
+			},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_disabling_two_factor")})
+			return
+		}
+
+		utils.Info("Two-factor authentication disabled", zap.String("user_id", userId))
+
+		c.JSON(http.StatusOK, gin.H{"message": i18n.Msg(c, "two_factor_disabled")})
+	}
+}
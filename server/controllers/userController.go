@@ -2,16 +2,24 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"github.com/joey17520/magic-stream-app/config"
 	"github.com/joey17520/magic-stream-app/database"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/middlewares"
 	"github.com/joey17520/magic-stream-app/models"
 	"github.com/joey17520/magic-stream-app/utils"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -34,6 +42,9 @@ func getUserCollection() *mongo.Collection {
 	return userCollection
 }
 
+// dummyPasswordHash 邮箱不存在时用于比较的bcrypt哈希，与真实密码比较的耗时相同
+const dummyPasswordHash = "$2a$10$atKkaIKD757JpB1SxJV0XO0PWYtq4qdXsRURQvc.peZZIpKl/Qvp6"
+
 // 加密函数
 func HashPassword(password string) (string, error) {
 	hashPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -46,22 +57,23 @@ func HashPassword(password string) (string, error) {
 
 func RegisterUser() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var user models.User
+		var register models.UserRegister
 
-		if err := c.ShouldBindJSON(&user); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+		if err := c.ShouldBindJSON(&register); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_input")})
 			return
 		}
+		register.Email = utils.NormalizeEmail(register.Email)
 		validate := validator.New()
 
-		if err := validate.Struct(user); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "detail": err.Error()})
+		if err := validate.Struct(register); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "detail": err.Error()})
 			return
 		}
 
-		hashedPassword, err := HashPassword(user.Password)
+		hashedPassword, err := HashPassword(register.Password)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to hash password"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_hashing_password")})
 			return
 		}
 
@@ -69,26 +81,38 @@ func RegisterUser() gin.HandlerFunc {
 		defer cancel()
 
 		collection := getUserCollection()
-		count, err := collection.CountDocuments(ctx, bson.M{"email": user.Email})
+		count, err := collection.CountDocuments(ctx, utils.EmailFilter(register.Email))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check existing user"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_checking_existing_user")})
 			return
 		}
 		if count > 0 {
-			c.JSON(http.StatusConflict, gin.H{"error": "User already exists"})
+			c.JSON(http.StatusConflict, gin.H{"error": i18n.Msg(c, "user_exists")})
 			return
 		}
-		user.UserID = bson.NewObjectID().Hex()
-		user.CreatedAt = time.Now()
-		user.UpdatedAt = time.Now()
-		user.Password = hashedPassword
+		user := models.User{
+			UserID:         bson.NewObjectID().Hex(),
+			FirstName:      register.FirstName,
+			LastName:       register.LastName,
+			Email:          register.Email,
+			Password:       hashedPassword,
+			Role:           models.RoleUser,
+			CreatedAt:      time.Now(),
+			UpdatedAt:      time.Now(),
+			FavoriteGenres: register.FavoriteGenres,
+		}
 
 		result, err := collection.InsertOne(ctx, user)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_creating_user")})
 			return
 		}
 
+		if err := sendVerificationEmail(ctx, user); err != nil {
+			// 用户可以通过重发接口再次获取验证邮件，这里不影响注册结果
+			utils.Error("Failed to send verification email", utils.ErrorFields(err)...)
+		}
+
 		c.JSON(http.StatusOK, result)
 	}
 }
@@ -98,7 +122,12 @@ func LoginUser() gin.HandlerFunc {
 		var userLogin models.UserLogin
 
 		if err := c.ShouldBindJSON(&userLogin); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input data"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_input")})
+			return
+		}
+
+		userLogin.Email = utils.NormalizeEmail(userLogin.Email)
+		if !loginAllowed(c, userLogin.Email) {
 			return
 		}
 
@@ -108,112 +137,277 @@ func LoginUser() gin.HandlerFunc {
 		var foundUser models.User
 
 		collection := getUserCollection()
-		err := collection.FindOne(ctx, bson.M{"email": userLogin.Email}).Decode(&foundUser)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, "No email address was found.")
+		err := collection.FindOne(ctx, utils.EmailFilter(userLogin.Email)).Decode(&foundUser)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_looking_up_user")})
 			return
 		}
 
-		err = bcrypt.CompareHashAndPassword([]byte(foundUser.Password), []byte(userLogin.Password))
+		// 邮箱不存在时也做一次密码比较，使两种失败的响应时间一致
+		passwordHash := foundUser.Password
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Password"})
+			passwordHash = dummyPasswordHash
+		}
+		if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(userLogin.Password)) != nil || err != nil {
+			recordLoginFailure(c, userLogin.Email, foundUser.UserID)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.Msg(c, "invalid_credentials")})
 			return
 		}
 
-		token, refreshToken, err := utils.GenerateAllTokens(foundUser.Email, foundUser.FirstName, foundUser.LastName, foundUser.Role, foundUser.UserID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
+		if err := utils.ResetLoginFailures(userLogin.Email); err != nil {
+			utils.Warn("Failed to reset login failures", utils.ErrorFields(err)...)
+		}
+
+		if !foundUser.EmailVerified && config.GetConfig().UnverifiedAccountPolicy == config.UnverifiedPolicyBlock {
+			c.JSON(http.StatusForbidden, gin.H{"error": i18n.Msg(c, "email_not_verified")})
 			return
 		}
 
-		err = utils.UpdateAllTokens(foundUser.UserID, token, refreshToken)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tokens"})
+		if foundUser.Disabled {
+			c.JSON(http.StatusForbidden, gin.H{"error": i18n.Msg(c, "account_disabled")})
 			return
 		}
 
-		// 使用http-only cookie来设置token，防止XSS攻击
-		http.SetCookie(c.Writer, &http.Cookie{
-			Name:  "access_token",
-			Value: token,
-			Path:  "/",
-			// Domain:   "localhost",
-			MaxAge:   86400,
-			Secure:   true,
-			HttpOnly: true,
-			SameSite: http.SameSiteNoneMode,
-		})
+		if foundUser.TwoFactorEnabled {
+			ttl := config.GetConfig().TwoFactorChallengeTTL
+			challenge, err := utils.GenerateChallengeToken(foundUser.Email, foundUser.UserID, ttl)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_generating_tokens")})
+				return
+			}
+
+			c.JSON(http.StatusOK, models.TwoFactorChallenge{
+				TwoFactorRequired: true,
+				ChallengeToken:    challenge,
+				ExpiresIn:         int(ttl.Seconds()),
+			})
+			return
+		}
 
-		http.SetCookie(c.Writer, &http.Cookie{
-			Name:  "refresh_token",
-			Value: refreshToken,
-			Path:  "/",
-			// Domain:   "localhost",
-			MaxAge:   86400,
-			Secure:   true,
-			HttpOnly: true,
-			SameSite: http.SameSiteNoneMode,
-		})
+		completeLogin(c, foundUser, userLogin.Device)
+	}
+}
+
+// completeLogin 为已通过全部验证的用户创建会话、设置cookie并返回用户信息
+func completeLogin(c *gin.Context, user models.User, device string) {
+	response, err := startLoginSession(c, user, device)
+	if err != nil {
+		if errors.Is(err, utils.ErrUserDisabled) {
+			c.JSON(http.StatusForbidden, gin.H{"error": i18n.Msg(c, "account_disabled")})
+			return
+		}
+		utils.Error("Failed to start login session", append(utils.ErrorFields(err), zap.String("user_id", user.UserID))...)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, loginErrorKey(err))})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// 创建登录会话各步骤失败的原因，由loginErrorKey转换为消息ID
+var (
+	errCancellingAccountDeletion = errors.New("failed to cancel account deletion")
+	errCreatingSession           = errors.New("failed to create session")
+	errGeneratingTokens          = errors.New("failed to generate tokens")
+)
+
+// loginErrorKey 创建登录会话失败的原因对应的消息ID
+func loginErrorKey(err error) string {
+	switch {
+	case errors.Is(err, errCancellingAccountDeletion):
+		return "error_cancelling_account_deletion"
+	case errors.Is(err, errCreatingSession):
+		return "error_creating_session"
+	case errors.Is(err, errGeneratingTokens):
+		return "error_generating_tokens"
+	default:
+		return "error_starting_login"
+	}
+}
+
+// startLoginSession 创建会话、签发令牌并设置cookie，失败的原因可以用loginErrorKey转换为消息ID
+func startLoginSession(c *gin.Context, user models.User, device string) (*models.UserResponse, error) {
+	if user.Disabled {
+		return nil, utils.ErrUserDisabled
+	}
+
+	if user.DeletionScheduledAt != nil {
+		if err := cancelAccountDeletion(c, &user); err != nil {
+			return nil, fmt.Errorf("%w: %w", errCancellingAccountDeletion, err)
+		}
+	}
+
+	session, err := utils.CreateSession(user.UserID, sessionDeviceName(device, c.Request.UserAgent()), c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingSession, err)
+	}
+
+	role := utils.EffectiveRole(user.Role, user.TwoFactorEnabled)
+	token, refreshToken, err := utils.GenerateAllTokens(user.Email, user.FirstName, user.LastName, role, user.UserID, session.SessionID, "", session.RefreshTokenID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errGeneratingTokens, err)
+	}
+
+	setAuthCookies(c, token, refreshToken)
+
+	return &models.UserResponse{
+		UserId:                 user.UserID,
+		FirstName:              user.FirstName,
+		LastName:               user.LastName,
+		Email:                  user.Email,
+		EmailVerified:          user.EmailVerified,
+		Role:                   role,
+		FavoriteGenres:         user.FavoriteGenres,
+		TwoFactorEnabled:       user.TwoFactorEnabled,
+		TwoFactorSetupRequired: utils.TwoFactorSetupRequired(user.Role, user.TwoFactorEnabled),
+	}, nil
+}
 
-		c.JSON(http.StatusOK, models.UserResponse{
-			UserId:    foundUser.UserID,
-			FirstName: foundUser.FirstName,
-			LastName:  foundUser.LastName,
-			Email:     foundUser.Email,
-			Role:      foundUser.Role,
-			// Token:          token,
-			// RefreshToken:   refreshToken,
-			FavoriteGenres: foundUser.FavoriteGenres,
+// loginAllowed 检查邮箱和IP是否因多次失败被暂时锁定，被锁定或检查出错时写入响应并返回false。
+// 密码登录、两步验证登录以及需要验证码的两步验证设置共用同一套失败计数
+func loginAllowed(c *gin.Context, email string) bool {
+	wait, err := utils.CheckLoginAllowed(email, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_checking_login_attempts")})
+		return false
+	}
+	if wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": i18n.Msg(c, "too_many_login_attempts")})
+		return false
+	}
+	return true
+}
+
+// recordLoginFailure 记录登录失败，触发锁定时写入审计日志
+func recordLoginFailure(c *gin.Context, email, userId string) {
+	lockouts, err := utils.RecordLoginFailure(email, c.ClientIP())
+	if err != nil {
+		utils.Error("Failed to record login failure", utils.ErrorFields(err)...)
+		return
+	}
+
+	for _, lockout := range lockouts {
+		utils.Warn("Login locked out after repeated failures",
+			zap.String("scope", lockout.Scope),
+			zap.String("email", email),
+			zap.String("ip", c.ClientIP()),
+			zap.Time("locked_until", lockout.Until),
+		)
+		middlewares.RecordLoginLockout(lockout.Scope)
+		utils.RecordAudit(models.AuditLog{
+			Action:    models.AuditActionLoginLockout,
+			UserID:    userId,
+			Email:     email,
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			Details: map[string]any{
+				"scope":        lockout.Scope,
+				"failures":     lockout.Failures,
+				"locked_until": lockout.Until,
+			},
 		})
 	}
 }
 
+// LogoutHandler 退出当前会话：会话ID只从调用者自己的令牌中获取，不会影响其他会话或其他用户
 func LogoutHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// clear the access_token cookie
-
-		var UserLogout struct {
-			UserId string `json:"user_id"`
+		if claims := sessionClaimsFromRequest(c); claims != nil {
+			err := utils.RevokeSession(claims.UserId, claims.SessionId)
+			if err != nil && !errors.Is(err, utils.ErrSessionInvalid) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_logging_out")})
+				return
+			}
+			utils.Info("User logged out", zap.String("user_id", claims.UserId), zap.String("session_id", claims.SessionId))
 		}
 
-		err := c.ShouldBindJSON(&UserLogout)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
-			return
-		}
+		clearAuthCookies(c)
 
-		utils.Info("User logout request", utils.HTTPRequestFields("POST", "/logout", "200", 0)...)
+		c.JSON(http.StatusOK, gin.H{"message": i18n.Msg(c, "logged_out")})
+	}
+}
 
-		err = utils.UpdateAllTokens(UserLogout.UserId, "", "")
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error logging out"})
-			return
+// sessionClaimsFromRequest 从access token（请求头或cookie）或refresh token cookie中解析出会话信息，都无效时返回nil
+func sessionClaimsFromRequest(c *gin.Context) *utils.SignedDetails {
+	if token, err := utils.GetAccessToken(c); err == nil {
+		if claims, err := utils.ValidateToken(token); err == nil {
+			return claims
 		}
+	}
 
-		http.SetCookie(c.Writer, &http.Cookie{
-			Name:  "access_token",
-			Value: "",
-			Path:  "/",
-			// Domain: "localhost",
-			MaxAge:   -1,
-			Secure:   true,
-			HttpOnly: true,
-			SameSite: http.SameSiteNoneMode,
-		})
+	if token, err := c.Cookie("refresh_token"); err == nil && token != "" {
+		if claims, err := utils.ValidateRefreshToken(token); err == nil {
+			return claims
+		}
+	}
 
-		http.SetCookie(c.Writer, &http.Cookie{
-			Name:  "refresh_token",
-			Value: "",
-			Path:  "/",
-			// Domain: "localhost",
-			MaxAge:   -1,
-			Secure:   true,
-			HttpOnly: true,
-			SameSite: http.SameSiteNoneMode,
-		})
+	return nil
+}
 
-		c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+// sessionDeviceName 确定会话的设备名称：优先使用客户端提供的名称，否则使用User-Agent
+func sessionDeviceName(device, userAgent string) string {
+	name := strings.TrimSpace(device)
+	if name == "" {
+		name = userAgent
+	}
+	if name == "" {
+		name = "Unknown device"
 	}
+	if len(name) > 100 {
+		name = name[:100]
+	}
+	return name
+}
+
+// setAuthCookies 使用http-only cookie来设置token，防止XSS攻击。登录和刷新令牌都使用这里，保证cookie属性一致
+func setAuthCookies(c *gin.Context, token, refreshToken string) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:  "access_token",
+		Value: token,
+		Path:  "/",
+		// Domain:   "localhost",
+		MaxAge:   86400,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+	})
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:  "refresh_token",
+		Value: refreshToken,
+		Path:  "/",
+		// Domain:   "localhost",
+		MaxAge:   int(utils.SessionTTL.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+	})
+}
+
+// clearAuthCookies 清除access_token和refresh_token cookie
+func clearAuthCookies(c *gin.Context) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:  "access_token",
+		Value: "",
+		Path:  "/",
+		// Domain: "localhost",
+		MaxAge:   -1,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+	})
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:  "refresh_token",
+		Value: "",
+		Path:  "/",
+		// Domain: "localhost",
+		MaxAge:   -1,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteNoneMode,
+	})
 }
 
 func RefreshTokenHandler() gin.HandlerFunc {
@@ -224,13 +418,13 @@ func RefreshTokenHandler() gin.HandlerFunc {
 		refreshToken, err := c.Cookie("refresh_token")
 
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unable to retrieve refresh token from cookie"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.Msg(c, "refresh_token_missing")})
 			return
 		}
 
 		claim, err := utils.ValidateRefreshToken(refreshToken)
 		if err != nil || claim == nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.Msg(c, "invalid_refresh_token")})
 			return
 		}
 
@@ -238,20 +432,57 @@ func RefreshTokenHandler() gin.HandlerFunc {
 		collection := getUserCollection()
 		err = collection.FindOne(ctx, bson.M{"user_id": claim.UserId}).Decode(&user)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.Msg(c, "user_not_found")})
+			return
+		}
+
+		if user.Disabled {
+			clearAuthCookies(c)
+			c.JSON(http.StatusForbidden, gin.H{"error": i18n.Msg(c, "account_disabled")})
+			return
+		}
+
+		// 会话所选的档案已被删除时结束会话，要求重新登录并选择档案，不能退回到不受限制的主档案
+		if claim.ProfileId != "" && findHouseholdProfile(user, claim.ProfileId) == nil {
+			if err := utils.RevokeSession(claim.UserId, claim.SessionId); err != nil && !errors.Is(err, utils.ErrSessionInvalid) {
+				utils.Warn("Failed to revoke session of deleted profile", utils.ErrorFields(err)...)
+			}
+			clearAuthCookies(c)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.Msg(c, "profile_gone")})
+			return
+		}
+
+		// 每个refresh token只能使用一次，重放已轮换的令牌会撤销整个会话
+		newRefreshTokenId, err := utils.RotateRefreshToken(claim.SessionId, claim.UserId, claim.ID)
+		if err != nil {
+			if errors.Is(err, utils.ErrRefreshTokenReused) {
+				utils.Warn("Refresh token reuse detected, session revoked",
+					zap.String("user_id", claim.UserId),
+					zap.String("session_id", claim.SessionId),
+					zap.String("ip", c.ClientIP()),
+				)
+				clearAuthCookies(c)
+				c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.Msg(c, "refresh_token_reused")})
+				return
+			}
+			if errors.Is(err, utils.ErrSessionInvalid) {
+				clearAuthCookies(c)
+				c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.Msg(c, "session_expired")})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_updating_tokens")})
 			return
 		}
 
-		newToken, newRefreshToken, _ := utils.GenerateAllTokens(user.Email, user.FirstName, user.LastName, user.Role, user.UserID)
-		err = utils.UpdateAllTokens(user.UserID, newToken, newRefreshToken)
+		// 沿用会话当前选择的档案
+		newToken, newRefreshToken, err := utils.GenerateAllTokens(user.Email, user.FirstName, user.LastName, utils.EffectiveRole(user.Role, user.TwoFactorEnabled), user.UserID, claim.SessionId, claim.ProfileId, newRefreshTokenId)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating tokens"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_generating_tokens")})
 			return
 		}
 
-		c.SetCookie("access_token", newToken, 86400, "/", "localhost", true, true)
-		c.SetCookie("refresh_token", refreshToken, 604800, "/", "localhost", true, true)
+		setAuthCookies(c, newToken, newRefreshToken)
 
-		c.JSON(http.StatusOK, gin.H{"message": "Tokens refreshed"})
+		c.JSON(http.StatusOK, gin.H{"message": i18n.Msg(c, "tokens_refreshed")})
 	}
 }
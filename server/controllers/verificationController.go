@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/config"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/mailer"
+	"github.com/joey17520/magic-stream-app/models"
+	"github.com/joey17520/magic-stream-app/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+)
+
+// sendVerificationEmail 为用户签发新的邮箱验证令牌并发送验证邮件，之前未使用的验证令牌随之失效
+func sendVerificationEmail(ctx context.Context, user models.User) error {
+	cfg := config.GetConfig()
+
+	if err := expireUserTokens(ctx, user.UserID, models.TokenPurposeEmailVerification); err != nil {
+		return err
+	}
+
+	token, err := issueUserToken(ctx, user.UserID, models.TokenPurposeEmailVerification, cfg.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return getMailer().Send(ctx, verificationMessage(user, token, cfg.AppBaseURL, cfg.EmailVerificationTTL))
+}
+
+// verificationMessage 构造包含验证链接的邮件
+func verificationMessage(user models.User, token, appBaseURL string, ttl time.Duration) mailer.Message {
+	verifyLink := appBaseURL + "/verify-email?token=" + url.QueryEscape(token)
+	return mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your MagicStream email address",
+		Body:    "Hi " + user.FirstName + ",\n\nPlease confirm your email address by opening the link below. It expires in " + ttl.String() + ".\n\n" + verifyLink,
+	}
+}
+
+// VerifyEmail 使用邮件中的令牌验证邮箱
+func VerifyEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw := c.Query("token")
+		if raw == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "verification_token_required")})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		token, err := consumeUserToken(ctx, raw, models.TokenPurposeEmailVerification)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_verification_token")})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_validating_verification_token")})
+			return
+		}
+
+		now := time.Now()
+		_, err = getUserCollection().UpdateOne(ctx,
+			bson.M{"user_id": token.UserID},
+			bson.M{"$set": bson.M{
+				"email_verified":    true,
+				"email_verified_at": now,
+				"updated_at":        now,
+			}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_verifying_email")})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": i18n.Msg(c, "email_verified")})
+	}
+}
+
+// ResendVerificationEmail 重新发送验证邮件。无论邮箱是否存在、是否已验证或仍在冷却时间内都返回相同的响应，
+// 避免泄露账户是否存在；查找用户和发送邮件在响应之后进行
+func ResendVerificationEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.EmailVerificationResend
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "invalid_request_body")})
+			return
+		}
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "validation_failed"), "detail": err.Error()})
+			return
+		}
+
+		if !runInBackground(accountEmailSlots, func() { resendVerificationEmail(req.Email) }) {
+			utils.Warn("Too many pending account emails, verification resend dropped")
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": i18n.Msg(c, "verification_email_sent")})
+	}
+}
+
+// resendVerificationEmail 邮箱已注册但未验证、且不在冷却时间内时重新发送验证邮件，在后台运行，错误只记录日志
+func resendVerificationEmail(email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), accountEmailTimeout)
+	defer cancel()
+
+	var user models.User
+	err := getUserCollection().FindOne(ctx, utils.EmailFilter(email)).Decode(&user)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			utils.Error("Failed to look up user for verification resend", utils.ErrorFields(err)...)
+		}
+		return
+	}
+	if user.EmailVerified {
+		return
+	}
+
+	wait, err := userTokenCooldown(ctx, user.UserID, models.TokenPurposeEmailVerification, config.GetConfig().EmailVerificationResendInterval)
+	if err != nil {
+		utils.Error("Failed to check verification email cooldown", append(utils.ErrorFields(err), zap.String("user_id", user.UserID))...)
+		return
+	}
+	if wait > 0 {
+		return
+	}
+
+	if err := sendVerificationEmail(ctx, user); err != nil {
+		utils.Error("Failed to send verification email", append(utils.ErrorFields(err), zap.String("user_id", user.UserID))...)
+	}
+}
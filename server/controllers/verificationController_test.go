@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/models"
+	"github.com/joey17520/magic-stream-app/utils"
+)
+
+func TestVerificationMessage(t *testing.T) {
+	raw, hash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		t.Fatalf("GenerateOpaqueToken: %v", err)
+	}
+
+	user := models.User{UserID: "user-1", Email: "bob@example.com", FirstName: "Bob"}
+	msg := verificationMessage(user, raw, "https://app.example.test", 48*time.Hour)
+	if msg.To != user.Email || !strings.Contains(msg.Body, "Bob") || !strings.Contains(msg.Body, "48h0m0s") {
+		t.Fatalf("message = %+v", msg)
+	}
+
+	link, err := url.Parse(linkPattern.FindString(msg.Body))
+	if err != nil {
+		t.Fatalf("parse link: %v", err)
+	}
+	if link.Host != "app.example.test" || link.Path != "/verify-email" {
+		t.Fatalf("link = %s, want https://app.example.test/verify-email", link)
+	}
+	if token := link.Query().Get("token"); utils.HashOpaqueToken(token) != hash {
+		t.Fatalf("token %q in link does not hash to the stored digest", token)
+	}
+}
+
+func TestVerificationHandlersRejectInvalidRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/verify-email", VerifyEmail())
+	router.POST("/verify-email/resend", ResendVerificationEmail())
+
+	tests := []struct {
+		method string
+		target string
+		body   string
+	}{
+		{method: http.MethodGet, target: "/verify-email"},
+		{method: http.MethodGet, target: "/verify-email?token="},
+		{method: http.MethodPost, target: "/verify-email/resend", body: `{"email":`},
+		{method: http.MethodPost, target: "/verify-email/resend", body: `{"email":"not-an-email"}`},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s %s %s: status = %d, want %d", tt.method, tt.target, tt.body, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+// TestAccountEmailResponsesAreUniform 后台名额用完时请求被丢弃，响应仍与正常发送时相同，不会访问数据库
+func TestAccountEmailResponsesAreUniform(t *testing.T) {
+	for range cap(accountEmailSlots) {
+		accountEmailSlots <- struct{}{}
+	}
+	t.Cleanup(func() {
+		for range cap(accountEmailSlots) {
+			<-accountEmailSlots
+		}
+	})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/verify-email/resend", ResendVerificationEmail())
+	router.POST("/password/forgot", ForgotPassword())
+
+	for _, target := range []string{"/verify-email/resend", "/password/forgot"} {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(`{"email":"someone@example.com"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK || rec.Header().Get("Retry-After") != "" {
+			t.Errorf("%s: status = %d, Retry-After = %q, want a plain 200", target, rec.Code, rec.Header().Get("Retry-After"))
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/database"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/models"
+	"github.com/joey17520/magic-stream-app/utils"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// maxWatchlistSize 每个档案片单的最大长度
+const maxWatchlistSize = 500
+
+var (
+	watchlistCollection             *mongo.Collection
+	watchlistCollectionsInitialized bool
+)
+
+// initWatchlistCollections 延迟初始化片单集合
+func initWatchlistCollections() {
+	if !watchlistCollectionsInitialized {
+		watchlistCollection = database.OpenCollection("watchlist")
+		watchlistCollectionsInitialized = true
+	}
+}
+
+// getWatchlistCollection 获取片单集合
+func getWatchlistCollection() *mongo.Collection {
+	initWatchlistCollections()
+	return watchlistCollection
+}
+
+// GetWatchlist 获取当前档案的片单，按加入时间倒序，附带电影信息
+func GetWatchlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		opts := options.Find().SetSort(bson.D{{Key: "added_at", Value: -1}})
+		cursor, err := getWatchlistCollection().Find(ctx, profileScope(userId, utils.GetProfileIdFromContext(c)), opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_watchlist")})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		items := []models.WatchlistItem{}
+		if err := cursor.All(ctx, &items); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_decoding_watchlist")})
+			return
+		}
+
+		movieIds := make([]string, 0, len(items))
+		for _, item := range items {
+			movieIds = append(movieIds, item.ImdbID)
+		}
+
+		movieFilter := restrictCertifications(c, bson.M{"imdb_id": bson.M{"$in": movieIds}}, "certification")
+		restrictAvailability(c, movieFilter, "availability")
+		movieCursor, err := getMovieCollection().Find(ctx, movieFilter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_movies")})
+			return
+		}
+		defer movieCursor.Close(ctx)
+
+		var movies []models.Movie
+		if err := movieCursor.All(ctx, &movies); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_decoding_movies")})
+			return
+		}
+
+		byId := make(map[string]*models.Movie, len(movies))
+		for i := range movies {
+			byId[movies[i].ImdbID] = &movies[i]
+		}
+
+		// 超出当前分级限制或当前地区不可观看的电影不出现在片单中
+		visible := make([]models.WatchlistItem, 0, len(items))
+		for _, item := range items {
+			if movie, ok := byId[item.ImdbID]; ok {
+				localized := localizeMovie(c, *movie)
+				item.Movie = &localized
+				visible = append(visible, item)
+			}
+		}
+
+		c.JSON(http.StatusOK, visible)
+	}
+}
+
+// AddToWatchlist 把电影加入当前档案的片单，重复加入不会改变原来的加入时间
+func AddToWatchlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+
+		movieId := c.Param("imdb_id")
+		if movieId == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "movie_id_required")})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var movie models.Movie
+		if err := getMovieCollection().FindOne(ctx, bson.M{"imdb_id": movieId}).Decode(&movie); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "movie_not_found")})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_movie")})
+			return
+		}
+		if !movieAvailableForRequest(c, movie) {
+			respondUnavailable(c)
+			return
+		}
+		if !utils.CertificationAllowed(movie.Certification, utils.GetMaxCertificationFromContext(c)) {
+			respondRestricted(c)
+			return
+		}
+
+		profileId := utils.GetProfileIdFromContext(c)
+		scope := profileScope(userId, profileId)
+
+		size, err := getWatchlistCollection().CountDocuments(ctx, scope)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_fetching_watchlist")})
+			return
+		}
+		if size >= maxWatchlistSize {
+			c.JSON(http.StatusConflict, gin.H{"error": i18n.Msg(c, "watchlist_full")})
+			return
+		}
+
+		item := models.WatchlistItem{
+			UserID:    userId,
+			ProfileID: profileId,
+			ImdbID:    movieId,
+			AddedAt:   time.Now(),
+		}
+
+		filter := profileScope(userId, profileId)
+		filter["imdb_id"] = movieId
+		opts := options.UpdateOne().SetUpsert(true)
+		if _, err := getWatchlistCollection().UpdateOne(ctx, filter, bson.M{"$setOnInsert": item}, opts); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_updating_watchlist")})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": i18n.Msg(c, "watchlist_added")})
+	}
+}
+
+// RemoveFromWatchlist 把电影移出当前档案的片单
+func RemoveFromWatchlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		filter := profileScope(userId, utils.GetProfileIdFromContext(c))
+		filter["imdb_id"] = c.Param("imdb_id")
+
+		result, err := getWatchlistCollection().DeleteOne(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_updating_watchlist")})
+			return
+		}
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": i18n.Msg(c, "movie_not_in_watchlist")})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": i18n.Msg(c, "watchlist_removed")})
+	}
+}
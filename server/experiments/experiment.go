@@ -0,0 +1,94 @@
+package experiments
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Variant 实验中的一个分组
+type Variant struct {
+	Name     string `json:"name"`
+	Strategy string `json:"strategy"`
+	Weight   int    `json:"weight"`
+}
+
+// Experiment 推荐策略A/B实验
+type Experiment struct {
+	Name     string    `json:"name"`
+	Variants []Variant `json:"variants"`
+}
+
+// Parse 解析实验配置。variants格式为逗号分隔的 分组名=策略:权重，例如
+// "control=ranking:50,treatment=diverse:50"
+func Parse(name, variants string) (*Experiment, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("experiment name is required")
+	}
+
+	experiment := &Experiment{Name: name}
+	seen := make(map[string]bool)
+
+	for _, item := range strings.Split(variants, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		variantName, rest, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid variant %q, expected name=strategy:weight", item)
+		}
+		strategy, weightStr, ok := strings.Cut(rest, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid variant %q, expected name=strategy:weight", item)
+		}
+
+		weight, err := strconv.Atoi(strings.TrimSpace(weightStr))
+		if err != nil || weight <= 0 {
+			return nil, fmt.Errorf("invalid weight for variant %q", variantName)
+		}
+
+		variantName = strings.TrimSpace(variantName)
+		if seen[variantName] {
+			return nil, fmt.Errorf("duplicate variant %q", variantName)
+		}
+		seen[variantName] = true
+
+		experiment.Variants = append(experiment.Variants, Variant{
+			Name:     variantName,
+			Strategy: strings.TrimSpace(strategy),
+			Weight:   weight,
+		})
+	}
+
+	if len(experiment.Variants) < 2 {
+		return nil, errors.New("experiment needs at least two variants")
+	}
+
+	return experiment, nil
+}
+
+// Assign 根据用户ID的哈希确定性地分配分组，同一用户在同一实验中始终落在同一分组
+func (e *Experiment) Assign(userId string) Variant {
+	totalWeight := 0
+	for _, variant := range e.Variants {
+		totalWeight += variant.Weight
+	}
+
+	sum := sha256.Sum256([]byte(e.Name + ":" + userId))
+	bucket := int(binary.BigEndian.Uint64(sum[:8]) % uint64(totalWeight))
+
+	for _, variant := range e.Variants {
+		if bucket < variant.Weight {
+			return variant
+		}
+		bucket -= variant.Weight
+	}
+
+	return e.Variants[len(e.Variants)-1]
+}
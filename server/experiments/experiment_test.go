@@ -0,0 +1,130 @@
+package experiments
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		expName  string
+		variants string
+		want     []Variant
+		wantErr  bool
+	}{
+		{
+			name:     "two variants",
+			expName:  "rec-2026",
+			variants: "control=ranking:50,treatment=diverse:50",
+			want:     []Variant{{"control", "ranking", 50}, {"treatment", "diverse", 50}},
+		},
+		{
+			name:     "spaces and empty items",
+			expName:  " rec ",
+			variants: " a = ranking : 1 ,, b=diverse:3 ",
+			want:     []Variant{{"a", "ranking", 1}, {"b", "diverse", 3}},
+		},
+		{name: "missing name", variants: "a=ranking:1,b=diverse:1", wantErr: true},
+		{name: "single variant", expName: "x", variants: "a=ranking:1", wantErr: true},
+		{name: "missing strategy", expName: "x", variants: "a=1,b=diverse:1", wantErr: true},
+		{name: "missing weight", expName: "x", variants: "a=ranking,b=diverse:1", wantErr: true},
+		{name: "zero weight", expName: "x", variants: "a=ranking:0,b=diverse:1", wantErr: true},
+		{name: "duplicate variant", expName: "x", variants: "a=ranking:1,a=diverse:1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			experiment, err := Parse(tt.expName, tt.variants)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Parse succeeded with %+v, want error", experiment)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if len(experiment.Variants) != len(tt.want) {
+				t.Fatalf("variants = %+v, want %+v", experiment.Variants, tt.want)
+			}
+			for i := range tt.want {
+				if experiment.Variants[i] != tt.want[i] {
+					t.Fatalf("variants = %+v, want %+v", experiment.Variants, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAssignDistribution(t *testing.T) {
+	const users = 20000
+
+	tests := []struct {
+		name     string
+		variants string
+	}{
+		{name: "even split", variants: "control=ranking:50,treatment=diverse:50"},
+		{name: "uneven split", variants: "control=ranking:90,treatment=diverse:10"},
+		{name: "three variants", variants: "a=ranking:1,b=diverse:2,c=diverse:1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			experiment, err := Parse("rec", tt.variants)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			totalWeight := 0
+			for _, variant := range experiment.Variants {
+				totalWeight += variant.Weight
+			}
+
+			counts := map[string]int{}
+			for i := range users {
+				counts[experiment.Assign(fmt.Sprintf("user-%d", i)).Name]++
+			}
+
+			for _, variant := range experiment.Variants {
+				want := float64(variant.Weight) / float64(totalWeight)
+				got := float64(counts[variant.Name]) / users
+				// 20000个用户时抽样误差远小于2个百分点
+				if math.Abs(got-want) > 0.02 {
+					t.Errorf("variant %s got %.3f of users, want %.3f", variant.Name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestAssignSticky(t *testing.T) {
+	experiment, err := Parse("rec", "control=ranking:50,treatment=diverse:50")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	renamed, err := Parse("rec-v2", "control=ranking:50,treatment=diverse:50")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	moved := 0
+	for i := range 1000 {
+		userId := fmt.Sprintf("user-%d", i)
+		first := experiment.Assign(userId)
+		for range 5 {
+			if again := experiment.Assign(userId); again != first {
+				t.Fatalf("user %s assigned to %s then %s", userId, first.Name, again.Name)
+			}
+		}
+		if renamed.Assign(userId).Name != first.Name {
+			moved++
+		}
+	}
+
+	// 分组按实验名称和用户ID哈希，新实验会重新打散用户，而不是沿用上一个实验的分组
+	if moved < 400 || moved > 600 {
+		t.Fatalf("%d of 1000 users changed group in a new experiment, want about half", moved)
+	}
+}
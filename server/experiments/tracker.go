@@ -0,0 +1,190 @@
+package experiments
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// 实验事件类型
+const (
+	EventExposure = "exposure"
+	OutcomeClick  = "click"
+	OutcomeWatch  = "watch"
+)
+
+// Event 实验曝光或转化事件
+type Event struct {
+	Experiment string    `bson:"experiment" json:"experiment"`
+	Variant    string    `bson:"variant" json:"variant"`
+	UserID     string    `bson:"user_id" json:"user_id"`
+	Type       string    `bson:"type" json:"type"`
+	MovieIDs   []string  `bson:"movie_ids,omitempty" json:"movie_ids,omitempty"`
+	ImdbID     string    `bson:"imdb_id,omitempty" json:"imdb_id,omitempty"`
+	CreatedAt  time.Time `bson:"created_at" json:"created_at"`
+}
+
+// VariantMetrics 单个分组的统计数据
+type VariantMetrics struct {
+	Variant        string  `json:"variant"`
+	Exposures      int64   `json:"exposures"`
+	ExposedUsers   int64   `json:"exposed_users"`
+	Clicks         int64   `json:"clicks"`
+	Watches        int64   `json:"watches"`
+	ConvertedUsers int64   `json:"converted_users"`
+	ConversionRate float64 `json:"conversion_rate"`
+}
+
+// Tracker 记录实验曝光与转化，并计算各分组的转化指标
+type Tracker struct {
+	collection *mongo.Collection
+}
+
+// NewTracker 创建实验事件记录器
+func NewTracker(collection *mongo.Collection) *Tracker {
+	return &Tracker{collection: collection}
+}
+
+// RecordExposure 记录用户看到了某个分组给出的推荐结果
+func (t *Tracker) RecordExposure(ctx context.Context, experiment, variant, userId string, movieIds []string) error {
+	_, err := t.collection.InsertOne(ctx, Event{
+		Experiment: experiment,
+		Variant:    variant,
+		UserID:     userId,
+		Type:       EventExposure,
+		MovieIDs:   movieIds,
+		CreatedAt:  time.Now(),
+	})
+	return err
+}
+
+// RecordOutcome 记录点击或观看转化。只有当电影曾出现在该用户的曝光结果中时才计入，
+// 返回值表示是否计入了转化。
+func (t *Tracker) RecordOutcome(ctx context.Context, experiment, variant, userId, movieId, outcome string) (bool, error) {
+	count, err := t.collection.CountDocuments(ctx, bson.M{
+		"experiment": experiment,
+		"variant":    variant,
+		"user_id":    userId,
+		"type":       EventExposure,
+		"movie_ids":  movieId,
+	})
+	if err != nil {
+		return false, err
+	}
+	if count == 0 {
+		return false, nil
+	}
+
+	_, err = t.collection.InsertOne(ctx, Event{
+		Experiment: experiment,
+		Variant:    variant,
+		UserID:     userId,
+		Type:       outcome,
+		ImdbID:     movieId,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// DeleteUserEvents 删除用户的所有实验事件，用于账户注销后清除个人数据
+func (t *Tracker) DeleteUserEvents(ctx context.Context, userId string) error {
+	_, err := t.collection.DeleteMany(ctx, bson.M{"user_id": userId})
+	return err
+}
+
+// Metrics 统计实验各分组的曝光、转化次数和用户转化率。
+// 先按分组、类型和用户分组得到每个用户的事件数，再汇总，避免把全部用户ID收集到一个数组中
+func (t *Tracker) Metrics(ctx context.Context, experiment *Experiment) ([]VariantMetrics, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"experiment": experiment.Name}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"variant": "$variant", "type": "$type", "user_id": "$user_id"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$facet", Value: bson.M{
+			"by_type": mongo.Pipeline{
+				{{Key: "$group", Value: bson.M{
+					"_id":   bson.M{"variant": "$_id.variant", "type": "$_id.type"},
+					"count": bson.M{"$sum": "$count"},
+					"users": bson.M{"$sum": 1},
+				}}},
+			},
+			"converted": mongo.Pipeline{
+				{{Key: "$match", Value: bson.M{"_id.type": bson.M{"$ne": EventExposure}}}},
+				{{Key: "$group", Value: bson.M{"_id": bson.M{"variant": "$_id.variant", "user_id": "$_id.user_id"}}}},
+				{{Key: "$group", Value: bson.M{"_id": "$_id.variant", "users": bson.M{"$sum": 1}}}},
+			},
+		}}},
+	}
+
+	cursor, err := t.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var facets []struct {
+		ByType []struct {
+			ID struct {
+				Variant string `bson:"variant"`
+				Type    string `bson:"type"`
+			} `bson:"_id"`
+			Count int64 `bson:"count"`
+			Users int64 `bson:"users"`
+		} `bson:"by_type"`
+		Converted []struct {
+			Variant string `bson:"_id"`
+			Users   int64  `bson:"users"`
+		} `bson:"converted"`
+	}
+	if err := cursor.All(ctx, &facets); err != nil {
+		return nil, err
+	}
+
+	byVariant := make(map[string]*VariantMetrics, len(experiment.Variants))
+	result := make([]VariantMetrics, len(experiment.Variants))
+	for i, variant := range experiment.Variants {
+		result[i].Variant = variant.Name
+		byVariant[variant.Name] = &result[i]
+	}
+	if len(facets) == 0 {
+		return result, nil
+	}
+
+	for _, row := range facets[0].ByType {
+		metrics, ok := byVariant[row.ID.Variant]
+		if !ok {
+			// 已从配置中移除的分组
+			continue
+		}
+
+		switch row.ID.Type {
+		case EventExposure:
+			metrics.Exposures = row.Count
+			metrics.ExposedUsers = row.Users
+		case OutcomeClick:
+			metrics.Clicks = row.Count
+		case OutcomeWatch:
+			metrics.Watches = row.Count
+		}
+	}
+
+	for _, row := range facets[0].Converted {
+		if metrics, ok := byVariant[row.Variant]; ok {
+			metrics.ConvertedUsers = row.Users
+		}
+	}
+
+	for i := range result {
+		if result[i].ExposedUsers > 0 {
+			result[i].ConversionRate = float64(result[i].ConvertedUsers) / float64(result[i].ExposedUsers)
+		}
+	}
+
+	return result, nil
+}
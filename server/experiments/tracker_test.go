@@ -0,0 +1,102 @@
+package experiments
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// testTracker 在临时数据库中创建Tracker，未设置MONGODB_TEST_URI时跳过测试
+func testTracker(t *testing.T) *Tracker {
+	t.Helper()
+
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI is not set")
+	}
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect to MongoDB: %v", err)
+	}
+
+	db := client.Database("magicstream_test_" + bson.NewObjectID().Hex())
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = db.Drop(ctx)
+		_ = client.Disconnect(ctx)
+	})
+
+	return NewTracker(db.Collection("experiment_events"))
+}
+
+func TestTrackerMetrics(t *testing.T) {
+	tracker := testTracker(t)
+	ctx := context.Background()
+	experiment := &Experiment{Name: "rec", Variants: []Variant{{"control", "ranking", 1}, {"treatment", "diverse", 1}}}
+
+	// control：u1看到两次推荐并点击、观看同一部电影，u2只看到推荐；treatment：u3点击了未推荐给他的电影
+	for _, exposure := range []struct{ variant, user string }{
+		{"control", "u1"}, {"control", "u1"}, {"control", "u2"}, {"treatment", "u3"},
+	} {
+		if err := tracker.RecordExposure(ctx, "rec", exposure.variant, exposure.user, []string{"tt1", "tt2"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, outcome := range []string{OutcomeClick, OutcomeWatch} {
+		if counted, err := tracker.RecordOutcome(ctx, "rec", "control", "u1", "tt1", outcome); err != nil || !counted {
+			t.Fatalf("RecordOutcome(%s) = %v, %v", outcome, counted, err)
+		}
+	}
+	if counted, err := tracker.RecordOutcome(ctx, "rec", "treatment", "u3", "tt9", OutcomeClick); err != nil || counted {
+		t.Fatalf("outcome for a movie that was never shown: counted = %v, err = %v", counted, err)
+	}
+
+	metrics, err := tracker.Metrics(ctx, experiment)
+	if err != nil {
+		t.Fatalf("Metrics: %v", err)
+	}
+
+	control := metrics[0]
+	if control.Exposures != 3 || control.ExposedUsers != 2 || control.Clicks != 1 || control.Watches != 1 {
+		t.Errorf("control = %+v", control)
+	}
+	// 同一用户的点击和观看只算一个转化用户
+	if control.ConvertedUsers != 1 || control.ConversionRate != 0.5 {
+		t.Errorf("control conversion = %d users, rate %v, want 1 and 0.5", control.ConvertedUsers, control.ConversionRate)
+	}
+
+	treatment := metrics[1]
+	if treatment.Exposures != 1 || treatment.ExposedUsers != 1 || treatment.ConvertedUsers != 0 || treatment.ConversionRate != 0 {
+		t.Errorf("treatment = %+v", treatment)
+	}
+
+	if err := tracker.DeleteUserEvents(ctx, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	metrics, err = tracker.Metrics(ctx, experiment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics[0].ExposedUsers != 1 || metrics[0].ConvertedUsers != 0 {
+		t.Errorf("after deleting u1: control = %+v", metrics[0])
+	}
+}
+
+func TestTrackerMetricsWithoutEvents(t *testing.T) {
+	tracker := testTracker(t)
+	experiment := &Experiment{Name: "empty", Variants: []Variant{{"a", "ranking", 1}}}
+
+	metrics, err := tracker.Metrics(context.Background(), experiment)
+	if err != nil {
+		t.Fatalf("Metrics: %v", err)
+	}
+	if len(metrics) != 1 || metrics[0] != (VariantMetrics{Variant: "a"}) {
+		t.Fatalf("metrics = %+v, want zero values for every variant", metrics)
+	}
+}
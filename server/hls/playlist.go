@@ -0,0 +1,200 @@
+package hls
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ContentType m3u8播放列表的媒体类型
+const ContentType = "application/vnd.apple.mpegurl"
+
+// maxSegments 一个媒体播放列表最多包含的分片数
+const maxSegments = 20000
+
+// 解析媒体播放列表的错误
+var (
+	ErrInvalidPlaylist = errors.New("invalid media playlist")
+	ErrUnsupported     = errors.New("unsupported media playlist")
+)
+
+// Segment 媒体播放列表中的一个分片，Duration单位为秒
+type Segment struct {
+	URI      string
+	Duration float64
+}
+
+// MediaPlaylist 媒体播放列表，InitURI为fMP4分片的初始化片段（#EXT-X-MAP），没有时为空
+type MediaPlaylist struct {
+	InitURI  string
+	Segments []Segment
+}
+
+// TargetDuration 最长分片时长向上取整，用于#EXT-X-TARGETDURATION
+func (p *MediaPlaylist) TargetDuration() int {
+	target := 1
+	for _, segment := range p.Segments {
+		target = max(target, int(math.Ceil(segment.Duration)))
+	}
+	return target
+}
+
+// ParseMediaPlaylist 解析打包工具（如ffmpeg）生成的点播媒体播放列表，只读取分片时长、分片地址和初始化片段；
+// 加密分片和字节范围分片不支持
+func ParseMediaPlaylist(r io.Reader) (*MediaPlaylist, error) {
+	scanner := bufio.NewScanner(r)
+	playlist := &MediaPlaylist{}
+
+	first := true
+	duration := -1.0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if first {
+			if line != "#EXTM3U" {
+				return nil, ErrInvalidPlaylist
+			}
+			first = false
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed <= 0 || math.IsInf(parsed, 0) {
+				return nil, fmt.Errorf("%w: bad #EXTINF %q", ErrInvalidPlaylist, line)
+			}
+			duration = parsed
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			uri, ok := attribute(strings.TrimPrefix(line, "#EXT-X-MAP:"), "URI")
+			if !ok || uri == "" {
+				return nil, fmt.Errorf("%w: bad #EXT-X-MAP %q", ErrInvalidPlaylist, line)
+			}
+			if _, hasRange := attribute(strings.TrimPrefix(line, "#EXT-X-MAP:"), "BYTERANGE"); hasRange {
+				return nil, fmt.Errorf("%w: byte range init segment", ErrUnsupported)
+			}
+			playlist.InitURI = uri
+		case strings.HasPrefix(line, "#EXT-X-KEY:"):
+			if method, _ := attribute(strings.TrimPrefix(line, "#EXT-X-KEY:"), "METHOD"); method != "NONE" {
+				return nil, fmt.Errorf("%w: encrypted segments", ErrUnsupported)
+			}
+		case strings.HasPrefix(line, "#EXT-X-BYTERANGE:"):
+			return nil, fmt.Errorf("%w: byte range segments", ErrUnsupported)
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			return nil, fmt.Errorf("%w: master playlist given", ErrInvalidPlaylist)
+		case strings.HasPrefix(line, "#"):
+			// 其他标签和注释由生成播放列表时重新输出或不需要
+		default:
+			if duration < 0 {
+				return nil, fmt.Errorf("%w: segment %q without #EXTINF", ErrInvalidPlaylist, line)
+			}
+			if len(playlist.Segments) >= maxSegments {
+				return nil, fmt.Errorf("%w: more than %d segments", ErrUnsupported, maxSegments)
+			}
+			playlist.Segments = append(playlist.Segments, Segment{URI: line, Duration: duration})
+			duration = -1
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if first || len(playlist.Segments) == 0 {
+		return nil, ErrInvalidPlaylist
+	}
+	return playlist, nil
+}
+
+// attribute 从标签的属性列表中读取一个属性，带引号的值去掉引号
+func attribute(list, name string) (string, bool) {
+	for len(list) > 0 {
+		var key string
+		key, list, _ = strings.Cut(list, "=")
+		var value string
+		if strings.HasPrefix(list, `"`) {
+			end := strings.Index(list[1:], `"`)
+			if end < 0 {
+				return "", false
+			}
+			value = list[1 : end+1]
+			list = strings.TrimPrefix(list[end+2:], ",")
+		} else {
+			value, list, _ = strings.Cut(list, ",")
+		}
+		if strings.TrimSpace(key) == name {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// Variant 主播放列表中的一个码率版本，URI为其媒体播放列表地址
+type Variant struct {
+	URI       string
+	Bandwidth int
+	Width     int
+	Height    int
+	Codecs    string
+}
+
+// WriteMaster 生成主播放列表，码率版本按带宽从低到高排列
+func WriteMaster(variants []Variant) []byte {
+	sorted := append([]Variant(nil), variants...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Bandwidth < sorted[j].Bandwidth })
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+	for _, variant := range sorted {
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d", variant.Bandwidth)
+		if variant.Width > 0 && variant.Height > 0 {
+			fmt.Fprintf(&b, ",RESOLUTION=%dx%d", variant.Width, variant.Height)
+		}
+		if variant.Codecs != "" {
+			fmt.Fprintf(&b, ",CODECS=%q", variant.Codecs)
+		}
+		b.WriteString("\n" + variant.URI + "\n")
+	}
+	return []byte(b.String())
+}
+
+// WriteMedia 生成点播媒体播放列表
+func WriteMedia(playlist *MediaPlaylist) []byte {
+	// #EXT-X-MAP用于非I帧列表需要版本6及以上
+	version := 3
+	if playlist.InitURI != "" {
+		version = 6
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-VERSION:%d\n#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n",
+		version, playlist.TargetDuration())
+	if playlist.InitURI != "" {
+		fmt.Fprintf(&b, "#EXT-X-MAP:URI=%q\n", playlist.InitURI)
+	}
+	for _, segment := range playlist.Segments {
+		fmt.Fprintf(&b, "#EXTINF:%s,\n%s\n", strconv.FormatFloat(segment.Duration, 'f', 3, 64), segment.URI)
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+	return []byte(b.String())
+}
+
+// segmentContentTypes 支持的分片格式
+var segmentContentTypes = map[string]string{
+	".ts":  "video/mp2t",
+	".m4s": "video/iso.segment",
+	".mp4": "video/mp4",
+	".aac": "audio/aac",
+}
+
+// SegmentContentType 按扩展名返回分片的媒体类型，不支持的格式返回空字符串
+func SegmentContentType(name string) string {
+	return segmentContentTypes[strings.ToLower(path.Ext(name))]
+}
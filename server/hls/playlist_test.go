@@ -0,0 +1,246 @@
+package hls
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// ffmpegPlaylist ffmpeg -f hls生成的TS分片播放列表
+const ffmpegPlaylist = `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXTINF:10.010000,
+seg_000.ts
+#EXTINF:9.342000,
+seg_001.ts
+
+#EXTINF:4.5,title
+seg_002.ts
+#EXT-X-ENDLIST
+`
+
+// fmp4Playlist 带初始化片段的fMP4播放列表
+const fmp4Playlist = `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:6
+#EXT-X-MAP:URI="init.mp4"
+#EXT-X-KEY:METHOD=NONE
+#EXTINF:6.000,
+seg_0.m4s
+#EXTINF:2.25,
+seg_1.m4s
+#EXT-X-ENDLIST
+`
+
+func TestParseMediaPlaylist(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  *MediaPlaylist
+	}{
+		{
+			name:  "ffmpeg ts",
+			input: ffmpegPlaylist,
+			want: &MediaPlaylist{Segments: []Segment{
+				{URI: "seg_000.ts", Duration: 10.01},
+				{URI: "seg_001.ts", Duration: 9.342},
+				{URI: "seg_002.ts", Duration: 4.5},
+			}},
+		},
+		{
+			name:  "fmp4 with init segment",
+			input: fmp4Playlist,
+			want: &MediaPlaylist{InitURI: "init.mp4", Segments: []Segment{
+				{URI: "seg_0.m4s", Duration: 6},
+				{URI: "seg_1.m4s", Duration: 2.25},
+			}},
+		},
+		{
+			name:  "crlf line endings",
+			input: "#EXTM3U\r\n#EXTINF:3,\r\na.ts\r\n",
+			want:  &MediaPlaylist{Segments: []Segment{{URI: "a.ts", Duration: 3}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMediaPlaylist(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("ParseMediaPlaylist: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("playlist = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMediaPlaylistRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr error
+	}{
+		{name: "empty", input: "", wantErr: ErrInvalidPlaylist},
+		{name: "missing header", input: "#EXTINF:10,\nseg.ts\n", wantErr: ErrInvalidPlaylist},
+		{name: "no segments", input: "#EXTM3U\n#EXT-X-ENDLIST\n", wantErr: ErrInvalidPlaylist},
+		{name: "segment without extinf", input: "#EXTM3U\nseg.ts\n", wantErr: ErrInvalidPlaylist},
+		{name: "bad duration", input: "#EXTM3U\n#EXTINF:abc,\nseg.ts\n", wantErr: ErrInvalidPlaylist},
+		{name: "zero duration", input: "#EXTM3U\n#EXTINF:0,\nseg.ts\n", wantErr: ErrInvalidPlaylist},
+		{name: "infinite duration", input: "#EXTM3U\n#EXTINF:Inf,\nseg.ts\n", wantErr: ErrInvalidPlaylist},
+		{name: "map without uri", input: "#EXTM3U\n#EXT-X-MAP:BYTERANGE=\"100@0\"\n#EXTINF:1,\nseg.m4s\n", wantErr: ErrInvalidPlaylist},
+		{
+			name:    "master playlist",
+			input:   "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=800000\nlow/index.m3u8\n",
+			wantErr: ErrInvalidPlaylist,
+		},
+		{
+			name:    "aes-128 key",
+			input:   "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"key.bin\"\n#EXTINF:10,\nseg.ts\n",
+			wantErr: ErrUnsupported,
+		},
+		{
+			name:    "sample-aes key",
+			input:   "#EXTM3U\n#EXT-X-KEY:METHOD=SAMPLE-AES,URI=\"key.bin\",KEYFORMAT=\"identity\"\n#EXTINF:10,\nseg.ts\n",
+			wantErr: ErrUnsupported,
+		},
+		{
+			name:    "key without method",
+			input:   "#EXTM3U\n#EXT-X-KEY:URI=\"key.bin\"\n#EXTINF:10,\nseg.ts\n",
+			wantErr: ErrUnsupported,
+		},
+		{
+			name:    "byte range segment",
+			input:   "#EXTM3U\n#EXTINF:10,\n#EXT-X-BYTERANGE:1000@0\nmovie.ts\n",
+			wantErr: ErrUnsupported,
+		},
+		{
+			name:    "byte range init segment",
+			input:   "#EXTM3U\n#EXT-X-MAP:URI=\"movie.mp4\",BYTERANGE=\"800@0\"\n#EXTINF:10,\nseg.m4s\n",
+			wantErr: ErrUnsupported,
+		},
+		{
+			name:    "too many segments",
+			input:   "#EXTM3U\n" + strings.Repeat("#EXTINF:1,\nseg.ts\n", maxSegments+1),
+			wantErr: ErrUnsupported,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			playlist, err := ParseMediaPlaylist(strings.NewReader(tt.input))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseMediaPlaylist = %+v, %v, want %v", playlist, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteMedia(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist *MediaPlaylist
+		want     string
+	}{
+		{
+			name: "ts segments",
+			playlist: &MediaPlaylist{Segments: []Segment{
+				{URI: "seg_000.ts", Duration: 10.01},
+				{URI: "seg_001.ts", Duration: 4.5},
+			}},
+			want: "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:11\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n" +
+				"#EXTINF:10.010,\nseg_000.ts\n#EXTINF:4.500,\nseg_001.ts\n#EXT-X-ENDLIST\n",
+		},
+		{
+			name: "fmp4 needs version 6",
+			playlist: &MediaPlaylist{InitURI: "init.mp4", Segments: []Segment{
+				{URI: "seg_0.m4s", Duration: 6},
+			}},
+			want: "#EXTM3U\n#EXT-X-VERSION:6\n#EXT-X-TARGETDURATION:6\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n" +
+				"#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:6.000,\nseg_0.m4s\n#EXT-X-ENDLIST\n",
+		},
+		{
+			name:     "short segments",
+			playlist: &MediaPlaylist{Segments: []Segment{{URI: "a.ts", Duration: 0.2}}},
+			want: "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:1\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n" +
+				"#EXTINF:0.200,\na.ts\n#EXT-X-ENDLIST\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(WriteMedia(tt.playlist)); got != tt.want {
+				t.Fatalf("WriteMedia =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMediaPlaylistRoundTrip(t *testing.T) {
+	for _, input := range []string{ffmpegPlaylist, fmp4Playlist} {
+		parsed, err := ParseMediaPlaylist(strings.NewReader(input))
+		if err != nil {
+			t.Fatalf("ParseMediaPlaylist: %v", err)
+		}
+
+		written := WriteMedia(parsed)
+		reparsed, err := ParseMediaPlaylist(bytes.NewReader(written))
+		if err != nil {
+			t.Fatalf("ParseMediaPlaylist of written playlist: %v\n%s", err, written)
+		}
+		if !reflect.DeepEqual(reparsed, parsed) {
+			t.Fatalf("round trip = %+v, want %+v", reparsed, parsed)
+		}
+		if !bytes.Equal(WriteMedia(reparsed), written) {
+			t.Fatalf("writing the reparsed playlist changed the output:\n%s", written)
+		}
+	}
+}
+
+func TestWriteMaster(t *testing.T) {
+	variants := []Variant{
+		{URI: "high/index.m3u8", Bandwidth: 5000000, Width: 1920, Height: 1080, Codecs: "avc1.640028,mp4a.40.2"},
+		{URI: "low/index.m3u8", Bandwidth: 800000},
+		{URI: "mid/index.m3u8", Bandwidth: 2500000, Width: 1280, Height: 720},
+	}
+
+	want := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-INDEPENDENT-SEGMENTS\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=800000\nlow/index.m3u8\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=2500000,RESOLUTION=1280x720\nmid/index.m3u8\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=5000000,RESOLUTION=1920x1080,CODECS=\"avc1.640028,mp4a.40.2\"\nhigh/index.m3u8\n"
+	if got := string(WriteMaster(variants)); got != want {
+		t.Fatalf("WriteMaster =\n%s\nwant\n%s", got, want)
+	}
+
+	// 排序不能修改调用方的切片
+	if variants[0].URI != "high/index.m3u8" {
+		t.Fatalf("WriteMaster reordered the input: %+v", variants)
+	}
+
+	// 主播放列表不能被当作媒体播放列表解析
+	if _, err := ParseMediaPlaylist(bytes.NewReader(WriteMaster(variants))); !errors.Is(err, ErrInvalidPlaylist) {
+		t.Fatalf("ParseMediaPlaylist of a master playlist = %v, want %v", err, ErrInvalidPlaylist)
+	}
+}
+
+func TestSegmentContentType(t *testing.T) {
+	tests := map[string]string{
+		"seg_000.ts":  "video/mp2t",
+		"SEG_000.TS":  "video/mp2t",
+		"seg_0.m4s":   "video/iso.segment",
+		"init.mp4":    "video/mp4",
+		"audio.aac":   "audio/aac",
+		"index.m3u8":  "",
+		"../etc/pass": "",
+	}
+	for name, want := range tests {
+		if got := SegmentContentType(name); got != want {
+			t.Errorf("SegmentContentType(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package i18n
+
+import "github.com/gin-gonic/gin"
+
+// 上下文中保存语言信息的键，由Locale中间件写入
+const (
+	languageKey    = "language"
+	preferencesKey = "languagePreferences"
+)
+
+// SetContext 解析请求的Accept-Language并把协商结果写入上下文，返回协商出的消息语言
+func SetContext(c *gin.Context) string {
+	preferences := ParseAcceptLanguage(c.GetHeader("Accept-Language"))
+	language := Negotiate(preferences)
+	c.Set(preferencesKey, preferences)
+	c.Set(languageKey, language)
+	return language
+}
+
+// FromContext 获取当前请求的消息语言；没有经过Locale中间件时直接解析请求头
+func FromContext(c *gin.Context) string {
+	if language := c.GetString(languageKey); language != "" {
+		return language
+	}
+	return SetContext(c)
+}
+
+// PreferencesFromContext 获取当前请求按优先级排列的语言标签，用于选择电影标题等内容的语言
+func PreferencesFromContext(c *gin.Context) []string {
+	if _, ok := c.Get(preferencesKey); !ok {
+		SetContext(c)
+	}
+	return c.GetStringSlice(preferencesKey)
+}
+
+// Msg 返回消息ID在当前请求语言中的文本
+func Msg(c *gin.Context, key string, args ...any) string {
+	return T(FromContext(c), key, args...)
+}
@@ -0,0 +1,178 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxPreferences 最多使用请求头中的前几个语言
+const maxPreferences = 10
+
+// DefaultLanguage 请求没有指定或不支持所指定的语言时使用的语言，消息目录中缺少的消息也回退到该语言
+const DefaultLanguage = "en"
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// catalogs 各语言的消息目录，键为语言代码（文件名），值为消息ID到文本的映射
+var catalogs = loadCatalogs()
+
+// loadCatalogs 读取内嵌的消息目录，目录文件随程序一起编译，格式错误属于编程错误
+func loadCatalogs() map[string]map[string]string {
+	entries, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+
+	result := make(map[string]map[string]string, len(entries))
+	for _, entry := range entries {
+		data, err := localeFiles.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("invalid message catalog %s: %v", entry.Name(), err))
+		}
+		result[strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))] = messages
+	}
+	return result
+}
+
+// Languages 返回有消息目录的语言
+func Languages() []string {
+	languages := make([]string, 0, len(catalogs))
+	for language := range catalogs {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// T 返回消息ID在指定语言中的文本，args不为空时按fmt格式化；
+// 该语言缺少此消息时回退到默认语言，仍然没有时返回消息ID本身
+func T(language, key string, args ...any) string {
+	message, ok := catalogs[language][key]
+	if !ok {
+		if message, ok = catalogs[DefaultLanguage][key]; !ok {
+			message = key
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
+
+// ParseAcceptLanguage 解析Accept-Language请求头，按权重从高到低返回语言标签，忽略通配符、格式不正确和权重为0的语言
+func ParseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag    string
+		weight float64
+	}
+
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if !validTag(tag) {
+			continue
+		}
+
+		weight := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			weight = parsed
+		}
+		if weight <= 0 {
+			continue
+		}
+		tags = append(tags, weighted{tag: tag, weight: weight})
+	}
+
+	// 权重相同的语言保持请求头中的顺序
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].weight > tags[j].weight })
+
+	result := make([]string, 0, min(len(tags), maxPreferences))
+	for _, tag := range tags[:min(len(tags), maxPreferences)] {
+		result = append(result, tag.tag)
+	}
+	return result
+}
+
+// validTag 语言标签只允许字母、数字和连字符；标签会被用作查询字段名，不能包含其他字符
+func validTag(tag string) bool {
+	if tag == "" || len(tag) > 35 {
+		return false
+	}
+	for _, r := range tag {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// Negotiate 从按优先级排列的语言标签中选出第一个有消息目录的语言，先精确匹配再按主语言匹配（zh-CN匹配zh）
+func Negotiate(preferences []string) string {
+	for _, tag := range preferences {
+		if _, ok := catalogs[strings.ToLower(tag)]; ok {
+			return strings.ToLower(tag)
+		}
+		if _, ok := catalogs[baseLanguage(tag)]; ok {
+			return baseLanguage(tag)
+		}
+	}
+	return DefaultLanguage
+}
+
+// Pick 按语言优先级从多语言文本中选出一个：依次尝试每个语言标签的精确匹配、主语言匹配和同一主语言的其他地区，
+// 都没有时返回false，调用方使用原始文本
+func Pick(values map[string]string, preferences []string) (string, bool) {
+	if len(values) == 0 {
+		return "", false
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	// 同一主语言有多个地区时结果保持稳定
+	slices.Sort(keys)
+
+	for _, tag := range preferences {
+		base := baseLanguage(tag)
+		for _, key := range keys {
+			if strings.EqualFold(key, tag) && values[key] != "" {
+				return values[key], true
+			}
+		}
+		for _, key := range keys {
+			if strings.EqualFold(key, base) && values[key] != "" {
+				return values[key], true
+			}
+		}
+		for _, key := range keys {
+			if baseLanguage(key) == base && values[key] != "" {
+				return values[key], true
+			}
+		}
+	}
+	return "", false
+}
+
+// baseLanguage 返回语言标签的主语言部分（小写），如zh-Hant-TW返回zh
+func baseLanguage(tag string) string {
+	base, _, _ := strings.Cut(tag, "-")
+	base, _, _ = strings.Cut(base, "_")
+	return strings.ToLower(base)
+}
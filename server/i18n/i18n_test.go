@@ -0,0 +1,130 @@
+package i18n
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+)
+
+// verbPattern 匹配消息中的fmt格式化动词
+var verbPattern = regexp.MustCompile(`%[-+# 0]*[0-9]*[a-zA-Z]`)
+
+func TestCatalogsHaveTheSameMessages(t *testing.T) {
+	base, ok := catalogs[DefaultLanguage]
+	if !ok {
+		t.Fatalf("no catalog for the default language %q", DefaultLanguage)
+	}
+
+	for _, language := range Languages() {
+		catalog := catalogs[language]
+		for key, message := range base {
+			translated, ok := catalog[key]
+			if !ok {
+				t.Errorf("%s: missing %q", language, key)
+				continue
+			}
+			// 译文的格式化参数必须与默认语言一致，否则Sprintf会输出%!d(MISSING)
+			if want, got := verbPattern.FindAllString(message, -1), verbPattern.FindAllString(translated, -1); !slices.Equal(want, got) {
+				t.Errorf("%s: %q has verbs %v, want %v", language, key, got, want)
+			}
+		}
+		for key := range catalog {
+			if _, ok := base[key]; !ok {
+				t.Errorf("%s: %q is not in the %s catalog", language, key, DefaultLanguage)
+			}
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	if got := T("zh", "invalid_page_size", 100); got == T("en", "invalid_page_size", 100) {
+		t.Errorf("zh message was not translated: %q", got)
+	}
+	if got := T("en", "invalid_page_size", 100); got != "page_size must be between 1 and 100" {
+		t.Errorf("T(en) = %q", got)
+	}
+	// 未知语言回退到默认语言，未知消息返回消息ID
+	if got, want := T("fr", "invalid_page_size", 5), T(DefaultLanguage, "invalid_page_size", 5); got != want {
+		t.Errorf("T(fr) = %q, want the default language %q", got, want)
+	}
+	if got := T("zh", "no_such_message"); got != "no_such_message" {
+		t.Errorf("T(unknown key) = %q", got)
+	}
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{"", []string{}},
+		{"zh-CN", []string{"zh-CN"}},
+		{"fr;q=0.5, zh-TW, en;q=0.8", []string{"zh-TW", "en", "fr"}},
+		{"de, fr", []string{"de", "fr"}},
+		{"*, en;q=0, ja;q=abc, es;q=0.1", []string{"es"}},
+		{"x$y, en.us, pt-BR", []string{"pt-BR"}},
+	}
+	for _, tt := range tests {
+		if got := ParseAcceptLanguage(tt.header); !slices.Equal(got, tt.want) {
+			t.Errorf("ParseAcceptLanguage(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+
+	many := "a1,a2,a3,a4,a5,a6,a7,a8,a9,b1,b2,b3"
+	if got := ParseAcceptLanguage(many); len(got) != maxPreferences {
+		t.Errorf("got %d preferences, want at most %d", len(got), maxPreferences)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for _, tt := range []struct {
+		preferences []string
+		want        string
+	}{
+		{nil, DefaultLanguage},
+		{[]string{"ZH"}, "zh"},
+		{[]string{"zh-Hant-TW"}, "zh"},
+		{[]string{"fr", "zh-CN", "en"}, "zh"},
+		{[]string{"fr", "de"}, DefaultLanguage},
+	} {
+		if got := Negotiate(tt.preferences); got != tt.want {
+			t.Errorf("Negotiate(%v) = %q, want %q", tt.preferences, got, tt.want)
+		}
+	}
+}
+
+func TestPick(t *testing.T) {
+	titles := map[string]string{"en": "Spirited Away", "zh-TW": "神隱少女", "zh-CN": "千与千寻", "ja": ""}
+
+	pick := func(preferences ...string) string {
+		value, ok := Pick(titles, preferences)
+		if !ok {
+			return "<none>"
+		}
+		return value
+	}
+
+	if got := pick("zh-TW"); got != "神隱少女" {
+		t.Errorf("exact match: %q", got)
+	}
+	if got := pick("zh-cn"); got != "千与千寻" {
+		t.Errorf("case-insensitive match: %q", got)
+	}
+	// 没有zh或zh-HK时按排序选择同一主语言的其他地区，结果稳定
+	if got := pick("zh-HK"); got != "千与千寻" {
+		t.Errorf("same base language: %q", got)
+	}
+	if got := pick("en-GB"); got != "Spirited Away" {
+		t.Errorf("base language: %q", got)
+	}
+	// 空文本视为没有译文
+	if got := pick("ja", "fr"); got != "<none>" {
+		t.Errorf("empty and missing translations: %q", got)
+	}
+	if got := pick("ja", "en"); got != "Spirited Away" {
+		t.Errorf("second preference: %q", got)
+	}
+	if _, ok := Pick(nil, []string{"en"}); ok {
+		t.Error("Pick(nil) reported a match")
+	}
+}
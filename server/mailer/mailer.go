@@ -0,0 +1,53 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Message 一封待发送的邮件
+type Message struct {
+	To      string    `json:"to"`
+	Subject string    `json:"subject"`
+	Body    string    `json:"body"`
+	SentAt  time.Time `json:"sent_at"`
+}
+
+// Mailer 邮件发送接口，便于在SMTP和本地发件箱之间切换
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// 邮件驱动名称
+const (
+	DriverSMTP   = "smtp"
+	DriverOutbox = "outbox"
+)
+
+// Options 创建Mailer所需的配置
+type Options struct {
+	Driver       string
+	From         string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	OutboxDir    string
+}
+
+// New 根据驱动名称创建Mailer
+func New(opts Options) (Mailer, error) {
+	switch strings.ToLower(opts.Driver) {
+	case DriverSMTP:
+		if opts.SMTPHost == "" {
+			return nil, fmt.Errorf("smtp host is required for the %q mail driver", DriverSMTP)
+		}
+		return NewSMTPMailer(opts.SMTPHost, opts.SMTPPort, opts.SMTPUsername, opts.SMTPPassword, opts.From), nil
+	case DriverOutbox, "":
+		return NewOutboxMailer(opts.OutboxDir)
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", opts.Driver)
+	}
+}
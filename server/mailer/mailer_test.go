@@ -0,0 +1,73 @@
+package mailer
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+
+	m, err := New(Options{Driver: "", OutboxDir: dir})
+	if err != nil {
+		t.Fatalf("New with default driver: %v", err)
+	}
+	if _, ok := m.(*OutboxMailer); !ok {
+		t.Fatalf("default driver = %T, want *OutboxMailer", m)
+	}
+
+	m, err = New(Options{Driver: "SMTP", SMTPHost: "smtp.example.test", SMTPPort: 587, From: "noreply@example.test"})
+	if err != nil {
+		t.Fatalf("New with smtp driver: %v", err)
+	}
+	if _, ok := m.(*SMTPMailer); !ok {
+		t.Fatalf("smtp driver = %T, want *SMTPMailer", m)
+	}
+
+	if _, err := New(Options{Driver: DriverSMTP}); err == nil {
+		t.Fatal("smtp driver without host was accepted")
+	}
+	if _, err := New(Options{Driver: DriverOutbox}); err == nil {
+		t.Fatal("outbox driver without directory was accepted")
+	}
+	if _, err := New(Options{Driver: "sendmail", OutboxDir: dir}); err == nil {
+		t.Fatal("unknown driver was accepted")
+	}
+}
+
+func TestOutboxMailer(t *testing.T) {
+	// 目录不存在时自动创建
+	outbox, err := NewOutboxMailer(filepath.Join(t.TempDir(), "outbox"))
+	if err != nil {
+		t.Fatalf("NewOutboxMailer: %v", err)
+	}
+
+	for _, subject := range []string{"first", "second", "third"} {
+		if err := outbox.Send(context.Background(), Message{To: "alice@example.com", Subject: subject, Body: subject + " body"}); err != nil {
+			t.Fatalf("Send %s: %v", subject, err)
+		}
+	}
+
+	messages, err := outbox.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(messages) != 3 {
+		t.Fatalf("outbox has %d messages, want 3", len(messages))
+	}
+	for i, subject := range []string{"first", "second", "third"} {
+		if messages[i].Subject != subject || messages[i].Body != subject+" body" || messages[i].SentAt.IsZero() {
+			t.Fatalf("message %d = %+v, want %q in send order", i, messages[i], subject)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := outbox.Send(ctx, Message{To: "alice@example.com"}); err == nil {
+		t.Fatal("Send succeeded with a cancelled context")
+	}
+	if messages, _ := outbox.List(); len(messages) != 3 {
+		t.Fatalf("outbox has %d messages after a cancelled send, want 3", len(messages))
+	}
+}
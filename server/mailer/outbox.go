@@ -0,0 +1,84 @@
+package mailer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OutboxMailer 把邮件写入本地目录而不是真正发送，适用于离线开发和测试
+type OutboxMailer struct {
+	dir string
+}
+
+// NewOutboxMailer 创建本地发件箱，目录不存在时自动创建
+func NewOutboxMailer(dir string) (*OutboxMailer, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("outbox directory is required for the %q mail driver", DriverOutbox)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &OutboxMailer{dir: dir}, nil
+}
+
+// Send 把邮件以JSON文件的形式写入发件箱目录
+func (m *OutboxMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	msg.SentAt = time.Now()
+	data, err := json.MarshalIndent(msg, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+
+	// 文件名以纳秒时间戳开头，按名称排序即为发送顺序
+	name := fmt.Sprintf("%d-%s.json", msg.SentAt.UnixNano(), hex.EncodeToString(suffix))
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o600)
+}
+
+// List 按发送顺序读取发件箱中的所有邮件
+func (m *OutboxMailer) List() ([]Message, error) {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	messages := make([]Message, 0, len(names))
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(m.dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
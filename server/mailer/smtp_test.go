@@ -0,0 +1,176 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTPServer 一个只支持最基本命令的SMTP服务器，记录收到的命令和邮件内容
+type fakeSMTPServer struct {
+	listener net.Listener
+	commands chan []string
+	data     chan string
+}
+
+func startFakeSMTP(t *testing.T) *fakeSMTPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &fakeSMTPServer{listener: listener, commands: make(chan []string, 1), data: make(chan string, 1)}
+	go server.serve()
+	return server
+}
+
+func (s *fakeSMTPServer) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	var commands []string
+	reply("220 fake ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		commands = append(commands, line)
+
+		switch verb := strings.ToUpper(strings.Fields(line)[0]); verb {
+		case "EHLO", "HELO":
+			reply("250 fake")
+		case "MAIL", "RCPT":
+			reply("250 OK")
+		case "DATA":
+			reply("354 go ahead")
+			var body strings.Builder
+			for {
+				dataLine, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				body.WriteString(dataLine)
+			}
+			s.data <- body.String()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			s.commands <- commands
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	server := startFakeSMTP(t)
+	m := NewSMTPMailer("127.0.0.1", server.port(), "", "", "MagicStream <no-reply@example.com>")
+
+	err := m.Send(context.Background(), Message{To: "ann@example.com", Subject: "Hello", Body: "line 1\nline 2"})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	data := <-server.data
+	for _, want := range []string{
+		"From: MagicStream <no-reply@example.com>\r\n",
+		"To: ann@example.com\r\n",
+		"Subject: Hello\r\n",
+		"\r\nline 1\r\nline 2",
+	} {
+		if !strings.Contains(data, want) {
+			t.Errorf("message is missing %q:\n%s", want, data)
+		}
+	}
+
+	// 信封发件人不带显示名称
+	commands := <-server.commands
+	if !containsCommand(commands, "MAIL FROM:<no-reply@example.com>") || !containsCommand(commands, "RCPT TO:<ann@example.com>") {
+		t.Errorf("commands = %q", commands)
+	}
+}
+
+func containsCommand(commands []string, prefix string) bool {
+	for _, command := range commands {
+		if strings.HasPrefix(command, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSMTPMailerHonorsDeadline(t *testing.T) {
+	// 接受连接但从不应答的服务器
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(5 * time.Second)
+		}
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	m := NewSMTPMailer("127.0.0.1", port, "", "", "no-reply@example.com")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = m.Send(ctx, Message{To: "ann@example.com", Subject: "Hello", Body: "hi"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Send = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Send returned after %v, want it bounded by the context deadline", elapsed)
+	}
+
+	cancelled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	if err := m.Send(cancelled, Message{To: "ann@example.com"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Send with a cancelled context = %v", err)
+	}
+}
+
+func TestSMTPMailerConnectionRefused(t *testing.T) {
+	// 连接已关闭的端口时返回错误而不是挂起
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	m := NewSMTPMailer("127.0.0.1", port, "", "", "no-reply@example.com")
+	err = m.Send(context.Background(), Message{To: "ann@example.com"})
+	if err == nil || !strings.Contains(err.Error(), "ann@example.com") || !strings.Contains(err.Error(), strconv.Itoa(port)) {
+		t.Fatalf("Send = %v, want a connection error naming the recipient", err)
+	}
+}
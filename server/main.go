@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joey17520/magic-stream-app/config"
+	"github.com/joey17520/magic-stream-app/controllers"
 	"github.com/joey17520/magic-stream-app/database"
+	"github.com/joey17520/magic-stream-app/mailer"
 	"github.com/joey17520/magic-stream-app/middlewares"
 	"github.com/joey17520/magic-stream-app/routes"
 	"github.com/joey17520/magic-stream-app/utils"
@@ -40,22 +43,90 @@ func main() {
 		logger.Debug("User collection initialized in utils package")
 	}
 
+	// 设置会话集合到utils包
+	sessionCollection := database.OpenCollection("sessions")
+	if sessionCollection != nil {
+		utils.SetSessionCollection(sessionCollection)
+		logger.Debug("Session collection initialized in utils package")
+	}
+
+	// 设置API密钥集合到utils包
+	apiKeyCollection := database.OpenCollection("api_keys")
+	if apiKeyCollection != nil {
+		utils.SetAPIKeyCollection(apiKeyCollection)
+		logger.Debug("API key collection initialized in utils package")
+	}
+
+	// 设置登录失败计数和审计日志集合到utils包
+	utils.SetLoginAttemptCollection(database.OpenCollection("login_attempts"), utils.LoginThrottleOptions{
+		MaxAccountFailures: cfg.LoginMaxAccountFailures,
+		MaxIPFailures:      cfg.LoginMaxIPFailures,
+		Window:             cfg.LoginFailureWindow,
+		LockoutDuration:    cfg.LoginLockoutDuration,
+		BaseDelay:          cfg.LoginBaseDelay,
+	})
+	utils.SetAuditLogCollection(database.OpenCollection("audit_logs"))
+
+	utils.SetTokenPrecedence(cfg.AuthTokenPrecedence)
+	utils.SetRequireAdminTwoFactor(cfg.RequireAdminTwoFactor)
+
+	// 初始化JWT签名密钥环并启动定期轮换
+	if err := utils.InitKeyring(database.OpenCollection("signing_keys"), utils.KeyringOptions{
+		Algorithm:           cfg.JWTSigningAlgorithm,
+		RotationInterval:    cfg.JWTKeyRotationInterval,
+		GracePeriod:         cfg.JWTKeyGracePeriod,
+		LegacyAccessSecret:  cfg.SecretKey,
+		LegacyRefreshSecret: cfg.SecretRefreshKey,
+		LegacyTokensUntil:   cfg.JWTLegacyTokensUntil,
+	}); err != nil {
+		logger.Fatal("Failed to initialize jwt keyring", zap.Error(err))
+	}
+	keyRotationCtx, stopKeyRotation := context.WithCancel(context.Background())
+	defer stopKeyRotation()
+	go utils.StartKeyRotation(keyRotationCtx)
+
+	// 创建邮件发送器，配置有误时在启动阶段退出，而不是在第一次发送邮件时
+	appMailer, err := mailer.New(mailer.Options{
+		Driver:       cfg.MailDriver,
+		From:         cfg.MailFrom,
+		SMTPHost:     cfg.SMTPHost,
+		SMTPPort:     cfg.SMTPPort,
+		SMTPUsername: cfg.SMTPUsername,
+		SMTPPassword: cfg.SMTPPassword,
+		OutboxDir:    cfg.MailOutboxDir,
+	})
+	if err != nil {
+		logger.Fatal("Failed to initialize mailer", zap.Error(err))
+	}
+	controllers.SetMailer(appMailer)
+
+	// 启动热门榜单后台聚合任务
+	aggregatorCtx, stopAggregator := context.WithCancel(context.Background())
+	defer stopAggregator()
+	go controllers.NewTrendingAggregator(cfg.TrendingRefreshInterval, cfg.TrendingLimit).Start(aggregatorCtx)
+
+	// 启动注销账户后台清理任务
+	purgerCtx, stopPurger := context.WithCancel(context.Background())
+	defer stopPurger()
+	go controllers.StartAccountPurger(purgerCtx, cfg.AccountPurgeInterval)
+
 	router := gin.New()
 
 	// CORS配置
 	corsConfig := cors.Config{
 		AllowOrigins:     cfg.AllowedOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-API-Key", "X-Parental-PIN", "Range"},
+		ExposeHeaders:    []string{"Content-Length", "WWW-Authenticate", "Content-Range", "Accept-Ranges", "ETag"},
 		MaxAge:           12 * time.Hour,
 		AllowCredentials: true, // 携带http-only cookie
 	}
 
-	// 中间件顺序很重要：CORS -> 结构化日志 -> 指标
+	// 中间件顺序很重要：CORS -> 结构化日志 -> 指标 -> 语言协商
 	router.Use(cors.New(corsConfig))
 	router.Use(StructuredLogger(logger))
 	router.Use(middlewares.MetricsMiddleware())
+	router.Use(middlewares.Locale())
 
 	routes.SetupUnprotectedRoutes(router)
 	routes.SetupProtectedRoutes(router)
@@ -0,0 +1,63 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FixtureProvider 从本地目录读取样例数据，每部电影一个 <imdb_id>.json 文件，内容为MovieMetadata。
+// 用于离线开发和测试，不访问网络
+type FixtureProvider struct {
+	dir string
+}
+
+// NewFixtureProvider 创建读取dir目录的FixtureProvider
+func NewFixtureProvider(dir string) (*FixtureProvider, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("fixture directory is required for the %q metadata provider", DriverFixture)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("metadata fixture path %q is not a directory", dir)
+	}
+	return &FixtureProvider{dir: dir}, nil
+}
+
+// Name 数据来源名称
+func (p *FixtureProvider) Name() string {
+	return DriverFixture
+}
+
+// Lookup 读取 <imdb_id>.json
+func (p *FixtureProvider) Lookup(ctx context.Context, imdbId string) (*MovieMetadata, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// IMDb ID 会拼接到文件路径中，格式不正确时不读取文件
+	if !ValidImdbID(imdbId) {
+		return nil, ErrNotFound
+	}
+
+	data, err := os.ReadFile(filepath.Join(p.dir, imdbId+".json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	var movie MovieMetadata
+	if err := json.Unmarshal(data, &movie); err != nil {
+		return nil, fmt.Errorf("invalid metadata fixture %s: %w", imdbId, err)
+	}
+	movie.ImdbID = imdbId
+	movie.Source = DriverFixture
+	return &movie, nil
+}
@@ -0,0 +1,73 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// MovieMetadata 从外部电影数据库取得的电影信息，图片为完整URL，预告片为YouTube视频ID
+type MovieMetadata struct {
+	ImdbID      string   `json:"imdb_id"`
+	Title       string   `json:"title"`
+	Overview    string   `json:"overview,omitempty"`
+	ReleaseYear int      `json:"release_year,omitempty"`
+	Runtime     int      `json:"runtime,omitempty"`
+	Genres      []string `json:"genres"`
+	PosterURL   string   `json:"poster_url,omitempty"`
+	BackdropURL string   `json:"backdrop_url,omitempty"`
+	TrailerKey  string   `json:"trailer_key,omitempty"`
+	// Source 提供数据的来源名称
+	Source string `json:"source"`
+}
+
+// MetadataProvider 电影元数据来源接口，便于在外部数据库和本地样例数据之间切换
+type MetadataProvider interface {
+	Name() string
+	// Lookup 按IMDb ID查询电影，找不到时返回ErrNotFound
+	Lookup(ctx context.Context, imdbId string) (*MovieMetadata, error)
+}
+
+// ErrNotFound 数据来源中没有这部电影
+var ErrNotFound = errors.New("movie not found in metadata provider")
+
+// 元数据来源驱动名称
+const (
+	DriverTMDB    = "tmdb"
+	DriverFixture = "fixture"
+)
+
+// Options 创建MetadataProvider所需的配置
+type Options struct {
+	Driver           string
+	TMDBAPIKey       string
+	TMDBBaseURL      string
+	TMDBImageBaseURL string
+	FixtureDir       string
+}
+
+// New 根据驱动名称创建MetadataProvider，驱动为空时返回nil表示未启用
+func New(opts Options) (MetadataProvider, error) {
+	switch strings.ToLower(opts.Driver) {
+	case "":
+		return nil, nil
+	case DriverTMDB:
+		if opts.TMDBAPIKey == "" {
+			return nil, fmt.Errorf("api key is required for the %q metadata provider", DriverTMDB)
+		}
+		return NewTMDBProvider(opts.TMDBAPIKey, opts.TMDBBaseURL, opts.TMDBImageBaseURL, nil), nil
+	case DriverFixture:
+		return NewFixtureProvider(opts.FixtureDir)
+	default:
+		return nil, fmt.Errorf("unknown metadata provider %q", opts.Driver)
+	}
+}
+
+var imdbIdPattern = regexp.MustCompile(`^tt[0-9]{7,10}$`)
+
+// ValidImdbID 判断是否为IMDb电影ID（tt加7到10位数字）
+func ValidImdbID(imdbId string) bool {
+	return imdbIdPattern.MatchString(imdbId)
+}
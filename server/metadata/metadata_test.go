@@ -0,0 +1,215 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	provider, err := New(Options{})
+	if err != nil || provider != nil {
+		t.Fatalf("empty driver: provider = %v, err = %v, want disabled", provider, err)
+	}
+
+	if _, err := New(Options{Driver: DriverTMDB}); err == nil {
+		t.Error("tmdb without an API key was accepted")
+	}
+	if provider, err := New(Options{Driver: "TMDB", TMDBAPIKey: "key"}); err != nil || provider.Name() != DriverTMDB {
+		t.Errorf("tmdb: provider = %v, err = %v", provider, err)
+	}
+
+	if _, err := New(Options{Driver: DriverFixture}); err == nil {
+		t.Error("fixture without a directory was accepted")
+	}
+	file := filepath.Join(t.TempDir(), "movie.json")
+	if err := os.WriteFile(file, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(Options{Driver: DriverFixture, FixtureDir: file}); err == nil {
+		t.Error("fixture path that is a file was accepted")
+	}
+
+	if _, err := New(Options{Driver: "omdb"}); err == nil {
+		t.Error("unknown driver was accepted")
+	}
+}
+
+func TestValidImdbID(t *testing.T) {
+	for id, want := range map[string]bool{
+		"tt0111161":    true,
+		"tt12345678":   true,
+		"tt123456":     false,
+		"nm0000151":    false,
+		"tt0111161/..": false,
+		"../tt0111161": false,
+		"":             false,
+	} {
+		if got := ValidImdbID(id); got != want {
+			t.Errorf("ValidImdbID(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestFixtureProvider(t *testing.T) {
+	// 使用仓库自带的样例数据
+	provider, err := NewFixtureProvider(filepath.Join("..", "fixtures", "metadata"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	movie, err := provider.Lookup(context.Background(), "tt0111161")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if movie.ImdbID != "tt0111161" || movie.Source != DriverFixture || movie.ReleaseYear != 1994 || len(movie.Genres) == 0 {
+		t.Fatalf("movie = %+v", movie)
+	}
+
+	if _, err := provider.Lookup(context.Background(), "tt9999999"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing fixture: err = %v, want ErrNotFound", err)
+	}
+	if _, err := provider.Lookup(context.Background(), "../../go"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("path outside the fixture directory: err = %v, want ErrNotFound", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := provider.Lookup(ctx, "tt0111161"); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled context: err = %v", err)
+	}
+}
+
+func TestFixtureProviderRejectsMalformedFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "tt0000001.json"), []byte(`{"title":`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	provider, err := NewFixtureProvider(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Lookup(context.Background(), "tt0000001"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("malformed fixture: err = %v", err)
+	}
+}
+
+// fakeTMDB 模拟TMDB的/find和/movie接口，记录收到的请求
+func fakeTMDB(t *testing.T, videos string) (*httptest.Server, *[]*http.Request) {
+	t.Helper()
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		switch r.URL.Path {
+		case "/find/tt0111161":
+			w.Write([]byte(`{"movie_results":[{"id":278}]}`))
+		case "/find/tt0000002":
+			w.Write([]byte(`{"movie_results":[]}`))
+		case "/movie/278":
+			w.Write([]byte(`{
+				"title": "The Shawshank Redemption",
+				"release_date": "1994-09-23",
+				"runtime": 142,
+				"poster_path": "/poster.jpg",
+				"genres": [{"name": "Drama"}, {"name": "Crime"}],
+				"videos": {"results": ` + videos + `}
+			}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestTMDBProviderLookup(t *testing.T) {
+	server, requests := fakeTMDB(t, `[
+		{"site": "YouTube", "type": "Teaser", "key": "teaser", "official": true},
+		{"site": "YouTube", "type": "Trailer", "key": "fan", "official": false},
+		{"site": "Vimeo", "type": "Trailer", "key": "vimeo", "official": true},
+		{"site": "YouTube", "type": "Trailer", "key": "official", "official": true}
+	]`)
+	provider := NewTMDBProvider("v3-key", server.URL+"/", "https://img.example.com/", server.Client())
+
+	movie, err := provider.Lookup(context.Background(), "tt0111161")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+
+	want := MovieMetadata{
+		ImdbID:      "tt0111161",
+		Title:       "The Shawshank Redemption",
+		ReleaseYear: 1994,
+		Runtime:     142,
+		Genres:      []string{"Drama", "Crime"},
+		PosterURL:   "https://img.example.com/poster.jpg",
+		TrailerKey:  "official",
+		Source:      DriverTMDB,
+	}
+	gotJSON, _ := json.Marshal(movie)
+	wantJSON, _ := json.Marshal(want)
+	if string(gotJSON) != string(wantJSON) {
+		t.Fatalf("movie = %s\nwant    %s", gotJSON, wantJSON)
+	}
+
+	// v3 API Key放在查询参数中
+	for _, r := range *requests {
+		if r.URL.Query().Get("api_key") != "v3-key" || r.Header.Get("Authorization") != "" {
+			t.Errorf("%s sent api_key=%q Authorization=%q", r.URL.Path, r.URL.Query().Get("api_key"), r.Header.Get("Authorization"))
+		}
+	}
+}
+
+func TestTMDBProviderBearerToken(t *testing.T) {
+	server, requests := fakeTMDB(t, `[]`)
+	token := "header.payload.signature"
+	provider := NewTMDBProvider(token, server.URL, "", server.Client())
+
+	movie, err := provider.Lookup(context.Background(), "tt0111161")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if movie.TrailerKey != "" || !strings.HasPrefix(movie.PosterURL, DefaultTMDBImageBaseURL) {
+		t.Fatalf("movie = %+v", movie)
+	}
+
+	// v4读访问令牌只通过Authorization头发送，不出现在URL中
+	for _, r := range *requests {
+		if r.Header.Get("Authorization") != "Bearer "+token || r.URL.Query().Has("api_key") {
+			t.Errorf("%s: Authorization=%q query=%q", r.URL.Path, r.Header.Get("Authorization"), r.URL.RawQuery)
+		}
+	}
+}
+
+func TestTMDBProviderErrors(t *testing.T) {
+	server, requests := fakeTMDB(t, `[]`)
+	provider := NewTMDBProvider("secret-key", server.URL, "", server.Client())
+
+	if _, err := provider.Lookup(context.Background(), "tt0000002"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("no movie results: err = %v, want ErrNotFound", err)
+	}
+	if _, err := provider.Lookup(context.Background(), "tt0000003"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("404 from TMDB: err = %v, want ErrNotFound", err)
+	}
+
+	count := len(*requests)
+	if _, err := provider.Lookup(context.Background(), "not-an-id"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("invalid id: err = %v, want ErrNotFound", err)
+	}
+	if len(*requests) != count {
+		t.Error("an invalid IMDb ID was sent to TMDB")
+	}
+
+	// 连接失败时错误信息不能包含API Key
+	server.Close()
+	_, err := provider.Lookup(context.Background(), "tt0111161")
+	if err == nil || strings.Contains(err.Error(), "secret-key") {
+		t.Fatalf("err = %v, want an error without the API key", err)
+	}
+}
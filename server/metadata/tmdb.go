@@ -0,0 +1,174 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TMDB默认地址
+const (
+	DefaultTMDBBaseURL      = "https://api.themoviedb.org/3"
+	DefaultTMDBImageBaseURL = "https://image.tmdb.org/t/p/original"
+)
+
+// TMDBProvider 通过TMDB API查询电影：先用IMDb ID查出TMDB ID，再读取详情和视频列表
+type TMDBProvider struct {
+	apiKey       string
+	baseURL      string
+	imageBaseURL string
+	client       *http.Client
+}
+
+// NewTMDBProvider 创建TMDBProvider。apiKey可以是v3 API Key或v4读访问令牌（JWT格式，通过Authorization头发送）；
+// 地址为空时使用TMDB官方地址，client为空时使用带超时的默认客户端
+func NewTMDBProvider(apiKey, baseURL, imageBaseURL string, client *http.Client) *TMDBProvider {
+	if baseURL == "" {
+		baseURL = DefaultTMDBBaseURL
+	}
+	if imageBaseURL == "" {
+		imageBaseURL = DefaultTMDBImageBaseURL
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &TMDBProvider{
+		apiKey:       apiKey,
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		imageBaseURL: strings.TrimRight(imageBaseURL, "/"),
+		client:       client,
+	}
+}
+
+// Name 数据来源名称
+func (p *TMDBProvider) Name() string {
+	return DriverTMDB
+}
+
+// tmdbFindResponse /find 接口的响应
+type tmdbFindResponse struct {
+	MovieResults []struct {
+		ID int `json:"id"`
+	} `json:"movie_results"`
+}
+
+// tmdbMovie /movie/{id} 接口的响应中用到的字段
+type tmdbMovie struct {
+	Title        string `json:"title"`
+	Overview     string `json:"overview"`
+	ReleaseDate  string `json:"release_date"`
+	Runtime      int    `json:"runtime"`
+	PosterPath   string `json:"poster_path"`
+	BackdropPath string `json:"backdrop_path"`
+	Genres       []struct {
+		Name string `json:"name"`
+	} `json:"genres"`
+	Videos struct {
+		Results []struct {
+			Site     string `json:"site"`
+			Type     string `json:"type"`
+			Key      string `json:"key"`
+			Official bool   `json:"official"`
+		} `json:"results"`
+	} `json:"videos"`
+}
+
+// Lookup 按IMDb ID查询电影
+func (p *TMDBProvider) Lookup(ctx context.Context, imdbId string) (*MovieMetadata, error) {
+	if !ValidImdbID(imdbId) {
+		return nil, ErrNotFound
+	}
+
+	var found tmdbFindResponse
+	if err := p.get(ctx, "/find/"+imdbId, url.Values{"external_source": {"imdb_id"}}, &found); err != nil {
+		return nil, err
+	}
+	if len(found.MovieResults) == 0 {
+		return nil, ErrNotFound
+	}
+
+	var movie tmdbMovie
+	path := "/movie/" + strconv.Itoa(found.MovieResults[0].ID)
+	if err := p.get(ctx, path, url.Values{"append_to_response": {"videos"}}, &movie); err != nil {
+		return nil, err
+	}
+
+	result := &MovieMetadata{
+		ImdbID:   imdbId,
+		Title:    movie.Title,
+		Overview: movie.Overview,
+		Runtime:  movie.Runtime,
+		Genres:   make([]string, 0, len(movie.Genres)),
+		Source:   DriverTMDB,
+	}
+	if len(movie.ReleaseDate) >= 4 {
+		result.ReleaseYear, _ = strconv.Atoi(movie.ReleaseDate[:4])
+	}
+	if movie.PosterPath != "" {
+		result.PosterURL = p.imageBaseURL + movie.PosterPath
+	}
+	if movie.BackdropPath != "" {
+		result.BackdropURL = p.imageBaseURL + movie.BackdropPath
+	}
+	for _, genre := range movie.Genres {
+		result.Genres = append(result.Genres, genre.Name)
+	}
+
+	// 优先使用官方发布的YouTube预告片
+	for _, video := range movie.Videos.Results {
+		if video.Site != "YouTube" || video.Type != "Trailer" {
+			continue
+		}
+		if result.TrailerKey == "" || video.Official {
+			result.TrailerKey = video.Key
+		}
+		if video.Official {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// get 请求TMDB接口并解析JSON响应；错误信息中不包含API Key
+func (p *TMDBProvider) get(ctx context.Context, path string, query url.Values, out any) error {
+	// v4读访问令牌是JWT，通过Authorization头发送；v3 API Key只能放在查询参数中
+	bearer := strings.Count(p.apiKey, ".") == 2
+	if !bearer {
+		query.Set("api_key", p.apiKey)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if bearer {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		// *url.Error 会带上完整地址，只保留底层错误
+		if urlErr, ok := err.(*url.Error); ok {
+			return fmt.Errorf("GET %s failed: %w", path, urlErr.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("GET %s returned %d", path, resp.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
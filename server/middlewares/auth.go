@@ -1,36 +1,265 @@
 package middlewares
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/config"
+	"github.com/joey17520/magic-stream-app/i18n"
+	"github.com/joey17520/magic-stream-app/models"
 	"github.com/joey17520/magic-stream-app/utils"
+	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
+// AuthMiddleware 校验X-API-Key头中的API密钥，或access token（Authorization: Bearer头或access_token cookie）及其会话
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token, err := utils.GetAccessToken(c)
+		if !authenticate(c) {
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// OptionalAuth 用于公开端点：请求没有携带任何凭据时以匿名身份继续，携带了凭据时与AuthMiddleware一样校验，
+// 使登录用户在公开端点上同样受到家长控制等个人设置的约束
+func OptionalAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("X-API-Key") == "" {
+			if _, err := utils.GetAccessToken(c); errors.Is(err, utils.ErrNoAccessToken) {
+				c.Next()
+				return
+			}
+		}
+
+		if !authenticate(c) {
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// authenticate 校验请求携带的凭据并把用户信息写入上下文，失败时写入响应并中止请求
+func authenticate(c *gin.Context) bool {
+	if rawKey := c.GetHeader("X-API-Key"); rawKey != "" {
+		return authenticateAPIKey(c, rawKey)
+	}
+
+	token, err := utils.GetAccessToken(c)
+	if err != nil {
+		if errors.Is(err, utils.ErrNoAccessToken) {
+			c.Header("WWW-Authenticate", `Bearer realm="MagicStream"`)
+		} else {
+			c.Header("WWW-Authenticate", `Bearer realm="MagicStream", error="invalid_request"`)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.Msg(c, accessTokenErrorKey(err))})
+		c.Abort()
+		return false
+	}
+
+	claims, err := utils.ValidateToken(token)
+	if err != nil {
+		c.Header("WWW-Authenticate", `Bearer realm="MagicStream", error="invalid_token"`)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.Msg(c, "invalid_token")})
+		c.Abort()
+		return false
+	}
+
+	if _, err := utils.ValidateSession(claims.SessionId, claims.UserId, c.ClientIP()); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.Msg(c, "session_expired")})
+		c.Abort()
+		return false
+	}
+
+	access, ok := currentUserAccess(c, claims.UserId, claims.ProfileId)
+	if !ok {
+		return false
+	}
+
+	c.Set("userId", claims.UserId)
+	c.Set("role", access.Role)
+	c.Set("sessionId", claims.SessionId)
+	if access.Profile != nil {
+		c.Set("profileId", access.Profile.ProfileID)
+		c.Set("profile", access.Profile)
+	}
+	c.Set("authMethod", utils.AuthMethodSession)
+	c.Set("country", access.Country)
+
+	return applyParentalControls(c, claims.UserId, access.MaxCertification)
+}
+
+// accessTokenErrorKey 读取访问令牌失败的原因对应的消息ID
+func accessTokenErrorKey(err error) string {
+	switch {
+	case errors.Is(err, utils.ErrBearerSchemeRequired):
+		return "bearer_scheme_required"
+	case errors.Is(err, utils.ErrBearerTokenMissing):
+		return "bearer_token_missing"
+	case errors.Is(err, utils.ErrAuthorizationMalformed):
+		return "authorization_header_malformed"
+	default:
+		return "access_token_missing"
+	}
+}
+
+// authenticateAPIKey 使用API密钥认证，角色按密钥所有者当前的角色确定，档案和家长控制按创建密钥时所选的档案确定；
+// 档案已被删除时密钥不再可用，不会退回到不受限制的主档案
+func authenticateAPIKey(c *gin.Context, rawKey string) bool {
+	key, err := utils.ValidateAPIKey(rawKey, c.ClientIP())
+	if err != nil {
+		if errors.Is(err, utils.ErrAPIKeyInvalid) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.Msg(c, "api_key_invalid")})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_validating_api_key")})
+		}
+		c.Abort()
+		return false
+	}
+
+	access, ok := currentUserAccess(c, key.UserID, key.ProfileID)
+	if !ok {
+		return false
+	}
+
+	c.Set("userId", key.UserID)
+	c.Set("role", access.Role)
+	if access.Profile != nil {
+		c.Set("profileId", access.Profile.ProfileID)
+		c.Set("profile", access.Profile)
+	}
+	c.Set("apiKeyId", key.KeyID)
+	c.Set("scopes", key.Scopes)
+	c.Set("authMethod", utils.AuthMethodAPIKey)
+	c.Set("country", access.Country)
+
+	return applyParentalControls(c, key.UserID, access.MaxCertification)
+}
+
+// applyParentalControls 记录当前请求允许的最高分级；请求携带正确的家长控制PIN时本次请求不受限制
+func applyParentalControls(c *gin.Context, userId, maxCertification string) bool {
+	pin := c.GetHeader(utils.ParentalPINHeader)
+	if maxCertification == "" || pin == "" {
+		c.Set("maxCertification", maxCertification)
+		return true
+	}
+
+	if err := utils.VerifyParentalPIN(userId, pin); err != nil {
+		switch {
+		case errors.Is(err, utils.ErrParentalPINLocked):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": i18n.Msg(c, "parental_pin_locked")})
+		case errors.Is(err, utils.ErrParentalPINInvalid):
+			c.JSON(http.StatusForbidden, gin.H{"error": i18n.Msg(c, "parental_pin_incorrect")})
+		case errors.Is(err, utils.ErrParentalPINNotSet):
+			c.JSON(http.StatusForbidden, gin.H{"error": i18n.Msg(c, "parental_pin_not_set")})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_checking_parental_pin")})
+		}
+		c.Abort()
+		return false
+	}
+
+	c.Set("parentalOverride", true)
+	return true
+}
+
+// currentUserAccess 读取用户当前的角色和所选档案，用户不存在、已被禁用或档案已被删除时中止请求
+func currentUserAccess(c *gin.Context, userId, profileId string) (*utils.UserAccess, bool) {
+	access, err := utils.GetUserAccess(userId, profileId)
+	if err != nil {
+		switch {
+		case errors.Is(err, utils.ErrUserDisabled):
+			c.JSON(http.StatusForbidden, gin.H{"error": i18n.Msg(c, "account_disabled")})
+		case errors.Is(err, utils.ErrProfileNotFound):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.Msg(c, "profile_gone")})
+		case errors.Is(err, mongo.ErrNoDocuments):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.Msg(c, "user_gone")})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_checking_user")})
+		}
+		c.Abort()
+		return nil, false
+	}
+
+	return access, true
+}
+
+// RequireScope 要求API密钥具备指定的权限范围，会话认证的请求不受限制，需在AuthMiddleware之后使用
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !utils.HasScope(c, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": i18n.Msg(c, "api_key_missing_scope", scope)})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireSession 要求使用登录会话认证，用于密码、会话和API密钥管理等不允许API密钥访问的功能
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if utils.GetAuthMethodFromContext(c) != utils.AuthMethodSession {
+			c.JSON(http.StatusForbidden, gin.H{"error": i18n.Msg(c, "session_required")})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireAdmin 要求当前用户为管理员，需在AuthMiddleware之后使用
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, err := utils.GetRoleFromContext(c)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.Msg(c, "role_not_found")})
 			c.Abort()
 			return
 		}
 
-		if token == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "No token provided"})
+		if role != models.RoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": i18n.Msg(c, "admin_required")})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireVerifiedEmail 在UNVERIFIED_ACCOUNT_POLICY为limit时，要求用户已验证邮箱才能使用该功能
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if config.GetConfig().UnverifiedAccountPolicy != config.UnverifiedPolicyLimit {
+			c.Next()
+			return
+		}
+
+		userId, err := utils.GetUserIdFromContext(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": i18n.Msg(c, "user_id_not_found")})
 			c.Abort()
 			return
 		}
 
-		claims, err := utils.ValidateToken(token)
+		verified, err := utils.IsEmailVerified(userId)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": i18n.Msg(c, "error_checking_email_verification")})
 			c.Abort()
 			return
 		}
 
-		c.Set("userId", claims.UserId)
-		c.Set("role", claims.Role)
+		if !verified {
+			c.JSON(http.StatusForbidden, gin.H{"error": i18n.Msg(c, "email_verification_required")})
+			c.Abort()
+			return
+		}
 
 		c.Next()
 	}
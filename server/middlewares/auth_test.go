@@ -0,0 +1,170 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/models"
+	"github.com/joey17520/magic-stream-app/utils"
+)
+
+func TestAuthMiddlewareChallenges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/protected", AuthMiddleware(), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name      string
+		header    string
+		wantError string
+	}{
+		{name: "no token", wantError: ""},
+		{name: "malformed header", header: "Basic dXNlcjpwYXNz", wantError: "invalid_request"},
+		{name: "invalid token", header: "Bearer not-a-jwt", wantError: "invalid_token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+			}
+			challenge := rec.Header().Get("WWW-Authenticate")
+			if !strings.HasPrefix(challenge, "Bearer ") {
+				t.Fatalf("WWW-Authenticate = %q, want a Bearer challenge", challenge)
+			}
+			if tt.wantError == "" && strings.Contains(challenge, "error=") {
+				t.Fatalf("WWW-Authenticate = %q, want no error for a missing token", challenge)
+			}
+			if tt.wantError != "" && !strings.Contains(challenge, `error="`+tt.wantError+`"`) {
+				t.Fatalf("WWW-Authenticate = %q, want error=%q", challenge, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// authenticate 模拟AuthMiddleware设置的认证信息
+	authenticate := func(method string, scopes []string) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.Set("authMethod", method)
+			if scopes != nil {
+				c.Set("scopes", scopes)
+			}
+		}
+	}
+
+	tests := []struct {
+		name   string
+		auth   gin.HandlerFunc
+		guard  gin.HandlerFunc
+		status int
+	}{
+		{name: "session has every scope", auth: authenticate(utils.AuthMethodSession, nil), guard: RequireScope(models.ScopeAdmin), status: http.StatusNoContent},
+		{name: "api key with scope", auth: authenticate(utils.AuthMethodAPIKey, []string{models.ScopeMoviesRead}), guard: RequireScope(models.ScopeMoviesRead), status: http.StatusNoContent},
+		{name: "api key without scope", auth: authenticate(utils.AuthMethodAPIKey, []string{models.ScopeMoviesRead}), guard: RequireScope(models.ScopeMoviesWrite), status: http.StatusForbidden},
+		{name: "api key with no scopes", auth: authenticate(utils.AuthMethodAPIKey, nil), guard: RequireScope(models.ScopeMoviesRead), status: http.StatusForbidden},
+		{name: "session allowed", auth: authenticate(utils.AuthMethodSession, nil), guard: RequireSession(), status: http.StatusNoContent},
+		{name: "api key needs a session", auth: authenticate(utils.AuthMethodAPIKey, []string{models.ScopeAdmin}), guard: RequireSession(), status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", tt.auth, tt.guard, func(c *gin.Context) {
+				c.Status(http.StatusNoContent)
+			})
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareRejectsMalformedAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/protected", AuthMiddleware(), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	// X-API-Key优先于Authorization头，格式错误的密钥不会回退到访问令牌
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("X-API-Key", "not-a-key")
+	req.Header.Set("Authorization", "Bearer whatever")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	serve := func(setRole func(c *gin.Context)) int {
+		router := gin.New()
+		router.GET("/admin", setRole, RequireAdmin(), func(c *gin.Context) {
+			c.Status(http.StatusNoContent)
+		})
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin", nil))
+		return rec.Code
+	}
+
+	if got := serve(func(c *gin.Context) {}); got != http.StatusUnauthorized {
+		t.Errorf("without role: status = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := serve(func(c *gin.Context) { c.Set("role", models.RoleUser) }); got != http.StatusForbidden {
+		t.Errorf("USER: status = %d, want %d", got, http.StatusForbidden)
+	}
+	if got := serve(func(c *gin.Context) { c.Set("role", models.RoleAdmin) }); got != http.StatusNoContent {
+		t.Errorf("ADMIN: status = %d, want %d", got, http.StatusNoContent)
+	}
+}
+
+func TestOptionalAuthAllowsAnonymousRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/movies", OptionalAuth(), func(c *gin.Context) {
+		if _, err := utils.GetUserIdFromContext(c); err == nil {
+			t.Error("anonymous request has a user in its context")
+		}
+		if max := utils.GetMaxCertificationFromContext(c); max != "" {
+			t.Errorf("anonymous request is limited to %q", max)
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/movies", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("anonymous: status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+
+	// 携带了无效的凭据时不会退化为匿名访问
+	req := httptest.NewRequest(http.MethodGet, "/movies", nil)
+	req.Header.Set("Authorization", "Bearer not-a-jwt")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("invalid token: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,16 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/i18n"
+)
+
+// Locale 根据Accept-Language协商响应语言，写入上下文供控制器读取消息目录和选择电影标题的语言
+func Locale() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		language := i18n.SetContext(c)
+		c.Header("Content-Language", language)
+		c.Writer.Header().Add("Vary", "Accept-Language")
+		c.Next()
+	}
+}
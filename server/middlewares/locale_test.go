@@ -0,0 +1,47 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/i18n"
+)
+
+func TestLocale(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/", Locale(), func(c *gin.Context) {
+		c.String(http.StatusOK, i18n.Msg(c, "user_not_found"))
+	})
+
+	serve := func(acceptLanguage string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if acceptLanguage != "" {
+			req.Header.Set("Accept-Language", acceptLanguage)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	zh := serve("zh-CN,zh;q=0.9,en;q=0.8")
+	if got := zh.Header().Get("Content-Language"); got != "zh" {
+		t.Errorf("Content-Language = %q, want zh", got)
+	}
+	if got := zh.Body.String(); got != i18n.T("zh", "user_not_found") {
+		t.Errorf("body = %q, want the zh message", got)
+	}
+	if got := zh.Header().Get("Vary"); got != "Accept-Language" {
+		t.Errorf("Vary = %q, want Accept-Language", got)
+	}
+
+	en := serve("")
+	if got := en.Header().Get("Content-Language"); got != i18n.DefaultLanguage {
+		t.Errorf("Content-Language without a header = %q, want %q", got, i18n.DefaultLanguage)
+	}
+	if en.Body.String() == zh.Body.String() {
+		t.Error("en and zh responses are identical")
+	}
+}
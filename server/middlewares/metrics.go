@@ -95,6 +95,41 @@ var (
 			Help: "Total number of recommendations generated",
 		},
 	)
+
+	// 推荐缓存指标，命中率 = hit / (hit + miss)
+	recommendationCacheRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "recommendation_cache_requests_total",
+			Help: "Total number of recommendation cache lookups by result",
+		},
+		[]string{"result"},
+	)
+
+	// 推荐实验指标
+	experimentExposuresTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "experiment_exposures_total",
+			Help: "Total number of recommendation experiment exposures",
+		},
+		[]string{"experiment", "variant"},
+	)
+
+	experimentOutcomesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "experiment_outcomes_total",
+			Help: "Total number of attributed recommendation experiment outcomes",
+		},
+		[]string{"experiment", "variant", "outcome"},
+	)
+
+	// 登录锁定指标
+	loginLockoutsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "login_lockouts_total",
+			Help: "Total number of login lockouts by scope (account or ip)",
+		},
+		[]string{"scope"},
+	)
 )
 
 // MetricsMiddleware 收集HTTP请求指标
@@ -159,6 +194,31 @@ func RecordRecommendationGenerated() {
 	recommendationsGeneratedTotal.Inc()
 }
 
+// RecordRecommendationCacheHit 记录推荐缓存命中
+func RecordRecommendationCacheHit() {
+	recommendationCacheRequestsTotal.WithLabelValues("hit").Inc()
+}
+
+// RecordRecommendationCacheMiss 记录推荐缓存未命中
+func RecordRecommendationCacheMiss() {
+	recommendationCacheRequestsTotal.WithLabelValues("miss").Inc()
+}
+
+// RecordExperimentExposure 记录推荐实验曝光事件
+func RecordExperimentExposure(experiment, variant string) {
+	experimentExposuresTotal.WithLabelValues(experiment, variant).Inc()
+}
+
+// RecordExperimentOutcome 记录推荐实验转化事件（click或watch）
+func RecordExperimentOutcome(experiment, variant, outcome string) {
+	experimentOutcomesTotal.WithLabelValues(experiment, variant, outcome).Inc()
+}
+
+// RecordLoginLockout 记录登录锁定事件
+func RecordLoginLockout(scope string) {
+	loginLockoutsTotal.WithLabelValues(scope).Inc()
+}
+
 // GetMetricsHandler 返回Prometheus指标处理器
 func GetMetricsHandler() gin.HandlerFunc {
 	// 创建Prometheus HTTP处理器
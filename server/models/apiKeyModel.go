@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// API密钥权限范围
+const (
+	ScopeMoviesRead   = "movies:read"
+	ScopeMoviesWrite  = "movies:write"
+	ScopeRatingsWrite = "ratings:write"
+	ScopeProfileRead  = "profile:read"
+	ScopeAdmin        = "admin"
+)
+
+// APIKeyScopeRoles 每个权限范围要求密钥所有者具备的角色，空字符串表示任何角色均可申请
+var APIKeyScopeRoles = map[string]string{
+	ScopeMoviesRead:   "",
+	ScopeMoviesWrite:  RoleAdmin,
+	ScopeRatingsWrite: "",
+	ScopeProfileRead:  "",
+	ScopeAdmin:        RoleAdmin,
+}
+
+// APIKey 用户的个人API密钥，用于脚本和服务间调用，只保存密钥的哈希值
+type APIKey struct {
+	KeyID  string `bson:"key_id" json:"key_id"`
+	UserID string `bson:"user_id" json:"-"`
+	// ProfileID 创建密钥时所选的家庭档案，使用密钥时按该档案的家长控制设置限制，为空表示账户主档案
+	ProfileID  string     `bson:"profile_id,omitempty" json:"profile_id,omitempty"`
+	Name       string     `bson:"name" json:"name"`
+	Prefix     string     `bson:"prefix" json:"prefix"`
+	KeyHash    string     `bson:"key_hash" json:"-"`
+	Scopes     []string   `bson:"scopes" json:"scopes"`
+	ExpiresAt  *time.Time `bson:"expires_at" json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `bson:"last_used_at" json:"last_used_at,omitempty"`
+	LastUsedIP string     `bson:"last_used_ip" json:"last_used_ip,omitempty"`
+	CreatedAt  time.Time  `bson:"created_at" json:"created_at"`
+	RevokedAt  *time.Time `bson:"revoked_at" json:"revoked_at,omitempty"`
+}
+
+// APIKeyCreate 创建API密钥请求，ExpiresInDays为空表示永不过期
+type APIKeyCreate struct {
+	Name          string   `json:"name" validate:"required,min=1,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,oneof=movies:read movies:write ratings:write profile:read admin"`
+	ExpiresInDays *int     `json:"expires_in_days" validate:"omitempty,min=1,max=3650"`
+}
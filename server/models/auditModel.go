@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// 审计日志动作
+const (
+	AuditActionLoginLockout    = "login.lockout"
+	AuditActionIdentityLinked  = "identity.linked"
+	AuditActionUserRoleChanged = "user.role_changed"
+	AuditActionUserDisabled    = "user.disabled"
+	AuditActionUserEnabled     = "user.enabled"
+	AuditActionUserLoggedOut   = "user.force_logout"
+
+	AuditActionAccountDeletionRequested = "account.deletion_requested"
+	AuditActionAccountDeletionCancelled = "account.deletion_cancelled"
+	AuditActionAccountDeleted           = "account.deleted"
+)
+
+// AuditLog 安全相关操作的审计记录
+type AuditLog struct {
+	ID        bson.ObjectID  `bson:"_id,omitempty" json:"_id,omitempty"`
+	Action    string         `bson:"action" json:"action"`
+	UserID    string         `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	Email     string         `bson:"email,omitempty" json:"email,omitempty"`
+	IP        string         `bson:"ip" json:"ip"`
+	UserAgent string         `bson:"user_agent" json:"user_agent"`
+	Details   map[string]any `bson:"details,omitempty" json:"details,omitempty"`
+	CreatedAt time.Time      `bson:"created_at" json:"created_at"`
+}
+
+// LoginAttempt 某个账户（邮箱）或IP在统计窗口内的登录失败计数
+type LoginAttempt struct {
+	Key            string     `bson:"key" json:"key"`
+	Failures       int        `bson:"failures" json:"failures"`
+	FirstFailureAt *time.Time `bson:"first_failure_at" json:"first_failure_at,omitempty"`
+	LastFailureAt  time.Time  `bson:"last_failure_at" json:"last_failure_at"`
+	NextAttemptAt  *time.Time `bson:"next_attempt_at" json:"next_attempt_at,omitempty"`
+	LockedUntil    *time.Time `bson:"locked_until" json:"locked_until,omitempty"`
+}
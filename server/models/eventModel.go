@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// 电影事件类型：view为打开电影详情，play为开始播放
+const (
+	MovieEventView    = "view"
+	MovieEventPlay    = "play"
+	MovieEventRate    = "rate"
+	MovieEventDismiss = "dismiss"
+)
+
+// MovieEvent 用户与电影之间的交互事件（浏览、播放、不感兴趣等），ProfileID为空表示账户主档案
+type MovieEvent struct {
+	ID        bson.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	UserID    string        `bson:"user_id" json:"user_id"`
+	ProfileID string        `bson:"profile_id,omitempty" json:"profile_id,omitempty"`
+	ImdbID    string        `bson:"imdb_id" json:"imdb_id"`
+	Type      string        `bson:"type" json:"type"`
+	Value     float64       `bson:"value,omitempty" json:"value,omitempty"`
+	CreatedAt time.Time     `bson:"created_at" json:"created_at"`
+}
+
+// WatchlistItem 档案片单中的一部电影，ProfileID为空表示账户主档案
+type WatchlistItem struct {
+	UserID    string    `bson:"user_id" json:"-"`
+	ProfileID string    `bson:"profile_id,omitempty" json:"profile_id,omitempty"`
+	ImdbID    string    `bson:"imdb_id" json:"imdb_id"`
+	AddedAt   time.Time `bson:"added_at" json:"added_at"`
+	Movie     *Movie    `bson:"-" json:"movie,omitempty"`
+}
+
+// TrendingMovie 热门榜单中的一条记录，由后台聚合任务定期生成
+type TrendingMovie struct {
+	Window     string    `bson:"window" json:"window"`
+	Rank       int       `bson:"rank" json:"rank"`
+	Score      float64   `bson:"score" json:"score"`
+	ImdbID     string    `bson:"imdb_id" json:"imdb_id"`
+	Movie      Movie     `bson:"movie" json:"movie"`
+	ComputedAt time.Time `bson:"computed_at" json:"computed_at"`
+}
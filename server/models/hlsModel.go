@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// HLSRendition 电影的一个HLS码率版本，分片保存在对象存储中，播放列表根据分片信息动态生成
+type HLSRendition struct {
+	ID     bson.ObjectID `bson:"_id,omitempty" json:"-"`
+	ImdbID string        `bson:"imdb_id" json:"imdb_id"`
+	// Name 码率版本名称，如720p，用于播放地址
+	Name      string `bson:"name" json:"name" validate:"required,max=32,alphanum"`
+	Bandwidth int    `bson:"bandwidth" json:"bandwidth" validate:"required,min=1"`
+	Width     int    `bson:"width,omitempty" json:"width,omitempty" validate:"min=0,max=16384"`
+	Height    int    `bson:"height,omitempty" json:"height,omitempty" validate:"min=0,max=16384"`
+	// Codecs RFC 6381编解码器字符串，如 avc1.64001f,mp4a.40.2
+	Codecs string `bson:"codecs,omitempty" json:"codecs,omitempty" validate:"omitempty,max=200,printascii,excludesall=\""`
+	// Init fMP4分片的初始化片段，MPEG-TS分片没有
+	Init     *HLSSegment  `bson:"init,omitempty" json:"init,omitempty"`
+	Segments []HLSSegment `bson:"segments" json:"-"`
+	// SegmentCount 和 Duration 为分片数和总时长（秒），列表查询时不需要读取所有分片
+	SegmentCount int       `bson:"segment_count" json:"segment_count"`
+	Duration     float64   `bson:"duration" json:"duration"`
+	CreatedAt    time.Time `bson:"created_at" json:"created_at"`
+}
+
+// HLSSegment 对象存储中的一个分片，Key为对象键，SHA256用作ETag
+type HLSSegment struct {
+	Key         string  `bson:"key" json:"-"`
+	Duration    float64 `bson:"duration" json:"duration"`
+	ContentType string  `bson:"content_type" json:"content_type"`
+	Size        int64   `bson:"size" json:"size"`
+	SHA256      string  `bson:"sha256" json:"sha256"`
+}
@@ -1,10 +1,16 @@
 package models
 
-import "go.mongodb.org/mongo-driver/v2/bson"
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
 
 type Genre struct {
 	GenreID   int    `bson:"genre_id" json:"genre_id" validate:"required"`
 	GenreName string `bson:"genre_name" json:"genre_name" validate:"required,min=2,max=100"`
+	// Names 各语言的类型名称，键为BCP 47语言标签；响应中的genre_name按请求语言替换，推荐仍按原始名称匹配
+	Names map[string]string `bson:"names,omitempty" json:"names,omitempty" validate:"omitempty,dive,keys,bcp47_language_tag,endkeys,required,max=100"`
 }
 
 type Ranking struct {
@@ -21,4 +27,115 @@ type Movie struct {
 	Genre       []Genre       `bson:"genre" json:"genre" validate:"required,dive"`
 	AdminReview string        `bson:"admin_review" json:"admin_review" validate:"required"`
 	Ranking     Ranking       `bson:"ranking" json:"ranking" validate:"required"`
+	// Certification 内容分级，未分级的电影在启用家长控制时视为最严格的级别
+	Certification string `bson:"certification,omitempty" json:"certification,omitempty" validate:"omitempty,oneof=G PG PG-13 R NC-17"`
+	// Availability 授权规则，满足任意一条即可观看；没有规则的电影在所有地区始终可以观看
+	Availability []AvailabilityWindow `bson:"availability,omitempty" json:"availability,omitempty" validate:"omitempty,dive"`
+	// Titles 各语言的标题，键为BCP 47语言标签；响应中的title按请求语言替换，没有对应语言时保留原始标题
+	Titles map[string]string `bson:"titles,omitempty" json:"titles,omitempty" validate:"omitempty,dive,keys,bcp47_language_tag,endkeys,required,max=500"`
+
+	// ReleaseYear 上映年份，Runtime 片长（分钟），为0表示未知
+	ReleaseYear int `bson:"release_year,omitempty" json:"release_year,omitempty" validate:"omitempty,min=1870,max=2100"`
+	Runtime     int `bson:"runtime,omitempty" json:"runtime,omitempty" validate:"omitempty,min=1,max=1000"`
+
+	Cast []CastMember `bson:"cast,omitempty" json:"cast,omitempty" validate:"omitempty,max=200,dive"`
+	Crew []CrewMember `bson:"crew,omitempty" json:"crew,omitempty" validate:"omitempty,max=200,dive"`
+
+	// Images 和 Videos 是poster_path、youtube_id之外的更多媒体资源，按类型区分
+	Images []MediaImage `bson:"images,omitempty" json:"images,omitempty" validate:"omitempty,max=100,dive"`
+	Videos []MediaVideo `bson:"videos,omitempty" json:"videos,omitempty" validate:"omitempty,max=50,dive"`
+
+	// Video 管理员上传的自托管视频，通过 /stream/:imdb_id 播放；为空时只能使用youtube_id
+	Video *VideoFile `bson:"video,omitempty" json:"video,omitempty"`
+}
+
+// VideoFile 保存在对象存储中的视频文件，Key为对象键（不返回给客户端），SHA256为内容摘要，用作ETag
+type VideoFile struct {
+	Key         string    `bson:"key" json:"-"`
+	ContentType string    `bson:"content_type" json:"content_type"`
+	Size        int64     `bson:"size" json:"size"`
+	SHA256      string    `bson:"sha256" json:"sha256"`
+	UploadedAt  time.Time `bson:"uploaded_at" json:"uploaded_at"`
+}
+
+// CastMember 演员表中的一项，PersonID对应people集合
+type CastMember struct {
+	PersonID  string `bson:"person_id" json:"person_id" validate:"required"`
+	Name      string `bson:"name" json:"name" validate:"required,max=200"`
+	Character string `bson:"character,omitempty" json:"character,omitempty" validate:"max=200"`
+	Order     int    `bson:"order" json:"order" validate:"min=0"`
+}
+
+// CrewMember 职员表中的一项，PersonID对应people集合
+type CrewMember struct {
+	PersonID   string `bson:"person_id" json:"person_id" validate:"required"`
+	Name       string `bson:"name" json:"name" validate:"required,max=200"`
+	Department string `bson:"department" json:"department" validate:"required,max=100"`
+	Job        string `bson:"job" json:"job" validate:"required,max=100"`
+}
+
+// 图片类型
+const (
+	ImageTypePoster   = "poster"
+	ImageTypeBackdrop = "backdrop"
+	ImageTypeStill    = "still"
+)
+
+// MediaImage 电影图片，Language为图片上文字的语言，没有文字时为空
+type MediaImage struct {
+	Type     string `bson:"type" json:"type" validate:"required,oneof=poster backdrop still"`
+	URL      string `bson:"url" json:"url" validate:"required,url"`
+	Width    int    `bson:"width,omitempty" json:"width,omitempty" validate:"min=0"`
+	Height   int    `bson:"height,omitempty" json:"height,omitempty" validate:"min=0"`
+	Language string `bson:"language,omitempty" json:"language,omitempty" validate:"omitempty,bcp47_language_tag"`
+}
+
+// 视频类型
+const (
+	VideoTypeTrailer    = "trailer"
+	VideoTypeTeaser     = "teaser"
+	VideoTypeClip       = "clip"
+	VideoTypeFeaturette = "featurette"
+)
+
+// MediaVideo 电影相关视频，Site为视频托管平台，Key为该平台上的视频ID
+type MediaVideo struct {
+	Type     string `bson:"type" json:"type" validate:"required,oneof=trailer teaser clip featurette"`
+	Site     string `bson:"site" json:"site" validate:"required,oneof=youtube vimeo"`
+	Key      string `bson:"key" json:"key" validate:"required,max=100"`
+	Name     string `bson:"name,omitempty" json:"name,omitempty" validate:"max=200"`
+	Language string `bson:"language,omitempty" json:"language,omitempty" validate:"omitempty,bcp47_language_tag"`
 }
+
+// AvailabilityWindow 一条授权规则：在Countries列出的地区（ISO 3166-1两位代码，为空表示所有地区），
+// 从StartsAt开始到EndsAt之前（为空表示不限）可以观看
+type AvailabilityWindow struct {
+	Countries []string   `bson:"countries,omitempty" json:"countries,omitempty" validate:"omitempty,dive,iso3166_1_alpha2"`
+	StartsAt  *time.Time `bson:"starts_at,omitempty" json:"starts_at,omitempty"`
+	EndsAt    *time.Time `bson:"ends_at,omitempty" json:"ends_at,omitempty"`
+}
+
+// LocalizedNamesUpdate 管理员替换电影标题或类型名称的多语言文本，空映射表示删除所有翻译
+type LocalizedNamesUpdate struct {
+	Names map[string]string `json:"names" validate:"max=50,dive,keys,bcp47_language_tag,endkeys,required,max=500"`
+}
+
+// MovieAvailabilityUpdate 管理员替换电影授权规则的请求，空列表表示取消所有限制
+type MovieAvailabilityUpdate struct {
+	Availability []AvailabilityWindow `json:"availability" validate:"max=100,dive"`
+}
+
+// 内容分级，按从宽到严排列
+const (
+	CertificationG    = "G"
+	CertificationPG   = "PG"
+	CertificationPG13 = "PG-13"
+	CertificationR    = "R"
+	CertificationNC17 = "NC-17"
+)
+
+// Certifications 所有内容分级，按从宽到严排列
+var Certifications = []string{CertificationG, CertificationPG, CertificationPG13, CertificationR, CertificationNC17}
+
+// DefaultKidsCertification 儿童档案未单独设置时允许的最高分级
+const DefaultKidsCertification = CertificationPG
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+)
+
+func TestMediaValidation(t *testing.T) {
+	validate := validator.New()
+
+	valid := []any{
+		MediaImage{Type: ImageTypeBackdrop, URL: "https://img.example.com/b.jpg", Width: 1920, Height: 1080},
+		MediaImage{Type: ImageTypePoster, URL: "https://img.example.com/p.jpg", Language: "zh-Hant"},
+		MediaVideo{Type: VideoTypeTrailer, Site: "youtube", Key: "dQw4w9WgXcQ"},
+		CrewMember{PersonID: "p-1", Name: "Hayao Miyazaki", Department: "Directing", Job: "Director"},
+		CastMember{PersonID: "p-2", Name: "Rumi Hiiragi", Character: "Chihiro"},
+	}
+	for _, value := range valid {
+		if err := validate.Struct(value); err != nil {
+			t.Errorf("%+v: %v", value, err)
+		}
+	}
+
+	invalid := []any{
+		MediaImage{Type: "banner", URL: "https://img.example.com/b.jpg"},
+		MediaImage{Type: ImageTypeStill, URL: "not a url"},
+		MediaImage{Type: ImageTypeStill, URL: "https://img.example.com/s.jpg", Language: "not_a_tag!"},
+		MediaImage{Type: ImageTypeStill, URL: "https://img.example.com/s.jpg", Width: -1},
+		MediaVideo{Type: VideoTypeClip, Site: "dailymotion", Key: "x"},
+		MediaVideo{Type: VideoTypeTeaser, Site: "vimeo"},
+		CrewMember{PersonID: "p-1", Name: "Hayao Miyazaki", Department: "Directing"},
+		CastMember{Name: "Rumi Hiiragi"},
+		CastMember{PersonID: "p-2", Name: "Rumi Hiiragi", Order: -1},
+	}
+	for _, value := range invalid {
+		if err := validate.Struct(value); err == nil {
+			t.Errorf("%+v passed validation", value)
+		}
+	}
+}
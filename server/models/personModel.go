@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Person 演职人员，电影的演员表和职员表通过PersonID引用
+type Person struct {
+	ID          bson.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	PersonID    string        `bson:"person_id" json:"person_id"`
+	Name        string        `bson:"name" json:"name" validate:"required,min=1,max=200"`
+	Biography   string        `bson:"biography,omitempty" json:"biography,omitempty" validate:"max=10000"`
+	BirthDate   *time.Time    `bson:"birth_date,omitempty" json:"birth_date,omitempty"`
+	ProfilePath string        `bson:"profile_path,omitempty" json:"profile_path,omitempty" validate:"omitempty,url"`
+	// KnownFor 主要从事的部门，如Acting、Directing
+	KnownFor  string    `bson:"known_for,omitempty" json:"known_for,omitempty" validate:"max=100"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// FilmographyEntry 人物作品列表中的一部电影及其在片中的角色和职务
+type FilmographyEntry struct {
+	Movie      Movie    `json:"movie"`
+	Characters []string `json:"characters,omitempty"`
+	Jobs       []string `json:"jobs,omitempty"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Rating 用户对电影的评分（1-5星）及可选的文字评论；作者注销账户后user_id被替换为匿名ID，Anonymized为true
+type Rating struct {
+	ID         bson.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	UserID     string        `bson:"user_id" json:"user_id"`
+	ImdbID     string        `bson:"imdb_id" json:"imdb_id"`
+	Rating     int           `bson:"rating" json:"rating" validate:"required,min=1,max=5"`
+	Review     string        `bson:"review,omitempty" json:"review,omitempty" validate:"max=2000"`
+	CreatedAt  time.Time     `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time     `bson:"updated_at" json:"updated_at"`
+	Anonymized bool          `bson:"anonymized,omitempty" json:"anonymized,omitempty"`
+}
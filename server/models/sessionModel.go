@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Session 一次登录产生的服务端会话，对应一台设备上的一组令牌。
+// 会话同时也是refresh token的轮换家族，RefreshTokenID记录当前唯一有效的refresh token的jti
+type Session struct {
+	SessionID      string     `bson:"session_id" json:"session_id"`
+	UserID         string     `bson:"user_id" json:"-"`
+	Device         string     `bson:"device" json:"device"`
+	IP             string     `bson:"ip" json:"ip"`
+	LastIP         string     `bson:"last_ip" json:"last_ip"`
+	UserAgent      string     `bson:"user_agent" json:"user_agent"`
+	CreatedAt      time.Time  `bson:"created_at" json:"created_at"`
+	LastUsedAt     time.Time  `bson:"last_used_at" json:"last_used_at"`
+	ExpiresAt      time.Time  `bson:"expires_at" json:"expires_at"`
+	RevokedAt      *time.Time `bson:"revoked_at" json:"revoked_at,omitempty"`
+	RefreshTokenID string     `bson:"refresh_token_id" json:"-"`
+	Current        bool       `bson:"-" json:"current"`
+}
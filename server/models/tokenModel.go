@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// 一次性令牌用途
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+)
+
+// UserToken 发给用户的一次性令牌（如密码重置），只保存令牌的哈希值
+type UserToken struct {
+	TokenHash string     `bson:"token_hash" json:"-"`
+	UserID    string     `bson:"user_id" json:"user_id"`
+	Purpose   string     `bson:"purpose" json:"purpose"`
+	ExpiresAt time.Time  `bson:"expires_at" json:"expires_at"`
+	UsedAt    *time.Time `bson:"used_at" json:"used_at,omitempty"`
+	CreatedAt time.Time  `bson:"created_at" json:"created_at"`
+}
+
+// PasswordChange 修改密码请求
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=6"`
+}
+
+// PasswordForgot 忘记密码请求
+type PasswordForgot struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// PasswordReset 使用重置令牌设置新密码
+type PasswordReset struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=6"`
+}
+
+// OAuthState 一次OIDC登录的临时状态，回调时按state查找并立即删除，只保存state的哈希值
+type OAuthState struct {
+	StateHash    string    `bson:"state_hash"`
+	Provider     string    `bson:"provider"`
+	Nonce        string    `bson:"nonce"`
+	CodeVerifier string    `bson:"code_verifier"`
+	Device       string    `bson:"device"`
+	ExpiresAt    time.Time `bson:"expires_at"`
+	CreatedAt    time.Time `bson:"created_at"`
+}
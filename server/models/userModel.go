@@ -7,32 +7,230 @@ import (
 )
 
 type User struct {
-	ID             bson.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
-	UserID         string        `json:"user_id" bson:"user_id"`
-	FirstName      string        `json:"first_name" bson:"first_name" validate:"required,min=2,max=100"`
-	LastName       string        `json:"last_name" bson:"last_name" validate:"required,min=2,max=100"`
-	Email          string        `json:"email" bson:"email" validate:"required,email"`
-	Password       string        `json:"password" bson:"password" validate:"required,min=6"`
-	Role           string        `json:"role" bson:"role" validate:"oneof=ADMIN USER"`
-	CreatedAt      time.Time     `json:"created_at" bson:"created_at"`
-	UpdatedAt      time.Time     `json:"updated_at" bson:"updated_at"`
-	Token          string        `json:"token" bson:"token"`
-	RefreshToken   string        `json:"refresh_token" bson:"refresh_token"`
-	FavoriteGenres []Genre       `json:"favorite_genres" bson:"favorite_genres" validate:"required,dive"`
+	ID              bson.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	UserID          string        `json:"user_id" bson:"user_id"`
+	FirstName       string        `json:"first_name" bson:"first_name" validate:"required,min=2,max=100"`
+	LastName        string        `json:"last_name" bson:"last_name" validate:"required,min=2,max=100"`
+	Email           string        `json:"email" bson:"email" validate:"required,email"`
+	EmailVerified   bool          `json:"email_verified" bson:"email_verified"`
+	EmailVerifiedAt *time.Time    `json:"email_verified_at,omitempty" bson:"email_verified_at,omitempty"`
+	Password        string        `json:"-" bson:"password"`
+	Role            string        `json:"role" bson:"role" validate:"oneof=ADMIN USER"`
+	CreatedAt       time.Time     `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at" bson:"updated_at"`
+	FavoriteGenres  []Genre       `json:"favorite_genres" bson:"favorite_genres" validate:"required,dive"`
+	// Country 用户所在地区（ISO 3166-1两位代码），请求没有可信的地区头时用于判断电影是否可以观看
+	Country string `json:"country,omitempty" bson:"country,omitempty"`
+
+	TwoFactorEnabled bool               `json:"two_factor_enabled" bson:"two_factor_enabled"`
+	TwoFactor        *TwoFactor         `json:"-" bson:"two_factor,omitempty"`
+	Identities       []ExternalIdentity `json:"identities,omitempty" bson:"identities,omitempty"`
+
+	// Profiles 家庭成员的观看档案；未选择档案时使用账户本身（主档案）的设置
+	Profiles []HouseholdProfile `json:"profiles,omitempty" bson:"profiles,omitempty"`
+
+	ParentalControls *ParentalControls `json:"parental_controls,omitempty" bson:"parental_controls,omitempty"`
+
+	Disabled       bool       `json:"disabled" bson:"disabled"`
+	DisabledAt     *time.Time `json:"disabled_at,omitempty" bson:"disabled_at,omitempty"`
+	DisabledReason string     `json:"disabled_reason,omitempty" bson:"disabled_reason,omitempty"`
+
+	DeletionRequestedAt *time.Time `json:"deletion_requested_at,omitempty" bson:"deletion_requested_at,omitempty"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty" bson:"deletion_scheduled_at,omitempty"`
+}
+
+// ExternalIdentity 关联到用户的外部身份提供方（OIDC）账户
+type ExternalIdentity struct {
+	Provider string    `json:"provider" bson:"provider"`
+	Subject  string    `json:"-" bson:"subject"`
+	Email    string    `json:"email" bson:"email"`
+	LinkedAt time.Time `json:"linked_at" bson:"linked_at"`
+}
+
+// HouseholdProfile 同一账户下的家庭成员档案，观看记录、片单和推荐按档案区分
+type HouseholdProfile struct {
+	ProfileID      string  `json:"profile_id" bson:"profile_id"`
+	Name           string  `json:"name" bson:"name"`
+	Avatar         string  `json:"avatar,omitempty" bson:"avatar,omitempty"`
+	FavoriteGenres []Genre `json:"favorite_genres" bson:"favorite_genres"`
+	Kids           bool    `json:"kids" bson:"kids"`
+	// MaxCertification 该档案允许的最高分级，为空时儿童档案使用DefaultKidsCertification，其他档案不限制
+	MaxCertification string    `json:"max_certification,omitempty" bson:"max_certification,omitempty"`
+	CreatedAt        time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// ParentalControls 账户的家长控制设置：主档案允许的最高分级，以及解除限制和修改限制所需的PIN（只保存哈希值）
+type ParentalControls struct {
+	MaxCertification string     `json:"max_certification,omitempty" bson:"max_certification,omitempty"`
+	PINHash          string     `json:"-" bson:"pin_hash,omitempty"`
+	PINSet           bool       `json:"pin_set" bson:"-"`
+	PINFailures      int        `json:"-" bson:"pin_failures"`
+	PINLockedUntil   *time.Time `json:"-" bson:"pin_locked_until,omitempty"`
+}
+
+// TwoFactor 两步验证（TOTP）设置，恢复码只保存哈希值
+type TwoFactor struct {
+	Secret        string     `bson:"secret,omitempty"`
+	PendingSecret string     `bson:"pending_secret,omitempty"`
+	RecoveryCodes []string   `bson:"recovery_codes,omitempty"`
+	LastUsedStep  int64      `bson:"last_used_step"`
+	EnabledAt     *time.Time `bson:"enabled_at,omitempty"`
+}
+
+// UserRegister 注册请求，密码只在请求中出现，不会随User序列化返回；注册的用户总是USER角色
+type UserRegister struct {
+	FirstName      string  `json:"first_name" validate:"required,min=2,max=100"`
+	LastName       string  `json:"last_name" validate:"required,min=2,max=100"`
+	Email          string  `json:"email" validate:"required,email"`
+	Password       string  `json:"password" validate:"required,min=6"`
+	FavoriteGenres []Genre `json:"favorite_genres" validate:"required,dive"`
+}
+
+// UserProfileUpdate 个人资料更新请求，未提供的字段保持不变
+type UserProfileUpdate struct {
+	FirstName      *string  `json:"first_name" validate:"omitempty,min=2,max=100"`
+	LastName       *string  `json:"last_name" validate:"omitempty,min=2,max=100"`
+	FavoriteGenres *[]Genre `json:"favorite_genres" validate:"omitempty,min=1,dive"`
+	Country        *string  `json:"country" validate:"omitempty,iso3166_1_alpha2"`
+}
+
+// HouseholdProfileCreate 创建家庭成员档案请求
+type HouseholdProfileCreate struct {
+	Name           string  `json:"name" validate:"required,min=1,max=50"`
+	Avatar         string  `json:"avatar" validate:"max=500"`
+	FavoriteGenres []Genre `json:"favorite_genres" validate:"required,min=1,dive"`
+	Kids           bool    `json:"kids"`
+	// MaxCertification 该档案允许的最高分级，为空表示使用默认规则
+	MaxCertification string `json:"max_certification" validate:"omitempty,oneof=G PG PG-13 R NC-17"`
+}
+
+// HouseholdProfileUpdate 更新家庭成员档案请求，未提供的字段保持不变
+type HouseholdProfileUpdate struct {
+	Name           *string  `json:"name" validate:"omitempty,min=1,max=50"`
+	Avatar         *string  `json:"avatar" validate:"omitempty,max=500"`
+	FavoriteGenres *[]Genre `json:"favorite_genres" validate:"omitempty,min=1,dive"`
+	Kids           *bool    `json:"kids"`
+	// MaxCertification 传空字符串表示清除设置，恢复默认规则
+	MaxCertification *string `json:"max_certification" validate:"omitempty,oneof='' G PG PG-13 R NC-17"`
+}
+
+// ParentalControlsUpdate 修改家长控制设置请求；已设置PIN时需要提供current_pin
+type ParentalControlsUpdate struct {
+	MaxCertification *string `json:"max_certification" validate:"omitempty,oneof='' G PG PG-13 R NC-17"`
+	PIN              *string `json:"pin" validate:"omitempty,min=4,max=6,numeric"`
+	CurrentPIN       string  `json:"current_pin"`
+}
+
+// HouseholdProfileSelect 选择当前使用的档案，profile_id为空时切换回账户主档案
+type HouseholdProfileSelect struct {
+	ProfileID string `json:"profile_id"`
+}
+
+// EmailVerificationResend 重新发送验证邮件请求
+type EmailVerificationResend struct {
+	Email string `json:"email" validate:"required,email"`
 }
 
 type UserLogin struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required,min=6"`
+	Device   string `json:"device"`
 }
 
 type UserResponse struct {
-	UserId         string  `json:"user_id"`
-	FirstName      string  `json:"first_name"`
-	LastName       string  `json:"last_name"`
-	Email          string  `json:"email"`
-	Role           string  `json:"role"`
-	Token          string  `json:"token"`
-	RefreshToken   string  `json:"refresh_token"`
-	FavoriteGenres []Genre `json:"favorite_genres"`
+	UserId                 string  `json:"user_id"`
+	FirstName              string  `json:"first_name"`
+	LastName               string  `json:"last_name"`
+	Email                  string  `json:"email"`
+	EmailVerified          bool    `json:"email_verified"`
+	Role                   string  `json:"role"`
+	FavoriteGenres         []Genre `json:"favorite_genres"`
+	TwoFactorEnabled       bool    `json:"two_factor_enabled"`
+	TwoFactorSetupRequired bool    `json:"two_factor_setup_required,omitempty"`
+}
+
+// TwoFactorChallenge 登录时密码验证通过但需要两步验证的响应
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int    `json:"expires_in"`
+}
+
+// TwoFactorLogin 两步验证登录请求，验证码和恢复码二选一
+type TwoFactorLogin struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode   string `json:"recovery_code" validate:"required_without=Code,omitempty,min=10,max=20"`
+	Device         string `json:"device"`
+}
+
+// TwoFactorCode 需要提供当前验证码的请求（确认启用、重新生成恢复码）
+type TwoFactorCode struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// TwoFactorDisable 关闭两步验证请求，需要当前密码和验证码（或恢复码）
+type TwoFactorDisable struct {
+	Password     string `json:"password" validate:"required"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code,omitempty,min=10,max=20"`
+}
+
+// 用户角色
+const (
+	RoleAdmin = "ADMIN"
+	RoleUser  = "USER"
+)
+
+// UserRoleUpdate 管理员修改用户角色请求
+type UserRoleUpdate struct {
+	Role string `json:"role" validate:"required,oneof=ADMIN USER"`
+}
+
+// UserDisable 管理员禁用用户请求
+type UserDisable struct {
+	Reason string `json:"reason" validate:"max=500"`
+}
+
+// UserPage 管理员分页查询用户的结果
+type UserPage struct {
+	Users    []User `json:"users"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"page_size"`
+	Total    int64  `json:"total"`
+}
+
+// AccountDelete 注销账户请求，设置了本地密码的账户需要提供当前密码
+type AccountDelete struct {
+	Password string `json:"password"`
+}
+
+// AccountExport 用户个人数据导出
+type AccountExport struct {
+	ExportedAt     time.Time        `json:"exported_at"`
+	Profile        User             `json:"profile"`
+	FavoriteGenres []Genre          `json:"favorite_genres"`
+	Ratings        []ExportedRating `json:"ratings"`
+	Reviews        []ExportedReview `json:"reviews"`
+	History        []MovieEvent     `json:"history"`
+	Watchlist      []WatchlistItem  `json:"watchlist"`
+	Sessions       []Session        `json:"sessions"`
+	APIKeys        []APIKey         `json:"api_keys"`
+}
+
+// ExportedRating 导出数据中的一条评分
+type ExportedRating struct {
+	ImdbID    string    `json:"imdb_id"`
+	Rating    int       `json:"rating"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ExportedReview 导出数据中的一条评论
+type ExportedReview struct {
+	ImdbID    string    `json:"imdb_id"`
+	Review    string    `json:"review"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestUserJSONHidesSecrets(t *testing.T) {
+	user := User{
+		UserID:   "user-1",
+		Email:    "alice@example.com",
+		Password: "$2a$14$hash",
+	}
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if _, ok := fields["password"]; ok {
+		t.Errorf("user JSON contains the password field: %s", data)
+	}
+	if strings.Contains(string(data), user.Password) {
+		t.Errorf("user JSON leaks the password hash: %s", data)
+	}
+	if fields["email"] != user.Email {
+		t.Errorf("email = %v, want %s", fields["email"], user.Email)
+	}
+}
+
+func TestUserJSONIgnoresClientSecrets(t *testing.T) {
+	// 客户端提交的password等字段不能直接写入User
+	var user User
+	body := `{"email":"alice@example.com","password":"secret123"}`
+	if err := json.Unmarshal([]byte(body), &user); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if user.Password != "" {
+		t.Fatalf("user password = %q, want it left empty", user.Password)
+	}
+
+	var register UserRegister
+	if err := json.Unmarshal([]byte(body), &register); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if register.Password != "secret123" {
+		t.Fatalf("register password = %q, want it read from the request", register.Password)
+	}
+}
+
+func TestUserResponseOmitsRefreshToken(t *testing.T) {
+	// refresh token只通过HttpOnly cookie下发，响应体中不能出现
+	data, err := json.Marshal(UserResponse{UserId: "user-1", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if strings.Contains(string(data), "refresh_token") {
+		t.Fatalf("user response contains a refresh_token field: %s", data)
+	}
+}
@@ -0,0 +1,280 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwksRefreshCooldown 遇到未知kid时重新获取JWKS的最小间隔
+const jwksRefreshCooldown = time.Minute
+
+// clockSkew 校验exp、iat时允许的时钟误差
+const clockSkew = time.Minute
+
+// Claims ID令牌（或userinfo）中用到的声明
+type Claims struct {
+	Email           string `json:"email"`
+	EmailVerified   *bool  `json:"email_verified"`
+	Name            string `json:"name"`
+	GivenName       string `json:"given_name"`
+	FamilyName      string `json:"family_name"`
+	Nonce           string `json:"nonce"`
+	AuthorizedParty string `json:"azp"`
+	jwt.RegisteredClaims
+}
+
+// IsEmailVerified 提供方是否明确声明邮箱已验证
+func (c *Claims) IsEmailVerified() bool {
+	return c.EmailVerified != nil && *c.EmailVerified
+}
+
+// VerifyIDToken 校验ID令牌的签名、issuer、audience、有效期和nonce（OIDC Core 3.1.3.7）
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (*Claims, error) {
+	algorithms := p.discovery.IDTokenSigningAlgValues
+	if len(algorithms) == 0 {
+		algorithms = []string{"RS256"}
+	}
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(raw, claims,
+		func(t *jwt.Token) (any, error) {
+			kid, _ := t.Header["kid"].(string)
+			return p.keys.get(ctx, kid, t.Method.Alg())
+		},
+		jwt.WithValidMethods(supportedAlgorithms(algorithms)),
+		jwt.WithIssuer(p.config.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("id token has no subject")
+	}
+
+	// 多个audience时azp必须是本客户端
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID {
+		return nil, errors.New("id token authorized party does not match client id")
+	}
+
+	if nonce == "" || claims.Nonce != nonce {
+		return nil, errors.New("id token nonce does not match")
+	}
+
+	return claims, nil
+}
+
+// supportedAlgorithms 提供方声明的签名算法中本实现支持的部分，不接受none和对称算法
+func supportedAlgorithms(declared []string) []string {
+	supported := []string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "EdDSA"}
+
+	algorithms := make([]string, 0, len(declared))
+	for _, alg := range declared {
+		if slices.Contains(supported, alg) {
+			algorithms = append(algorithms, alg)
+		}
+	}
+	return algorithms
+}
+
+// keySet 缓存身份提供方的JWKS公钥，遇到未知kid时重新获取（提供方轮换密钥）
+type keySet struct {
+	mu          sync.Mutex
+	client      *http.Client
+	uri         string
+	keys        map[string]jsonWebKey
+	lastFetched time.Time
+}
+
+// jsonWebKey 解析后的公钥
+type jsonWebKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+func newKeySet(client *http.Client, uri string) *keySet {
+	return &keySet{client: client, uri: uri, keys: map[string]jsonWebKey{}}
+}
+
+// get 按kid和算法获取公钥；没有kid时只有JWKS中恰好一把可用密钥才使用它
+func (s *keySet) get(ctx context.Context, kid, alg string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.lookup(kid, alg)
+	if !ok && time.Since(s.lastFetched) > jwksRefreshCooldown {
+		if err := s.refresh(ctx); err != nil {
+			return nil, err
+		}
+		key, ok = s.lookup(kid, alg)
+	}
+	if !ok {
+		return nil, fmt.Errorf("no signing key found for kid %q", kid)
+	}
+
+	return key.key, nil
+}
+
+func (s *keySet) lookup(kid, alg string) (jsonWebKey, bool) {
+	if kid != "" {
+		key, ok := s.keys[kid]
+		return key, ok && keyMatchesAlgorithm(key, alg)
+	}
+
+	var found []jsonWebKey
+	for _, key := range s.keys {
+		if keyMatchesAlgorithm(key, alg) {
+			found = append(found, key)
+		}
+	}
+	if len(found) != 1 {
+		return jsonWebKey{}, false
+	}
+	return found[0], true
+}
+
+// keyMatchesAlgorithm 检查令牌声明的算法与密钥类型（及JWK中声明的alg）一致，防止算法混淆
+func keyMatchesAlgorithm(key jsonWebKey, alg string) bool {
+	if key.alg != "" && key.alg != alg {
+		return false
+	}
+
+	switch key.key.(type) {
+	case *rsa.PublicKey:
+		return alg == "RS256" || alg == "RS384" || alg == "RS512" || alg == "PS256"
+	case *ecdsa.PublicKey:
+		return alg == "ES256" || alg == "ES384"
+	case ed25519.PublicKey:
+		return alg == "EdDSA"
+	default:
+		return false
+	}
+}
+
+// refresh 重新获取JWKS
+func (s *keySet) refresh(ctx context.Context) error {
+	var doc struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			Alg string `json:"alg"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+
+	s.lastFetched = time.Now()
+	if err := getJSON(ctx, s.client, s.uri, "", &doc); err != nil {
+		return fmt.Errorf("fetching jwks: %w", err)
+	}
+
+	keys := make(map[string]jsonWebKey, len(doc.Keys))
+	for _, jwk := range doc.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		var key crypto.PublicKey
+		var err error
+		switch jwk.Kty {
+		case "RSA":
+			key, err = parseRSAKey(jwk.N, jwk.E)
+		case "EC":
+			key, err = parseECKey(jwk.Crv, jwk.X, jwk.Y)
+		case "OKP":
+			key, err = parseEdKey(jwk.Crv, jwk.X)
+		default:
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		keys[jwk.Kid] = jsonWebKey{alg: jwk.Alg, key: key}
+	}
+
+	s.keys = keys
+	return nil
+}
+
+func parseRSAKey(n, e string) (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, err
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, err
+	}
+
+	exponent := new(big.Int).SetBytes(eBytes)
+	if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid rsa exponent")
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(nBytes), E: int(exponent.Int64())}, nil
+}
+
+func parseECKey(crv, x, y string) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+
+	xBytes, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, err
+	}
+	yBytes, err := base64.RawURLEncoding.DecodeString(y)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(xBytes), Y: new(big.Int).SetBytes(yBytes)}
+	if !curve.IsOnCurve(key.X, key.Y) {
+		return nil, errors.New("ec point is not on curve")
+	}
+	return key, nil
+}
+
+func parseEdKey(crv, x string) (ed25519.PublicKey, error) {
+	if crv != "Ed25519" {
+		return nil, fmt.Errorf("unsupported curve %q", crv)
+	}
+
+	xBytes, err := base64.RawURLEncoding.DecodeString(x)
+	if err != nil {
+		return nil, err
+	}
+	if len(xBytes) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid ed25519 key length")
+	}
+	return ed25519.PublicKey(xBytes), nil
+}
@@ -0,0 +1,261 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config 一个OIDC身份提供方的配置
+type Config struct {
+	// Name 提供方名称，用于路由（/auth/:provider）和账户关联
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL 在身份提供方登记的回调地址
+	RedirectURL string
+	// Scopes 额外申请的权限范围，openid总是包含在内
+	Scopes []string
+	// HTTPClient 访问身份提供方使用的客户端，为空时使用带超时的默认客户端
+	HTTPClient *http.Client
+}
+
+// Discovery OpenID Connect发现文档中用到的字段
+type Discovery struct {
+	Issuer                        string   `json:"issuer"`
+	AuthorizationEndpoint         string   `json:"authorization_endpoint"`
+	TokenEndpoint                 string   `json:"token_endpoint"`
+	UserinfoEndpoint              string   `json:"userinfo_endpoint"`
+	JWKSURI                       string   `json:"jwks_uri"`
+	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported"`
+	IDTokenSigningAlgValues       []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// TokenResponse 令牌端点的响应
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Provider 已完成发现的OIDC身份提供方
+type Provider struct {
+	config    Config
+	discovery Discovery
+	client    *http.Client
+	keys      *keySet
+}
+
+// NewProvider 读取发现文档并创建Provider，发现文档中的issuer必须与配置完全一致
+func NewProvider(ctx context.Context, cfg Config) (*Provider, error) {
+	if cfg.Issuer == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, fmt.Errorf("oidc provider %q: issuer, client id and redirect url are required", cfg.Name)
+	}
+
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	wellKnown := strings.TrimSuffix(cfg.Issuer, "/") + "/.well-known/openid-configuration"
+
+	var discovery Discovery
+	if err := getJSON(ctx, client, wellKnown, "", &discovery); err != nil {
+		return nil, fmt.Errorf("oidc provider %q: discovery failed: %w", cfg.Name, err)
+	}
+
+	if discovery.Issuer != cfg.Issuer {
+		return nil, fmt.Errorf("oidc provider %q: issuer mismatch, expected %q got %q", cfg.Name, cfg.Issuer, discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc provider %q: discovery document is missing required endpoints", cfg.Name)
+	}
+
+	// 未声明支持的方法时仍然发送S256，不支持PKCE的提供方会忽略该参数
+	if len(discovery.CodeChallengeMethodsSupported) > 0 && !slices.Contains(discovery.CodeChallengeMethodsSupported, "S256") {
+		return nil, fmt.Errorf("oidc provider %q: S256 PKCE is not supported", cfg.Name)
+	}
+
+	return &Provider{
+		config:    cfg,
+		discovery: discovery,
+		client:    client,
+		keys:      newKeySet(client, discovery.JWKSURI),
+	}, nil
+}
+
+// Name 提供方名称
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// AuthCodeURL 生成跳转到身份提供方的授权地址（授权码模式 + PKCE）
+func (p *Provider) AuthCodeURL(state, nonce, codeChallenge string) string {
+	scopes := []string{"openid"}
+	for _, scope := range p.config.Scopes {
+		if scope != "openid" && scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.config.ClientID)
+	params.Set("redirect_uri", p.config.RedirectURL)
+	params.Set("scope", strings.Join(scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(p.discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.discovery.AuthorizationEndpoint + separator + params.Encode()
+}
+
+// Exchange 使用授权码和PKCE校验值换取令牌
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (*TokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("code_verifier", codeVerifier)
+	if p.config.ClientSecret != "" {
+		form.Set("client_secret", p.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var token TokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, err
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("token response does not contain an id_token")
+	}
+
+	return &token, nil
+}
+
+// UserInfo 使用access token读取用户信息，用于ID令牌中缺少邮箱等声明的提供方
+func (p *Provider) UserInfo(ctx context.Context, accessToken string) (*Claims, error) {
+	if p.discovery.UserinfoEndpoint == "" {
+		return nil, errors.New("provider does not expose a userinfo endpoint")
+	}
+
+	var claims Claims
+	if err := getJSON(ctx, p.client, p.discovery.UserinfoEndpoint, accessToken, &claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// getJSON 发起GET请求并解析JSON响应
+func getJSON(ctx context.Context, client *http.Client, endpoint, bearer string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", endpoint, resp.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+// Registry 按名称管理多个身份提供方，发现在首次使用时进行，失败后下次请求会重试
+type Registry struct {
+	mu        sync.Mutex
+	configs   map[string]Config
+	providers map[string]*Provider
+}
+
+// ErrUnknownProvider 请求的身份提供方未配置
+var ErrUnknownProvider = errors.New("unknown identity provider")
+
+// NewRegistry 创建身份提供方注册表
+func NewRegistry(configs []Config) *Registry {
+	r := &Registry{
+		configs:   make(map[string]Config, len(configs)),
+		providers: make(map[string]*Provider, len(configs)),
+	}
+	for _, cfg := range configs {
+		r.configs[cfg.Name] = cfg
+	}
+	return r
+}
+
+// Get 获取已完成发现的身份提供方
+func (r *Registry) Get(ctx context.Context, name string) (*Provider, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if provider, ok := r.providers[name]; ok {
+		return provider, nil
+	}
+
+	cfg, ok := r.configs[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	provider, err := NewProvider(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	r.providers[name] = provider
+	return provider, nil
+}
+
+// Names 已配置的身份提供方名称
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.configs))
+	for name := range r.configs {
+		names = append(names, name)
+	}
+	return names
+}
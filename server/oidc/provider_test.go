@@ -0,0 +1,176 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const (
+	testClientID    = "magicstream"
+	testRedirectURL = "http://api.example.test/auth/stub/callback"
+)
+
+// newTestProvider 启动模拟身份提供方并完成发现
+func newTestProvider(t *testing.T, users ...StubUser) *Provider {
+	t.Helper()
+
+	var stub *StubServer
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stub.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	var err error
+	stub, err = NewStubServer(server.URL, testClientID, users...)
+	if err != nil {
+		t.Fatalf("NewStubServer: %v", err)
+	}
+
+	provider, err := NewProvider(context.Background(), Config{
+		Name:        "stub",
+		Issuer:      server.URL,
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+	})
+	if err != nil {
+		t.Fatalf("NewProvider: %v", err)
+	}
+	return provider
+}
+
+// authorize 请求授权端点，返回回调地址中的code和state（模拟浏览器跟随跳转到回调）
+func authorize(t *testing.T, provider *Provider, state, nonce, challenge string) (string, string) {
+	t.Helper()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(provider.AuthCodeURL(state, nonce, challenge))
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("parse callback location: %v", err)
+	}
+	callback := *location
+	callback.RawQuery = ""
+	if callback.String() != testRedirectURL {
+		t.Fatalf("callback = %s, want %s", callback.String(), testRedirectURL)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestCallbackFlow(t *testing.T) {
+	provider := newTestProvider(t, StubUser{
+		Subject:       "stub-alice",
+		Email:         "alice@example.com",
+		EmailVerified: true,
+		GivenName:     "Alice",
+		FamilyName:    "Liddell",
+	})
+	ctx := context.Background()
+
+	state, _ := RandomString()
+	nonce, _ := RandomString()
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatalf("NewPKCE: %v", err)
+	}
+
+	code, returnedState := authorize(t, provider, state, nonce, challenge)
+	if returnedState != state {
+		t.Fatalf("state = %q, want %q", returnedState, state)
+	}
+	if code == "" {
+		t.Fatal("callback has no code")
+	}
+
+	token, err := provider.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	claims, err := provider.VerifyIDToken(ctx, token.IDToken, nonce)
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if claims.Subject != "stub-alice" || claims.Email != "alice@example.com" || !claims.IsEmailVerified() {
+		t.Fatalf("claims = %+v, want subject stub-alice with verified alice@example.com", claims)
+	}
+
+	// 授权码只能使用一次
+	if _, err := provider.Exchange(ctx, code, verifier); err == nil {
+		t.Fatal("Exchange accepted a code that was already used")
+	}
+}
+
+func TestCallbackRejections(t *testing.T) {
+	provider := newTestProvider(t, StubUser{Subject: "stub-bob", Email: "bob@example.com", EmailVerified: true})
+	ctx := context.Background()
+
+	otherVerifier, _, err := NewPKCE()
+	if err != nil {
+		t.Fatalf("NewPKCE: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		// verifier 为空时使用与挑战值匹配的校验值
+		verifier string
+		// idTokenNonce 根据授权请求中的nonce返回校验ID令牌时使用的nonce，为nil时表示应在换取令牌时失败
+		idTokenNonce func(issued string) string
+	}{
+		{name: "wrong PKCE verifier", verifier: otherVerifier},
+		{name: "nonce mismatch", idTokenNonce: func(issued string) string { return issued + "-other" }},
+		{name: "missing nonce", idTokenNonce: func(string) string { return "" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, _ := RandomString()
+			nonce, _ := RandomString()
+			verifier, challenge, err := NewPKCE()
+			if err != nil {
+				t.Fatalf("NewPKCE: %v", err)
+			}
+
+			code, _ := authorize(t, provider, state, nonce, challenge)
+
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+			token, err := provider.Exchange(ctx, code, verifier)
+			if tt.idTokenNonce == nil {
+				if err == nil {
+					t.Fatal("Exchange succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+
+			if _, err := provider.VerifyIDToken(ctx, token.IDToken, tt.idTokenNonce(nonce)); err == nil {
+				t.Fatal("VerifyIDToken succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// RFC 7636 附录B中的示例
+	const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	const want = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	if got := CodeChallenge(verifier); got != want {
+		t.Fatalf("CodeChallenge = %q, want %q", got, want)
+	}
+}
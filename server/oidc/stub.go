@@ -0,0 +1,220 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// StubUser 本地模拟身份提供方登录的用户
+type StubUser struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+}
+
+// StubServer 仅用于本地开发和联调的最小OIDC身份提供方：
+// 授权端点不做交互直接同意，按login_hint（邮箱）返回用户，支持PKCE S256。
+// 不要在生产环境中使用
+type StubServer struct {
+	issuer   string
+	clientID string
+	users    map[string]StubUser
+	fallback StubUser
+	key      *rsa.PrivateKey
+	kid      string
+
+	mu    sync.Mutex
+	codes map[string]stubCode
+}
+
+type stubCode struct {
+	user          StubUser
+	clientID      string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+	expiresAt     time.Time
+}
+
+// NewStubServer 创建模拟身份提供方，issuer必须是外部访问该服务的地址；未匹配login_hint时使用第一个用户
+func NewStubServer(issuer, clientID string, users ...StubUser) (*StubServer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	kid, err := RandomString()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &StubServer{
+		issuer:   issuer,
+		clientID: clientID,
+		users:    make(map[string]StubUser, len(users)),
+		key:      key,
+		kid:      kid[:16],
+		codes:    map[string]stubCode{},
+	}
+	for i, user := range users {
+		if i == 0 {
+			s.fallback = user
+		}
+		s.users[user.Email] = user
+	}
+
+	return s, nil
+}
+
+// ServeHTTP 实现http.Handler
+func (s *StubServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		s.discovery(w)
+	case "/authorize":
+		s.authorize(w, r)
+	case "/token":
+		s.token(w, r)
+	case "/jwks":
+		s.jwks(w)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *StubServer) discovery(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, Discovery{
+		Issuer:                        s.issuer,
+		AuthorizationEndpoint:         s.issuer + "/authorize",
+		TokenEndpoint:                 s.issuer + "/token",
+		JWKSURI:                       s.issuer + "/jwks",
+		CodeChallengeMethodsSupported: []string{"S256"},
+		IDTokenSigningAlgValues:       []string{"RS256"},
+	})
+}
+
+func (s *StubServer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") != s.clientID || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := s.users[q.Get("login_hint")]
+	if !ok {
+		user = s.fallback
+	}
+
+	code, err := RandomString()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.mu.Lock()
+	s.codes[code] = stubCode{
+		user:          user,
+		clientID:      q.Get("client_id"),
+		redirectURI:   q.Get("redirect_uri"),
+		nonce:         q.Get("nonce"),
+		codeChallenge: q.Get("code_challenge"),
+		expiresAt:     time.Now().Add(time.Minute),
+	}
+	s.mu.Unlock()
+
+	params := redirectURI.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	redirectURI.RawQuery = params.Encode()
+
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (s *StubServer) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	s.mu.Lock()
+	code, ok := s.codes[r.PostForm.Get("code")]
+	delete(s.codes, r.PostForm.Get("code"))
+	s.mu.Unlock()
+
+	if !ok || time.Now().After(code.expiresAt) ||
+		code.clientID != r.PostForm.Get("client_id") ||
+		code.redirectURI != r.PostForm.Get("redirect_uri") ||
+		CodeChallenge(r.PostForm.Get("code_verifier")) != code.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	verified := code.user.EmailVerified
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, &Claims{
+		Email:         code.user.Email,
+		EmailVerified: &verified,
+		GivenName:     code.user.GivenName,
+		FamilyName:    code.user.FamilyName,
+		Name:          code.user.GivenName + " " + code.user.FamilyName,
+		Nonce:         code.nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer,
+			Subject:   code.user.Subject,
+			Audience:  jwt.ClaimStrings{code.clientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+		},
+	})
+	idToken.Header["kid"] = s.kid
+
+	signed, err := idToken.SignedString(s.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	accessToken, _ := RandomString()
+	writeJSON(w, http.StatusOK, TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		IDToken:     signed,
+		ExpiresIn:   300,
+	})
+}
+
+func (s *StubServer) jwks(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": s.kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+		}},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,162 @@
+package recommendation
+
+import (
+	"sync"
+	"time"
+
+	"github.com/joey17520/magic-stream-app/models"
+)
+
+// Candidates 一个档案的推荐候选集及计算时使用的喜爱类型。候选集与请求地区无关，
+// 每次请求按地区过滤后再交给推荐策略挑选
+type Candidates struct {
+	Movies         []models.Movie
+	FavoriteGenres []string
+	// BuiltAt 计算候选集的时间，读取缓存时据此去掉之后才播放的电影
+	BuiltAt time.Time
+}
+
+// Without 返回去掉指定电影后的候选集，不修改原候选集（可能仍在缓存中被其他请求读取）
+func (c Candidates) Without(movieIds []string) Candidates {
+	if len(movieIds) == 0 {
+		return c
+	}
+
+	excluded := make(map[string]struct{}, len(movieIds))
+	for _, movieId := range movieIds {
+		excluded[movieId] = struct{}{}
+	}
+
+	movies := make([]models.Movie, 0, len(c.Movies))
+	for _, movie := range c.Movies {
+		if _, ok := excluded[movie.ImdbID]; !ok {
+			movies = append(movies, movie)
+		}
+	}
+	c.Movies = movies
+	return c
+}
+
+// cacheEntry 单个用户的推荐缓存
+type cacheEntry struct {
+	candidates Candidates
+	expiresAt  time.Time
+}
+
+// Cache 按用户缓存推荐候选集，支持TTL过期、单用户失效和全量失效。
+// 计算推荐前先通过Version取得版本号，写入时版本号不一致说明期间发生过失效，结果会被丢弃，
+// 避免把失效前计算出的旧结果写回缓存。
+// 版本号来自单调递增的clock：单用户失效时记录到versions，全量失效时记录到generation并清空versions，
+// 因此versions只保存上次全量失效之后失效过的用户
+type Cache struct {
+	mu         sync.RWMutex
+	ttl        time.Duration
+	entries    map[string]cacheEntry
+	versions   map[string]uint64
+	generation uint64
+	clock      uint64
+	// nextSweep 下次清理过期条目的时间，写入缓存时顺带清理，长期不再访问的用户不会一直占用内存
+	nextSweep time.Time
+}
+
+// NewCache 创建推荐缓存，ttl<=0时缓存不生效
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{
+		ttl:      ttl,
+		entries:  make(map[string]cacheEntry),
+		versions: make(map[string]uint64),
+	}
+}
+
+// Enabled 缓存是否生效
+func (c *Cache) Enabled() bool {
+	return c.ttl > 0
+}
+
+// Get 获取未过期的缓存结果，读到已过期的条目时将其删除
+func (c *Cache) Get(key string) (Candidates, bool) {
+	if !c.Enabled() {
+		return Candidates{}, false
+	}
+
+	now := time.Now()
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+
+	if !ok {
+		return Candidates{}, false
+	}
+	if now.After(entry.expiresAt) {
+		c.mu.Lock()
+		// 释放读锁期间可能已被重新写入
+		if current, ok := c.entries[key]; ok && now.After(current.expiresAt) {
+			delete(c.entries, key)
+		}
+		c.mu.Unlock()
+		return Candidates{}, false
+	}
+	return entry.candidates, true
+}
+
+// Version 获取key当前的版本号，单用户失效或全量失效都会改变版本号
+func (c *Cache) Version(key string) uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.version(key)
+}
+
+// version 调用方需持有锁
+func (c *Cache) version(key string) uint64 {
+	return max(c.generation, c.versions[key])
+}
+
+// Set 写入缓存，version与当前版本号不一致时放弃写入
+func (c *Cache) Set(key string, candidates Candidates, version uint64) {
+	if !c.Enabled() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.After(c.nextSweep) {
+		for k, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		c.nextSweep = now.Add(c.ttl)
+	}
+
+	if c.version(key) != version {
+		return
+	}
+	c.entries[key] = cacheEntry{
+		candidates: candidates,
+		expiresAt:  now.Add(c.ttl),
+	}
+}
+
+// Invalidate 使单个用户的缓存失效
+func (c *Cache) Invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+	c.clock++
+	c.versions[key] = c.clock
+}
+
+// InvalidateAll 使所有缓存失效，用于电影目录发生变化时。新的generation大于此前所有单用户版本号，
+// 可以直接清空versions
+func (c *Cache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]cacheEntry)
+	c.clock++
+	c.generation = c.clock
+	c.versions = make(map[string]uint64)
+}
@@ -0,0 +1,147 @@
+package recommendation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joey17520/magic-stream-app/models"
+)
+
+func testCandidates(ids ...string) Candidates {
+	movies := make([]models.Movie, 0, len(ids))
+	for _, id := range ids {
+		movies = append(movies, models.Movie{ImdbID: id})
+	}
+	return Candidates{Movies: movies}
+}
+
+func TestCacheStaleWrites(t *testing.T) {
+	tests := []struct {
+		name string
+		// invalidate 在取得版本号之后、写入之前发生的失效
+		invalidate func(c *Cache)
+		wantCached bool
+	}{
+		{name: "no invalidation", invalidate: func(*Cache) {}, wantCached: true},
+		{name: "user invalidated", invalidate: func(c *Cache) { c.Invalidate("u1") }},
+		{name: "all invalidated", invalidate: func(c *Cache) { c.InvalidateAll() }},
+		{name: "other user invalidated", invalidate: func(c *Cache) { c.Invalidate("u2") }, wantCached: true},
+		{
+			// 全量失效会清空versions，之前单用户失效的版本号不能因此回退
+			name: "user invalidated then all invalidated",
+			invalidate: func(c *Cache) {
+				c.Invalidate("u1")
+				c.Invalidate("u1")
+				c.InvalidateAll()
+			},
+		},
+		{
+			// 清空versions后再次单用户失效，得到的版本号不能与失效前的版本号重合
+			name: "all invalidated then user invalidated",
+			invalidate: func(c *Cache) {
+				c.InvalidateAll()
+				c.Invalidate("u1")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCache(time.Minute)
+			// 取版本号前u1已有单用户版本号
+			c.Invalidate("u1")
+			c.Invalidate("u1")
+
+			version := c.Version("u1")
+			tt.invalidate(c)
+			c.Set("u1", testCandidates("tt1"), version)
+
+			if _, ok := c.Get("u1"); ok != tt.wantCached {
+				t.Fatalf("cached = %v, want %v", ok, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestCacheVersionsMonotonic(t *testing.T) {
+	c := NewCache(time.Minute)
+
+	seen := map[uint64]bool{}
+	last := c.Version("u1")
+	seen[last] = true
+	steps := []func(){
+		func() { c.Invalidate("u1") },
+		func() { c.Invalidate("u2") },
+		func() { c.InvalidateAll() },
+		func() { c.Invalidate("u1") },
+		func() { c.Invalidate("u1") },
+		func() { c.InvalidateAll() },
+		func() { c.InvalidateAll() },
+	}
+	for i, step := range steps {
+		step()
+		version := c.Version("u1")
+		if version < last {
+			t.Fatalf("step %d: version went back from %d to %d", i, last, version)
+		}
+		last = version
+	}
+	if len(c.versions) != 0 {
+		t.Fatalf("versions has %d entries after InvalidateAll, want 0", len(c.versions))
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	c := NewCache(20 * time.Millisecond)
+
+	c.Set("u1", testCandidates("tt1"), c.Version("u1"))
+	if got, ok := c.Get("u1"); !ok || got.Movies[0].ImdbID != "tt1" {
+		t.Fatalf("Get = %+v, %v, want cached tt1", got, ok)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	// 读到过期条目时删除
+	if _, ok := c.Get("u1"); ok {
+		t.Fatal("expired entry was returned")
+	}
+	if _, ok := c.entries["u1"]; ok {
+		t.Fatal("expired entry was not evicted on read")
+	}
+
+	// 不再被读取的过期条目在之后的写入时清理
+	c.Set("u2", testCandidates("tt2"), c.Version("u2"))
+	time.Sleep(30 * time.Millisecond)
+	c.Set("u3", testCandidates("tt3"), c.Version("u3"))
+	if _, ok := c.entries["u2"]; ok {
+		t.Fatal("expired entry was not swept")
+	}
+	if _, ok := c.entries["u3"]; !ok {
+		t.Fatal("fresh entry is missing")
+	}
+}
+
+func TestCacheDisabled(t *testing.T) {
+	c := NewCache(0)
+	c.Set("u1", testCandidates("tt1"), c.Version("u1"))
+	if _, ok := c.Get("u1"); ok {
+		t.Fatal("disabled cache returned an entry")
+	}
+}
+
+func TestCandidatesWithout(t *testing.T) {
+	cached := testCandidates("tt1", "tt2", "tt3")
+
+	filtered := cached.Without([]string{"tt2", "tt9"})
+	if len(filtered.Movies) != 2 || filtered.Movies[0].ImdbID != "tt1" || filtered.Movies[1].ImdbID != "tt3" {
+		t.Fatalf("Without(tt2, tt9) = %+v, want tt1 and tt3", filtered.Movies)
+	}
+	// 缓存中的候选集会被并发请求共用，过滤不能改动它
+	if len(cached.Movies) != 3 || cached.Movies[1].ImdbID != "tt2" {
+		t.Fatalf("Without modified the cached candidates: %+v", cached.Movies)
+	}
+
+	if unchanged := cached.Without(nil); len(unchanged.Movies) != 3 {
+		t.Fatalf("Without(nil) = %+v, want all candidates", unchanged.Movies)
+	}
+}
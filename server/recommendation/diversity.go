@@ -0,0 +1,165 @@
+package recommendation
+
+import (
+	"math"
+
+	"github.com/joey17520/magic-stream-app/models"
+)
+
+// unrankedValue 未评级电影的ranking_value
+const unrankedValue = 999
+
+// Options 推荐结果后处理参数
+type Options struct {
+	// Limit 最终返回的电影数量
+	Limit int
+	// MaxGenreShare 单一类型在结果中的最大占比，取值(0, 1]，1表示不限制
+	MaxGenreShare float64
+	// Lambda MMR中相关性与多样性的权衡系数，1只看相关性，0只看多样性
+	Lambda float64
+}
+
+// Rerank 对候选电影进行多样性重排：
+// 使用最大边际相关性（MMR）逐个挑选电影，同时限制每个类型的占比。
+// 当满足类型上限的候选不足时，放宽上限以保证返回数量。
+func Rerank(candidates []models.Movie, favoriteGenres []string, opts Options) []models.Movie {
+	if opts.Limit <= 0 || len(candidates) == 0 {
+		return []models.Movie{}
+	}
+
+	favorites := make(map[string]struct{}, len(favoriteGenres))
+	for _, name := range favoriteGenres {
+		favorites[name] = struct{}{}
+	}
+
+	relevance := relevanceScores(candidates, favorites)
+
+	maxPerGenre := opts.Limit
+	if opts.MaxGenreShare > 0 && opts.MaxGenreShare < 1 {
+		maxPerGenre = int(math.Ceil(opts.MaxGenreShare * float64(opts.Limit)))
+		if maxPerGenre < 1 {
+			maxPerGenre = 1
+		}
+	}
+
+	selected := make([]models.Movie, 0, opts.Limit)
+	used := make([]bool, len(candidates))
+	genreCounts := make(map[string]int)
+
+	for len(selected) < opts.Limit {
+		best := pickNext(candidates, selected, used, relevance, opts.Lambda, func(movie models.Movie) bool {
+			for _, genre := range movie.Genre {
+				if genreCounts[genre.GenreName] >= maxPerGenre {
+					return false
+				}
+			}
+			return true
+		})
+
+		if best < 0 {
+			// 所有剩余候选都会突破类型上限，放宽约束继续挑选
+			best = pickNext(candidates, selected, used, relevance, opts.Lambda, nil)
+		}
+		if best < 0 {
+			break
+		}
+
+		used[best] = true
+		selected = append(selected, candidates[best])
+		for _, genre := range candidates[best].Genre {
+			genreCounts[genre.GenreName]++
+		}
+	}
+
+	return selected
+}
+
+// pickNext 在未使用且满足约束的候选中选出MMR得分最高者，没有可选项时返回-1
+func pickNext(candidates, selected []models.Movie, used []bool, relevance []float64, lambda float64, admissible func(models.Movie) bool) int {
+	best := -1
+	bestScore := math.Inf(-1)
+
+	for i, movie := range candidates {
+		if used[i] {
+			continue
+		}
+		if admissible != nil && !admissible(movie) {
+			continue
+		}
+
+		maxSimilarity := 0.0
+		for _, chosen := range selected {
+			if sim := genreSimilarity(movie, chosen); sim > maxSimilarity {
+				maxSimilarity = sim
+			}
+		}
+
+		score := lambda*relevance[i] - (1-lambda)*maxSimilarity
+		if score > bestScore {
+			best = i
+			bestScore = score
+		}
+	}
+
+	return best
+}
+
+// relevanceScores 计算候选电影的相关性得分，取值[0, 1]。
+// 评级越好（ranking_value越小）得分越高，同时奖励与用户喜爱类型的重合度。
+func relevanceScores(candidates []models.Movie, favorites map[string]struct{}) []float64 {
+	maxRank := 0
+	for _, movie := range candidates {
+		value := movie.Ranking.RankingValue
+		if value != unrankedValue && value > maxRank {
+			maxRank = value
+		}
+	}
+
+	scores := make([]float64, len(candidates))
+	for i, movie := range candidates {
+		rankScore := 0.0
+		value := movie.Ranking.RankingValue
+		if value > 0 && value != unrankedValue && maxRank > 0 {
+			rankScore = 1 - float64(value-1)/float64(maxRank)
+		}
+
+		affinity := 0.0
+		if len(movie.Genre) > 0 && len(favorites) > 0 {
+			matched := 0
+			for _, genre := range movie.Genre {
+				if _, ok := favorites[genre.GenreName]; ok {
+					matched++
+				}
+			}
+			affinity = float64(matched) / float64(len(movie.Genre))
+		}
+
+		scores[i] = 0.7*rankScore + 0.3*affinity
+	}
+
+	return scores
+}
+
+// genreSimilarity 两部电影类型集合的Jaccard相似度
+func genreSimilarity(a, b models.Movie) float64 {
+	if len(a.Genre) == 0 || len(b.Genre) == 0 {
+		return 0
+	}
+
+	set := make(map[string]struct{}, len(a.Genre))
+	for _, genre := range a.Genre {
+		set[genre.GenreName] = struct{}{}
+	}
+
+	intersection := 0
+	union := len(set)
+	for _, genre := range b.Genre {
+		if _, ok := set[genre.GenreName]; ok {
+			intersection++
+		} else {
+			union++
+		}
+	}
+
+	return float64(intersection) / float64(union)
+}
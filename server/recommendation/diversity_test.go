@@ -0,0 +1,206 @@
+package recommendation
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/joey17520/magic-stream-app/models"
+)
+
+// movie 构造测试用电影，rank为ranking_value
+func movie(id string, rank int, genres ...string) models.Movie {
+	m := models.Movie{ImdbID: id, Ranking: models.Ranking{RankingValue: rank}}
+	for i, name := range genres {
+		m.Genre = append(m.Genre, models.Genre{GenreID: i + 1, GenreName: name})
+	}
+	return m
+}
+
+// ids 按顺序取出电影ID
+func ids(movies []models.Movie) []string {
+	result := make([]string, len(movies))
+	for i, m := range movies {
+		result[i] = m.ImdbID
+	}
+	return result
+}
+
+// genreCounts 统计结果中每个类型出现的次数
+func genreCounts(movies []models.Movie) map[string]int {
+	counts := map[string]int{}
+	for _, m := range movies {
+		for _, genre := range m.Genre {
+			counts[genre.GenreName]++
+		}
+	}
+	return counts
+}
+
+func TestRerank(t *testing.T) {
+	dramaHeavy := []models.Movie{
+		movie("d1", 1, "Drama"),
+		movie("d2", 1, "Drama"),
+		movie("d3", 2, "Drama"),
+		movie("d4", 2, "Drama"),
+		movie("d5", 3, "Drama"),
+		movie("c1", 3, "Comedy"),
+		movie("c2", 4, "Comedy"),
+		movie("a1", 4, "Action"),
+	}
+
+	tests := []struct {
+		name       string
+		candidates []models.Movie
+		favorites  []string
+		opts       Options
+		// wantLen 期望返回的数量
+		wantLen int
+		// wantMaxPerGenre 每个类型最多出现的次数，0表示不检查
+		wantMaxPerGenre int
+		// wantOrder 期望的完整顺序，为空时不检查
+		wantOrder []string
+	}{
+		{
+			name:       "zero limit",
+			candidates: dramaHeavy,
+			opts:       Options{Limit: 0, MaxGenreShare: 1, Lambda: 0.7},
+			wantLen:    0,
+		},
+		{
+			name:    "no candidates",
+			opts:    Options{Limit: 5, MaxGenreShare: 0.5, Lambda: 0.7},
+			wantLen: 0,
+		},
+		{
+			name:            "genre cap limits the dominant genre",
+			candidates:      dramaHeavy,
+			favorites:       []string{"Drama"},
+			opts:            Options{Limit: 4, MaxGenreShare: 0.5, Lambda: 1},
+			wantLen:         4,
+			wantMaxPerGenre: 2,
+		},
+		{
+			name:       "cap is relaxed when candidates run out",
+			candidates: dramaHeavy[:5],
+			opts:       Options{Limit: 4, MaxGenreShare: 0.25, Lambda: 1},
+			wantLen:    4,
+			wantOrder:  []string{"d1", "d2", "d3", "d4"},
+		},
+		{
+			name: "pure relevance keeps ranking order",
+			candidates: []models.Movie{
+				movie("r3", 3, "Drama"),
+				movie("r1", 1, "Drama"),
+				movie("u", unrankedValue, "Drama"),
+				movie("r2", 2, "Drama"),
+			},
+			opts:      Options{Limit: 4, MaxGenreShare: 1, Lambda: 1},
+			wantLen:   4,
+			wantOrder: []string{"r1", "r2", "r3", "u"},
+		},
+		{
+			name: "favorite genres break ranking ties",
+			candidates: []models.Movie{
+				movie("comedy", 1, "Comedy"),
+				movie("drama", 1, "Drama"),
+			},
+			favorites: []string{"Drama"},
+			opts:      Options{Limit: 2, MaxGenreShare: 1, Lambda: 1},
+			wantLen:   2,
+			wantOrder: []string{"drama", "comedy"},
+		},
+		{
+			name: "low lambda prefers a different genre over a similar better ranked movie",
+			candidates: []models.Movie{
+				movie("d1", 1, "Drama"),
+				movie("d2", 2, "Drama"),
+				movie("c1", 5, "Comedy"),
+			},
+			opts:      Options{Limit: 2, MaxGenreShare: 1, Lambda: 0.3},
+			wantLen:   2,
+			wantOrder: []string{"d1", "c1"},
+		},
+		{
+			name:       "limit larger than candidates",
+			candidates: dramaHeavy[:3],
+			opts:       Options{Limit: 10, MaxGenreShare: 0.3, Lambda: 0.7},
+			wantLen:    3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Rerank(tt.candidates, tt.favorites, tt.opts)
+
+			if len(got) != tt.wantLen {
+				t.Fatalf("len = %d, want %d (%v)", len(got), tt.wantLen, ids(got))
+			}
+
+			seen := map[string]bool{}
+			for _, m := range got {
+				if seen[m.ImdbID] {
+					t.Fatalf("%s selected twice: %v", m.ImdbID, ids(got))
+				}
+				seen[m.ImdbID] = true
+			}
+
+			if tt.wantMaxPerGenre > 0 {
+				for genre, count := range genreCounts(got) {
+					if count > tt.wantMaxPerGenre {
+						t.Fatalf("genre %s appears %d times, want at most %d (%v)", genre, count, tt.wantMaxPerGenre, ids(got))
+					}
+				}
+			}
+
+			if tt.wantOrder != nil {
+				order := ids(got)
+				for i := range tt.wantOrder {
+					if order[i] != tt.wantOrder[i] {
+						t.Fatalf("order = %v, want %v", order, tt.wantOrder)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGenreCap(t *testing.T) {
+	// Drama评级最好，不限制时会占满结果
+	var candidates []models.Movie
+	for g, genre := range []string{"Drama", "Comedy", "Action", "Horror"} {
+		for i := range 10 {
+			candidates = append(candidates, movie(fmt.Sprintf("%s-%d", genre, i), g*10+i+1, genre))
+		}
+	}
+
+	tests := []struct {
+		share   float64
+		limit   int
+		wantCap int
+	}{
+		{share: 1, limit: 8, wantCap: 8},
+		{share: 0.5, limit: 10, wantCap: 5},
+		{share: 0.34, limit: 6, wantCap: 3},
+		{share: 0.25, limit: 8, wantCap: 2},
+		{share: 0.01, limit: 4, wantCap: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("share %.2f limit %d", tt.share, tt.limit), func(t *testing.T) {
+			got := Rerank(candidates, []string{"Drama"}, Options{Limit: tt.limit, MaxGenreShare: tt.share, Lambda: 1})
+			if len(got) != tt.limit {
+				t.Fatalf("len = %d, want %d", len(got), tt.limit)
+			}
+			counts := genreCounts(got)
+			for genre, count := range counts {
+				if count > tt.wantCap {
+					t.Fatalf("genre %s appears %d times, want at most %d (%v)", genre, count, tt.wantCap, ids(got))
+				}
+			}
+			// 上限内优先选择评级最好的Drama
+			if want := min(tt.wantCap, tt.limit); counts["Drama"] != want {
+				t.Fatalf("Drama appears %d times, want %d (%v)", counts["Drama"], want, ids(got))
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package recommendation
+
+import "github.com/joey17520/magic-stream-app/models"
+
+// 推荐策略名称
+const (
+	// StrategyRanking 按评级排序直接截取，不做多样性处理
+	StrategyRanking = "ranking"
+	// StrategyDiverse 使用MMR和类型占比上限做多样性重排
+	StrategyDiverse = "diverse"
+)
+
+// DefaultStrategy 未参与实验时使用的策略
+const DefaultStrategy = StrategyDiverse
+
+// Strategy 从已按评级排序的候选集中挑选最终推荐结果
+type Strategy func(candidates []models.Movie, favoriteGenres []string, opts Options) []models.Movie
+
+// strategies 已注册的推荐策略
+var strategies = map[string]Strategy{
+	StrategyRanking: rankingStrategy,
+	StrategyDiverse: Rerank,
+}
+
+// GetStrategy 按名称获取推荐策略
+func GetStrategy(name string) (Strategy, bool) {
+	strategy, ok := strategies[name]
+	return strategy, ok
+}
+
+// rankingStrategy 保持候选集原有顺序，取前Limit部电影
+func rankingStrategy(candidates []models.Movie, _ []string, opts Options) []models.Movie {
+	if opts.Limit <= 0 {
+		return []models.Movie{}
+	}
+	if len(candidates) > opts.Limit {
+		return candidates[:opts.Limit]
+	}
+	return candidates
+}
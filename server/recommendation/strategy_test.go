@@ -0,0 +1,39 @@
+package recommendation
+
+import (
+	"testing"
+
+	"github.com/joey17520/magic-stream-app/models"
+)
+
+func TestRankingStrategy(t *testing.T) {
+	candidates := []models.Movie{movie("a", 1), movie("b", 2), movie("c", 3)}
+
+	strategy, ok := GetStrategy(StrategyRanking)
+	if !ok {
+		t.Fatal("ranking strategy is not registered")
+	}
+	if _, ok := GetStrategy(DefaultStrategy); !ok {
+		t.Fatal("default strategy is not registered")
+	}
+
+	tests := []struct {
+		limit int
+		want  []string
+	}{
+		{limit: 0, want: []string{}},
+		{limit: 2, want: []string{"a", "b"}},
+		{limit: 5, want: []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		got := ids(strategy(candidates, nil, Options{Limit: tt.limit}))
+		if len(got) != len(tt.want) {
+			t.Fatalf("limit %d: got %v, want %v", tt.limit, got, tt.want)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Fatalf("limit %d: got %v, want %v", tt.limit, got, tt.want)
+			}
+		}
+	}
+}
@@ -4,13 +4,84 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/joey17520/magic-stream-app/controllers"
 	"github.com/joey17520/magic-stream-app/middlewares"
+	"github.com/joey17520/magic-stream-app/models"
 )
 
 func SetupProtectedRoutes(router *gin.Engine) {
 	router.Use(middlewares.AuthMiddleware())
 
-	router.GET("/movie/:imdb_id", controllers.GetMovie())
-	router.POST("/movie", controllers.AddMovie())
-	router.GET("/recommendedmovies", controllers.GetRecommendedMovies())
-	router.PATCH("/updatereview/:imdb_id", controllers.AdminReviewUpdate())
+	// 使用API密钥访问时需要具备对应的权限范围
+	moviesRead := middlewares.RequireScope(models.ScopeMoviesRead)
+	moviesWrite := middlewares.RequireScope(models.ScopeMoviesWrite)
+	ratingsWrite := middlewares.RequireScope(models.ScopeRatingsWrite)
+
+	router.GET("/movie/:imdb_id", moviesRead, controllers.GetMovie())
+	router.POST("/movie", moviesWrite, middlewares.RequireAdmin(), middlewares.RequireVerifiedEmail(), controllers.AddMovie())
+	router.POST("/movie/:imdb_id/rating", ratingsWrite, middlewares.RequireVerifiedEmail(), controllers.RateMovie())
+	router.GET("/recommendedmovies", moviesRead, controllers.GetRecommendedMovies())
+	router.POST("/recommendations/:imdb_id/dismiss", ratingsWrite, controllers.DismissRecommendation())
+	router.POST("/recommendations/:imdb_id/click", ratingsWrite, controllers.ClickRecommendation())
+	router.PATCH("/updatereview/:imdb_id", moviesWrite, middlewares.RequireVerifiedEmail(), controllers.AdminReviewUpdate())
+
+	// 当前档案的片单和观看记录
+	router.GET("/watchlist", moviesRead, controllers.GetWatchlist())
+	router.PUT("/watchlist/:imdb_id", ratingsWrite, controllers.AddToWatchlist())
+	router.DELETE("/watchlist/:imdb_id", ratingsWrite, controllers.RemoveFromWatchlist())
+	router.GET("/history", moviesRead, controllers.GetHistory())
+
+	// 自托管视频播放
+	router.GET("/stream/:imdb_id", moviesRead, controllers.StreamMovie())
+	router.HEAD("/stream/:imdb_id", moviesRead, controllers.StreamMovie())
+	router.GET("/stream/:imdb_id/hls/master.m3u8", moviesRead, controllers.StreamHLSMaster())
+	router.GET("/stream/:imdb_id/hls/:rendition/index.m3u8", moviesRead, controllers.StreamHLSMedia())
+	router.GET("/stream/:imdb_id/hls/:rendition/segments/:segment", moviesRead, controllers.StreamHLSSegment())
+
+	// 当前用户
+	router.GET("/me", middlewares.RequireScope(models.ScopeProfileRead), controllers.GetProfile())
+
+	// 账户管理只允许登录会话访问，API密钥不能修改账户或签发新的凭据
+	account := router.Group("/me", middlewares.RequireSession())
+	account.PATCH("", controllers.UpdateProfile())
+	account.DELETE("", controllers.DeleteAccount())
+	account.GET("/export", controllers.ExportAccount())
+	account.POST("/password", controllers.ChangePassword())
+	account.GET("/sessions", controllers.GetSessions())
+	account.DELETE("/sessions", controllers.RevokeAllSessions())
+	account.DELETE("/sessions/:session_id", controllers.RevokeSession())
+	account.GET("/api-keys", controllers.GetAPIKeys())
+	account.POST("/api-keys", controllers.CreateAPIKey())
+	account.DELETE("/api-keys/:key_id", controllers.RevokeAPIKey())
+	account.GET("/profiles", controllers.GetHouseholdProfiles())
+	account.POST("/profiles", controllers.CreateHouseholdProfile())
+	account.POST("/profiles/select", controllers.SelectHouseholdProfile())
+	account.PATCH("/profiles/:profile_id", controllers.UpdateHouseholdProfile())
+	account.DELETE("/profiles/:profile_id", controllers.DeleteHouseholdProfile())
+	account.GET("/parental-controls", controllers.GetParentalControls())
+	account.PUT("/parental-controls", controllers.UpdateParentalControls())
+	account.POST("/2fa/enroll", controllers.EnrollTwoFactor())
+	account.POST("/2fa/confirm", controllers.ConfirmTwoFactor())
+	account.POST("/2fa/recovery-codes", controllers.RegenerateRecoveryCodes())
+	account.POST("/2fa/disable", controllers.DisableTwoFactor())
+
+	// 管理员端点
+	admin := router.Group("/admin", middlewares.RequireScope(models.ScopeAdmin), middlewares.RequireAdmin())
+	admin.GET("/experiments", controllers.GetExperimentMetrics())
+	admin.GET("/catalog/preview", controllers.PreviewCatalog())
+	admin.PUT("/movies/:imdb_id/availability", controllers.UpdateMovieAvailability())
+	admin.PUT("/movies/:imdb_id/titles", controllers.UpdateMovieTitles())
+	admin.PUT("/movies/:imdb_id/video", controllers.UploadMovieVideo())
+	admin.DELETE("/movies/:imdb_id/video", controllers.DeleteMovieVideo())
+	admin.GET("/movies/:imdb_id/hls", controllers.GetHLSRenditions())
+	admin.PUT("/movies/:imdb_id/hls/:rendition", controllers.UploadHLSRendition())
+	admin.DELETE("/movies/:imdb_id/hls/:rendition", controllers.DeleteHLSRendition())
+	admin.PUT("/genres/:genre_id/names", controllers.UpdateGenreNames())
+	admin.POST("/people", controllers.CreatePerson())
+	admin.GET("/metadata/:imdb_id", controllers.PreviewMovieMetadata())
+	admin.POST("/metadata/:imdb_id/import", controllers.ImportMovieMetadata())
+	admin.GET("/users", controllers.AdminListUsers())
+	admin.GET("/users/:user_id", controllers.AdminGetUser())
+	admin.PATCH("/users/:user_id/role", controllers.AdminUpdateUserRole())
+	admin.POST("/users/:user_id/disable", controllers.AdminDisableUser())
+	admin.POST("/users/:user_id/enable", controllers.AdminEnableUser())
+	admin.POST("/users/:user_id/logout", controllers.AdminLogoutUser())
 }
@@ -15,11 +15,23 @@ func SetupUnprotectedRoutes(router *gin.Engine) {
 	// 指标端点
 	router.GET("/metrics", middlewares.GetMetricsHandler())
 
+	// 令牌验证公钥
+	router.GET("/.well-known/jwks.json", controllers.GetJWKS())
+
 	// 业务端点
-	router.GET("/movies", controllers.GetMovies())
+	router.GET("/movies", middlewares.OptionalAuth(), controllers.GetMovies())
+	router.GET("/movies/trending", middlewares.OptionalAuth(), controllers.GetTrendingMovies())
+	router.GET("/people/:id", middlewares.OptionalAuth(), controllers.GetPerson())
 	router.POST("/register", controllers.RegisterUser())
 	router.POST("/login", controllers.LoginUser())
+	router.POST("/login/2fa", controllers.LoginTwoFactor())
+	router.GET("/auth/:provider/login", controllers.OIDCLogin())
+	router.GET("/auth/:provider/callback", controllers.OIDCCallback())
 	router.POST("/logout", controllers.LogoutHandler())
 	router.GET("/genres", controllers.GetGenres())
 	router.POST("/refresh", controllers.RefreshTokenHandler())
+	router.POST("/password/forgot", controllers.ForgotPassword())
+	router.POST("/password/reset", controllers.ResetPassword())
+	router.GET("/verify-email", controllers.VerifyEmail())
+	router.POST("/verify-email/resend", controllers.ResendVerificationEmail())
 }
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// LocalStore 把对象保存为本地目录下的文件，key中的“/”对应子目录
+type LocalStore struct {
+	dir string
+}
+
+// NewLocalStore 创建保存到dir目录的LocalStore，目录不存在时自动创建
+func NewLocalStore(dir string) (*LocalStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("directory is required for the %q storage driver", DriverLocal)
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &LocalStore{dir: dir}, nil
+}
+
+// Name 存储驱动名称
+func (s *LocalStore) Name() string {
+	return DriverLocal
+}
+
+// path 把key转换为文件路径，拒绝绝对路径和跳出存储目录的key
+func (s *LocalStore) path(key string) (string, error) {
+	local := filepath.FromSlash(key)
+	if key == "" || !filepath.IsLocal(local) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.dir, local), nil
+}
+
+// Put 先写入同目录下的临时文件，完成后再重命名，正在读取旧文件的请求不受影响
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader) (BlobInfo, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return BlobInfo{}, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), contextReader{ctx: ctx, r: r})
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	if err := tmp.Sync(); err != nil {
+		return BlobInfo{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return BlobInfo{}, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return BlobInfo{}, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	return BlobInfo{Key: key, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil)), ModTime: info.ModTime()}, nil
+}
+
+// Open 打开文件，BlobInfo中不计算摘要
+func (s *LocalStore) Open(ctx context.Context, key string) (io.ReadSeekCloser, BlobInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, BlobInfo{}, err
+	}
+	path, err := s.path(key)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, BlobInfo{}, ErrNotFound
+		}
+		return nil, BlobInfo{}, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, BlobInfo{}, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, BlobInfo{}, ErrNotFound
+	}
+	return file, BlobInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Delete 删除文件
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// contextReader 在每次读取前检查ctx，客户端断开后尽快停止写入
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
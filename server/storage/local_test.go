@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestStore(t *testing.T) (*LocalStore, string) {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "media")
+	store, err := NewLocalStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, dir
+}
+
+func TestLocalStoreRejectsKeysOutsideDirectory(t *testing.T) {
+	store, _ := newTestStore(t)
+
+	for _, key := range []string{
+		"",
+		"../escape.mp4",
+		"videos/../../escape.mp4",
+		"/etc/passwd",
+		"..",
+	} {
+		if _, err := store.path(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("path(%q) = %v, want ErrInvalidKey", key, err)
+		}
+		if _, err := store.Put(context.Background(), key, strings.NewReader("x")); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) = %v, want ErrInvalidKey", key, err)
+		}
+		if _, _, err := store.Open(context.Background(), key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Open(%q) = %v, want ErrInvalidKey", key, err)
+		}
+	}
+
+	// 清理后仍在存储目录内的key是允许的
+	if _, err := store.path("videos/./tt0111161/../tt0111161/source.mp4"); err != nil {
+		t.Errorf("path with redundant segments: %v", err)
+	}
+}
+
+func TestLocalStorePutAndOpen(t *testing.T) {
+	store, dir := newTestStore(t)
+	ctx := context.Background()
+	content := []byte("not really a video")
+
+	info, err := store.Put(ctx, "videos/tt0111161/source.mp4", bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	sum := sha256.Sum256(content)
+	if info.Size != int64(len(content)) || info.SHA256 != hex.EncodeToString(sum[:]) || info.ModTime.IsZero() {
+		t.Fatalf("info = %+v", info)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "videos", "tt0111161", "source.mp4")); err != nil {
+		t.Fatalf("file was not written under the store directory: %v", err)
+	}
+
+	file, opened, err := store.Open(ctx, "videos/tt0111161/source.mp4")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer file.Close()
+	if opened.Size != info.Size {
+		t.Fatalf("opened size = %d, want %d", opened.Size, info.Size)
+	}
+	// 支持Seek，供Range请求使用
+	if _, err := file.Seek(4, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	rest, _ := io.ReadAll(file)
+	if string(rest) != "really a video" {
+		t.Fatalf("read after seek = %q", rest)
+	}
+
+	if _, _, err := store.Open(ctx, "videos/missing.mp4"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing key: err = %v, want ErrNotFound", err)
+	}
+	if _, _, err := store.Open(ctx, "videos/tt0111161"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("directory key: err = %v, want ErrNotFound", err)
+	}
+
+	if err := store.Delete(ctx, "videos/tt0111161/source.mp4"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := store.Delete(ctx, "videos/tt0111161/source.mp4"); err != nil {
+		t.Fatalf("Delete of a missing key: %v", err)
+	}
+}
+
+// failingReader 先返回一部分数据，然后报错
+type failingReader struct {
+	data []byte
+	done bool
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.done {
+		return 0, errors.New("connection reset")
+	}
+	r.done = true
+	return copy(p, r.data), nil
+}
+
+func TestLocalStorePutReplacesAtomically(t *testing.T) {
+	store, dir := newTestStore(t)
+	ctx := context.Background()
+	key := "videos/tt0111161/source.mp4"
+
+	if _, err := store.Put(ctx, key, strings.NewReader("version 1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// 读取中的旧文件在替换后仍然完整可读
+	reader, _, err := store.Open(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	if _, err := store.Put(ctx, key, strings.NewReader("version 2, longer")); err != nil {
+		t.Fatal(err)
+	}
+	old, _ := io.ReadAll(reader)
+	if string(old) != "version 1" {
+		t.Fatalf("open reader saw %q after replacement, want the old content", old)
+	}
+
+	// 写入失败时保留原有内容，也不留下临时文件
+	if _, err := store.Put(ctx, key, &failingReader{data: []byte("partial")}); err == nil {
+		t.Fatal("Put with a failing reader succeeded")
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := store.Put(cancelled, key, strings.NewReader("version 3")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Put with a cancelled context = %v", err)
+	}
+
+	file, _, err := store.Open(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	current, _ := io.ReadAll(file)
+	if string(current) != "version 2, longer" {
+		t.Fatalf("content = %q, want the last complete upload", current)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "videos", "tt0111161"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Fatalf("directory holds %v, want only source.mp4", names)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if store, err := New(Options{}); err != nil || store != nil {
+		t.Fatalf("empty driver: store = %v, err = %v", store, err)
+	}
+	if _, err := New(Options{Driver: DriverLocal}); err == nil {
+		t.Error("local driver without a directory was accepted")
+	}
+	if _, err := New(Options{Driver: "s3", LocalDir: t.TempDir()}); err == nil {
+		t.Error("unknown driver was accepted")
+	}
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// BlobInfo 已保存对象的信息，SHA256为内容摘要（十六进制），可用作ETag
+type BlobInfo struct {
+	Key     string
+	Size    int64
+	SHA256  string
+	ModTime time.Time
+}
+
+// BlobStore 对象存储接口，便于在本地文件系统和云存储之间切换。
+// Open 返回的对象必须支持Seek，供http.ServeContent处理Range请求
+type BlobStore interface {
+	Name() string
+	// Put 保存r中的全部内容，key已存在时覆盖；写入失败不会留下不完整的对象
+	Put(ctx context.Context, key string, r io.Reader) (BlobInfo, error)
+	// Open 打开对象，不存在时返回ErrNotFound，调用方负责关闭
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, BlobInfo, error)
+	// Delete 删除对象，不存在时不报错
+	Delete(ctx context.Context, key string) error
+}
+
+// 对象存储相关错误
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// 存储驱动名称
+const (
+	DriverLocal = "local"
+)
+
+// Options 创建BlobStore所需的配置
+type Options struct {
+	Driver   string
+	LocalDir string
+}
+
+// New 根据驱动名称创建BlobStore，驱动为空时返回nil表示未启用
+func New(opts Options) (BlobStore, error) {
+	switch strings.ToLower(opts.Driver) {
+	case "":
+		return nil, nil
+	case DriverLocal:
+		return NewLocalStore(opts.LocalDir)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", opts.Driver)
+	}
+}
@@ -0,0 +1,210 @@
+package trending
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/joey17520/magic-stream-app/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+)
+
+// Window 热门榜单的统计窗口
+type Window struct {
+	// Name 窗口名称，即接口中的window参数
+	Name string
+	// Span 统计的时间范围
+	Span time.Duration
+	// HalfLife 事件权重衰减一半所需的时间
+	HalfLife time.Duration
+}
+
+// Windows 支持的统计窗口
+var Windows = []Window{
+	{Name: "24h", Span: 24 * time.Hour, HalfLife: 6 * time.Hour},
+	{Name: "7d", Span: 7 * 24 * time.Hour, HalfLife: 48 * time.Hour},
+}
+
+// DefaultWindow 未指定窗口时使用的窗口名称
+const DefaultWindow = "24h"
+
+// 事件基础权重：评分事件按星级缩放，满分评分相当于3次观看
+const (
+	viewWeight          = 1.0
+	ratingWeightPerStar = 0.6
+)
+
+// FindWindow 按名称查找统计窗口
+func FindWindow(name string) (Window, bool) {
+	for _, window := range Windows {
+		if window.Name == name {
+			return window, true
+		}
+	}
+	return Window{}, false
+}
+
+// Aggregator 定期从观看和评分事件计算热门榜单，写入物化集合供接口直接读取
+type Aggregator struct {
+	events   *mongo.Collection
+	movies   *mongo.Collection
+	trending *mongo.Collection
+	interval time.Duration
+	limit    int
+	logger   *zap.Logger
+}
+
+// NewAggregator 创建热门榜单聚合器
+func NewAggregator(events, movies, trending *mongo.Collection, interval time.Duration, limit int, logger *zap.Logger) *Aggregator {
+	return &Aggregator{
+		events:   events,
+		movies:   movies,
+		trending: trending,
+		interval: interval,
+		limit:    limit,
+		logger:   logger,
+	}
+}
+
+// Start 立即刷新一次榜单，之后按固定间隔刷新，直到ctx被取消
+func (a *Aggregator) Start(ctx context.Context) {
+	a.refreshAll(ctx)
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.refreshAll(ctx)
+		}
+	}
+}
+
+// refreshAll 刷新所有窗口的榜单，单个窗口失败不影响其他窗口
+func (a *Aggregator) refreshAll(ctx context.Context) {
+	for _, window := range Windows {
+		start := time.Now()
+		if err := a.Refresh(ctx, window); err != nil {
+			a.logger.Error("Failed to refresh trending movies",
+				zap.String("window", window.Name),
+				zap.Error(err),
+			)
+			continue
+		}
+		a.logger.Debug("Trending movies refreshed",
+			zap.String("window", window.Name),
+			zap.Duration("duration", time.Since(start)),
+		)
+	}
+}
+
+// Refresh 重新计算指定窗口的榜单。
+// 同一用户在窗口内对同一部电影的同类事件只计一次（取最近一次），反复打开详情页或修改评分不会刷高排名；
+// 每个事件的得分为 基础权重 × 2^(-事件年龄/半衰期)，按电影汇总后取前limit名。
+func (a *Aggregator) Refresh(ctx context.Context, window Window) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	now := time.Now()
+	decay := -math.Ln2 / float64(window.HalfLife.Milliseconds())
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"type":       bson.M{"$in": []string{models.MovieEventView, models.MovieEventRate}},
+			"created_at": bson.M{"$gte": now.Add(-window.Span)},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":        bson.M{"imdb_id": "$imdb_id", "user_id": "$user_id", "type": "$type"},
+			"value":      bson.M{"$last": "$value"},
+			"created_at": bson.M{"$last": "$created_at"},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"imdb_id": "$_id.imdb_id",
+			"weight": bson.M{"$cond": bson.A{
+				bson.M{"$eq": bson.A{"$_id.type", models.MovieEventRate}},
+				bson.M{"$multiply": bson.A{"$value", ratingWeightPerStar}},
+				viewWeight,
+			}},
+			"age": bson.M{"$subtract": bson.A{now, "$created_at"}},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": "$imdb_id",
+			"score": bson.M{"$sum": bson.M{"$multiply": bson.A{
+				"$weight",
+				bson.M{"$exp": bson.M{"$multiply": bson.A{"$age", decay}}},
+			}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "score", Value: -1}}}},
+		{{Key: "$limit", Value: a.limit}},
+	}
+
+	cursor, err := a.events.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+
+	var scores []struct {
+		ImdbID string  `bson:"_id"`
+		Score  float64 `bson:"score"`
+	}
+	if err := cursor.All(ctx, &scores); err != nil {
+		return err
+	}
+
+	movieIds := make([]string, 0, len(scores))
+	for _, score := range scores {
+		movieIds = append(movieIds, score.ImdbID)
+	}
+
+	moviesById := make(map[string]models.Movie, len(movieIds))
+	if len(movieIds) > 0 {
+		movieCursor, err := a.movies.Find(ctx, bson.M{"imdb_id": bson.M{"$in": movieIds}})
+		if err != nil {
+			return err
+		}
+
+		var movies []models.Movie
+		if err := movieCursor.All(ctx, &movies); err != nil {
+			return err
+		}
+		for _, movie := range movies {
+			moviesById[movie.ImdbID] = movie
+		}
+	}
+
+	entries := make([]any, 0, len(scores))
+	for _, score := range scores {
+		movie, ok := moviesById[score.ImdbID]
+		if !ok {
+			// 电影已被删除
+			continue
+		}
+		entries = append(entries, models.TrendingMovie{
+			Window:     window.Name,
+			Rank:       len(entries) + 1,
+			Score:      score.Score,
+			ImdbID:     score.ImdbID,
+			Movie:      movie,
+			ComputedAt: now,
+		})
+	}
+
+	// 先写入新榜单再删除旧榜单，保证读取方始终能拿到完整数据
+	if len(entries) > 0 {
+		if _, err := a.trending.InsertMany(ctx, entries); err != nil {
+			return err
+		}
+	}
+
+	_, err = a.trending.DeleteMany(ctx, bson.M{
+		"window":      window.Name,
+		"computed_at": bson.M{"$lt": now},
+	})
+	return err
+}
@@ -0,0 +1,113 @@
+package trending
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/joey17520/magic-stream-app/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+)
+
+func TestFindWindow(t *testing.T) {
+	for _, name := range []string{"24h", "7d", DefaultWindow} {
+		window, ok := FindWindow(name)
+		if !ok || window.Name != name {
+			t.Fatalf("FindWindow(%q) = %+v, %v", name, window, ok)
+		}
+	}
+
+	for _, name := range []string{"", "1h", "24H", "30d"} {
+		if _, ok := FindWindow(name); ok {
+			t.Fatalf("FindWindow(%q) found a window", name)
+		}
+	}
+}
+
+func TestWindowsDecayWithinSpan(t *testing.T) {
+	// 半衰期不短于窗口时，窗口开始处的事件与刚发生的事件几乎同等重要，榜单失去时效性
+	for _, window := range Windows {
+		if window.HalfLife <= 0 || window.HalfLife >= window.Span {
+			t.Errorf("window %s: half-life %s, want within (0, %s)", window.Name, window.HalfLife, window.Span)
+		}
+	}
+}
+
+// testDatabase 打开一个临时数据库，未设置MONGODB_TEST_URI时跳过测试
+func testDatabase(t *testing.T) *mongo.Database {
+	t.Helper()
+
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI is not set")
+	}
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect to MongoDB: %v", err)
+	}
+
+	db := client.Database("magicstream_test_" + bson.NewObjectID().Hex())
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = db.Drop(ctx)
+		_ = client.Disconnect(ctx)
+	})
+	return db
+}
+
+// TestRefreshCountsEachUserOnce 一个用户反复打开详情页、反复修改评分，不能超过两个用户各看一次
+func TestRefreshCountsEachUserOnce(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	if _, err := db.Collection("movies").InsertMany(ctx, []any{
+		models.Movie{ImdbID: "tt0000001", Title: "Spammed"},
+		models.Movie{ImdbID: "tt0000002", Title: "Popular"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []any
+	for i := range 50 {
+		events = append(events, models.MovieEvent{UserID: "spammer", ImdbID: "tt0000001", Type: models.MovieEventView, CreatedAt: now.Add(-time.Duration(i) * time.Second)})
+	}
+	for i, stars := range []float64{5, 5, 5, 1} {
+		// 最后一次评分为1星，只有它计入得分
+		events = append(events, models.MovieEvent{UserID: "spammer", ImdbID: "tt0000001", Type: models.MovieEventRate, Value: stars, CreatedAt: now.Add(-time.Duration(4-i) * time.Minute)})
+	}
+	for _, user := range []string{"alice", "bob", "carol"} {
+		events = append(events, models.MovieEvent{UserID: user, ImdbID: "tt0000002", Type: models.MovieEventView, CreatedAt: now})
+	}
+	if _, err := db.Collection("movie_events").InsertMany(ctx, events); err != nil {
+		t.Fatal(err)
+	}
+
+	aggregator := NewAggregator(db.Collection("movie_events"), db.Collection("movies"), db.Collection("trending"), time.Hour, 10, zap.NewNop())
+	window, _ := FindWindow("24h")
+	if err := aggregator.Refresh(ctx, window); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	cursor, err := db.Collection("trending").Find(ctx, bson.M{"window": "24h"}, options.Find().SetSort(bson.D{{Key: "rank", Value: 1}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ranked []models.TrendingMovie
+	if err := cursor.All(ctx, &ranked); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ranked) != 2 || ranked[0].ImdbID != "tt0000002" {
+		t.Fatalf("ranking = %+v, want the title three users viewed first", ranked)
+	}
+	// spammer：一次观看加一次1星评分，时间衰减使得分略低于1.6
+	if score := ranked[1].Score; score > viewWeight+ratingWeightPerStar || score < 1.5 {
+		t.Fatalf("spammed title score = %v, want about %v", score, viewWeight+ratingWeightPerStar)
+	}
+}
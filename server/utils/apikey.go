@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// APIKeyPrefix API密钥的固定前缀，便于在日志和代码仓库中识别泄露的密钥
+const APIKeyPrefix = "msk_"
+
+// apiKeyDisplayLength 展示给用户用于区分密钥的前缀长度
+const apiKeyDisplayLength = 12
+
+// apiKeyTouchInterval 更新密钥最近使用时间的最小间隔
+const apiKeyTouchInterval = time.Minute
+
+// 认证方式
+const (
+	AuthMethodSession = "session"
+	AuthMethodAPIKey  = "api_key"
+)
+
+// ErrAPIKeyInvalid API密钥不存在、已撤销或已过期
+var ErrAPIKeyInvalid = errors.New("API key is invalid, expired or revoked")
+
+// apiKeyCollection将在运行时通过SetAPIKeyCollection设置
+var apiKeyCollection *mongo.Collection
+
+// SetAPIKeyCollection 设置API密钥集合，用于打破导入循环
+func SetAPIKeyCollection(collection *mongo.Collection) {
+	apiKeyCollection = collection
+}
+
+// CreateAPIKey 为用户的某个档案创建API密钥，返回密钥记录和只展示一次的原始密钥
+func CreateAPIKey(userId, profileId, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	secret, _, err := GenerateOpaqueToken()
+	if err != nil {
+		return nil, "", err
+	}
+	raw := APIKeyPrefix + secret
+
+	key := &models.APIKey{
+		KeyID:     bson.NewObjectID().Hex(),
+		UserID:    userId,
+		ProfileID: profileId,
+		Name:      name,
+		Prefix:    raw[:apiKeyDisplayLength],
+		KeyHash:   HashOpaqueToken(raw),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+
+	if _, err := apiKeyCollection.InsertOne(ctx, key); err != nil {
+		return nil, "", err
+	}
+
+	return key, raw, nil
+}
+
+// CountAPIKeys 统计用户未撤销的API密钥数量
+func CountAPIKeys(userId string) (int64, error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return apiKeyCollection.CountDocuments(ctx, bson.M{"user_id": userId, "revoked_at": nil})
+}
+
+// ListAPIKeys 列出用户未撤销的API密钥（包括已过期的），按创建时间倒序
+func ListAPIKeys(userId string) ([]models.APIKey, error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := apiKeyCollection.Find(ctx, bson.M{"user_id": userId, "revoked_at": nil}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	keys := []models.APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey 撤销用户的某个API密钥，密钥不存在或不属于该用户时返回ErrAPIKeyInvalid
+func RevokeAPIKey(userId, keyId string) error {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := apiKeyCollection.UpdateOne(ctx,
+		bson.M{"key_id": keyId, "user_id": userId, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrAPIKeyInvalid
+	}
+
+	return nil
+}
+
+// RevokeAllAPIKeys 撤销用户的所有API密钥
+func RevokeAllAPIKeys(userId string) error {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := apiKeyCollection.UpdateMany(ctx,
+		bson.M{"user_id": userId, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	return err
+}
+
+// DeleteUserAPIKeys 删除用户的所有API密钥记录，用于账户注销后清除个人数据
+func DeleteUserAPIKeys(userId string) error {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := apiKeyCollection.DeleteMany(ctx, bson.M{"user_id": userId})
+	return err
+}
+
+// ValidateAPIKey 校验原始API密钥，并按间隔刷新最近使用时间和IP
+func ValidateAPIKey(raw, ip string) (*models.APIKey, error) {
+	if !strings.HasPrefix(raw, APIKeyPrefix) {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	var key models.APIKey
+	err := apiKeyCollection.FindOne(ctx, bson.M{
+		"key_hash":   HashOpaqueToken(raw),
+		"revoked_at": nil,
+		"$or": bson.A{
+			bson.M{"expires_at": nil},
+			bson.M{"expires_at": bson.M{"$gt": now}},
+		},
+	}).Decode(&key)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrAPIKeyInvalid
+		}
+		return nil, err
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval || key.LastUsedIP != ip {
+		_, err := apiKeyCollection.UpdateOne(ctx,
+			bson.M{"key_id": key.KeyID},
+			bson.M{"$set": bson.M{"last_used_at": now, "last_used_ip": ip}},
+		)
+		if err != nil {
+			Warn("Failed to update API key last used time", ErrorFields(err)...)
+		}
+	}
+
+	return &key, nil
+}
+
+// GetAuthMethodFromContext 获取当前请求的认证方式，未设置时视为会话认证
+func GetAuthMethodFromContext(c *gin.Context) string {
+	if method, ok := c.Get("authMethod"); ok {
+		if m, ok := method.(string); ok {
+			return m
+		}
+	}
+	return AuthMethodSession
+}
+
+// HasScope 判断当前请求是否具备某个权限范围，会话认证的请求具备所有权限范围
+func HasScope(c *gin.Context, scope string) bool {
+	if GetAuthMethodFromContext(c) != AuthMethodAPIKey {
+		return true
+	}
+
+	scopes, _ := c.Get("scopes")
+	granted, ok := scopes.([]string)
+	if !ok {
+		return false
+	}
+
+	return slices.Contains(granted, scope)
+}
@@ -0,0 +1,199 @@
+package utils
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/models"
+)
+
+// useTestAPIKeys 让API密钥函数在测试期间使用临时集合
+func useTestAPIKeys(t *testing.T) {
+	t.Helper()
+	collection := testCollection(t, "api_keys")
+
+	previous := apiKeyCollection
+	apiKeyCollection = collection
+	t.Cleanup(func() { apiKeyCollection = previous })
+}
+
+func TestValidateAPIKeyRequiresPrefix(t *testing.T) {
+	// 没有固定前缀的值不会被当作API密钥查询数据库
+	for _, raw := range []string{"", "abc", "MSK_abc", "msk", " msk_abc", "Bearer msk_abc"} {
+		if _, err := ValidateAPIKey(raw, "10.0.0.1"); !errors.Is(err, ErrAPIKeyInvalid) {
+			t.Errorf("ValidateAPIKey(%q) = %v, want ErrAPIKeyInvalid", raw, err)
+		}
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	newContext := func(values map[string]any) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		for key, value := range values {
+			c.Set(key, value)
+		}
+		return c
+	}
+
+	session := newContext(map[string]any{"authMethod": AuthMethodSession})
+	unset := newContext(nil)
+	readOnly := newContext(map[string]any{
+		"authMethod": AuthMethodAPIKey,
+		"scopes":     []string{models.ScopeMoviesRead, models.ScopeProfileRead},
+	})
+	noScopes := newContext(map[string]any{"authMethod": AuthMethodAPIKey})
+
+	for _, scope := range []string{models.ScopeMoviesRead, models.ScopeMoviesWrite, models.ScopeAdmin} {
+		if !HasScope(session, scope) || !HasScope(unset, scope) {
+			t.Errorf("session without API key lacks scope %s", scope)
+		}
+		if HasScope(noScopes, scope) {
+			t.Errorf("API key without scopes has scope %s", scope)
+		}
+	}
+
+	if !HasScope(readOnly, models.ScopeMoviesRead) || !HasScope(readOnly, models.ScopeProfileRead) {
+		t.Error("API key lacks a granted scope")
+	}
+	if HasScope(readOnly, models.ScopeMoviesWrite) || HasScope(readOnly, models.ScopeAdmin) {
+		t.Error("API key has a scope it was not granted")
+	}
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	useTestAPIKeys(t)
+
+	key, raw, err := CreateAPIKey("user-1", "", "script", []string{models.ScopeMoviesRead}, nil)
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if !strings.HasPrefix(raw, APIKeyPrefix) || !strings.HasPrefix(raw, key.Prefix) || key.KeyHash == raw {
+		t.Fatalf("key = %+v, raw = %q", key, raw)
+	}
+
+	validated, err := ValidateAPIKey(raw, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("ValidateAPIKey: %v", err)
+	}
+	if validated.KeyID != key.KeyID || validated.UserID != "user-1" {
+		t.Fatalf("validated = %+v, want key %s of user-1", validated, key.KeyID)
+	}
+
+	// 前缀正确但密钥不存在
+	if _, err := ValidateAPIKey(raw+"x", "10.0.0.1"); !errors.Is(err, ErrAPIKeyInvalid) {
+		t.Fatalf("ValidateAPIKey with an unknown key = %v, want ErrAPIKeyInvalid", err)
+	}
+
+	keys, err := ListAPIKeys("user-1")
+	if err != nil {
+		t.Fatalf("ListAPIKeys: %v", err)
+	}
+	if len(keys) != 1 || keys[0].LastUsedIP != "10.0.0.1" || keys[0].LastUsedAt == nil {
+		t.Fatalf("keys = %+v, want one key last used from 10.0.0.1", keys)
+	}
+
+	if err := RevokeAPIKey("user-2", key.KeyID); !errors.Is(err, ErrAPIKeyInvalid) {
+		t.Fatalf("RevokeAPIKey by another user = %v, want ErrAPIKeyInvalid", err)
+	}
+	if err := RevokeAPIKey("user-1", key.KeyID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	if _, err := ValidateAPIKey(raw, "10.0.0.1"); !errors.Is(err, ErrAPIKeyInvalid) {
+		t.Fatalf("ValidateAPIKey after revocation = %v, want ErrAPIKeyInvalid", err)
+	}
+	if count, err := CountAPIKeys("user-1"); err != nil || count != 0 {
+		t.Fatalf("CountAPIKeys = %d, %v, want 0", count, err)
+	}
+}
+
+func TestAPIKeyExpiry(t *testing.T) {
+	useTestAPIKeys(t)
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	_, expired, err := CreateAPIKey("user-1", "", "expired", []string{models.ScopeMoviesRead}, &past)
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	_, valid, err := CreateAPIKey("user-1", "", "valid", []string{models.ScopeMoviesRead}, &future)
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+
+	if _, err := ValidateAPIKey(expired, "10.0.0.1"); !errors.Is(err, ErrAPIKeyInvalid) {
+		t.Fatalf("ValidateAPIKey with an expired key = %v, want ErrAPIKeyInvalid", err)
+	}
+	if _, err := ValidateAPIKey(valid, "10.0.0.1"); err != nil {
+		t.Fatalf("ValidateAPIKey with an unexpired key: %v", err)
+	}
+
+	// 已过期的密钥仍然列出，便于用户查看和撤销
+	if keys, err := ListAPIKeys("user-1"); err != nil || len(keys) != 2 {
+		t.Fatalf("ListAPIKeys = %d keys, %v, want 2", len(keys), err)
+	}
+}
+
+func TestRevokeAndDeleteUserAPIKeys(t *testing.T) {
+	useTestAPIKeys(t)
+
+	_, first, err := CreateAPIKey("user-1", "", "first", []string{models.ScopeMoviesRead}, nil)
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	_, second, err := CreateAPIKey("user-1", "", "second", []string{models.ScopeMoviesRead}, nil)
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	_, other, err := CreateAPIKey("user-2", "", "other", []string{models.ScopeMoviesRead}, nil)
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+
+	if err := RevokeAllAPIKeys("user-1"); err != nil {
+		t.Fatalf("RevokeAllAPIKeys: %v", err)
+	}
+	for _, raw := range []string{first, second} {
+		if _, err := ValidateAPIKey(raw, "10.0.0.1"); !errors.Is(err, ErrAPIKeyInvalid) {
+			t.Errorf("ValidateAPIKey after RevokeAllAPIKeys = %v, want ErrAPIKeyInvalid", err)
+		}
+	}
+	if _, err := ValidateAPIKey(other, "10.0.0.1"); err != nil {
+		t.Fatalf("another user's key was revoked: %v", err)
+	}
+
+	// 撤销的密钥仍然保留记录，注销账户时才删除
+	if keys, _ := ListAPIKeys("user-1"); len(keys) != 2 {
+		t.Fatalf("ListAPIKeys after revoking = %d keys, want 2", len(keys))
+	}
+	if err := DeleteUserAPIKeys("user-1"); err != nil {
+		t.Fatalf("DeleteUserAPIKeys: %v", err)
+	}
+	if keys, _ := ListAPIKeys("user-1"); len(keys) != 0 {
+		t.Fatalf("ListAPIKeys after deleting = %+v, want none", keys)
+	}
+	if keys, _ := ListAPIKeys("user-2"); len(keys) != 1 {
+		t.Fatalf("another user's keys were deleted: %+v", keys)
+	}
+}
+
+func TestAPIKeyKeepsProfile(t *testing.T) {
+	useTestAPIKeys(t)
+
+	// 使用密钥时按创建时所选的档案应用家长控制
+	_, raw, err := CreateAPIKey("user-1", "profile-kids", "tv", []string{models.ScopeMoviesRead}, nil)
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	key, err := ValidateAPIKey(raw, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("ValidateAPIKey: %v", err)
+	}
+	if key.ProfileID != "profile-kids" {
+		t.Fatalf("ProfileID = %q, want profile-kids", key.ProfileID)
+	}
+}
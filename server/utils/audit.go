@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"context"
+	"time"
+
+	"github.com/joey17520/magic-stream-app/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+)
+
+// auditLogCollection将在运行时通过SetAuditLogCollection设置
+var auditLogCollection *mongo.Collection
+
+// SetAuditLogCollection 设置审计日志集合，用于打破导入循环
+func SetAuditLogCollection(collection *mongo.Collection) {
+	auditLogCollection = collection
+}
+
+// RecordAudit 写入一条审计日志，写入失败只记录错误日志，不影响调用方的业务流程
+func RecordAudit(entry models.AuditLog) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	if _, err := auditLogCollection.InsertOne(ctx, entry); err != nil {
+		Error("Failed to write audit log", append(ErrorFields(err), zap.String("action", entry.Action))...)
+	}
+}
+
+// AnonymizeAuditLogs 清除用户审计日志中的邮箱、IP和User-Agent，保留动作和时间用于安全审计
+func AnonymizeAuditLogs(userId, email string) error {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := auditLogCollection.UpdateMany(ctx,
+		bson.M{"$or": bson.A{bson.M{"user_id": userId}, bson.M{"email": email}}},
+		bson.M{
+			"$set":   bson.M{"ip": "", "user_agent": ""},
+			"$unset": bson.M{"email": ""},
+		},
+	)
+	return err
+}
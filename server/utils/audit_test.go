@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/joey17520/magic-stream-app/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestAnonymizeAuditLogs(t *testing.T) {
+	collection := testCollection(t, "audit_logs")
+	previous := auditLogCollection
+	auditLogCollection = collection
+	t.Cleanup(func() { auditLogCollection = previous })
+
+	// 登录锁定只记录了邮箱，没有用户ID
+	RecordAudit(models.AuditLog{Action: models.AuditActionIdentityLinked, UserID: "user-1", Email: "ann@example.com", IP: "10.0.0.1", UserAgent: "Firefox"})
+	RecordAudit(models.AuditLog{Action: models.AuditActionLoginLockout, Email: "ann@example.com", IP: "10.0.0.2", UserAgent: "curl"})
+	RecordAudit(models.AuditLog{Action: models.AuditActionIdentityLinked, UserID: "user-2", Email: "bob@example.com", IP: "10.0.0.3", UserAgent: "Safari"})
+
+	if err := AnonymizeAuditLogs("user-1", "ann@example.com"); err != nil {
+		t.Fatalf("AnonymizeAuditLogs: %v", err)
+	}
+
+	cursor, err := collection.Find(context.Background(), bson.M{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs []models.AuditLog
+	if err := cursor.All(context.Background(), &logs); err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 3 {
+		t.Fatalf("got %d audit logs, want 3 (anonymizing must not delete entries)", len(logs))
+	}
+
+	for _, entry := range logs {
+		if entry.UserID == "user-2" {
+			if entry.Email != "bob@example.com" || entry.IP == "" {
+				t.Errorf("another user's entry was anonymized: %+v", entry)
+			}
+			continue
+		}
+		if entry.Email != "" || entry.IP != "" || entry.UserAgent != "" {
+			t.Errorf("entry %+v still holds personal data", entry)
+		}
+		if entry.Action == "" || entry.CreatedAt.IsZero() {
+			t.Errorf("entry %+v lost its action or time", entry)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/models"
+)
+
+// NormalizeRegion 把地区代码转换为大写的两位字母，格式不正确时返回空字符串（视为未知地区）
+func NormalizeRegion(region string) string {
+	region = strings.ToUpper(strings.TrimSpace(region))
+	if len(region) != 2 || region[0] < 'A' || region[0] > 'Z' || region[1] < 'A' || region[1] > 'Z' {
+		return ""
+	}
+	return region
+}
+
+// NormalizeAvailability 统一授权规则中的地区代码为大写，便于校验和查询
+func NormalizeAvailability(windows []models.AvailabilityWindow) {
+	for i := range windows {
+		for j, country := range windows[i].Countries {
+			windows[i].Countries[j] = strings.ToUpper(strings.TrimSpace(country))
+		}
+	}
+}
+
+// MovieAvailable 判断电影在指定地区和时间是否可以观看：没有规则时总是可以观看，否则满足任意一条规则即可。
+// 地区未知时只有不限地区的规则生效
+func MovieAvailable(windows []models.AvailabilityWindow, region string, at time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	for _, window := range windows {
+		if len(window.Countries) > 0 && (region == "" || !slices.Contains(window.Countries, region)) {
+			continue
+		}
+		if window.StartsAt != nil && window.StartsAt.After(at) {
+			continue
+		}
+		if window.EndsAt != nil && !window.EndsAt.After(at) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// GetCountryFromContext 获取已登录用户资料中填写的地区，未登录或未填写时为空
+func GetCountryFromContext(c *gin.Context) string {
+	return c.GetString("country")
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joey17520/magic-stream-app/models"
+)
+
+func TestNormalizeRegion(t *testing.T) {
+	for input, want := range map[string]string{
+		"us":    "US",
+		" de ":  "DE",
+		"GB":    "GB",
+		"":      "",
+		"USA":   "",
+		"u1":    "",
+		"XX-YY": "",
+		"é":     "",
+	} {
+		if got := NormalizeRegion(input); got != want {
+			t.Errorf("NormalizeRegion(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestNormalizeAvailability(t *testing.T) {
+	windows := []models.AvailabilityWindow{
+		{Countries: []string{"us", " ca"}},
+		{},
+	}
+	NormalizeAvailability(windows)
+
+	if windows[0].Countries[0] != "US" || windows[0].Countries[1] != "CA" {
+		t.Fatalf("countries = %v, want [US CA]", windows[0].Countries)
+	}
+	if windows[1].Countries != nil {
+		t.Fatalf("empty window gained countries: %v", windows[1].Countries)
+	}
+}
+
+func TestMovieAvailable(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	before := now.Add(-24 * time.Hour)
+	after := now.Add(24 * time.Hour)
+
+	usOnly := models.AvailabilityWindow{Countries: []string{"US"}}
+	global := models.AvailabilityWindow{}
+	upcoming := models.AvailabilityWindow{StartsAt: &after}
+	expired := models.AvailabilityWindow{EndsAt: &before}
+	endsNow := models.AvailabilityWindow{EndsAt: &now}
+	current := models.AvailabilityWindow{Countries: []string{"DE"}, StartsAt: &before, EndsAt: &after}
+
+	tests := []struct {
+		name    string
+		windows []models.AvailabilityWindow
+		region  string
+		want    bool
+	}{
+		{"no rules", nil, "", true},
+		{"listed region", []models.AvailabilityWindow{usOnly}, "US", true},
+		{"other region", []models.AvailabilityWindow{usOnly}, "FR", false},
+		{"unknown region with regional rule", []models.AvailabilityWindow{usOnly}, "", false},
+		{"unknown region with global rule", []models.AvailabilityWindow{usOnly, global}, "", true},
+		{"not started", []models.AvailabilityWindow{upcoming}, "US", false},
+		{"expired", []models.AvailabilityWindow{expired}, "US", false},
+		{"end is exclusive", []models.AvailabilityWindow{endsNow}, "US", false},
+		{"inside window", []models.AvailabilityWindow{current}, "DE", true},
+		{"any rule matches", []models.AvailabilityWindow{expired, current}, "DE", true},
+	}
+
+	for _, tt := range tests {
+		if got := MovieAvailable(tt.windows, tt.region, now); got != tt.want {
+			t.Errorf("%s: MovieAvailable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// NormalizeEmail 去掉首尾空白并统一为小写，保存和比较邮箱前使用
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// EmailFilter 按邮箱查找用户的查询条件，忽略大小写，以兼容统一小写之前保存的账户
+func EmailFilter(email string) bson.M {
+	return bson.M{"email": bson.M{
+		"$regex":   "^" + regexp.QuoteMeta(NormalizeEmail(email)) + "$",
+		"$options": "i",
+	}}
+}
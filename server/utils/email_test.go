@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	for in, want := range map[string]string{
+		"alice@example.com":       "alice@example.com",
+		"  Alice@Example.COM\n":   "alice@example.com",
+		"BOB+Movies@example.org ": "bob+movies@example.org",
+		"":                        "",
+	} {
+		if got := NormalizeEmail(in); got != want {
+			t.Errorf("NormalizeEmail(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// TestEmailFilter 查询忽略大小写，但仍是整串匹配，邮箱中的正则元字符按字面处理
+func TestEmailFilter(t *testing.T) {
+	users := testCollection(t, "users")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := users.InsertMany(ctx, []any{
+		bson.M{"user_id": "legacy", "email": "Alice.Smith@Example.com"},
+		bson.M{"user_id": "other", "email": "aliceXsmith@example.com"},
+		bson.M{"user_id": "longer", "email": "alice.smith@example.com.evil"},
+	}); err != nil {
+		t.Fatalf("insert users: %v", err)
+	}
+
+	cursor, err := users.Find(ctx, EmailFilter(" alice.smith@EXAMPLE.com"))
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	var found []struct {
+		UserID string `bson:"user_id"`
+	}
+	if err := cursor.All(ctx, &found); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(found) != 1 || found[0].UserID != "legacy" {
+		t.Fatalf("EmailFilter matched %+v, want only the legacy account", found)
+	}
+}
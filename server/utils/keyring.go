@@ -0,0 +1,489 @@
+package utils
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+)
+
+// 支持的JWT签名算法
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// 签名密钥状态
+const (
+	keyStatusActive   = "active"
+	keyStatusRetiring = "retiring"
+)
+
+// keyringMaintenanceInterval 后台检查密钥轮换和重新加载密钥的间隔
+const keyringMaintenanceInterval = 5 * time.Minute
+
+// keyringReloadCooldown 遇到未知kid时重新加载密钥的最小间隔，防止伪造kid造成数据库压力
+const keyringReloadCooldown = 10 * time.Second
+
+// signingKeyDocument 签名密钥在数据库中的存储格式。
+// 私钥以PKCS#8 PEM保存，需保护好数据库的访问权限。
+type signingKeyDocument struct {
+	Kid        string     `bson:"kid"`
+	Algorithm  string     `bson:"alg"`
+	PrivateKey string     `bson:"private_key"`
+	Status     string     `bson:"status"`
+	CreatedAt  time.Time  `bson:"created_at"`
+	RetireAt   *time.Time `bson:"retire_at,omitempty"`
+}
+
+// signingKey 已加载的签名密钥
+type signingKey struct {
+	kid       string
+	algorithm string
+	private   crypto.Signer
+	public    crypto.PublicKey
+	createdAt time.Time
+	retireAt  *time.Time
+}
+
+// JWK JSON Web Key，只包含公钥信息
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeyringOptions 密钥环配置
+type KeyringOptions struct {
+	// Algorithm 签名算法，HS256表示继续使用SECRET_KEY对称签名，不做轮换
+	Algorithm string
+	// RotationInterval 签名密钥的最长使用时间，到期后生成新密钥
+	RotationInterval time.Duration
+	// GracePeriod 旧密钥被替换后仍可用于验证的时间，应不短于refresh token有效期
+	GracePeriod time.Duration
+	// LegacyAccessSecret、LegacyRefreshSecret 对称密钥，用于HS256签名以及验证没有kid的旧令牌
+	LegacyAccessSecret  string
+	LegacyRefreshSecret string
+	// LegacyTokensUntil 使用非对称算法时，没有kid的旧令牌在此时间之前仍可验证，零值表示不再接受；
+	// HS256模式签发的令牌本身没有kid，不受此限制
+	LegacyTokensUntil time.Time
+}
+
+// Keyring 管理JWT签名密钥：多把密钥同时可用于验证，最新的活跃密钥用于签名
+type Keyring struct {
+	mu         sync.RWMutex
+	collection *mongo.Collection
+	opts       KeyringOptions
+	keys       map[string]*signingKey
+	current    *signingKey
+	lastReload time.Time
+}
+
+// keyring将在运行时通过InitKeyring设置
+var keyring *Keyring
+
+// InitKeyring 初始化密钥环：从数据库加载密钥，没有可用密钥时生成第一把
+func InitKeyring(collection *mongo.Collection, opts KeyringOptions) error {
+	switch opts.Algorithm {
+	case AlgorithmHS256, AlgorithmRS256, AlgorithmEdDSA:
+	default:
+		return fmt.Errorf("unsupported jwt signing algorithm %q", opts.Algorithm)
+	}
+
+	k := &Keyring{
+		collection: collection,
+		opts:       opts,
+		keys:       make(map[string]*signingKey),
+	}
+
+	if opts.Algorithm != AlgorithmHS256 {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := k.reload(ctx); err != nil {
+			return err
+		}
+		if err := k.rotateIfDue(ctx); err != nil {
+			return err
+		}
+	}
+
+	keyring = k
+	return nil
+}
+
+// StartKeyRotation 定期轮换到期的签名密钥、清理过了宽限期的旧密钥，并重新加载其他实例生成的密钥
+func StartKeyRotation(ctx context.Context) {
+	if keyring == nil || keyring.opts.Algorithm == AlgorithmHS256 {
+		return
+	}
+
+	ticker := time.NewTicker(keyringMaintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := keyring.maintain(ctx); err != nil {
+				Error("Failed to maintain jwt signing keys", ErrorFields(err)...)
+			}
+		}
+	}
+}
+
+// GetJWKS 返回所有可用于验证的公钥，供其他服务验证本服务签发的令牌
+func GetJWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	if keyring == nil {
+		return jwks
+	}
+
+	keyring.mu.RLock()
+	defer keyring.mu.RUnlock()
+
+	for _, key := range keyring.sortedKeys() {
+		jwk := JWK{Kid: key.kid, Use: "sig", Alg: key.algorithm}
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks
+}
+
+// signToken 使用当前签名密钥签名，HS256模式下使用令牌类型对应的对称密钥
+func signToken(claims jwt.Claims, tokenType string) (string, error) {
+	if keyring == nil {
+		return "", errors.New("jwt keyring is not initialized")
+	}
+
+	if keyring.opts.Algorithm == AlgorithmHS256 {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(keyring.legacySecret(tokenType)))
+	}
+
+	keyring.mu.RLock()
+	key := keyring.current
+	keyring.mu.RUnlock()
+
+	if key == nil {
+		return "", errors.New("no active jwt signing key")
+	}
+
+	token := jwt.NewWithClaims(signingMethod(key.algorithm), claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
+}
+
+// errLegacyTokenExpired 已切换到非对称算法且超过了LegacyTokensUntil，不再接受没有kid的旧令牌
+var errLegacyTokenExpired = errors.New("tokens without kid are no longer accepted")
+
+// verificationKey 返回jwt.Keyfunc：有kid的令牌使用密钥环中的公钥，没有kid的旧令牌使用令牌类型对应的对称密钥
+func verificationKey(tokenType string) jwt.Keyfunc {
+	return func(t *jwt.Token) (any, error) {
+		if keyring == nil {
+			return nil, errors.New("jwt keyring is not initialized")
+		}
+
+		kid, _ := t.Header["kid"].(string)
+		if kid == "" {
+			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, errors.New("unexpected signing method for token without kid")
+			}
+			if !keyring.acceptsLegacyTokens(time.Now()) {
+				return nil, errLegacyTokenExpired
+			}
+			return []byte(keyring.legacySecret(tokenType)), nil
+		}
+
+		key := keyring.lookup(kid)
+		if key == nil {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+
+		// 签名算法必须与密钥登记的算法一致，防止算法混淆攻击
+		if t.Method.Alg() != key.algorithm {
+			return nil, fmt.Errorf("signing method %s does not match key %q", t.Method.Alg(), kid)
+		}
+
+		return key.public, nil
+	}
+}
+
+// acceptsLegacyTokens 在now是否接受没有kid的令牌：HS256模式始终接受，切换到非对称算法后只在LegacyTokensUntil之前接受
+func (k *Keyring) acceptsLegacyTokens(now time.Time) bool {
+	return k.opts.Algorithm == AlgorithmHS256 || now.Before(k.opts.LegacyTokensUntil)
+}
+
+// legacySecret 令牌类型对应的对称密钥
+func (k *Keyring) legacySecret(tokenType string) string {
+	if tokenType == TokenTypeRefresh {
+		return k.opts.LegacyRefreshSecret
+	}
+	return k.opts.LegacyAccessSecret
+}
+
+// lookup 按kid查找可用于验证的密钥，找不到时从数据库重新加载一次
+func (k *Keyring) lookup(kid string) *signingKey {
+	k.mu.RLock()
+	key, ok := k.keys[kid]
+	canReload := time.Since(k.lastReload) > keyringReloadCooldown
+	k.mu.RUnlock()
+
+	if !ok && canReload && k.opts.Algorithm != AlgorithmHS256 {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := k.reload(ctx); err != nil {
+			Warn("Failed to reload jwt signing keys", ErrorFields(err)...)
+			return nil
+		}
+
+		k.mu.RLock()
+		key, ok = k.keys[kid]
+		k.mu.RUnlock()
+	}
+
+	if !ok || (key.retireAt != nil && time.Now().After(*key.retireAt)) {
+		return nil
+	}
+	return key
+}
+
+// maintain 清理过期密钥、重新加载并在需要时轮换
+func (k *Keyring) maintain(ctx context.Context) error {
+	_, err := k.collection.DeleteMany(ctx, bson.M{
+		"status":    keyStatusRetiring,
+		"retire_at": bson.M{"$lte": time.Now()},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := k.reload(ctx); err != nil {
+		return err
+	}
+
+	return k.rotateIfDue(ctx)
+}
+
+// rotateIfDue 当前签名密钥不存在、算法不一致或超过轮换间隔时生成新密钥
+func (k *Keyring) rotateIfDue(ctx context.Context) error {
+	k.mu.RLock()
+	current := k.current
+	k.mu.RUnlock()
+
+	if current != nil && current.algorithm == k.opts.Algorithm && time.Since(current.createdAt) < k.opts.RotationInterval {
+		return nil
+	}
+
+	return k.Rotate(ctx)
+}
+
+// Rotate 生成新的签名密钥，之前的活跃密钥转为只验证状态，在宽限期结束后失效
+func (k *Keyring) Rotate(ctx context.Context) error {
+	doc, err := generateSigningKey(k.opts.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := k.collection.InsertOne(ctx, doc); err != nil {
+		return err
+	}
+
+	retireAt := doc.CreatedAt.Add(k.opts.GracePeriod)
+	_, err = k.collection.UpdateMany(ctx,
+		bson.M{"status": keyStatusActive, "kid": bson.M{"$ne": doc.Kid}},
+		bson.M{"$set": bson.M{"status": keyStatusRetiring, "retire_at": retireAt}},
+	)
+	if err != nil {
+		return err
+	}
+
+	GetLogger().Info("JWT signing key rotated",
+		zap.String("kid", doc.Kid),
+		zap.String("alg", doc.Algorithm),
+		zap.Time("previous_keys_retire_at", retireAt),
+	)
+
+	return k.reload(ctx)
+}
+
+// reload 从数据库加载所有未过期的密钥，最新的活跃密钥作为签名密钥
+func (k *Keyring) reload(ctx context.Context) error {
+	cursor, err := k.collection.Find(ctx, bson.M{
+		"$or": bson.A{
+			bson.M{"status": keyStatusActive},
+			bson.M{"status": keyStatusRetiring, "retire_at": bson.M{"$gt": time.Now()}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	var docs []signingKeyDocument
+	if err := cursor.All(ctx, &docs); err != nil {
+		return err
+	}
+
+	k.load(docs)
+	return nil
+}
+
+// load 用数据库中的密钥替换已加载的密钥，最新的活跃密钥作为签名密钥
+func (k *Keyring) load(docs []signingKeyDocument) {
+	keys := make(map[string]*signingKey, len(docs))
+	var current *signingKey
+	for _, doc := range docs {
+		key, err := parseSigningKey(doc)
+		if err != nil {
+			Warn("Skipping invalid jwt signing key", zap.String("kid", doc.Kid), zap.Error(err))
+			continue
+		}
+		keys[key.kid] = key
+
+		if doc.Status == keyStatusActive && (current == nil || key.createdAt.After(current.createdAt)) {
+			current = key
+		}
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.current = current
+	k.lastReload = time.Now()
+	k.mu.Unlock()
+}
+
+// sortedKeys 按创建时间倒序返回密钥，调用方需持有读锁
+func (k *Keyring) sortedKeys() []*signingKey {
+	keys := make([]*signingKey, 0, len(k.keys))
+	for _, key := range k.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].createdAt.After(keys[j].createdAt)
+	})
+	return keys
+}
+
+// generateSigningKey 生成指定算法的新密钥
+func generateSigningKey(algorithm string) (*signingKeyDocument, error) {
+	var private crypto.Signer
+	var err error
+
+	switch algorithm {
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("cannot generate key for algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	return &signingKeyDocument{
+		Kid:        NewTokenId(),
+		Algorithm:  algorithm,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		Status:     keyStatusActive,
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+// parseSigningKey 解析数据库中的密钥
+func parseSigningKey(doc signingKeyDocument) (*signingKey, error) {
+	block, _ := pem.Decode([]byte(doc.PrivateKey))
+	if block == nil {
+		return nil, errors.New("invalid PEM private key")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{
+		kid:       doc.Kid,
+		algorithm: doc.Algorithm,
+		createdAt: doc.CreatedAt,
+		retireAt:  doc.RetireAt,
+	}
+	if doc.Status == keyStatusActive {
+		key.retireAt = nil
+	}
+
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		if doc.Algorithm != AlgorithmRS256 {
+			return nil, fmt.Errorf("rsa key registered with algorithm %q", doc.Algorithm)
+		}
+		key.private = private
+		key.public = &private.PublicKey
+	case ed25519.PrivateKey:
+		if doc.Algorithm != AlgorithmEdDSA {
+			return nil, fmt.Errorf("ed25519 key registered with algorithm %q", doc.Algorithm)
+		}
+		key.private = private
+		key.public = private.Public()
+	default:
+		return nil, errors.New("unsupported private key type")
+	}
+
+	return key, nil
+}
+
+// signingMethod 算法名称对应的jwt签名方法
+func signingMethod(algorithm string) jwt.SigningMethod {
+	switch algorithm {
+	case AlgorithmRS256:
+		return jwt.SigningMethodRS256
+	case AlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA
+	default:
+		return jwt.SigningMethodHS256
+	}
+}
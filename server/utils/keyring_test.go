@@ -0,0 +1,281 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// useKeyring 在测试期间替换全局密钥环，不连接数据库
+func useKeyring(t *testing.T, opts KeyringOptions) *Keyring {
+	t.Helper()
+	previous := keyring
+	t.Cleanup(func() { keyring = previous })
+
+	keyring = &Keyring{opts: opts, keys: map[string]*signingKey{}, lastReload: time.Now()}
+	return keyring
+}
+
+// newKeyDocument 生成密钥文档，createdAt用于区分新旧密钥
+func newKeyDocument(t *testing.T, algorithm string, createdAt time.Time) signingKeyDocument {
+	t.Helper()
+	doc, err := generateSigningKey(algorithm)
+	if err != nil {
+		t.Fatalf("generateSigningKey(%s): %v", algorithm, err)
+	}
+	doc.CreatedAt = createdAt
+	return *doc
+}
+
+// retire 与Rotate相同：活跃密钥转为只验证状态
+func retire(doc signingKeyDocument, retireAt time.Time) signingKeyDocument {
+	doc.Status = keyStatusRetiring
+	doc.RetireAt = &retireAt
+	return doc
+}
+
+// signTestToken 签发一个10分钟后过期的令牌
+func signTestToken(t *testing.T, tokenType string) string {
+	t.Helper()
+	claims := &SignedDetails{
+		UserId:    "user-1",
+		TokenType: tokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(10 * time.Minute)),
+		},
+	}
+	token, err := signToken(claims, tokenType)
+	if err != nil {
+		t.Fatalf("signToken: %v", err)
+	}
+	return token
+}
+
+// tokenKid 读取令牌头中的kid
+func tokenKid(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &SignedDetails{})
+	if err != nil {
+		t.Fatalf("ParseUnverified: %v", err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestKeyringSignAndVerify(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmRS256, AlgorithmEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			k := useKeyring(t, KeyringOptions{Algorithm: algorithm})
+			doc := newKeyDocument(t, algorithm, time.Now())
+			k.load([]signingKeyDocument{doc})
+
+			token := signTestToken(t, TokenTypeAccess)
+			if kid := tokenKid(t, token); kid != doc.Kid {
+				t.Fatalf("kid = %q, want %q", kid, doc.Kid)
+			}
+
+			claims, err := parseToken(token, TokenTypeAccess)
+			if err != nil {
+				t.Fatalf("parseToken: %v", err)
+			}
+			if claims.UserId != "user-1" {
+				t.Fatalf("UserId = %q, want user-1", claims.UserId)
+			}
+
+			// 令牌类型不能混用
+			if _, err := parseToken(token, TokenTypeRefresh); err == nil {
+				t.Fatal("access token accepted as refresh token")
+			}
+
+			jwks := GetJWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != doc.Kid || jwks.Keys[0].Alg != algorithm {
+				t.Fatalf("jwks = %+v, want the single %s key", jwks, algorithm)
+			}
+		})
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	k := useKeyring(t, KeyringOptions{Algorithm: AlgorithmRS256})
+	now := time.Now()
+	old := newKeyDocument(t, AlgorithmRS256, now.Add(-time.Hour))
+	k.load([]signingKeyDocument{old})
+	oldToken := signTestToken(t, TokenTypeAccess)
+
+	// 轮换：新密钥成为签名密钥，旧密钥在宽限期内仍可验证
+	next := newKeyDocument(t, AlgorithmRS256, now)
+	retiring := retire(old, now.Add(time.Hour))
+	k.load([]signingKeyDocument{retiring, next})
+
+	newToken := signTestToken(t, TokenTypeAccess)
+	if kid := tokenKid(t, newToken); kid != next.Kid {
+		t.Fatalf("new token kid = %q, want the rotated key %q", kid, next.Kid)
+	}
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		if _, err := parseToken(token, TokenTypeAccess); err != nil {
+			t.Fatalf("%s token rejected during the grace period: %v", name, err)
+		}
+	}
+
+	jwks := GetJWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kid != next.Kid || jwks.Keys[1].Kid != old.Kid {
+		t.Fatalf("jwks = %+v, want the new key followed by the retiring key", jwks)
+	}
+
+	// 宽限期结束后，即使密钥尚未被清理，旧令牌也不能再通过验证
+	k.load([]signingKeyDocument{retire(old, now.Add(-time.Second)), next})
+	if _, err := parseToken(oldToken, TokenTypeAccess); err == nil {
+		t.Fatal("token signed by a retired key was accepted")
+	}
+	if _, err := parseToken(newToken, TokenTypeAccess); err != nil {
+		t.Fatalf("token signed by the current key rejected: %v", err)
+	}
+
+	// 清理后旧密钥不再出现在JWKS中
+	k.load([]signingKeyDocument{next})
+	if _, err := parseToken(oldToken, TokenTypeAccess); err == nil {
+		t.Fatal("token signed by a removed key was accepted")
+	}
+	if jwks := GetJWKS(); len(jwks.Keys) != 1 || jwks.Keys[0].Kid != next.Kid {
+		t.Fatalf("jwks = %+v, want only the current key", jwks)
+	}
+}
+
+func TestKeyringRejectsForeignTokens(t *testing.T) {
+	k := useKeyring(t, KeyringOptions{
+		Algorithm:           AlgorithmRS256,
+		LegacyAccessSecret:  "access-secret",
+		LegacyRefreshSecret: "refresh-secret",
+	})
+	doc := newKeyDocument(t, AlgorithmRS256, time.Now())
+	k.load([]signingKeyDocument{doc})
+
+	expiresAt := jwt.NewNumericDate(time.Now().Add(10 * time.Minute))
+	claims := &SignedDetails{TokenType: TokenTypeAccess, RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: expiresAt}}
+
+	// 其他实例签发、本地从未加载过的密钥
+	other := newKeyDocument(t, AlgorithmRS256, time.Now())
+	otherKey, err := parseSigningKey(other)
+	if err != nil {
+		t.Fatalf("parseSigningKey: %v", err)
+	}
+	unknown := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	unknown.Header["kid"] = other.Kid
+	unknownToken, _ := unknown.SignedString(otherKey.private)
+
+	// kid指向RSA密钥、却用HS256签名的伪造令牌
+	key := k.lookup(doc.Kid)
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	confused.Header["kid"] = doc.Kid
+	confusedToken, _ := confused.SignedString([]byte(doc.PrivateKey))
+
+	// 没有kid的RS256令牌
+	noKid, _ := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key.private)
+
+	// 没有过期时间的令牌
+	noExpiry := jwt.NewWithClaims(jwt.SigningMethodRS256, &SignedDetails{TokenType: TokenTypeAccess})
+	noExpiry.Header["kid"] = doc.Kid
+	noExpiryToken, _ := noExpiry.SignedString(key.private)
+
+	tests := map[string]string{
+		"unknown kid":         unknownToken,
+		"algorithm confusion": confusedToken,
+		"rsa without kid":     noKid,
+		"missing expiry":      noExpiryToken,
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseToken(token, TokenTypeAccess); err == nil {
+				t.Fatal("token was accepted")
+			}
+		})
+	}
+}
+
+func TestKeyringLegacyTokens(t *testing.T) {
+	opts := KeyringOptions{
+		Algorithm:           AlgorithmHS256,
+		LegacyAccessSecret:  "access-secret",
+		LegacyRefreshSecret: "refresh-secret",
+	}
+	useKeyring(t, opts)
+
+	access := signTestToken(t, TokenTypeAccess)
+	refresh := signTestToken(t, TokenTypeRefresh)
+	if kid := tokenKid(t, access); kid != "" {
+		t.Fatalf("HS256 token has kid %q, want none", kid)
+	}
+	if _, err := parseToken(access, TokenTypeAccess); err != nil {
+		t.Fatalf("HS256 access token rejected: %v", err)
+	}
+	if _, err := parseToken(refresh, TokenTypeRefresh); err != nil {
+		t.Fatalf("HS256 refresh token rejected: %v", err)
+	}
+	// 两种令牌使用不同的密钥
+	if _, err := parseToken(refresh, TokenTypeAccess); err == nil {
+		t.Fatal("refresh token accepted as access token")
+	}
+
+	// 切换到非对称算法后，切换前签发的旧令牌在LegacyTokensUntil之前仍可验证
+	opts.Algorithm = AlgorithmEdDSA
+	opts.LegacyTokensUntil = time.Now().Add(time.Hour)
+	k := useKeyring(t, opts)
+	k.load([]signingKeyDocument{newKeyDocument(t, AlgorithmEdDSA, time.Now())})
+	if _, err := parseToken(access, TokenTypeAccess); err != nil {
+		t.Fatalf("legacy access token rejected after switching to EdDSA: %v", err)
+	}
+	if kid := tokenKid(t, signTestToken(t, TokenTypeAccess)); kid == "" {
+		t.Fatal("EdDSA token has no kid")
+	}
+
+	// 过了截止时间或没有配置截止时间，旧令牌即使未过期也不再接受
+	for name, until := range map[string]time.Time{"cutoff passed": time.Now().Add(-time.Minute), "no cutoff": {}} {
+		k.opts.LegacyTokensUntil = until
+		if _, err := parseToken(refresh, TokenTypeRefresh); !errors.Is(err, errLegacyTokenExpired) {
+			t.Errorf("%s: legacy refresh token error = %v, want %v", name, err, errLegacyTokenExpired)
+		}
+	}
+}
+
+func TestParseSigningKey(t *testing.T) {
+	rsaDoc := newKeyDocument(t, AlgorithmRS256, time.Now())
+	edDoc := newKeyDocument(t, AlgorithmEdDSA, time.Now())
+
+	mismatched := rsaDoc
+	mismatched.Algorithm = AlgorithmEdDSA
+	if _, err := parseSigningKey(mismatched); err == nil {
+		t.Fatal("rsa key registered as EdDSA was accepted")
+	}
+	mismatched = edDoc
+	mismatched.Algorithm = AlgorithmRS256
+	if _, err := parseSigningKey(mismatched); err == nil {
+		t.Fatal("ed25519 key registered as RS256 was accepted")
+	}
+
+	invalid := rsaDoc
+	invalid.PrivateKey = "not a pem"
+	if _, err := parseSigningKey(invalid); err == nil {
+		t.Fatal("invalid PEM was accepted")
+	}
+
+	// 活跃密钥忽略retire_at
+	active := rsaDoc
+	retireAt := time.Now().Add(-time.Hour)
+	active.RetireAt = &retireAt
+	key, err := parseSigningKey(active)
+	if err != nil {
+		t.Fatalf("parseSigningKey: %v", err)
+	}
+	if key.retireAt != nil {
+		t.Fatal("active key kept retire_at")
+	}
+
+	// 无效密钥在加载时跳过，不影响其他密钥
+	k := &Keyring{}
+	k.load([]signingKeyDocument{invalid, edDoc})
+	if len(k.keys) != 1 || k.current == nil || k.current.kid != edDoc.Kid {
+		t.Fatalf("loaded keys = %v, want only %s", k.keys, edDoc.Kid)
+	}
+}
@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/joey17520/magic-stream-app/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// loginMaxDelay 渐进延迟的上限
+const loginMaxDelay = 30 * time.Second
+
+// LoginThrottleOptions 登录失败限制配置
+type LoginThrottleOptions struct {
+	// MaxAccountFailures 同一邮箱在窗口内允许的失败次数，达到后锁定该邮箱
+	MaxAccountFailures int
+	// MaxIPFailures 同一IP在窗口内允许的失败次数，达到后锁定该IP
+	MaxIPFailures int
+	// Window 失败次数的统计窗口
+	Window time.Duration
+	// LockoutDuration 锁定时长
+	LockoutDuration time.Duration
+	// BaseDelay 同一邮箱每次失败后必须等待的基础时间，每多失败一次翻倍
+	BaseDelay time.Duration
+}
+
+// LoginLockout 一次登录失败导致的锁定
+type LoginLockout struct {
+	Scope    string
+	Failures int
+	Until    time.Time
+}
+
+// 登录失败计数的范围
+const (
+	LoginScopeAccount = "account"
+	LoginScopeIP      = "ip"
+)
+
+var (
+	// loginAttemptCollection将在运行时通过SetLoginAttemptCollection设置
+	loginAttemptCollection *mongo.Collection
+	loginThrottle          = LoginThrottleOptions{
+		MaxAccountFailures: 5,
+		MaxIPFailures:      20,
+		Window:             15 * time.Minute,
+		LockoutDuration:    15 * time.Minute,
+		BaseDelay:          time.Second,
+	}
+)
+
+// SetLoginAttemptCollection 设置登录失败计数集合和限制配置，用于打破导入循环
+func SetLoginAttemptCollection(collection *mongo.Collection, opts LoginThrottleOptions) {
+	loginAttemptCollection = collection
+	loginThrottle = opts
+}
+
+// loginAttemptKeys 返回邮箱和IP对应的计数键
+func loginAttemptKeys(email, ip string) (string, string) {
+	return LoginScopeAccount + ":" + strings.ToLower(strings.TrimSpace(email)), LoginScopeIP + ":" + ip
+}
+
+// CheckLoginAllowed 检查邮箱和IP当前是否允许尝试登录，不允许时返回需要等待的时间
+func CheckLoginAllowed(email, ip string) (time.Duration, error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	accountKey, ipKey := loginAttemptKeys(email, ip)
+	cursor, err := loginAttemptCollection.Find(ctx, bson.M{"key": bson.M{"$in": bson.A{accountKey, ipKey}}})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var attempts []models.LoginAttempt
+	if err := cursor.All(ctx, &attempts); err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	var wait time.Duration
+	for _, attempt := range attempts {
+		for _, until := range []*time.Time{attempt.LockedUntil, attempt.NextAttemptAt} {
+			if until != nil && until.After(now) && until.Sub(now) > wait {
+				wait = until.Sub(now)
+			}
+		}
+	}
+
+	return wait, nil
+}
+
+// RecordLoginFailure 记录一次登录失败，返回本次失败触发的锁定（可能同时锁定邮箱和IP）
+func RecordLoginFailure(email, ip string) ([]LoginLockout, error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	accountKey, ipKey := loginAttemptKeys(email, ip)
+
+	var lockouts []LoginLockout
+	for _, scope := range []struct {
+		name        string
+		key         string
+		maxFailures int
+		delay       bool
+	}{
+		// 渐进延迟只作用于邮箱，避免共享出口IP的正常用户被拖慢
+		{LoginScopeAccount, accountKey, loginThrottle.MaxAccountFailures, true},
+		{LoginScopeIP, ipKey, loginThrottle.MaxIPFailures, false},
+	} {
+		attempt, err := incrementLoginFailures(ctx, scope.key)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		set := bson.M{}
+		if attempt.Failures >= scope.maxFailures {
+			// 锁定后重置计数，锁定结束后重新开始计算
+			until := now.Add(loginThrottle.LockoutDuration)
+			set["locked_until"] = until
+			set["failures"] = 0
+			set["first_failure_at"] = nil
+			set["next_attempt_at"] = nil
+			lockouts = append(lockouts, LoginLockout{Scope: scope.name, Failures: attempt.Failures, Until: until})
+		} else if scope.delay {
+			set["next_attempt_at"] = now.Add(loginFailureDelay(attempt.Failures))
+		} else {
+			continue
+		}
+
+		if _, err := loginAttemptCollection.UpdateOne(ctx, bson.M{"key": scope.key}, bson.M{"$set": set}); err != nil {
+			return nil, err
+		}
+	}
+
+	return lockouts, nil
+}
+
+// ResetLoginFailures 登录成功后清除该邮箱的失败计数；IP的计数保留，防止用一个已知账户重置IP限制
+func ResetLoginFailures(email string) error {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	accountKey, _ := loginAttemptKeys(email, "")
+	_, err := loginAttemptCollection.DeleteOne(ctx, bson.M{"key": accountKey})
+	return err
+}
+
+// incrementLoginFailures 原子地增加失败次数，上次失败超出统计窗口时从1重新计数
+func incrementLoginFailures(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	now := time.Now()
+	expired := bson.M{"$lt": bson.A{
+		bson.M{"$ifNull": bson.A{"$first_failure_at", time.Unix(0, 0)}},
+		now.Add(-loginThrottle.Window),
+	}}
+
+	update := bson.A{bson.M{"$set": bson.M{
+		"key":              key,
+		"failures":         bson.M{"$cond": bson.A{expired, 1, bson.M{"$add": bson.A{"$failures", 1}}}},
+		"first_failure_at": bson.M{"$cond": bson.A{expired, now, "$first_failure_at"}},
+		"last_failure_at":  now,
+	}}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var attempt models.LoginAttempt
+	err := loginAttemptCollection.FindOneAndUpdate(ctx, bson.M{"key": key}, update, opts).Decode(&attempt)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("login attempt counter was not created")
+		}
+		return nil, err
+	}
+
+	return &attempt, nil
+}
+
+// loginFailureDelay 第n次失败后需要等待的时间：第一次失败不延迟，之后从BaseDelay开始翻倍
+func loginFailureDelay(failures int) time.Duration {
+	if failures <= 1 || loginThrottle.BaseDelay <= 0 {
+		return 0
+	}
+
+	delay := loginThrottle.BaseDelay
+	for i := 2; i < failures && delay < loginMaxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, loginMaxDelay)
+}
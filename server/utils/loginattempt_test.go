@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// useLoginThrottle 在测试期间使用指定的登录限制配置
+func useLoginThrottle(t *testing.T, opts LoginThrottleOptions) {
+	t.Helper()
+	previous := loginThrottle
+	loginThrottle = opts
+	t.Cleanup(func() { loginThrottle = previous })
+}
+
+// useTestLoginAttempts 让登录失败计数在测试期间使用临时集合和指定配置
+func useTestLoginAttempts(t *testing.T, opts LoginThrottleOptions) {
+	t.Helper()
+	collection := testCollection(t, "login_attempts")
+
+	previous := loginAttemptCollection
+	loginAttemptCollection = collection
+	t.Cleanup(func() { loginAttemptCollection = previous })
+	useLoginThrottle(t, opts)
+}
+
+func TestLoginFailureDelay(t *testing.T) {
+	useLoginThrottle(t, LoginThrottleOptions{BaseDelay: time.Second})
+
+	want := map[int]time.Duration{
+		0:   0,
+		1:   0,
+		2:   time.Second,
+		3:   2 * time.Second,
+		4:   4 * time.Second,
+		6:   16 * time.Second,
+		7:   loginMaxDelay,
+		100: loginMaxDelay,
+	}
+	for failures, delay := range want {
+		if got := loginFailureDelay(failures); got != delay {
+			t.Errorf("loginFailureDelay(%d) = %s, want %s", failures, got, delay)
+		}
+	}
+
+	useLoginThrottle(t, LoginThrottleOptions{BaseDelay: 0})
+	if got := loginFailureDelay(10); got != 0 {
+		t.Errorf("loginFailureDelay with no base delay = %s, want 0", got)
+	}
+
+	// 基础延迟本身超过上限时同样受上限约束
+	useLoginThrottle(t, LoginThrottleOptions{BaseDelay: time.Minute})
+	if got := loginFailureDelay(2); got != loginMaxDelay {
+		t.Errorf("loginFailureDelay with a large base delay = %s, want %s", got, loginMaxDelay)
+	}
+}
+
+func TestLoginAttemptKeys(t *testing.T) {
+	account, ip := loginAttemptKeys("  Alice@Example.COM ", "10.0.0.1")
+	if account != "account:alice@example.com" || ip != "ip:10.0.0.1" {
+		t.Fatalf("keys = %q, %q", account, ip)
+	}
+}
+
+// recordFailures 记录n次登录失败，返回最后一次触发的锁定
+func recordFailures(t *testing.T, email, ip string, n int) []LoginLockout {
+	t.Helper()
+	var lockouts []LoginLockout
+	for range n {
+		var err error
+		if lockouts, err = RecordLoginFailure(email, ip); err != nil {
+			t.Fatalf("RecordLoginFailure: %v", err)
+		}
+	}
+	return lockouts
+}
+
+// loginWait 返回邮箱和IP当前需要等待的时间
+func loginWait(t *testing.T, email, ip string) time.Duration {
+	t.Helper()
+	wait, err := CheckLoginAllowed(email, ip)
+	if err != nil {
+		t.Fatalf("CheckLoginAllowed: %v", err)
+	}
+	return wait
+}
+
+func TestAccountLockout(t *testing.T) {
+	useTestLoginAttempts(t, LoginThrottleOptions{
+		MaxAccountFailures: 3,
+		MaxIPFailures:      100,
+		Window:             time.Minute,
+		LockoutDuration:    time.Minute,
+	})
+
+	// 邮箱大小写不同也计入同一个账户
+	if lockouts := recordFailures(t, "Alice@example.com", "10.0.0.1", 2); len(lockouts) != 0 {
+		t.Fatalf("locked out after 2 failures: %+v", lockouts)
+	}
+	if wait := loginWait(t, "alice@example.com", "10.0.0.1"); wait != 0 {
+		t.Fatalf("wait after 2 failures = %s, want 0", wait)
+	}
+
+	lockouts := recordFailures(t, "alice@example.com", "10.0.0.2", 1)
+	if len(lockouts) != 1 || lockouts[0].Scope != LoginScopeAccount || lockouts[0].Failures != 3 {
+		t.Fatalf("lockouts = %+v, want the account locked after 3 failures", lockouts)
+	}
+
+	// 账户锁定对任何IP都生效，但不影响同一IP上的其他账户
+	if wait := loginWait(t, "alice@example.com", "10.0.0.9"); wait <= 0 || wait > time.Minute {
+		t.Fatalf("wait for the locked account = %s, want up to 1m", wait)
+	}
+	if wait := loginWait(t, "bob@example.com", "10.0.0.1"); wait != 0 {
+		t.Fatalf("wait for another account = %s, want 0", wait)
+	}
+}
+
+func TestIPLockout(t *testing.T) {
+	useTestLoginAttempts(t, LoginThrottleOptions{
+		MaxAccountFailures: 100,
+		MaxIPFailures:      3,
+		Window:             time.Minute,
+		LockoutDuration:    time.Minute,
+	})
+
+	// 同一IP对不同账户的尝试累计计数
+	recordFailures(t, "a@example.com", "10.0.0.1", 1)
+	recordFailures(t, "b@example.com", "10.0.0.1", 1)
+	lockouts := recordFailures(t, "c@example.com", "10.0.0.1", 1)
+	if len(lockouts) != 1 || lockouts[0].Scope != LoginScopeIP {
+		t.Fatalf("lockouts = %+v, want the IP locked", lockouts)
+	}
+
+	if wait := loginWait(t, "new@example.com", "10.0.0.1"); wait <= 0 {
+		t.Fatal("locked IP can still try other accounts")
+	}
+	if wait := loginWait(t, "a@example.com", "10.0.0.2"); wait != 0 {
+		t.Fatalf("wait from another IP = %s, want 0", wait)
+	}
+}
+
+func TestProgressiveDelayAndReset(t *testing.T) {
+	useTestLoginAttempts(t, LoginThrottleOptions{
+		MaxAccountFailures: 10,
+		MaxIPFailures:      4,
+		Window:             time.Minute,
+		LockoutDuration:    time.Minute,
+		BaseDelay:          time.Second,
+	})
+
+	// 第一次失败不延迟
+	recordFailures(t, "alice@example.com", "10.0.0.1", 1)
+	if wait := loginWait(t, "alice@example.com", "10.0.0.1"); wait != 0 {
+		t.Fatalf("wait after the first failure = %s, want 0", wait)
+	}
+
+	recordFailures(t, "alice@example.com", "10.0.0.1", 1)
+	if wait := loginWait(t, "alice@example.com", "10.0.0.1"); wait <= 0 || wait > time.Second {
+		t.Fatalf("wait after the second failure = %s, want up to 1s", wait)
+	}
+	// 延迟只作用于账户，同一IP上的其他账户不受影响
+	if wait := loginWait(t, "bob@example.com", "10.0.0.1"); wait != 0 {
+		t.Fatalf("wait for another account = %s, want 0", wait)
+	}
+
+	// 登录成功后清除账户的延迟
+	if err := ResetLoginFailures("ALICE@example.com"); err != nil {
+		t.Fatalf("ResetLoginFailures: %v", err)
+	}
+	if wait := loginWait(t, "alice@example.com", "10.0.0.1"); wait != 0 {
+		t.Fatalf("wait after a successful login = %s, want 0", wait)
+	}
+
+	// 账户重新从第一次失败开始计数，IP的计数保留：第4次失败锁定IP
+	lockouts := recordFailures(t, "alice@example.com", "10.0.0.1", 2)
+	if len(lockouts) != 1 || lockouts[0].Scope != LoginScopeIP || lockouts[0].Failures != 4 {
+		t.Fatalf("lockouts = %+v, want only the IP locked after 4 failures", lockouts)
+	}
+}
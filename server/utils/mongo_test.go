@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// testMongoURIEnv 依赖MongoDB的测试使用的连接地址，未设置时这些测试被跳过
+const testMongoURIEnv = "MONGODB_TEST_URI"
+
+// testCollection 在一个临时数据库中打开集合，测试结束后删除整个数据库
+func testCollection(t *testing.T, name string) *mongo.Collection {
+	t.Helper()
+
+	uri := os.Getenv(testMongoURIEnv)
+	if uri == "" {
+		t.Skipf("%s is not set", testMongoURIEnv)
+	}
+
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect to MongoDB: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Fatalf("ping MongoDB: %v", err)
+	}
+
+	db := client.Database("magicstream_test_" + bson.NewObjectID().Hex())
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := db.Drop(ctx); err != nil {
+			t.Errorf("drop test database: %v", err)
+		}
+		_ = client.Disconnect(ctx)
+	})
+
+	return db.Collection(name)
+}
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joey17520/magic-stream-app/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ParentalPINHeader 临时解除家长控制限制时携带PIN的请求头
+const ParentalPINHeader = "X-Parental-PIN"
+
+// 连续输错PIN达到上限后锁定一段时间，防止穷举4-6位数字
+const (
+	maxParentalPINFailures = 5
+	parentalPINLockout     = 15 * time.Minute
+)
+
+var (
+	// ErrParentalPINNotSet 账户没有设置家长控制PIN
+	ErrParentalPINNotSet = errors.New("parental PIN has not been set")
+	// ErrParentalPINInvalid PIN不正确
+	ErrParentalPINInvalid = errors.New("parental PIN is incorrect")
+	// ErrParentalPINLocked 连续输错PIN，暂时锁定
+	ErrParentalPINLocked = errors.New("too many incorrect PIN attempts, please try again later")
+)
+
+// EffectiveMaxCertification 计算当前档案实际允许的最高分级，返回空字符串表示不限制：
+// 选择了档案时使用档案的设置（儿童档案默认PG），否则使用账户主档案的设置
+func EffectiveMaxCertification(controls *models.ParentalControls, profile *models.HouseholdProfile) string {
+	if profile != nil {
+		if profile.MaxCertification != "" {
+			return profile.MaxCertification
+		}
+		if profile.Kids {
+			return models.DefaultKidsCertification
+		}
+		return ""
+	}
+	if controls != nil {
+		return controls.MaxCertification
+	}
+	return ""
+}
+
+// AllowedCertifications 返回不超过maxCertification的分级列表，maxCertification为空时返回nil表示不限制。
+// 未分级的电影不在列表中，启用限制后不会被返回
+func AllowedCertifications(maxCertification string) []string {
+	if maxCertification == "" {
+		return nil
+	}
+	index := slices.Index(models.Certifications, maxCertification)
+	if index < 0 {
+		return []string{}
+	}
+	return slices.Clone(models.Certifications[:index+1])
+}
+
+// CertificationAllowed 判断电影分级是否在允许范围内
+func CertificationAllowed(certification, maxCertification string) bool {
+	allowed := AllowedCertifications(maxCertification)
+	return allowed == nil || slices.Contains(allowed, certification)
+}
+
+// GetMaxCertificationFromContext 获取当前请求允许的最高分级，为空表示不限制
+func GetMaxCertificationFromContext(c *gin.Context) string {
+	return c.GetString("maxCertification")
+}
+
+// HashParentalPIN 计算PIN的哈希值
+func HashParentalPIN(pin string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// VerifyParentalPIN 校验用户的家长控制PIN，连续输错达到上限后锁定一段时间，校验成功时清除失败计数
+func VerifyParentalPIN(userId, pin string) error {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var result struct {
+		ParentalControls *models.ParentalControls `bson:"parental_controls"`
+	}
+
+	opts := options.FindOne().SetProjection(bson.M{"parental_controls": 1})
+	if err := userCollection.FindOne(ctx, bson.M{"user_id": userId}, opts).Decode(&result); err != nil {
+		return err
+	}
+
+	controls := result.ParentalControls
+	if controls == nil || controls.PINHash == "" {
+		return ErrParentalPINNotSet
+	}
+
+	now := time.Now()
+	if controls.PINLockedUntil != nil && controls.PINLockedUntil.After(now) {
+		return ErrParentalPINLocked
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(controls.PINHash), []byte(pin)) != nil {
+		update := bson.M{"$inc": bson.M{"parental_controls.pin_failures": 1}}
+		if controls.PINFailures+1 >= maxParentalPINFailures {
+			update = bson.M{"$set": bson.M{
+				"parental_controls.pin_failures":     0,
+				"parental_controls.pin_locked_until": now.Add(parentalPINLockout),
+			}}
+		}
+		if _, err := userCollection.UpdateOne(ctx, bson.M{"user_id": userId}, update); err != nil {
+			return err
+		}
+		return ErrParentalPINInvalid
+	}
+
+	if controls.PINFailures > 0 || controls.PINLockedUntil != nil {
+		_, err := userCollection.UpdateOne(ctx,
+			bson.M{"user_id": userId},
+			bson.M{
+				"$set":   bson.M{"parental_controls.pin_failures": 0},
+				"$unset": bson.M{"parental_controls.pin_locked_until": ""},
+			},
+		)
+		if err != nil {
+			Warn("Failed to reset parental PIN failures", ErrorFields(err)...)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/joey17520/magic-stream-app/models"
+)
+
+func TestEffectiveMaxCertification(t *testing.T) {
+	controls := &models.ParentalControls{MaxCertification: models.CertificationPG13}
+
+	if got := EffectiveMaxCertification(nil, nil); got != "" {
+		t.Errorf("no controls: got %q, want unrestricted", got)
+	}
+	if got := EffectiveMaxCertification(controls, nil); got != models.CertificationPG13 {
+		t.Errorf("main profile: got %q, want the account setting", got)
+	}
+
+	// 选择了档案时只看档案自己的设置，账户主档案的限制不会叠加
+	if got := EffectiveMaxCertification(controls, &models.HouseholdProfile{}); got != "" {
+		t.Errorf("adult profile: got %q, want unrestricted", got)
+	}
+	if got := EffectiveMaxCertification(controls, &models.HouseholdProfile{Kids: true}); got != models.DefaultKidsCertification {
+		t.Errorf("kids profile: got %q, want %q", got, models.DefaultKidsCertification)
+	}
+	kids := &models.HouseholdProfile{Kids: true, MaxCertification: models.CertificationG}
+	if got := EffectiveMaxCertification(controls, kids); got != models.CertificationG {
+		t.Errorf("kids profile with its own limit: got %q, want G", got)
+	}
+}
+
+func TestCertificationAllowed(t *testing.T) {
+	if AllowedCertifications("") != nil {
+		t.Fatal("AllowedCertifications(\"\") must be nil (unrestricted)")
+	}
+	if got := AllowedCertifications(models.CertificationPG13); !slices.Equal(got, []string{"G", "PG", "PG-13"}) {
+		t.Fatalf("AllowedCertifications(PG-13) = %v", got)
+	}
+	// 未知的分级不放行任何电影，而不是退化为不限制
+	if got := AllowedCertifications("X"); got == nil || len(got) != 0 {
+		t.Fatalf("AllowedCertifications(X) = %#v, want an empty non-nil list", got)
+	}
+
+	tests := []struct {
+		certification, max string
+		want               bool
+	}{
+		{"R", "", true},
+		{"", "", true},
+		{"PG", "PG-13", true},
+		{"PG-13", "PG-13", true},
+		{"R", "PG-13", false},
+		{"", "NC-17", false}, // 启用限制后未分级的电影不会返回
+		{"G", "X", false},
+	}
+	for _, tt := range tests {
+		if got := CertificationAllowed(tt.certification, tt.max); got != tt.want {
+			t.Errorf("CertificationAllowed(%q, %q) = %v, want %v", tt.certification, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestAllowedCertificationsDoesNotAlias(t *testing.T) {
+	allowed := AllowedCertifications(models.CertificationR)
+	allowed[0] = "tampered"
+	if models.Certifications[0] != models.CertificationG {
+		t.Fatal("AllowedCertifications returned a slice backed by models.Certifications")
+	}
+}
+
+func TestVerifyParentalPIN(t *testing.T) {
+	collection := testCollection(t, "users")
+	previous := userCollection
+	userCollection = collection
+	t.Cleanup(func() { userCollection = previous })
+
+	hash, err := HashParentalPIN("1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = collection.InsertMany(context.Background(), []any{
+		models.User{UserID: "user-1", ParentalControls: &models.ParentalControls{MaxCertification: "PG", PINHash: hash}},
+		models.User{UserID: "user-2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifyParentalPIN("user-2", "1234"); !errors.Is(err, ErrParentalPINNotSet) {
+		t.Fatalf("without a PIN: err = %v, want ErrParentalPINNotSet", err)
+	}
+	if err := VerifyParentalPIN("user-1", "1234"); err != nil {
+		t.Fatalf("correct PIN: %v", err)
+	}
+
+	// 一次成功会清零失败计数，之后连续输错达到上限才锁定
+	if err := VerifyParentalPIN("user-1", "0000"); !errors.Is(err, ErrParentalPINInvalid) {
+		t.Fatalf("wrong PIN: err = %v", err)
+	}
+	if err := VerifyParentalPIN("user-1", "1234"); err != nil {
+		t.Fatalf("correct PIN after a failure: %v", err)
+	}
+	for i := 1; i < maxParentalPINFailures; i++ {
+		if err := VerifyParentalPIN("user-1", "0000"); !errors.Is(err, ErrParentalPINInvalid) {
+			t.Fatalf("failure %d: err = %v, want ErrParentalPINInvalid", i, err)
+		}
+	}
+	if err := VerifyParentalPIN("user-1", "0000"); !errors.Is(err, ErrParentalPINInvalid) {
+		t.Fatalf("failure %d: err = %v, want ErrParentalPINInvalid", maxParentalPINFailures, err)
+	}
+	// 锁定期间即使PIN正确也拒绝
+	if err := VerifyParentalPIN("user-1", "1234"); !errors.Is(err, ErrParentalPINLocked) {
+		t.Fatalf("correct PIN while locked: err = %v, want ErrParentalPINLocked", err)
+	}
+}
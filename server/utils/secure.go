@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// GenerateOpaqueToken 生成随机的不透明令牌，返回原始值（发给用户）和哈希值（存入数据库）
+func GenerateOpaqueToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+
+	raw := base64.RawURLEncoding.EncodeToString(buf)
+	return raw, HashOpaqueToken(raw), nil
+}
+
+// HashOpaqueToken 计算不透明令牌的SHA-256哈希，用于存储和查找
+func HashOpaqueToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewTokenId 生成JWT的唯一标识（jti）
+func NewTokenId() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		// crypto/rand 在受支持的平台上不会失败
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
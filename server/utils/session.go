@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/joey17520/magic-stream-app/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// SessionTTL 会话有效期，与refresh token有效期一致
+const SessionTTL = 7 * 24 * time.Hour
+
+// sessionTouchInterval 更新会话最近使用时间的最小间隔，避免每个请求都写数据库
+const sessionTouchInterval = time.Minute
+
+// ErrSessionInvalid 会话不存在、已撤销或已过期
+var ErrSessionInvalid = errors.New("session is invalid or has been revoked")
+
+// ErrRefreshTokenReused 已被轮换掉的refresh token再次出现，说明令牌可能已泄露
+var ErrRefreshTokenReused = errors.New("refresh token has already been used")
+
+// sessionCollection将在运行时通过SetSessionCollection设置
+var sessionCollection *mongo.Collection
+
+// SetSessionCollection 设置会话集合，用于打破导入循环
+func SetSessionCollection(collection *mongo.Collection) {
+	sessionCollection = collection
+}
+
+// CreateSession 为用户创建新的会话
+func CreateSession(userId, device, ip, userAgent string) (*models.Session, error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	session := &models.Session{
+		SessionID:  bson.NewObjectID().Hex(),
+		UserID:     userId,
+		Device:     device,
+		IP:         ip,
+		LastIP:     ip,
+		UserAgent:  userAgent,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(SessionTTL),
+
+		RefreshTokenID: NewTokenId(),
+	}
+
+	if _, err := sessionCollection.InsertOne(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// ValidateSession 校验会话属于该用户且仍然有效，并按间隔刷新最近使用时间和IP
+func ValidateSession(sessionId, userId, ip string) (*models.Session, error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var session models.Session
+	err := sessionCollection.FindOne(ctx, bson.M{
+		"session_id": sessionId,
+		"user_id":    userId,
+		"revoked_at": nil,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&session)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrSessionInvalid
+		}
+		return nil, err
+	}
+
+	if time.Since(session.LastUsedAt) > sessionTouchInterval || session.LastIP != ip {
+		_, err := sessionCollection.UpdateOne(ctx,
+			bson.M{"session_id": sessionId},
+			bson.M{"$set": bson.M{"last_used_at": time.Now(), "last_ip": ip}},
+		)
+		if err != nil {
+			Warn("Failed to update session last used time", ErrorFields(err)...)
+		}
+	}
+
+	return &session, nil
+}
+
+// RotateRefreshToken 轮换会话的refresh token：只有当前有效的jti才能换取新的jti，旧的jti随即作废。
+// 如果出现已被轮换掉的jti（重放），整个会话（令牌家族）都会被撤销并返回ErrRefreshTokenReused。
+func RotateRefreshToken(sessionId, userId, refreshTokenId string) (string, error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	newRefreshTokenId := NewTokenId()
+
+	result, err := sessionCollection.UpdateOne(ctx,
+		bson.M{
+			"session_id":       sessionId,
+			"user_id":          userId,
+			"refresh_token_id": refreshTokenId,
+			"revoked_at":       nil,
+			"expires_at":       bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{
+			"refresh_token_id": newRefreshTokenId,
+			"last_used_at":     now,
+			"expires_at":       now.Add(SessionTTL),
+		}},
+	)
+	if err != nil {
+		return "", err
+	}
+	if result.MatchedCount == 1 {
+		return newRefreshTokenId, nil
+	}
+
+	// 没有匹配时区分会话失效和令牌重放
+	var session models.Session
+	err = sessionCollection.FindOne(ctx, bson.M{"session_id": sessionId, "user_id": userId}).Decode(&session)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", ErrSessionInvalid
+		}
+		return "", err
+	}
+
+	if session.RefreshTokenID != refreshTokenId {
+		// 签名有效但jti不是当前值，只可能是之前签发过、已被轮换掉的令牌
+		_, err := sessionCollection.UpdateOne(ctx,
+			bson.M{"session_id": sessionId, "revoked_at": nil},
+			bson.M{"$set": bson.M{"revoked_at": now}},
+		)
+		if err != nil {
+			return "", err
+		}
+		return "", ErrRefreshTokenReused
+	}
+
+	return "", ErrSessionInvalid
+}
+
+// ListSessions 列出用户所有有效的会话，按最近使用时间倒序
+func ListSessions(userId string) ([]models.Session, error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"user_id":    userId,
+		"revoked_at": nil,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "last_used_at", Value: -1}})
+
+	cursor, err := sessionCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []models.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession 撤销用户的某个会话，会话不存在或不属于该用户时返回ErrSessionInvalid
+func RevokeSession(userId, sessionId string) error {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := sessionCollection.UpdateOne(ctx,
+		bson.M{"session_id": sessionId, "user_id": userId, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrSessionInvalid
+	}
+
+	return nil
+}
+
+// RevokeAllSessions 撤销用户的所有会话，exceptSessionId不为空时保留该会话
+func RevokeAllSessions(userId, exceptSessionId string) error {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"user_id": userId, "revoked_at": nil}
+	if exceptSessionId != "" {
+		filter["session_id"] = bson.M{"$ne": exceptSessionId}
+	}
+
+	_, err := sessionCollection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked_at": time.Now()}})
+	return err
+}
+
+// DeleteUserSessions 删除用户的所有会话记录，用于账户注销后清除个人数据
+func DeleteUserSessions(userId string) error {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := sessionCollection.DeleteMany(ctx, bson.M{"user_id": userId})
+	return err
+}
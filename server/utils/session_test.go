@@ -0,0 +1,263 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/joey17520/magic-stream-app/models"
+)
+
+// useTestSessions 让会话函数在测试期间使用临时集合
+func useTestSessions(t *testing.T) {
+	t.Helper()
+	collection := testCollection(t, "sessions")
+
+	previous := sessionCollection
+	sessionCollection = collection
+	t.Cleanup(func() { sessionCollection = previous })
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	useTestSessions(t)
+
+	session, err := CreateSession("user-1", "laptop", "10.0.0.1", "Firefox")
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+	if session.SessionID == "" || !session.ExpiresAt.After(time.Now().Add(SessionTTL-time.Minute)) {
+		t.Fatalf("session = %+v", session)
+	}
+
+	if _, err := ValidateSession(session.SessionID, "user-1", "10.0.0.1"); err != nil {
+		t.Fatalf("ValidateSession: %v", err)
+	}
+	// 会话属于其他用户时视为不存在
+	if _, err := ValidateSession(session.SessionID, "user-2", "10.0.0.1"); !errors.Is(err, ErrSessionInvalid) {
+		t.Fatalf("ValidateSession for another user = %v, want ErrSessionInvalid", err)
+	}
+
+	// IP变化时记录最近使用的IP
+	if _, err := ValidateSession(session.SessionID, "user-1", "10.0.0.2"); err != nil {
+		t.Fatalf("ValidateSession from a new IP: %v", err)
+	}
+	sessions, err := ListSessions("user-1")
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].LastIP != "10.0.0.2" || sessions[0].IP != "10.0.0.1" {
+		t.Fatalf("sessions = %+v, want one session last used from 10.0.0.2", sessions)
+	}
+
+	if err := RevokeSession("user-2", session.SessionID); !errors.Is(err, ErrSessionInvalid) {
+		t.Fatalf("RevokeSession by another user = %v, want ErrSessionInvalid", err)
+	}
+	if err := RevokeSession("user-1", session.SessionID); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+	if _, err := ValidateSession(session.SessionID, "user-1", "10.0.0.1"); !errors.Is(err, ErrSessionInvalid) {
+		t.Fatalf("ValidateSession after revocation = %v, want ErrSessionInvalid", err)
+	}
+	if err := RevokeSession("user-1", session.SessionID); !errors.Is(err, ErrSessionInvalid) {
+		t.Fatalf("revoking twice = %v, want ErrSessionInvalid", err)
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	useTestSessions(t)
+
+	now := time.Now()
+	expired := models.Session{
+		SessionID:  "expired",
+		UserID:     "user-1",
+		CreatedAt:  now.Add(-SessionTTL - time.Hour),
+		LastUsedAt: now.Add(-SessionTTL),
+		ExpiresAt:  now.Add(-time.Minute),
+	}
+	if _, err := sessionCollection.InsertOne(context.Background(), expired); err != nil {
+		t.Fatalf("insert expired session: %v", err)
+	}
+
+	if _, err := ValidateSession("expired", "user-1", "10.0.0.1"); !errors.Is(err, ErrSessionInvalid) {
+		t.Fatalf("ValidateSession = %v, want ErrSessionInvalid", err)
+	}
+	if sessions, err := ListSessions("user-1"); err != nil || len(sessions) != 0 {
+		t.Fatalf("ListSessions = %+v, %v, want no sessions", sessions, err)
+	}
+}
+
+func TestListAndRevokeAllSessions(t *testing.T) {
+	useTestSessions(t)
+
+	var ids []string
+	for _, device := range []string{"phone", "tablet", "tv"} {
+		session, err := CreateSession("user-1", device, "10.0.0.1", device)
+		if err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+		ids = append(ids, session.SessionID)
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, err := CreateSession("user-2", "laptop", "10.0.0.9", "laptop"); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	// 最近使用的会话排在前面
+	sessions, err := ListSessions("user-1")
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if len(sessions) != 3 || sessions[0].Device != "tv" || sessions[2].Device != "phone" {
+		t.Fatalf("sessions = %+v, want tv, tablet, phone", sessions)
+	}
+
+	// 退出其他设备时保留当前会话
+	if err := RevokeAllSessions("user-1", ids[0]); err != nil {
+		t.Fatalf("RevokeAllSessions: %v", err)
+	}
+	sessions, _ = ListSessions("user-1")
+	if len(sessions) != 1 || sessions[0].SessionID != ids[0] {
+		t.Fatalf("sessions = %+v, want only %s", sessions, ids[0])
+	}
+
+	if err := RevokeAllSessions("user-1", ""); err != nil {
+		t.Fatalf("RevokeAllSessions: %v", err)
+	}
+	if sessions, _ := ListSessions("user-1"); len(sessions) != 0 {
+		t.Fatalf("sessions = %+v, want none", sessions)
+	}
+	// 其他用户的会话不受影响
+	if sessions, _ := ListSessions("user-2"); len(sessions) != 1 {
+		t.Fatalf("user-2 sessions = %+v, want one", sessions)
+	}
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	useTestSessions(t)
+
+	session, err := CreateSession("user-1", "laptop", "10.0.0.1", "Firefox")
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	first, err := RotateRefreshToken(session.SessionID, "user-1", session.RefreshTokenID)
+	if err != nil {
+		t.Fatalf("RotateRefreshToken: %v", err)
+	}
+	second, err := RotateRefreshToken(session.SessionID, "user-1", first)
+	if err != nil {
+		t.Fatalf("RotateRefreshToken with the rotated jti: %v", err)
+	}
+	if first == session.RefreshTokenID || second == first {
+		t.Fatalf("jti did not change: %s -> %s -> %s", session.RefreshTokenID, first, second)
+	}
+
+	// 不属于该用户或不存在的会话
+	if _, err := RotateRefreshToken(session.SessionID, "user-2", second); !errors.Is(err, ErrSessionInvalid) {
+		t.Fatalf("rotation by another user = %v, want ErrSessionInvalid", err)
+	}
+	if _, err := RotateRefreshToken("missing", "user-1", second); !errors.Is(err, ErrSessionInvalid) {
+		t.Fatalf("rotation of a missing session = %v, want ErrSessionInvalid", err)
+	}
+
+	// 重放已轮换掉的jti，整个会话被撤销
+	if _, err := RotateRefreshToken(session.SessionID, "user-1", first); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reusing a rotated jti = %v, want ErrRefreshTokenReused", err)
+	}
+	if _, err := ValidateSession(session.SessionID, "user-1", "10.0.0.1"); !errors.Is(err, ErrSessionInvalid) {
+		t.Fatalf("session after reuse = %v, want it revoked", err)
+	}
+	// 家族中最新的令牌也随之失效
+	if _, err := RotateRefreshToken(session.SessionID, "user-1", second); !errors.Is(err, ErrSessionInvalid) {
+		t.Fatalf("rotating the latest jti after reuse = %v, want ErrSessionInvalid", err)
+	}
+}
+
+func TestRotateRefreshTokenExpiredSession(t *testing.T) {
+	useTestSessions(t)
+
+	now := time.Now()
+	expired := models.Session{
+		SessionID:      "expired",
+		UserID:         "user-1",
+		CreatedAt:      now.Add(-SessionTTL - time.Hour),
+		LastUsedAt:     now.Add(-SessionTTL),
+		ExpiresAt:      now.Add(-time.Minute),
+		RefreshTokenID: "jti-1",
+	}
+	if _, err := sessionCollection.InsertOne(context.Background(), expired); err != nil {
+		t.Fatalf("insert expired session: %v", err)
+	}
+
+	// 会话过期不是重放
+	if _, err := RotateRefreshToken("expired", "user-1", "jti-1"); !errors.Is(err, ErrSessionInvalid) {
+		t.Fatalf("RotateRefreshToken = %v, want ErrSessionInvalid", err)
+	}
+}
+
+func TestRotateRefreshTokenConcurrent(t *testing.T) {
+	useTestSessions(t)
+
+	session, err := CreateSession("user-1", "laptop", "10.0.0.1", "Firefox")
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	const attempts = 8
+	results := make(chan error, attempts)
+	start := make(chan struct{})
+	for range attempts {
+		go func() {
+			<-start
+			_, err := RotateRefreshToken(session.SessionID, "user-1", session.RefreshTokenID)
+			results <- err
+		}()
+	}
+	close(start)
+
+	// 同一个jti只能换取一次新令牌，其余请求都视为重放
+	succeeded, reused := 0, 0
+	for range attempts {
+		switch err := <-results; {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, ErrRefreshTokenReused):
+			reused++
+		default:
+			t.Errorf("RotateRefreshToken: %v", err)
+		}
+	}
+	if succeeded != 1 || reused != attempts-1 {
+		t.Fatalf("%d rotations succeeded and %d were reuses, want 1 and %d", succeeded, reused, attempts-1)
+	}
+
+	if _, err := ValidateSession(session.SessionID, "user-1", "10.0.0.1"); !errors.Is(err, ErrSessionInvalid) {
+		t.Fatalf("session after concurrent reuse = %v, want it revoked", err)
+	}
+}
+
+func TestDeleteUserSessions(t *testing.T) {
+	useTestSessions(t)
+
+	for _, user := range []string{"user-1", "user-1", "user-2"} {
+		if _, err := CreateSession(user, "laptop", "10.0.0.1", "Firefox"); err != nil {
+			t.Fatalf("CreateSession: %v", err)
+		}
+	}
+
+	if err := DeleteUserSessions("user-1"); err != nil {
+		t.Fatalf("DeleteUserSessions: %v", err)
+	}
+
+	count, err := sessionCollection.CountDocuments(context.Background(), map[string]string{"user_id": "user-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("%d sessions left for user-1, want 0", count)
+	}
+	if sessions, _ := ListSessions("user-2"); len(sessions) != 1 {
+		t.Fatalf("sessions of user-2 = %+v, want 1", sessions)
+	}
+}
@@ -3,13 +3,15 @@ package utils
 import (
 	"context"
 	"errors"
-	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/joey17520/magic-stream-app/models"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 type SignedDetails struct {
@@ -18,11 +20,50 @@ type SignedDetails struct {
 	LastName  string
 	Role      string
 	UserId    string
+	SessionId string
+	ProfileId string `json:"pid,omitempty"`
+	TokenType string `json:"typ,omitempty"`
 	jwt.RegisteredClaims
 }
 
-var SECRET_KEY string = os.Getenv("SECRET_KEY")
-var SECRET_REFRESH_KEY string = os.Getenv("SECRET_REFRESH_KEY")
+// 访问令牌来源，用于配置Authorization头和cookie同时存在时的优先级
+const (
+	TokenSourceHeader = "header"
+	TokenSourceCookie = "cookie"
+)
+
+// ErrNoAccessToken 请求中既没有Authorization头也没有access_token cookie
+var ErrNoAccessToken = errors.New("No access token provided")
+
+// Authorization头格式错误
+var (
+	ErrBearerSchemeRequired   = errors.New("Authorization header must use the Bearer scheme")
+	ErrBearerTokenMissing     = errors.New("Bearer token is missing from Authorization header")
+	ErrAuthorizationMalformed = errors.New("Authorization header is malformed, expected 'Bearer <token>'")
+)
+
+// 上下文中缺少认证中间件写入的信息，说明路由没有经过AuthMiddleware
+var (
+	ErrUserIdNotInContext    = errors.New("userId does not exist in this context")
+	ErrSessionIdNotInContext = errors.New("sessionId does not exist in this context")
+	ErrRoleNotInContext      = errors.New("role does not exist in this context")
+)
+
+// tokenPrecedence 将在运行时通过SetTokenPrecedence设置
+var tokenPrecedence = TokenSourceHeader
+
+// SetTokenPrecedence 设置优先读取的访问令牌来源
+func SetTokenPrecedence(source string) {
+	tokenPrecedence = source
+}
+
+// 令牌类型，防止access token和refresh token在使用同一把签名密钥时被互换使用
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+	// TokenTypeChallenge 密码验证通过、等待两步验证时签发的临时令牌，不能用于访问API
+	TokenTypeChallenge = "challenge"
+)
 
 // userCollection将在运行时通过SetUserCollection设置
 var userCollection *mongo.Collection
@@ -32,13 +73,18 @@ func SetUserCollection(collection *mongo.Collection) {
 	userCollection = collection
 }
 
-func GenerateAllTokens(email, firstName, lastName, role, userId string) (string, string, error) {
+// GenerateAllTokens 签发access token和refresh token，refreshTokenId作为refresh token的jti用于轮换校验；
+// profileId为当前选择的家庭成员档案，为空表示账户主档案，刷新令牌时沿用
+func GenerateAllTokens(email, firstName, lastName, role, userId, sessionId, profileId, refreshTokenId string) (string, string, error) {
 	claims := &SignedDetails{
 		Email:     email,
 		FirstName: firstName,
 		LastName:  lastName,
 		Role:      role,
 		UserId:    userId,
+		SessionId: sessionId,
+		ProfileId: profileId,
+		TokenType: TokenTypeAccess,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    "MagicStream",
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -46,8 +92,7 @@ func GenerateAllTokens(email, firstName, lastName, role, userId string) (string,
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString([]byte(SECRET_KEY))
+	signedToken, err := signToken(claims, TokenTypeAccess)
 	if err != nil {
 		return "", "", err
 	}
@@ -59,15 +104,18 @@ func GenerateAllTokens(email, firstName, lastName, role, userId string) (string,
 		LastName:  lastName,
 		Role:      role,
 		UserId:    userId,
+		SessionId: sessionId,
+		ProfileId: profileId,
+		TokenType: TokenTypeRefresh,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        refreshTokenId,
 			Issuer:    "MagicStream",
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * 7 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(SessionTTL)),
 		},
 	}
 
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	signedRefreshToken, err := refreshToken.SignedString([]byte(SECRET_REFRESH_KEY))
+	signedRefreshToken, err := signToken(refreshClaims, TokenTypeRefresh)
 	if err != nil {
 		return "", "", err
 	}
@@ -75,59 +123,172 @@ func GenerateAllTokens(email, firstName, lastName, role, userId string) (string,
 	return signedToken, signedRefreshToken, nil
 }
 
-func UpdateAllTokens(userId, token, refreshToken string) (err error) {
+// GenerateChallengeToken 签发两步验证的挑战令牌，只证明用户已通过密码验证
+func GenerateChallengeToken(email, userId string, ttl time.Duration) (string, error) {
+	claims := &SignedDetails{
+		Email:     email,
+		UserId:    userId,
+		TokenType: TokenTypeChallenge,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        NewTokenId(),
+			Issuer:    "MagicStream",
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		},
+	}
+
+	return signToken(claims, TokenTypeChallenge)
+}
+
+// ValidateChallengeToken 校验两步验证的挑战令牌
+func ValidateChallengeToken(tokenString string) (*SignedDetails, error) {
+	claims, err := parseToken(tokenString, TokenTypeChallenge)
+	if err != nil {
+		return nil, err
+	}
+
+	// 挑战令牌总是带有类型，没有类型的旧令牌不能当作挑战令牌使用
+	if claims.TokenType != TokenTypeChallenge {
+		return nil, errors.New("unexpected token type")
+	}
+
+	return claims, nil
+}
+
+// IsEmailVerified 查询用户邮箱是否已验证
+func IsEmailVerified(userId string) (bool, error) {
 	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	updateAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	var result struct {
+		EmailVerified bool `bson:"email_verified"`
+	}
 
-	updateData := bson.M{
-		"$set": bson.M{
-			"token":         token,
-			"refresh_token": refreshToken,
-			"update_at":     updateAt,
-		},
+	opts := options.FindOne().SetProjection(bson.M{"email_verified": 1})
+	err := userCollection.FindOne(ctx, bson.M{"user_id": userId}, opts).Decode(&result)
+	if err != nil {
+		return false, err
+	}
+
+	return result.EmailVerified, nil
+}
+
+// ErrUserDisabled 用户已被管理员禁用
+var ErrUserDisabled = errors.New("account has been disabled")
+
+// ErrProfileNotFound 令牌中的家庭成员档案已被删除
+var ErrProfileNotFound = errors.New("profile no longer exists")
+
+// UserAccess 用户当前实际生效的角色和所选档案
+type UserAccess struct {
+	Role string
+	// Profile 当前选择的家庭成员档案，使用账户主档案时为nil
+	Profile *models.HouseholdProfile
+	// MaxCertification 当前档案允许的最高分级，为空表示不限制
+	MaxCertification string
+	// Country 用户资料中填写的地区
+	Country string
+}
+
+// GetUserAccess 查询用户当前实际生效的角色，并确认所选档案仍然存在；用户被禁用时返回ErrUserDisabled。
+// 每个请求都从数据库读取角色，管理员调整角色或禁用账户后立即生效，不必等待令牌过期
+func GetUserAccess(userId, profileId string) (*UserAccess, error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var result struct {
+		Role             string                    `bson:"role"`
+		TwoFactorEnabled bool                      `bson:"two_factor_enabled"`
+		Disabled         bool                      `bson:"disabled"`
+		Profiles         []models.HouseholdProfile `bson:"profiles"`
+		ParentalControls *models.ParentalControls  `bson:"parental_controls"`
+		Country          string                    `bson:"country"`
 	}
 
-	_, err = userCollection.UpdateOne(ctx, bson.M{"user_id": userId}, updateData)
+	projection := bson.M{"role": 1, "two_factor_enabled": 1, "disabled": 1, "parental_controls.max_certification": 1, "country": 1}
+	if profileId != "" {
+		projection["profiles"] = bson.M{"$elemMatch": bson.M{"profile_id": profileId}}
+	}
 
+	opts := options.FindOne().SetProjection(projection)
+	err := userCollection.FindOne(ctx, bson.M{"user_id": userId}, opts).Decode(&result)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	if result.Disabled {
+		return nil, ErrUserDisabled
+	}
+
+	access := &UserAccess{Role: EffectiveRole(result.Role, result.TwoFactorEnabled)}
+	if profileId != "" {
+		if len(result.Profiles) == 0 {
+			return nil, ErrProfileNotFound
+		}
+		access.Profile = &result.Profiles[0]
+	}
+	access.MaxCertification = EffectiveMaxCertification(result.ParentalControls, access.Profile)
+	access.Country = result.Country
+
+	return access, nil
 }
 
+// GetAccessToken 从请求中获取access token，按配置的优先级依次检查Authorization头和access_token cookie。
+// Authorization头格式错误时直接返回错误，不会回退到cookie
 func GetAccessToken(c *gin.Context) (string, error) {
-	// authHeader := c.Request.Header.Get("Authorization")
-	// if authHeader == "" {
-	// 	return "", errors.New("Authorization header is required")
-	// }
-
-	// tokenString := authHeader[len("Bearer "):]
-	// if tokenString == "" {
-	// 	return "", errors.New("Bearer token is required")
-	// }
+	sources := []func(*gin.Context) (string, error){getBearerToken, getCookieToken}
+	if tokenPrecedence == TokenSourceCookie {
+		sources = []func(*gin.Context) (string, error){getCookieToken, getBearerToken}
+	}
 
-	tokenString, err := c.Cookie("access_token")
-	if err != nil {
-		return "", err
+	for _, source := range sources {
+		token, err := source(c)
+		if err != nil {
+			return "", err
+		}
+		if token != "" {
+			return token, nil
+		}
 	}
 
-	return tokenString, nil
+	return "", ErrNoAccessToken
 }
 
-func ValidateToken(tokenString string) (*SignedDetails, error) {
-	claims := &SignedDetails{}
+// getBearerToken 解析Authorization: Bearer <token>，没有该请求头时返回空字符串
+func getBearerToken(c *gin.Context) (string, error) {
+	authHeader := strings.TrimSpace(c.GetHeader("Authorization"))
+	if authHeader == "" {
+		return "", nil
+	}
+
+	scheme, token, _ := strings.Cut(authHeader, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", ErrBearerSchemeRequired
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", ErrBearerTokenMissing
+	}
+	if strings.ContainsAny(token, " \t") {
+		return "", ErrAuthorizationMalformed
+	}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (any, error) {
-		return []byte(SECRET_KEY), nil
-	})
+	return token, nil
+}
+
+// getCookieToken 读取access_token cookie，没有该cookie时返回空字符串
+func getCookieToken(c *gin.Context) (string, error) {
+	token, err := c.Cookie("access_token")
 	if err != nil {
-		return nil, err
+		return "", nil
 	}
+	return token, nil
+}
 
-	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+func ValidateToken(tokenString string) (*SignedDetails, error) {
+	claims, err := parseToken(tokenString, TokenTypeAccess)
+	if err != nil {
 		return nil, err
 	}
 
@@ -142,50 +303,93 @@ func GetUserIdFromContext(c *gin.Context) (string, error) {
 	userId, exists := c.Get("userId")
 
 	if !exists {
-		return "", errors.New("UserId does not exists in this context")
+		return "", ErrUserIdNotInContext
 	}
 
 	id, ok := userId.(string)
 
 	if !ok {
-		return "", errors.New("unable to retrieve userId")
+		return "", ErrUserIdNotInContext
+	}
+
+	return id, nil
+}
+
+// GetSessionIdFromContext 获取当前请求所属的会话ID
+func GetSessionIdFromContext(c *gin.Context) (string, error) {
+	sessionId, exists := c.Get("sessionId")
+
+	if !exists {
+		return "", ErrSessionIdNotInContext
+	}
+
+	id, ok := sessionId.(string)
+
+	if !ok {
+		return "", ErrSessionIdNotInContext
 	}
 
 	return id, nil
 }
 
+// GetProfileIdFromContext 获取当前请求选择的家庭成员档案ID，为空表示账户主档案
+func GetProfileIdFromContext(c *gin.Context) string {
+	return c.GetString("profileId")
+}
+
+// GetProfileFromContext 获取当前请求选择的家庭成员档案，使用账户主档案时返回nil
+func GetProfileFromContext(c *gin.Context) *models.HouseholdProfile {
+	if profile, ok := c.Get("profile"); ok {
+		if p, ok := profile.(*models.HouseholdProfile); ok {
+			return p
+		}
+	}
+	return nil
+}
+
 func GetRoleFromContext(c *gin.Context) (string, error) {
 	role, exists := c.Get("role")
 
 	if !exists {
-		return "", errors.New("role does not exists in this context")
+		return "", ErrRoleNotInContext
 	}
 
 	memberRole, ok := role.(string)
 
 	if !ok {
-		return "", errors.New("unable to retrieve userId")
+		return "", ErrRoleNotInContext
 	}
 
 	return memberRole, nil
 }
 
 func ValidateRefreshToken(tokenString string) (*SignedDetails, error) {
-	claims := &SignedDetails{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (any, error) {
-		return []byte(SECRET_REFRESH_KEY), nil
-	})
-
+	claims, err := parseToken(tokenString, TokenTypeRefresh)
 	if err != nil {
 		return nil, err
 	}
 
-	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+	if claims.ExpiresAt.Time.Before(time.Now()) {
+		return nil, errors.New("refresh token has expired")
+	}
+
+	return claims, nil
+}
+
+// parseToken 验证签名并解析令牌。没有kid的旧令牌按类型使用对应的对称密钥验证，
+// 新令牌的类型必须与期望的类型一致
+func parseToken(tokenString, tokenType string) (*SignedDetails, error) {
+	claims := &SignedDetails{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, verificationKey(tokenType),
+		jwt.WithValidMethods([]string{AlgorithmHS256, AlgorithmRS256, AlgorithmEdDSA}),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
 		return nil, err
 	}
 
-	if claims.ExpiresAt.Time.Before(time.Now()) {
-		return nil, errors.New("refresh token has expired")
+	if claims.TokenType != "" && claims.TokenType != tokenType {
+		return nil, errors.New("unexpected token type")
 	}
 
 	return claims, nil
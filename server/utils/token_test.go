@@ -0,0 +1,182 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/joey17520/magic-stream-app/models"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// accessTokenRequest 构造带有指定Authorization头和access_token cookie的请求上下文
+func accessTokenRequest(header, cookie string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	if header != "" {
+		c.Request.Header.Set("Authorization", header)
+	}
+	if cookie != "" {
+		c.Request.AddCookie(&http.Cookie{Name: "access_token", Value: cookie})
+	}
+	return c
+}
+
+func TestGetAccessToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		precedence string
+		header     string
+		cookie     string
+		want       string
+		wantErr    error
+	}{
+		{name: "header only", precedence: TokenSourceHeader, header: "Bearer h1", want: "h1"},
+		{name: "cookie only", precedence: TokenSourceHeader, cookie: "c1", want: "c1"},
+		{name: "header preferred", precedence: TokenSourceHeader, header: "Bearer h1", cookie: "c1", want: "h1"},
+		{name: "cookie preferred", precedence: TokenSourceCookie, header: "Bearer h1", cookie: "c1", want: "c1"},
+		{name: "cookie preferred without cookie", precedence: TokenSourceCookie, header: "Bearer h1", want: "h1"},
+		{name: "scheme is case insensitive", precedence: TokenSourceHeader, header: "bearer h1", want: "h1"},
+		{name: "surrounding spaces", precedence: TokenSourceHeader, header: "  Bearer   h1  ", want: "h1"},
+		{name: "basic scheme", precedence: TokenSourceHeader, header: "Basic dXNlcjpwYXNz", cookie: "c1", wantErr: ErrBearerSchemeRequired},
+		{name: "missing token", precedence: TokenSourceHeader, header: "Bearer", cookie: "c1", wantErr: ErrBearerTokenMissing},
+		{name: "extra parts", precedence: TokenSourceHeader, header: "Bearer h1 h2", cookie: "c1", wantErr: ErrAuthorizationMalformed},
+		{name: "nothing", precedence: TokenSourceHeader, wantErr: ErrNoAccessToken},
+	}
+
+	defer SetTokenPrecedence(tokenPrecedence)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetTokenPrecedence(tt.precedence)
+
+			got, err := GetAccessToken(accessTokenRequest(tt.header, tt.cookie))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("GetAccessToken = %q, %v, want %v", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("GetAccessToken = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAccessTokenMissing(t *testing.T) {
+	// 没有任何令牌与令牌格式错误需要区分，前者不带error参数
+	if _, err := GetAccessToken(accessTokenRequest("", "")); !errors.Is(err, ErrNoAccessToken) {
+		t.Fatalf("GetAccessToken = %v, want ErrNoAccessToken", err)
+	}
+	if _, err := GetAccessToken(accessTokenRequest("Token abc", "")); !errors.Is(err, ErrBearerSchemeRequired) {
+		t.Fatalf("GetAccessToken with a malformed header = %v, want ErrBearerSchemeRequired", err)
+	}
+}
+
+func TestGenerateAllTokensCarryProfile(t *testing.T) {
+	k := useKeyring(t, KeyringOptions{Algorithm: AlgorithmEdDSA})
+	k.load([]signingKeyDocument{newKeyDocument(t, AlgorithmEdDSA, time.Now())})
+
+	access, refresh, err := GenerateAllTokens("ann@example.com", "Ann", "Lee", "USER", "user-1", "session-1", "profile-kids", "jti-1")
+	if err != nil {
+		t.Fatalf("GenerateAllTokens: %v", err)
+	}
+
+	accessClaims, err := ValidateToken(access)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	refreshClaims, err := ValidateRefreshToken(refresh)
+	if err != nil {
+		t.Fatalf("ValidateRefreshToken: %v", err)
+	}
+
+	// 刷新令牌必须记住所选档案，否则刷新后会回到账户主档案
+	for name, claims := range map[string]*SignedDetails{"access": accessClaims, "refresh": refreshClaims} {
+		if claims.ProfileId != "profile-kids" || claims.SessionId != "session-1" || claims.UserId != "user-1" {
+			t.Errorf("%s claims = %+v", name, claims)
+		}
+	}
+	if refreshClaims.ID != "jti-1" {
+		t.Errorf("refresh jti = %q, want jti-1", refreshClaims.ID)
+	}
+
+	// 账户主档案不写入pid
+	access, _, err = GenerateAllTokens("ann@example.com", "Ann", "Lee", "USER", "user-1", "session-1", "", "jti-2")
+	if err != nil {
+		t.Fatalf("GenerateAllTokens: %v", err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(access, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := parsed.Claims.(jwt.MapClaims)["pid"]; ok {
+		t.Error("token for the main profile carries a pid claim")
+	}
+}
+
+func TestGetUserAccess(t *testing.T) {
+	collection := testCollection(t, "users")
+	previous := userCollection
+	userCollection = collection
+	t.Cleanup(func() { userCollection = previous })
+
+	_, err := collection.InsertMany(context.Background(), []any{
+		models.User{UserID: "user-1", Role: "USER", Profiles: []models.HouseholdProfile{
+			{ProfileID: "profile-1", Name: "Kids", Kids: true},
+			{ProfileID: "profile-2", Name: "Guest"},
+		}},
+		models.User{UserID: "user-2", Role: "USER", Disabled: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	access, err := GetUserAccess("user-1", "")
+	if err != nil || access.Role != "USER" || access.Profile != nil {
+		t.Fatalf("main profile: access = %+v, err = %v", access, err)
+	}
+
+	access, err = GetUserAccess("user-1", "profile-1")
+	if err != nil {
+		t.Fatalf("GetUserAccess: %v", err)
+	}
+	if access.Profile == nil || access.Profile.ProfileID != "profile-1" || !access.Profile.Kids {
+		t.Fatalf("profile = %+v, want the kids profile", access.Profile)
+	}
+
+	if _, err := GetUserAccess("user-1", "profile-deleted"); !errors.Is(err, ErrProfileNotFound) {
+		t.Errorf("deleted profile: err = %v, want ErrProfileNotFound", err)
+	}
+	if _, err := GetUserAccess("user-2", ""); !errors.Is(err, ErrUserDisabled) {
+		t.Errorf("disabled user: err = %v, want ErrUserDisabled", err)
+	}
+	if _, err := GetUserAccess("user-3", ""); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("missing user: err = %v, want ErrNoDocuments", err)
+	}
+}
+
+func TestContextGettersWithoutAuthentication(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+	if _, err := GetUserIdFromContext(c); !errors.Is(err, ErrUserIdNotInContext) {
+		t.Errorf("GetUserIdFromContext = %v, want ErrUserIdNotInContext", err)
+	}
+	if _, err := GetSessionIdFromContext(c); !errors.Is(err, ErrSessionIdNotInContext) {
+		t.Errorf("GetSessionIdFromContext = %v, want ErrSessionIdNotInContext", err)
+	}
+	if _, err := GetRoleFromContext(c); !errors.Is(err, ErrRoleNotInContext) {
+		t.Errorf("GetRoleFromContext = %v, want ErrRoleNotInContext", err)
+	}
+
+	// 值的类型不对与缺失一样处理
+	c.Set("userId", 42)
+	if _, err := GetUserIdFromContext(c); !errors.Is(err, ErrUserIdNotInContext) {
+		t.Errorf("GetUserIdFromContext with a non-string = %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/joey17520/magic-stream-app/models"
+)
+
+// RFC 6238 TOTP参数，与常见的身份验证器应用（Google Authenticator、1Password等）默认值一致
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// totpSkew 允许前后各偏差一个时间步长，容忍客户端时钟误差
+	totpSkew = 1
+)
+
+// recoveryCodeCount 每次生成的恢复码数量
+const recoveryCodeCount = 10
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// requireAdminTwoFactor 将在运行时通过SetRequireAdminTwoFactor设置
+var requireAdminTwoFactor bool
+
+// SetRequireAdminTwoFactor 设置管理员是否必须启用两步验证
+func SetRequireAdminTwoFactor(required bool) {
+	requireAdminTwoFactor = required
+}
+
+// EffectiveRole 返回用户实际生效的角色：要求管理员启用两步验证而尚未启用时，只能以普通用户身份访问
+func EffectiveRole(role string, twoFactorEnabled bool) string {
+	if role == models.RoleAdmin && requireAdminTwoFactor && !twoFactorEnabled {
+		return models.RoleUser
+	}
+	return role
+}
+
+// TwoFactorSetupRequired 用户是否因为管理员强制策略需要启用两步验证
+func TwoFactorSetupRequired(role string, twoFactorEnabled bool) bool {
+	return EffectiveRole(role, twoFactorEnabled) != role
+}
+
+// GenerateTOTPSecret 生成160位的随机TOTP密钥（Base32编码）
+func GenerateTOTPSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+// TOTPURI 生成身份验证器应用可以扫描的otpauth URI
+func TOTPURI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// ValidateTOTP 校验验证码，成功时返回匹配的时间步长，调用方需保证同一步长只被接受一次以防止重放
+func ValidateTOTP(secret, code string, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// totpCode 计算某个时间步长的验证码（RFC 4226 动态截断）
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// GenerateRecoveryCodes 生成一组恢复码，返回展示给用户的原始值和存入数据库的哈希值
+func GenerateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(totpEncoding.EncodeToString(buf))[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, HashRecoveryCode(raw))
+	}
+
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode 规范化（去掉分隔符、忽略大小写）后计算恢复码的哈希
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return HashOpaqueToken(normalized)
+}
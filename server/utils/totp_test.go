@@ -0,0 +1,187 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret RFC 6238附录B中SHA1测试向量的密钥"12345678901234567890"（Base32编码）
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfcSecret)
+	if err != nil {
+		t.Fatalf("decode secret: %v", err)
+	}
+
+	// RFC给出的是8位验证码，6位验证码为其后6位
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+
+	for _, tt := range tests {
+		if got := totpCode(key, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	key, _ := totpEncoding.DecodeString(rfcSecret)
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / totpPeriod
+
+	codeAt := func(step int64) string { return totpCode(key, step) }
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current step", secret: rfcSecret, code: codeAt(current), wantStep: current, wantOK: true},
+		{name: "previous step", secret: rfcSecret, code: codeAt(current - 1), wantStep: current - 1, wantOK: true},
+		{name: "next step", secret: rfcSecret, code: codeAt(current + 1), wantStep: current + 1, wantOK: true},
+		{name: "two steps behind", secret: rfcSecret, code: codeAt(current - 2)},
+		{name: "two steps ahead", secret: rfcSecret, code: codeAt(current + 2)},
+		{name: "surrounding spaces", secret: rfcSecret, code: " " + codeAt(current) + " ", wantStep: current, wantOK: true},
+		{name: "lowercase secret", secret: strings.ToLower(rfcSecret), code: codeAt(current), wantStep: current, wantOK: true},
+		{name: "wrong code", secret: rfcSecret, code: "000000"},
+		{name: "too short", secret: rfcSecret, code: codeAt(current)[:5]},
+		{name: "too long", secret: rfcSecret, code: codeAt(current) + "0"},
+		{name: "invalid secret", secret: "not base32!", code: codeAt(current)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(tt.secret, tt.code, now)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Fatalf("ValidateTOTP = (%d, %v), want (%d, %v)", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPReplay(t *testing.T) {
+	key, _ := totpEncoding.DecodeString(rfcSecret)
+	now := time.Unix(1234567890, 0)
+	current := now.Unix() / totpPeriod
+
+	// 与verifyTwoFactor相同：只接受大于上次使用步长的验证码
+	var lastUsedStep int64
+	accept := func(code string, at time.Time) bool {
+		step, ok := ValidateTOTP(rfcSecret, code, at)
+		if !ok || step <= lastUsedStep {
+			return false
+		}
+		lastUsedStep = step
+		return true
+	}
+
+	code := totpCode(key, current)
+	if !accept(code, now) {
+		t.Fatal("first use of a valid code was rejected")
+	}
+	if accept(code, now) {
+		t.Fatal("the same code was accepted twice")
+	}
+	// 下一个时间步长内，上一步的验证码仍在容差范围内，但已经用过
+	if accept(code, now.Add(totpPeriod*time.Second)) {
+		t.Fatal("a used code was accepted in the next time step")
+	}
+	// 客户端时钟偏慢时提交上一步的验证码也不能绕过
+	if accept(totpCode(key, current-1), now) {
+		t.Fatal("an older code was accepted after a newer one was used")
+	}
+	if !accept(totpCode(key, current+1), now) {
+		t.Fatal("a code from a later time step was rejected")
+	}
+}
+
+func TestTOTPSecretAndURI(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("secret %q decodes to %d bytes (%v), want 20", secret, len(key), err)
+	}
+
+	uri, err := url.Parse(TOTPURI("MagicStream", "alice@example.com", secret))
+	if err != nil {
+		t.Fatalf("parse uri: %v", err)
+	}
+	query := uri.Query()
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || query.Get("secret") != secret || query.Get("issuer") != "MagicStream" {
+		t.Fatalf("uri = %s", uri)
+	}
+	if query.Get("digits") != "6" || query.Get("period") != "30" || query.Get("algorithm") != "SHA1" {
+		t.Fatalf("uri parameters = %v", query)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes: %v", err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), recoveryCodeCount)
+	}
+
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Fatalf("code %q, want xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Fatalf("duplicate code %q", code)
+		}
+		seen[code] = true
+
+		// 用户输入时可以省略分隔符、使用大写或带空格
+		for _, input := range []string{code, strings.ReplaceAll(code, "-", ""), strings.ToUpper(code), code[:5] + " " + code[6:]} {
+			if HashRecoveryCode(input) != hashes[i] {
+				t.Fatalf("HashRecoveryCode(%q) does not match the stored hash", input)
+			}
+		}
+	}
+}
+
+func TestEffectiveRole(t *testing.T) {
+	defer SetRequireAdminTwoFactor(requireAdminTwoFactor)
+
+	tests := []struct {
+		required  bool
+		role      string
+		enabled   bool
+		want      string
+		wantSetup bool
+	}{
+		{required: false, role: "ADMIN", enabled: false, want: "ADMIN"},
+		{required: true, role: "ADMIN", enabled: true, want: "ADMIN"},
+		{required: true, role: "ADMIN", enabled: false, want: "USER", wantSetup: true},
+		{required: true, role: "USER", enabled: false, want: "USER"},
+	}
+
+	for _, tt := range tests {
+		SetRequireAdminTwoFactor(tt.required)
+		if got := EffectiveRole(tt.role, tt.enabled); got != tt.want {
+			t.Errorf("EffectiveRole(%s, %v) with policy %v = %s, want %s", tt.role, tt.enabled, tt.required, got, tt.want)
+		}
+		if got := TwoFactorSetupRequired(tt.role, tt.enabled); got != tt.wantSetup {
+			t.Errorf("TwoFactorSetupRequired(%s, %v) with policy %v = %v, want %v", tt.role, tt.enabled, tt.required, got, tt.wantSetup)
+		}
+	}
+}